@@ -13,11 +13,14 @@ import (
 	dbcfg "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/db"
 	config "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/server"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcserver"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/handler"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/server"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
 	"go.uber.org/fx"
 )
 
@@ -38,8 +41,11 @@ func main() {
 		config.Module,
 		dbcfg.Module,
 		db.Module,
+		stream.Module,
 		service.Module,
+		idempotency.Module,
 		handler.Module,
+		grpcserver.Module,
 		server.Module,
 		compression.Module,
 		sign.Module,
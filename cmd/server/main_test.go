@@ -18,12 +18,15 @@ import (
 	dbcfg "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/db"
 	config "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/server"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcserver"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/handler"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/server"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
 	"go.uber.org/fx"
 )
 
@@ -34,8 +37,11 @@ func TestMain_WiringIsValid(t *testing.T) {
 		config.Module,
 		dbcfg.Module,
 		db.Module,
+		stream.Module,
 		service.Module,
+		idempotency.Module,
 		handler.Module,
+		grpcserver.Module,
 		server.Module,
 		compression.Module,
 		sign.Module,
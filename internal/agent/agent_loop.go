@@ -118,8 +118,24 @@ func sendMetrics(ctx context.Context, senders []sender.SenderInterface, metrics
 			}
 		}
 	} else {
+		for _, s := range senders {
+			ss, ok := s.(sender.StreamingSender)
+			if !ok {
+				continue
+			}
+			select {
+			case tasks <- func() { ss.SendStream(ctx, metrics) }:
+			case <-ctx.Done():
+				close(tasks)
+				wg.Wait()
+				return
+			}
+		}
 		for _, m := range metrics {
 			for _, s := range senders {
+				if _, ok := s.(sender.StreamingSender); ok {
+					continue
+				}
 				metric := m
 				sdr := s
 				send := func(ms []*models.Metrics) {
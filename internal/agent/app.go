@@ -2,14 +2,21 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
 	"time"
 
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/collector"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sender"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
 	"go.uber.org/fx"
 )
 
@@ -24,6 +31,10 @@ type AppConfig struct {
 	SignKey        sign.SignKey
 	RateLimit      int
 	CryptoKeyPath  string
+	Instance       string
+	GRPCAddress    string
+	Stream         bool
+	Format         string
 }
 
 const (
@@ -41,6 +52,14 @@ const (
 	DefaultRateLimit = 1
 	// DefaultCryptoKeyPath is the default path to the encryption key file.
 	DefaultCryptoKeyPath = ""
+	// DefaultInstance leaves metrics in the shared namespace (no instance identifier is sent).
+	DefaultInstance = ""
+	// DefaultGRPCAddress keeps the agent on the HTTP transport.
+	DefaultGRPCAddress = ""
+	// DefaultStream keeps the agent sending JSON metrics one by one.
+	DefaultStream = false
+	// DefaultFormat keeps the agent sending request bodies as JSON.
+	DefaultFormat = codec.MediaTypeJSON
 )
 
 // RunAgent launches the agent loop when the fx application starts.
@@ -91,21 +110,77 @@ var ModuleCollector = fx.Module("collector",
 	),
 )
 
-// ProvideSender constructs both plain-text and JSON senders for the agent.
+// ProvideSender constructs the senders for the agent: a gRPC sender when a gRPC address is configured,
+// otherwise both plain-text and JSON HTTP senders. With Stream the JSON sender submits every report
+// as one NDJSON stream. Format selects the body format of the JSON sender; an unknown format is an error.
 func ProvideSender(cfg AppConfig, l logger.Logger, c compression.Compressor, enc cryptoutil.Encryptor) ([]sender.SenderInterface, error) {
+	if cfg.GRPCAddress != "" {
+		gs, err := sender.NewGRPCSender(cfg.GRPCAddress, l, cfg.SignKey, enc)
+		if err != nil {
+			return nil, err
+		}
+		gs.SetInstance(cfg.Instance)
+		gs.SetRealIP(localIP(cfg.GRPCAddress, l))
+		return []sender.SenderInterface{gs}, nil
+	}
+	ip := localIP(net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), l)
 	senders := make([]sender.SenderInterface, 0, 2)
-	senders = append(senders,
-		sender.NewPlainSender(cfg.Host, cfg.Port, nil, l, cfg.SignKey),
-		sender.NewJSONSender(cfg.Host, cfg.Port, nil, l, c, cfg.SignKey, enc),
-	)
+	plain := sender.NewPlainSender(cfg.Host, cfg.Port, nil, l, cfg.SignKey)
+	plain.SetInstance(cfg.Instance)
+	plain.SetRealIP(ip)
+	js := sender.NewJSONSender(cfg.Host, cfg.Port, nil, l, c, cfg.SignKey, enc)
+	js.SetInstance(cfg.Instance)
+	js.SetRealIP(ip)
+	if cfg.Format != "" {
+		cd, ok := codec.ForContentType(cfg.Format)
+		if !ok {
+			return nil, fmt.Errorf("unsupported body format %q", cfg.Format)
+		}
+		js.SetCodec(cd)
+	}
+	if cfg.Stream {
+		senders = append(senders, plain, &sender.NDJSONSender{JSONSender: js})
+		return senders, nil
+	}
+	senders = append(senders, plain, js)
 	return senders, nil
 }
 
+// localIP returns the agent address used to reach the server, or "" when it cannot be determined.
+func localIP(addr string, l logger.Logger) string {
+	ip, err := subnet.LocalIP(addr)
+	if err != nil {
+		if l != nil {
+			l.WriteError("detect agent ip failed", "addr", addr, "error", err)
+		}
+		return ""
+	}
+	return ip.String()
+}
+
+// CloseSenders releases sender connections once the agent has flushed its last metrics.
+func CloseSenders(lc fx.Lifecycle, senders []sender.SenderInterface) {
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			var errs []error
+			for _, s := range senders {
+				if c, ok := s.(io.Closer); ok {
+					errs = append(errs, c.Close())
+				}
+			}
+			return errors.Join(errs...)
+		},
+	})
+}
+
 // ModuleSender provides the sender dependencies via fx.
 var ModuleSender = fx.Module("sender",
 	fx.Provide(
 		ProvideSender,
 	),
+	fx.Invoke(
+		CloseSenders,
+	),
 )
 
 // ProvideAgentLoopConfig derives the loop configuration from the agent config.
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sender"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 	"github.com/stretchr/testify/assert"
@@ -66,6 +67,74 @@ func TestProvideSender_ReturnsPlainAndJSON(t *testing.T) {
 	}
 }
 
+func TestProvideSender_StreamSelectsNDJSON(t *testing.T) {
+	cfg := AppConfig{Host: "localhost", Port: 8080, Stream: true}
+	senders, err := ProvideSender(cfg, &test.FakeLogger{}, test.NewFakeCompressor("gzip"), nil)
+	if err != nil {
+		t.Fatalf("ProvideSender returned error: %v", err)
+	}
+	if len(senders) != 2 {
+		t.Fatalf("expected 2 senders, got %d", len(senders))
+	}
+	if gotType := reflect.TypeOf(senders[1]).String(); gotType != "*sender.NDJSONSender" {
+		t.Errorf("expected second sender to be *sender.NDJSONSender, got %s", gotType)
+	}
+}
+
+func TestProvideSender_Format(t *testing.T) {
+	cfg := AppConfig{Host: "localhost", Port: 8080, Format: "application/msgpack"}
+	if _, err := ProvideSender(cfg, &test.FakeLogger{}, test.NewFakeCompressor("gzip"), nil); err != nil {
+		t.Fatalf("ProvideSender returned error: %v", err)
+	}
+
+	cfg.Format = "text/plain"
+	if _, err := ProvideSender(cfg, &test.FakeLogger{}, test.NewFakeCompressor("gzip"), nil); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestSendMetrics_StreamingSenderGetsWholeReport(t *testing.T) {
+	stream := &test.FakeStreamSender{}
+	single := &test.FakeAgentSender{}
+	g := 1.0
+	metrics := []*models.Metrics{
+		{ID: "a", MType: models.GaugeType, Value: &g},
+		{ID: "b", MType: models.GaugeType, Value: &g},
+		{ID: "c", MType: models.GaugeType, Value: &g},
+	}
+
+	sendMetrics(context.Background(), []sender.SenderInterface{stream, single}, metrics, 2)
+
+	if len(stream.Streams) != 1 || len(stream.Streams[0]) != len(metrics) {
+		t.Fatalf("streaming sender got %d reports, want one with every metric", len(stream.Streams))
+	}
+	if stream.Sends != 0 {
+		t.Fatalf("streaming sender must not be sent metrics one by one, got %d", stream.Sends)
+	}
+	if single.Sends != int32(len(metrics)) {
+		t.Fatalf("sender got %d calls, want %d", single.Sends, len(metrics))
+	}
+}
+
+func TestProvideSender_GRPCAddressSelectsGRPC(t *testing.T) {
+	cfg := AppConfig{Host: "localhost", Port: 8080, GRPCAddress: "localhost:3200"}
+	senders, err := ProvideSender(cfg, &test.FakeLogger{}, test.NewFakeCompressor("gzip"), nil)
+	if err != nil {
+		t.Fatalf("ProvideSender returned error: %v", err)
+	}
+	if len(senders) != 1 {
+		t.Fatalf("expected 1 sender, got %d", len(senders))
+	}
+	if gotType := reflect.TypeOf(senders[0]).String(); gotType != "*sender.GRPCSender" {
+		t.Errorf("expected *sender.GRPCSender, got %s", gotType)
+	}
+	lc := &fakeLifecycle{}
+	CloseSenders(lc, senders)
+	if err := lc.hooks[0].OnStop(context.Background()); err != nil {
+		t.Errorf("close senders: %v", err)
+	}
+}
+
 func TestProvideAgentLoopConfig_CopiesFields(t *testing.T) {
 	want := AppConfig{
 		PollInterval:   2 * time.Second,
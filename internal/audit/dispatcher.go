@@ -11,8 +11,19 @@ type Event struct {
 	Timestamp int64    `json:"ts"`
 	Metrics   []string `json:"metrics"`
 	IPAddress string   `json:"ip_address"`
+	// Action is empty for updates and names the operation otherwise, e.g. ActionDelete.
+	Action string `json:"action,omitempty"`
 }
 
+const (
+	// ActionDelete marks events for metrics removed from the storage.
+	ActionDelete = "delete"
+	// ActionReset marks events for counters reset to zero.
+	ActionReset = "reset"
+	// ActionExpire marks events for series evicted by the server after their TTL.
+	ActionExpire = "expire"
+)
+
 // Dispatcher delivers audit events to all registered observers.
 type Dispatcher struct {
 	mu        sync.RWMutex
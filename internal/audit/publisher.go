@@ -62,7 +62,10 @@ func NewPublisher(p PublisherParams) (Publisher, error) {
 	return NewDispatcher(observers...), nil
 }
 
-const contextMetricsKey = "audit.metrics"
+const (
+	contextMetricsKey = "audit.metrics"
+	contextActionKey  = "audit.action"
+)
 
 var metricsPool = sync.Pool{
 	New: func() any { return make([]string, 0, 4) },
@@ -90,6 +93,14 @@ func AddRequestMetrics(c *gin.Context, metrics ...string) {
 	c.Set(contextMetricsKey, collected)
 }
 
+// SetRequestAction records the operation performed by the current Gin request; updates need not set it.
+func SetRequestAction(c *gin.Context, action string) {
+	if c == nil {
+		return
+	}
+	c.Set(contextActionKey, action)
+}
+
 func takeRequestMetrics(c *gin.Context) []string {
 	if c == nil {
 		return nil
@@ -143,6 +154,7 @@ func Middleware(pub Publisher, l logger.Logger, clock Clock) gin.HandlerFunc {
 			Timestamp: clock.Now().Unix(),
 			Metrics:   metrics,
 			IPAddress: ip,
+			Action:    c.GetString(contextActionKey),
 		}
 		if err := pub.Publish(eventCtx, event); err != nil && l != nil {
 			l.WriteError("audit publish failed", "error", err)
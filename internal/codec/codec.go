@@ -0,0 +1,89 @@
+// Package codec encodes and decodes the metric bodies of the HTTP API in the supported formats:
+// JSON, Protocol Buffers and MessagePack.
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// Media types of the supported formats.
+const (
+	MediaTypeJSON     = "application/json"
+	MediaTypeProtobuf = "application/x-protobuf"
+	MediaTypeMsgPack  = "application/msgpack"
+)
+
+// ErrUnsupportedValue indicates a value that is neither a metric nor a list of metrics.
+var ErrUnsupportedValue = errors.New("unsupported value")
+
+// Codec is a body format. Decode accepts *models.Metrics, *[]models.Metrics and the *models.ListOptions
+// of a bulk read; Marshal accepts models.Metrics, *models.Metrics, []models.Metrics and []*models.Metrics.
+type Codec interface {
+	// ContentType is the media type of the format in Content-Type and Accept headers.
+	ContentType() string
+	Decode(r io.Reader, v any) error
+	Marshal(v any) ([]byte, error)
+}
+
+var (
+	// JSON is the default format of the API.
+	JSON Codec = jsonCodec{}
+	// Protobuf encodes a metric as metricspb.Metric and a list of metrics as metricspb.MetricList.
+	Protobuf Codec = protobufCodec{}
+	// MsgPack encodes metrics with the field names of their JSON form.
+	MsgPack Codec = msgpackCodec{}
+)
+
+var codecs = []Codec{JSON, Protobuf, MsgPack}
+
+// ContentTypes returns the media types of all codecs, JSON first.
+func ContentTypes() []string {
+	types := make([]string, len(codecs))
+	for i, c := range codecs {
+		types[i] = c.ContentType()
+	}
+	return types
+}
+
+// ForContentType returns the codec selected by a Content-Type header value; parameters are ignored.
+func ForContentType(contentType string) (Codec, bool) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	for _, c := range codecs {
+		if strings.EqualFold(mt, c.ContentType()) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func unsupported(v any) error {
+	return fmt.Errorf("%w: %T", ErrUnsupportedValue, v)
+}
+
+// metricsOf returns the metrics held by a value accepted by Marshal.
+func metricsOf(v any) (single *models.Metrics, list []models.Metrics, err error) {
+	switch t := v.(type) {
+	case models.Metrics:
+		return &t, nil, nil
+	case *models.Metrics:
+		return t, nil, nil
+	case []models.Metrics:
+		return nil, t, nil
+	case []*models.Metrics:
+		list := make([]models.Metrics, len(t))
+		for i, m := range t {
+			list[i] = *m
+		}
+		return nil, list, nil
+	}
+	return nil, nil, unsupported(v)
+}
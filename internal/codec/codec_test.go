@@ -0,0 +1,159 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func sampleMetrics() []models.Metrics {
+	value, delta := 1.5, int64(7)
+	h := models.NewHistogram([]float64{1, 10})
+	h.Observe(3)
+	return []models.Metrics{
+		{ID: "Alloc", MType: models.GaugeType, Value: &value, Labels: models.Labels{models.InstanceLabel: "host-1"}},
+		{ID: "PollCount", MType: models.CounterType, Delta: &delta},
+		{ID: "latency", MType: models.HistogramType, Histogram: h},
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	for _, c := range codecs {
+		metrics := sampleMetrics()
+
+		body, err := c.Marshal(metrics)
+		if err != nil {
+			t.Fatalf("%s: marshal list: %v", c.ContentType(), err)
+		}
+		var list []models.Metrics
+		if err := c.Decode(bytes.NewReader(body), &list); err != nil {
+			t.Fatalf("%s: decode list: %v", c.ContentType(), err)
+		}
+		if !reflect.DeepEqual(list, metrics) {
+			t.Fatalf("%s: list = %+v, want %+v", c.ContentType(), list, metrics)
+		}
+
+		body, err = c.Marshal(&metrics[0])
+		if err != nil {
+			t.Fatalf("%s: marshal metric: %v", c.ContentType(), err)
+		}
+		var m models.Metrics
+		if err := c.Decode(bytes.NewReader(body), &m); err != nil {
+			t.Fatalf("%s: decode metric: %v", c.ContentType(), err)
+		}
+		if !reflect.DeepEqual(m, metrics[0]) {
+			t.Fatalf("%s: metric = %+v, want %+v", c.ContentType(), m, metrics[0])
+		}
+	}
+}
+
+func TestCodecs_MarshalPointerList(t *testing.T) {
+	metrics := sampleMetrics()
+	ptrs := []*models.Metrics{&metrics[0], &metrics[1]}
+	for _, c := range codecs {
+		want, err := c.Marshal(metrics[:2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Marshal(ptrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: pointer list encodes differently", c.ContentType())
+		}
+	}
+}
+
+func TestCodecs_DecodeOverwrites(t *testing.T) {
+	for _, c := range codecs {
+		metrics := sampleMetrics()
+		body, err := c.Marshal(metrics[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		shared := 42.0
+		m := models.Metrics{ID: "old", MType: models.GaugeType, Value: &shared, Delta: new(int64)}
+		if err := c.Decode(bytes.NewReader(body), &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Value != nil || *m.Delta != 7 || shared != 42 {
+			t.Fatalf("%s: decoded %+v, shared value %v", c.ContentType(), m, shared)
+		}
+	}
+}
+
+func TestCodecs_DecodeListOptions(t *testing.T) {
+	want := models.ListOptions{
+		Type: models.GaugeType, IDs: []string{"Alloc", "HeapAlloc"}, Prefix: "A", Regex: "^A",
+		Instance: "host-1", Cursor: "abc", Limit: 10,
+	}
+	jsonBody, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mp bytes.Buffer
+	enc := msgpack.NewEncoder(&mp)
+	enc.SetCustomStructTag(structTag)
+	if err := enc.Encode(want); err != nil {
+		t.Fatal(err)
+	}
+	pb, err := proto.Marshal(&metricspb.ListQuery{
+		Type: "gauge", Ids: []string{"Alloc", "HeapAlloc"}, Prefix: "A", Regex: "^A",
+		Instance: "host-1", Cursor: "abc", Limit: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for c, body := range map[Codec][]byte{JSON: jsonBody, MsgPack: mp.Bytes(), Protobuf: pb} {
+		got := models.ListOptions{Prefix: "stale", Limit: 1}
+		if err := c.Decode(bytes.NewReader(body), &got); err != nil {
+			t.Fatalf("%s: %v", c.ContentType(), err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: options = %+v, want %+v", c.ContentType(), got, want)
+		}
+	}
+}
+
+func TestCodecs_UnsupportedValue(t *testing.T) {
+	for _, c := range []Codec{Protobuf, MsgPack} {
+		if _, err := c.Marshal("x"); !errors.Is(err, ErrUnsupportedValue) {
+			t.Fatalf("%s: marshal err = %v", c.ContentType(), err)
+		}
+		var s string
+		if err := c.Decode(bytes.NewReader(nil), &s); !errors.Is(err, ErrUnsupportedValue) {
+			t.Fatalf("%s: decode err = %v", c.ContentType(), err)
+		}
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Codec
+	}{
+		{"application/json", JSON},
+		{"application/json; charset=utf-8", JSON},
+		{"Application/X-Protobuf", Protobuf},
+		{"application/msgpack", MsgPack},
+		{"text/plain", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, ok := ForContentType(tt.header)
+		if ok != (tt.want != nil) || got != tt.want {
+			t.Fatalf("ForContentType(%q) = %v, %v", tt.header, got, ok)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package codec
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return MediaTypeJSON }
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
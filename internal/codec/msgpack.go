@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// structTag makes MessagePack bodies use the keys and omitempty rules of the JSON bodies.
+const structTag = "json"
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return MediaTypeMsgPack }
+
+// Decode overwrites the destination like the JSON decoding of Metrics does: the decoder would otherwise
+// keep the fields missing from the body and write through the pointers of reused values.
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag(structTag)
+	switch t := v.(type) {
+	case *models.Metrics:
+		var m models.Metrics
+		if err := dec.Decode(&m); err != nil {
+			return err
+		}
+		*t = m
+		return nil
+	case *[]models.Metrics:
+		clear((*t)[:cap(*t)])
+		*t = (*t)[:0]
+		return dec.Decode(t)
+	case *models.ListOptions:
+		var o models.ListOptions
+		if err := dec.Decode(&o); err != nil {
+			return err
+		}
+		*t = o
+		return nil
+	}
+	return unsupported(v)
+}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	if _, _, err := metricsOf(v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag(structTag)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
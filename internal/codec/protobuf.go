@@ -0,0 +1,73 @@
+package codec
+
+import (
+	"io"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return MediaTypeProtobuf }
+
+func (protobufCodec) Decode(r io.Reader, v any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case *models.Metrics:
+		var p metricspb.Metric
+		if err := proto.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		*t = grpcapi.FromProto(&p)
+		return nil
+	case *[]models.Metrics:
+		var p metricspb.MetricList
+		if err := proto.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		list := (*t)[:0]
+		for _, m := range p.GetMetrics() {
+			list = append(list, grpcapi.FromProto(m))
+		}
+		*t = list
+		return nil
+	case *models.ListOptions:
+		var p metricspb.ListQuery
+		if err := proto.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		*t = models.ListOptions{
+			Type:     models.MetricType(p.GetType()),
+			IDs:      p.GetIds(),
+			Prefix:   p.GetPrefix(),
+			Regex:    p.GetRegex(),
+			Instance: p.GetInstance(),
+			Cursor:   p.GetCursor(),
+			Limit:    int(p.GetLimit()),
+		}
+		return nil
+	}
+	return unsupported(v)
+}
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	single, list, err := metricsOf(v)
+	if err != nil {
+		return nil, err
+	}
+	if single != nil {
+		return proto.Marshal(grpcapi.ToProto(single))
+	}
+	p := &metricspb.MetricList{Metrics: make([]*metricspb.Metric, len(list))}
+	for i := range list {
+		p.Metrics[i] = grpcapi.ToProto(&list[i])
+	}
+	return proto.Marshal(p)
+}
@@ -15,19 +15,38 @@ type CollectorInterface interface {
 	SetGauge(name string, value float64)
 }
 
+// GCPauseMetric is the name of the histogram of GC stop-the-world pauses, in seconds.
+const GCPauseMetric = "GCPause"
+
+// DefaultGCPauseBuckets are the bucket bounds, in seconds, of the GC pause histogram.
+var DefaultGCPauseBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1}
+
 // Collector gathers runtime metrics and stores them in-memory.
 type Collector struct {
 	mu      sync.RWMutex
 	metrics map[string]*models.Metrics
+
+	gcBuckets []float64
+	lastNumGC uint32
 }
 
 // NewCollector constructs a Collector ready to gather runtime metrics.
 func NewCollector() *Collector {
 	return &Collector{
-		metrics: make(map[string]*models.Metrics),
+		metrics:   make(map[string]*models.Metrics),
+		gcBuckets: DefaultGCPauseBuckets,
 	}
 }
 
+// SetGCPauseBuckets replaces the bucket bounds of the GC pause histogram.
+// Pauses observed with the previous bounds are discarded.
+func (c *Collector) SetGCPauseBuckets(bounds []float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gcBuckets = append([]float64(nil), bounds...)
+	delete(c.metrics, GCPauseMetric)
+}
+
 // MetricGetter extracts a metric value from runtime.MemStats.
 type MetricGetter[T any] func(*runtime.MemStats) T
 
@@ -108,16 +127,43 @@ func (c *Collector) Collect() {
 			c.metrics[name] = m
 		}
 	}
+
+	c.collectGCPauses(&rtm)
+}
+
+// collectGCPauses observes every GC pause completed since the previous call.
+// MemStats keeps only the latest len(PauseNs) pauses, older ones are lost when polling is too slow.
+func (c *Collector) collectGCPauses(rtm *runtime.MemStats) {
+	m, ok := c.metrics[GCPauseMetric]
+	if !ok || m.Histogram == nil {
+		m, _ = models.NewHistogramMetrics(GCPauseMetric, models.NewHistogram(c.gcBuckets))
+		c.metrics[GCPauseMetric] = m
+	}
+
+	n := rtm.NumGC - c.lastNumGC
+	if n > uint32(len(rtm.PauseNs)) {
+		n = uint32(len(rtm.PauseNs))
+	}
+	for i := uint32(0); i < n; i++ {
+		idx := (rtm.NumGC - i + uint32(len(rtm.PauseNs)) - 1) % uint32(len(rtm.PauseNs))
+		m.Histogram.Observe(float64(rtm.PauseNs[idx]) / 1e9)
+	}
+	c.lastNumGC = rtm.NumGC
 }
 
 // Snapshot returns deep copies of all collected metrics.
+// Histograms are reported as deltas: their observations are cleared once included in a snapshot,
+// so the server can merge them like counters.
 func (c *Collector) Snapshot() []*models.Metrics {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	out := make([]*models.Metrics, 0, len(c.metrics))
 	for _, m := range c.metrics {
 		out = append(out, cloneMetrics(m))
+		if m.Histogram != nil {
+			m.Histogram = models.NewHistogram(m.Histogram.Bounds)
+		}
 	}
 	return out
 }
@@ -152,12 +198,19 @@ func cloneMetrics(m *models.Metrics) *models.Metrics {
 		d := *m.Delta
 		dp = &d
 	}
+	var hp *models.Histogram
+	if m.Histogram != nil {
+		h := m.Histogram.Clone()
+		hp = &h
+	}
 	return &models.Metrics{
-		ID:    m.ID,
-		MType: m.MType,
-		Delta: dp,
-		Value: vp,
-		Hash:  m.Hash,
+		ID:        m.ID,
+		MType:     m.MType,
+		Delta:     dp,
+		Value:     vp,
+		Hash:      m.Hash,
+		Labels:    m.Labels.Clone(),
+		Histogram: hp,
 	}
 }
 
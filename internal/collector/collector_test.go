@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"runtime"
 	"testing"
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
@@ -22,7 +23,7 @@ func TestCollector_Collect_PopulatesAllMetrics(t *testing.T) {
 
 	snap := c.Snapshot()
 
-	wantCount := len(gaugeGetters) + 1 + len(counterGetters)
+	wantCount := len(gaugeGetters) + 1 + len(counterGetters) + 1 // RandomValue and GCPause
 	if len(snap) != wantCount {
 		t.Fatalf("snapshot size = %d, want %d", len(snap), wantCount)
 	}
@@ -150,7 +151,7 @@ func TestCollector_Snapshot_ContainsAllAfterMultipleCollects(t *testing.T) {
 
 	snap := c.Snapshot()
 
-	wantCount := len(gaugeGetters) + 1 + len(counterGetters)
+	wantCount := len(gaugeGetters) + 1 + len(counterGetters) + 1 // RandomValue and GCPause
 	if len(snap) != wantCount {
 		t.Fatalf("snapshot size = %d, want %d", len(snap), wantCount)
 	}
@@ -184,3 +185,34 @@ func TestCollector_SetGauge(t *testing.T) {
 		t.Fatalf("SetGauge update failed: %+v", m)
 	}
 }
+
+func TestCollector_GCPauseHistogram(t *testing.T) {
+	c := NewCollector()
+	c.SetGCPauseBuckets([]float64{0.001, 1})
+	c.Collect()
+	c.Snapshot()
+
+	runtime.GC()
+	runtime.GC()
+	c.Collect()
+
+	snap := c.Snapshot()
+	m, ok := findMetric(snap, GCPauseMetric)
+	if !ok || m.MType != models.HistogramType || m.Histogram == nil {
+		t.Fatalf("GC pause histogram missing: %+v", m)
+	}
+	if m.Histogram.Count < 2 {
+		t.Fatalf("expected at least 2 pauses, got %d", m.Histogram.Count)
+	}
+	if err := m.Histogram.Validate(); err != nil {
+		t.Fatalf("invalid histogram: %v", err)
+	}
+	if len(m.Histogram.Bounds) != 2 {
+		t.Fatalf("custom buckets not applied: %v", m.Histogram.Bounds)
+	}
+
+	m, _ = findMetric(c.Snapshot(), GCPauseMetric)
+	if m.Histogram.Count != 0 {
+		t.Fatalf("histogram must be reset after snapshot, got %d", m.Histogram.Count)
+	}
+}
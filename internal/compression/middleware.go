@@ -19,7 +19,7 @@ func WithAllowedContentTypes(ct ...string) Option {
 	return func(s *settings) { s.allowedCT = append([]string(nil), ct...) }
 }
 
-var defaultCT = []string{"application/json", "text/html"}
+var defaultCT = []string{"application/json", "application/x-ndjson", "application/x-protobuf", "application/msgpack", "text/html"}
 
 // Middleware provides transparent request decompression and response compression for Gin.
 func Middleware(cpr Compressor, opts ...Option) gin.HandlerFunc {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/agent"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
 	commoncfg "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/common"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
 	"go.uber.org/fx"
@@ -21,6 +22,10 @@ func buildAgentConfig() (agent.AppConfig, error) {
 		LoopIterations: agent.DefaultLoopIterations,
 		RateLimit:      agent.DefaultRateLimit,
 		CryptoKeyPath:  agent.DefaultCryptoKeyPath,
+		Instance:       agent.DefaultInstance,
+		GRPCAddress:    agent.DefaultGRPCAddress,
+		Stream:         agent.DefaultStream,
+		Format:         agent.DefaultFormat,
 	}
 	cfg := defaultAppConfig
 
@@ -78,6 +83,25 @@ func buildAgentConfig() (agent.AppConfig, error) {
 		cfg.CryptoKeyPath = *fileCfg.CryptoKey
 	}
 
+	if fileCfg.Instance != nil {
+		cfg.Instance = *fileCfg.Instance
+	}
+
+	if fileCfg.GRPCAddress != nil {
+		cfg.GRPCAddress = *fileCfg.GRPCAddress
+	}
+
+	if fileCfg.Stream != nil {
+		cfg.Stream = *fileCfg.Stream
+	}
+
+	if fileCfg.Format != nil {
+		if _, ok := codec.ForContentType(*fileCfg.Format); !ok {
+			return cfg, fmt.Errorf("config format: unsupported %q", *fileCfg.Format)
+		}
+		cfg.Format = *fileCfg.Format
+	}
+
 	if envVars.Host != "" {
 		cfg.Host = envVars.Host
 	} else if flagArgs.addressFlag.Host != "" {
@@ -119,6 +143,30 @@ func buildAgentConfig() (agent.AppConfig, error) {
 	} else if flagArgs.CryptoKey != "" {
 		cfg.CryptoKeyPath = flagArgs.CryptoKey
 	}
+
+	if envVars.Instance != nil {
+		cfg.Instance = *envVars.Instance
+	} else if flagArgs.Instance != "" {
+		cfg.Instance = flagArgs.Instance
+	}
+
+	if envVars.GRPCAddress != nil {
+		cfg.GRPCAddress = *envVars.GRPCAddress
+	} else if flagArgs.GRPCAddress != "" {
+		cfg.GRPCAddress = flagArgs.GRPCAddress
+	}
+
+	if envVars.Stream != nil {
+		cfg.Stream = *envVars.Stream
+	} else if flagArgs.Stream != nil {
+		cfg.Stream = *flagArgs.Stream
+	}
+
+	if envVars.Format != nil {
+		cfg.Format = *envVars.Format
+	} else if flagArgs.Format != "" {
+		cfg.Format = flagArgs.Format
+	}
 	return cfg, nil
 }
 
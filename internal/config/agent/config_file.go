@@ -13,6 +13,10 @@ type agentFileConfig struct {
 	Key            *string `json:"key"`
 	RateLimit      *int    `json:"rate_limit"`
 	CryptoKey      *string `json:"crypto_key"`
+	Instance       *string `json:"instance"`
+	GRPCAddress    *string `json:"grpc_address"`
+	Stream         *bool   `json:"stream"`
+	Format         *string `json:"format"`
 }
 
 func parseDuration(raw string) (time.Duration, error) {
@@ -299,3 +299,154 @@ func TestBuildAgentConfig_KeyPriority(t *testing.T) {
 		})
 	})
 }
+
+func TestBuildAgentConfig_InstancePriority(t *testing.T) {
+	cfgFile := t.TempDir() + "/config.json"
+	if err := os.WriteFile(cfgFile, []byte(`{"instance": "file-host"}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+
+	withEnvMap(map[string]string{EnvInstanceVarName: "", "CONFIG": cfgFile}, func() {
+		withArgs(nil, func() {
+			got, _ := buildAgentConfig()
+			if got.Instance != "file-host" {
+				t.Fatalf("want instance from file, got %q", got.Instance)
+			}
+		})
+		withArgs([]string{"-instance", "flag-host"}, func() {
+			got, _ := buildAgentConfig()
+			if got.Instance != "flag-host" {
+				t.Fatalf("flag must override file, got %q", got.Instance)
+			}
+		})
+	})
+	withEnvMap(map[string]string{EnvInstanceVarName: "env-host", "CONFIG": ""}, func() {
+		withArgs([]string{"-instance", "flag-host"}, func() {
+			got, _ := buildAgentConfig()
+			if got.Instance != "env-host" {
+				t.Fatalf("env must win, got %q", got.Instance)
+			}
+		})
+	})
+}
+
+func TestBuildAgentConfig_GRPCAddressPriority(t *testing.T) {
+	cfgFile := t.TempDir() + "/config.json"
+	if err := os.WriteFile(cfgFile, []byte(`{"grpc_address": "file:3200"}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+
+	withEnvMap(map[string]string{EnvGRPCAddressVarName: "", "CONFIG": cfgFile}, func() {
+		withArgs(nil, func() {
+			got, _ := buildAgentConfig()
+			if got.GRPCAddress != "file:3200" {
+				t.Fatalf("want grpc address from file, got %q", got.GRPCAddress)
+			}
+		})
+		withArgs([]string{"-grpc-address", "flag:3200"}, func() {
+			got, _ := buildAgentConfig()
+			if got.GRPCAddress != "flag:3200" {
+				t.Fatalf("flag must override file, got %q", got.GRPCAddress)
+			}
+		})
+	})
+	withEnvMap(map[string]string{EnvGRPCAddressVarName: "env:3200", "CONFIG": ""}, func() {
+		withArgs([]string{"-grpc-address", "flag:3200"}, func() {
+			got, _ := buildAgentConfig()
+			if got.GRPCAddress != "env:3200" {
+				t.Fatalf("env must win, got %q", got.GRPCAddress)
+			}
+		})
+	})
+}
+
+func TestBuildAgentConfig_StreamPriority(t *testing.T) {
+	cfgFile := t.TempDir() + "/config.json"
+	if err := os.WriteFile(cfgFile, []byte(`{"stream": true}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+
+	withEnvMap(map[string]string{EnvStreamVarName: "", "CONFIG": cfgFile}, func() {
+		withArgs(nil, func() {
+			got, _ := buildAgentConfig()
+			if !got.Stream {
+				t.Fatalf("want stream from file")
+			}
+		})
+		withArgs([]string{"-stream", "false"}, func() {
+			got, _ := buildAgentConfig()
+			if got.Stream {
+				t.Fatalf("flag must override file")
+			}
+		})
+	})
+	withEnvMap(map[string]string{EnvStreamVarName: "true", "CONFIG": ""}, func() {
+		withArgs([]string{"-stream", "false"}, func() {
+			got, _ := buildAgentConfig()
+			if !got.Stream {
+				t.Fatalf("env must win")
+			}
+		})
+	})
+}
+
+func TestBuildAgentConfig_FormatPriority(t *testing.T) {
+	cfgFile := t.TempDir() + "/config.json"
+	if err := os.WriteFile(cfgFile, []byte(`{"format": "application/msgpack"}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+
+	withEnvMap(map[string]string{EnvFormatVarName: "", "CONFIG": ""}, func() {
+		withArgs(nil, func() {
+			got, _ := buildAgentConfig()
+			if got.Format != agent.DefaultFormat {
+				t.Fatalf("want default format, got %q", got.Format)
+			}
+		})
+	})
+	withEnvMap(map[string]string{EnvFormatVarName: "", "CONFIG": cfgFile}, func() {
+		withArgs(nil, func() {
+			got, _ := buildAgentConfig()
+			if got.Format != "application/msgpack" {
+				t.Fatalf("want format from file, got %q", got.Format)
+			}
+		})
+		withArgs([]string{"-format", "application/x-protobuf"}, func() {
+			got, _ := buildAgentConfig()
+			if got.Format != "application/x-protobuf" {
+				t.Fatalf("flag must override file, got %q", got.Format)
+			}
+		})
+	})
+	withEnvMap(map[string]string{EnvFormatVarName: "application/json", "CONFIG": cfgFile}, func() {
+		withArgs([]string{"-format", "application/x-protobuf"}, func() {
+			got, _ := buildAgentConfig()
+			if got.Format != "application/json" {
+				t.Fatalf("env must win, got %q", got.Format)
+			}
+		})
+	})
+}
+
+func TestBuildAgentConfig_UnknownFormat(t *testing.T) {
+	withEnvMap(map[string]string{EnvFormatVarName: "text/plain", "CONFIG": ""}, func() {
+		withArgs([]string{"-format", "text/xml"}, func() {
+			got, _ := buildAgentConfig()
+			if got.Format != agent.DefaultFormat {
+				t.Fatalf("unknown env and flag formats must be ignored, got %q", got.Format)
+			}
+		})
+	})
+
+	cfgFile := t.TempDir() + "/config.json"
+	if err := os.WriteFile(cfgFile, []byte(`{"format": "text/plain"}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+	withEnvMap(map[string]string{EnvFormatVarName: "", "CONFIG": cfgFile}, func() {
+		withArgs(nil, func() {
+			if _, err := buildAgentConfig(); err == nil {
+				t.Fatalf("expected error for unknown format in config file")
+			}
+		})
+	})
+}
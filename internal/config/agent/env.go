@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
 	commoncfg "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/common"
 )
 
@@ -14,6 +15,10 @@ const (
 	EnvKeyVarName            = "KEY"
 	EnvRateLimitVarName      = "RATE_LIMIT"
 	EnvCryptoKeyPathVarName  = "CRYPTO_KEY"
+	EnvInstanceVarName       = "INSTANCE"
+	EnvGRPCAddressVarName    = "GRPC_ADDRESS"
+	EnvStreamVarName         = "STREAM"
+	EnvFormatVarName         = "FORMAT"
 )
 
 type AgentEnvVars struct {
@@ -24,6 +29,10 @@ type AgentEnvVars struct {
 	SignKey           *string
 	RateLimit         *int
 	CryptoKeyPath     *string
+	Instance          *string
+	GRPCAddress       *string
+	Stream            *bool
+	Format            *string
 }
 
 func getEnvVars() (AgentEnvVars, error) {
@@ -50,6 +59,22 @@ func getEnvVars() (AgentEnvVars, error) {
 	if v, ok := os.LookupEnv(EnvCryptoKeyPathVarName); ok && v != "" {
 		e.CryptoKeyPath = &v
 	}
+	if v, ok := os.LookupEnv(EnvInstanceVarName); ok && v != "" {
+		e.Instance = &v
+	}
+	if v, ok := os.LookupEnv(EnvGRPCAddressVarName); ok && v != "" {
+		e.GRPCAddress = &v
+	}
+	if v, ok := os.LookupEnv(EnvStreamVarName); ok && v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			e.Stream = &b
+		}
+	}
+	if v, ok := os.LookupEnv(EnvFormatVarName); ok && v != "" {
+		if _, known := codec.ForContentType(v); known {
+			e.Format = &v
+		}
+	}
 	if v, ok := os.LookupEnv(EnvRateLimitVarName); ok && v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
 			e.RateLimit = &n
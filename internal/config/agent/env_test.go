@@ -265,3 +265,21 @@ func TestGetEnvVars_CryptoKey_SetWhenProvided(t *testing.T) {
 		}
 	})
 }
+
+func TestGetEnvVars_Instance(t *testing.T) {
+	withEnvMap(map[string]string{EnvInstanceVarName: "host-1"}, func() {
+		got, err := getEnvVars()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Instance == nil || *got.Instance != "host-1" {
+			t.Fatalf("instance mismatch: %+v", got.Instance)
+		}
+	})
+	withEnvMap(map[string]string{EnvInstanceVarName: ""}, func() {
+		got, _ := getEnvVars()
+		if got.Instance != nil {
+			t.Fatalf("empty instance must be ignored, got %q", *got.Instance)
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/agent"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
 
 	commoncfg "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/common"
 )
@@ -19,6 +20,10 @@ type AgentFlags struct {
 	RateLimit         *int
 	CryptoKey         string
 	ConfigPath        string
+	Instance          string
+	GRPCAddress       string
+	Stream            *bool
+	Format            string
 }
 
 var (
@@ -31,6 +36,10 @@ type SignKeyFlagValue struct{ SignKey string }
 type RateLimitFlagValue struct{ Rate *int }
 type CryptoKeyFlagValue struct{ Path string }
 type ConfigPathFlagValue struct{ Path string }
+type InstanceFlagValue struct{ ID string }
+type GRPCAddressFlagValue struct{ Address string }
+type StreamFlagValue struct{ Enabled *bool }
+type FormatFlagValue struct{ Format string }
 
 func ParseReportSecondsFlag(value string, present bool) (ReportSecondsFlagValue, error) {
 	if !present {
@@ -79,6 +88,41 @@ func ParseCryptoKeyFlag(value string, present bool) (CryptoKeyFlagValue, error)
 	return CryptoKeyFlagValue{Path: value}, nil
 }
 
+func ParseInstanceFlag(value string, present bool) (InstanceFlagValue, error) {
+	if !present {
+		return InstanceFlagValue{}, nil
+	}
+	return InstanceFlagValue{ID: value}, nil
+}
+
+func ParseGRPCAddressFlag(value string, present bool) (GRPCAddressFlagValue, error) {
+	if !present {
+		return GRPCAddressFlagValue{}, nil
+	}
+	return GRPCAddressFlagValue{Address: value}, nil
+}
+
+func ParseStreamFlag(value string, present bool) (StreamFlagValue, error) {
+	if !present {
+		return StreamFlagValue{}, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return StreamFlagValue{}, fmt.Errorf("invalid -stream: %q", value)
+	}
+	return StreamFlagValue{Enabled: &b}, nil
+}
+
+func ParseFormatFlag(value string, present bool) (FormatFlagValue, error) {
+	if !present {
+		return FormatFlagValue{}, nil
+	}
+	if _, ok := codec.ForContentType(value); !ok {
+		return FormatFlagValue{}, fmt.Errorf("invalid -format: %q", value)
+	}
+	return FormatFlagValue{Format: value}, nil
+}
+
 func flagsValueMapper(dst *AgentFlags, v commoncfg.FlagValue) error {
 	switch t := v.(type) {
 	case nil:
@@ -115,6 +159,20 @@ func flagsValueMapper(dst *AgentFlags, v commoncfg.FlagValue) error {
 	case ConfigPathFlagValue:
 		dst.ConfigPath = t.Path
 		return nil
+	case InstanceFlagValue:
+		dst.Instance = t.ID
+		return nil
+	case GRPCAddressFlagValue:
+		dst.GRPCAddress = t.Address
+		return nil
+	case StreamFlagValue:
+		if t.Enabled != nil {
+			dst.Stream = t.Enabled
+		}
+		return nil
+	case FormatFlagValue:
+		dst.Format = t.Format
+		return nil
 	default:
 		return nil
 	}
@@ -135,6 +193,10 @@ func parseFlags() (AgentFlags, error) {
 	fs.String("crypto-key", "", "path to public key for encryption")
 	fs.String("c", "", "path to configuration file")
 	fs.String("config", "", "path to configuration file")
+	fs.String("instance", "", "agent instance identifier used to scope metrics on the server")
+	fs.String("grpc-address", "", "gRPC endpoint, e.g., localhost:3200 (default empty, metrics are sent over HTTP)")
+	fs.String("stream", "", "send every report as one NDJSON stream to /updates/stream (default false)")
+	fs.String("format", "", "request body format: application/json, application/x-protobuf or application/msgpack (default application/json)")
 
 	return commoncfg.
 		NewDispatcher[AgentFlags](fs, flagsValueMapper).
@@ -144,6 +206,10 @@ func parseFlags() (AgentFlags, error) {
 		Handle("k", commoncfg.Lift(ParseSignKeyFlag)).
 		Handle("l", commoncfg.Lift(ParseRateLimitFlag)).
 		Handle("crypto-key", commoncfg.Lift(ParseCryptoKeyFlag)).
+		Handle("instance", commoncfg.Lift(ParseInstanceFlag)).
+		Handle("grpc-address", commoncfg.Lift(ParseGRPCAddressFlag)).
+		Handle("stream", commoncfg.Lift(ParseStreamFlag)).
+		Handle("format", commoncfg.Lift(ParseFormatFlag)).
 		Handle("c", func(v string, present bool) (commoncfg.FlagValue, error) {
 			if !present {
 				return nil, nil
@@ -1,6 +1,7 @@
 package dbcfg
 
 import (
+	"fmt"
 	"os"
 
 	commoncfg "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/common"
@@ -22,17 +23,57 @@ func buildDBConfig() (*db.Config, error) {
 		return nil, err
 	}
 
-	dsn := ""
+	cfg := &db.Config{HistoryRetention: db.DefaultHistoryRetention}
 	if fileCfg.DatabaseDSN != nil {
-		dsn = *fileCfg.DatabaseDSN
+		cfg.DSN = *fileCfg.DatabaseDSN
+	}
+	if fileCfg.RedisDSN != nil {
+		cfg.RedisDSN = *fileCfg.RedisDSN
+	}
+	if fileCfg.BoltPath != nil {
+		cfg.BoltPath = *fileCfg.BoltPath
+	}
+	if fileCfg.History != nil {
+		cfg.History = *fileCfg.History
+	}
+	if fileCfg.HistoryRetention != nil {
+		d, err := parseRetention(*fileCfg.HistoryRetention)
+		if err != nil {
+			return nil, fmt.Errorf("config history_retention: %w", err)
+		}
+		cfg.HistoryRetention = d
 	}
 
 	if env.DSN != "" {
-		dsn = env.DSN
+		cfg.DSN = env.DSN
 	} else if flags.DSN != "" {
-		dsn = flags.DSN
+		cfg.DSN = flags.DSN
+	}
+
+	if env.RedisDSN != "" {
+		cfg.RedisDSN = env.RedisDSN
+	} else if flags.RedisDSN != "" {
+		cfg.RedisDSN = flags.RedisDSN
+	}
+
+	if env.BoltPath != "" {
+		cfg.BoltPath = env.BoltPath
+	} else if flags.BoltPath != "" {
+		cfg.BoltPath = flags.BoltPath
+	}
+
+	if env.History != nil {
+		cfg.History = *env.History
+	} else if flags.History != nil {
+		cfg.History = *flags.History
+	}
+
+	if env.HistoryRetention != nil {
+		cfg.HistoryRetention = *env.HistoryRetention
+	} else if flags.HistoryRetention != nil {
+		cfg.HistoryRetention = *flags.HistoryRetention
 	}
-	return &db.Config{DSN: dsn}, nil
+	return cfg, nil
 }
 
 var Module = fx.Module(
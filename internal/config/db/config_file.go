@@ -1,5 +1,25 @@
 package dbcfg
 
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
 type dbFileConfig struct {
-	DatabaseDSN *string `json:"database_dsn"`
+	DatabaseDSN      *string `json:"database_dsn"`
+	RedisDSN         *string `json:"redis_dsn"`
+	BoltPath         *string `json:"bolt_path"`
+	History          *bool   `json:"history"`
+	HistoryRetention *string `json:"history_retention"`
+}
+
+func parseRetention(raw string) (time.Duration, error) {
+	if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+		return d, nil
+	}
+	if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+		return time.Duration(v) * time.Second, nil
+	}
+	return 0, fmt.Errorf("invalid duration: %s", raw)
 }
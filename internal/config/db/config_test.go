@@ -139,3 +139,91 @@ func withArgs(args []string, fn func()) {
 	defer func() { os.Args = old }()
 	fn()
 }
+
+func TestBuildDBConfig_HistoryDefaultsAndPrecedence(t *testing.T) {
+	withEnv(EnvHistoryVarName, "", func() {
+		withEnv(EnvHistoryRetentionVarName, "", func() {
+			withArgs(nil, func() {
+				cfg, err := buildDBConfig()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if cfg.History || cfg.HistoryRetention != db.DefaultHistoryRetention {
+					t.Fatalf("unexpected defaults: %+v", cfg)
+				}
+			})
+
+			withArgs([]string{"-history", "true", "-history-retention", "2h"}, func() {
+				cfg, _ := buildDBConfig()
+				if !cfg.History || cfg.HistoryRetention != 2*time.Hour {
+					t.Fatalf("flags not applied: %+v", cfg)
+				}
+			})
+		})
+	})
+
+	withEnv(EnvHistoryVarName, "false", func() {
+		withEnv(EnvHistoryRetentionVarName, "60", func() {
+			withArgs([]string{"-history", "true", "-history-retention", "2h"}, func() {
+				cfg, _ := buildDBConfig()
+				if cfg.History || cfg.HistoryRetention != time.Minute {
+					t.Fatalf("env should win: %+v", cfg)
+				}
+			})
+		})
+	})
+}
+
+func TestBuildDBConfig_HistoryFromFile(t *testing.T) {
+	cfgFile := t.TempDir() + "/config.json"
+	if err := os.WriteFile(cfgFile, []byte(`{"history":true,"history_retention":"30m"}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+	withEnv("CONFIG", cfgFile, func() {
+		withArgs(nil, func() {
+			cfg, err := buildDBConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cfg.History || cfg.HistoryRetention != 30*time.Minute {
+				t.Fatalf("file values not applied: %+v", cfg)
+			}
+		})
+	})
+
+	if err := os.WriteFile(cfgFile, []byte(`{"history_retention":"soon"}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+	withEnv("CONFIG", cfgFile, func() {
+		withArgs(nil, func() {
+			if _, err := buildDBConfig(); err == nil {
+				t.Fatalf("want invalid retention error")
+			}
+		})
+	})
+}
+
+func TestBuildDBConfig_RedisDSNPrecedence(t *testing.T) {
+	withEnv(EnvRedisDSNVarName, "redis://env:6379/0", func() {
+		withArgs([]string{"-redis-dsn", "redis://flag:6379/0"}, func() {
+			cfg, err := buildDBConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.RedisDSN != "redis://env:6379/0" {
+				t.Fatalf("env redis dsn must win, got %q", cfg.RedisDSN)
+			}
+		})
+	})
+	withEnv(EnvRedisDSNVarName, "", func() {
+		withArgs([]string{"-redis-dsn", "redis://flag:6379/0"}, func() {
+			cfg, err := buildDBConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.RedisDSN != "redis://flag:6379/0" {
+				t.Fatalf("flag redis dsn expected, got %q", cfg.RedisDSN)
+			}
+		})
+	})
+}
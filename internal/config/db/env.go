@@ -1,13 +1,38 @@
 package dbcfg
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
-const EnvDSNVarName = "DATABASE_DSN"
+const (
+	EnvDSNVarName              = "DATABASE_DSN"
+	EnvRedisDSNVarName         = "REDIS_DSN"
+	EnvBoltPathVarName         = "BOLT_PATH"
+	EnvHistoryVarName          = "HISTORY"
+	EnvHistoryRetentionVarName = "HISTORY_RETENTION"
+)
 
 type DBEnvVars struct {
-	DSN string
+	DSN              string
+	RedisDSN         string
+	BoltPath         string
+	History          *bool
+	HistoryRetention *time.Duration
 }
 
 func getEnvVars() (DBEnvVars, error) {
-	return DBEnvVars{DSN: os.Getenv(EnvDSNVarName)}, nil
+	e := DBEnvVars{DSN: os.Getenv(EnvDSNVarName), RedisDSN: os.Getenv(EnvRedisDSNVarName), BoltPath: os.Getenv(EnvBoltPathVarName)}
+	if v := os.Getenv(EnvHistoryVarName); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			e.History = &b
+		}
+	}
+	if v := os.Getenv(EnvHistoryRetentionVarName); v != "" {
+		if d, err := parseRetention(v); err == nil {
+			e.HistoryRetention = &d
+		}
+	}
+	return e, nil
 }
@@ -4,11 +4,17 @@ import (
 	"flag"
 	"io"
 	"os"
+	"strconv"
+	"time"
 )
 
 type DBFlags struct {
-	DSN        string
-	ConfigPath string
+	DSN              string
+	RedisDSN         string
+	BoltPath         string
+	History          *bool
+	HistoryRetention *time.Duration
+	ConfigPath       string
 }
 
 var (
@@ -19,6 +25,10 @@ func parseFlags() (DBFlags, error) {
 	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	fs.String("d", defaultDSN, "PostreSQL connection string")
+	fs.String("redis-dsn", "", "Redis connection string, e.g. redis://localhost:6379/0, used when no PostgreSQL DSN is set")
+	fs.String("bolt-path", "", "path to the embedded bbolt metrics file, used when no PostgreSQL or Redis DSN is set")
+	fs.String("history", "", "record every metric update into the history tables")
+	fs.String("history-retention", "", "how long history samples are kept, e.g. 24h (0 keeps forever)")
 	fs.String("c", "", "path to configuration file")
 	fs.String("config", "", "path to configuration file")
 
@@ -34,6 +44,30 @@ func parseFlags() (DBFlags, error) {
 		flags.DSN = fs.Lookup("d").Value.String()
 	}
 
+	if set["redis-dsn"] {
+		flags.RedisDSN = fs.Lookup("redis-dsn").Value.String()
+	}
+
+	if set["bolt-path"] {
+		flags.BoltPath = fs.Lookup("bolt-path").Value.String()
+	}
+
+	if set["history"] {
+		b, err := strconv.ParseBool(fs.Lookup("history").Value.String())
+		if err != nil {
+			return DBFlags{}, err
+		}
+		flags.History = &b
+	}
+
+	if set["history-retention"] {
+		d, err := parseRetention(fs.Lookup("history-retention").Value.String())
+		if err != nil {
+			return DBFlags{}, err
+		}
+		flags.HistoryRetention = &d
+	}
+
 	if set["config"] {
 		flags.ConfigPath = fs.Lookup("config").Value.String()
 	} else if set["c"] {
@@ -6,8 +6,13 @@ import (
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
 	commoncfg "github.com/polkiloo/go-musthave-metrics-tppl/internal/config/common"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcserver"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/schema"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/server"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
 	"go.uber.org/fx"
 )
 
@@ -17,8 +22,15 @@ func buildServerConfig() (server.AppConfig, error) {
 		Port:            server.DefaultAppPort,
 		StoreInterval:   server.DefaultStoreInterval,
 		FileStoragePath: server.DefaultFileStoragePath,
+		StoreGens:       server.DefaultStoreGens,
 		Restore:         server.DefaultRestore,
 		CryptoKeyPath:   server.DefaultCryptoKeyPath,
+		GRPCAddress:     server.DefaultGRPCAddress,
+		TrustedSubnet:   server.DefaultTrustedSubnet,
+		WALPath:         server.DefaultWALPath,
+		WALSync:         server.DefaultWALSync,
+		MetricTTL:       server.DefaultMetricTTL,
+		SchemaFile:      server.DefaultSchemaFile,
 	}
 
 	cfg := defaultAppConfig
@@ -60,6 +72,9 @@ func buildServerConfig() (server.AppConfig, error) {
 	if fileCfg.StoreFile != nil {
 		cfg.FileStoragePath = *fileCfg.StoreFile
 	}
+	if fileCfg.StoreGens != nil {
+		cfg.StoreGens = *fileCfg.StoreGens
+	}
 
 	if fileCfg.Restore != nil {
 		cfg.Restore = *fileCfg.Restore
@@ -81,6 +96,30 @@ func buildServerConfig() (server.AppConfig, error) {
 		cfg.CryptoKeyPath = *fileCfg.CryptoKey
 	}
 
+	if fileCfg.GRPCAddress != nil {
+		cfg.GRPCAddress = *fileCfg.GRPCAddress
+	}
+
+	if fileCfg.TrustedSubnet != nil {
+		cfg.TrustedSubnet = *fileCfg.TrustedSubnet
+	}
+
+	if fileCfg.WALPath != nil {
+		cfg.WALPath = *fileCfg.WALPath
+	}
+
+	if fileCfg.WALSync != nil {
+		cfg.WALSync = *fileCfg.WALSync
+	}
+
+	if fileCfg.MetricTTL != nil {
+		cfg.MetricTTL = *fileCfg.MetricTTL
+	}
+
+	if fileCfg.SchemaFile != nil {
+		cfg.SchemaFile = *fileCfg.SchemaFile
+	}
+
 	if envVars.Host != "" {
 		cfg.Host = envVars.Host
 	} else if flagArgs.addressFlag.Host != "" {
@@ -105,6 +144,12 @@ func buildServerConfig() (server.AppConfig, error) {
 		cfg.FileStoragePath = flagArgs.fileStorage
 	}
 
+	if envVars.StoreGens != nil {
+		cfg.StoreGens = *envVars.StoreGens
+	} else if flagArgs.storeGens != nil {
+		cfg.StoreGens = *flagArgs.storeGens
+	}
+
 	if envVars.Restore != nil {
 		cfg.Restore = *envVars.Restore
 	} else if flagArgs.restore != nil {
@@ -135,6 +180,47 @@ func buildServerConfig() (server.AppConfig, error) {
 		cfg.CryptoKeyPath = flagArgs.CryptoKeyPath
 	}
 
+	if envVars.GRPCAddress != "" {
+		cfg.GRPCAddress = envVars.GRPCAddress
+	} else if flagArgs.grpcAddress != "" {
+		cfg.GRPCAddress = flagArgs.grpcAddress
+	}
+
+	if envVars.TrustedSubnet != "" {
+		cfg.TrustedSubnet = envVars.TrustedSubnet
+	} else if flagArgs.trustedSubnet != "" {
+		cfg.TrustedSubnet = flagArgs.trustedSubnet
+	}
+
+	if envVars.WALPath != "" {
+		cfg.WALPath = envVars.WALPath
+	} else if flagArgs.walPath != "" {
+		cfg.WALPath = flagArgs.walPath
+	}
+
+	if envVars.WALSync != "" {
+		cfg.WALSync = envVars.WALSync
+	} else if flagArgs.walSync != "" {
+		cfg.WALSync = flagArgs.walSync
+	}
+
+	if envVars.MetricTTL != "" {
+		cfg.MetricTTL = envVars.MetricTTL
+	} else if flagArgs.metricTTL != "" {
+		cfg.MetricTTL = flagArgs.metricTTL
+	}
+
+	if envVars.SchemaFile != "" {
+		cfg.SchemaFile = envVars.SchemaFile
+	} else if flagArgs.schemaFile != "" {
+		cfg.SchemaFile = flagArgs.schemaFile
+	}
+
+	// The write-ahead log is compacted only when a snapshot is written, so without one it grows forever.
+	if cfg.WALPath != "" && cfg.FileStoragePath == "" {
+		return cfg, fmt.Errorf("wal %q requires a file storage path", cfg.WALPath)
+	}
+
 	return cfg, nil
 }
 
@@ -147,5 +233,28 @@ var Module = fx.Module(
 		func(c server.AppConfig) audit.Config {
 			return audit.Config{FilePath: c.AuditFile, Endpoint: c.AuditURL}
 		},
+		func(c server.AppConfig) grpcserver.Config {
+			return grpcserver.Config{Address: c.GRPCAddress}
+		},
+		func(c server.AppConfig) (subnet.Trusted, error) {
+			return subnet.ParseTrusted(c.TrustedSubnet)
+		},
+		func(c server.AppConfig) service.SnapshotConfig {
+			return service.SnapshotConfig{Generations: c.StoreGens}
+		},
+		func(c server.AppConfig) (storage.WALConfig, error) {
+			interval, err := storage.ParseWALSync(c.WALSync)
+			return storage.WALConfig{Path: c.WALPath, SyncInterval: interval}, err
+		},
+		func(c server.AppConfig) (service.TTLConfig, error) {
+			rules, err := service.ParseTTLRules(c.MetricTTL)
+			return service.TTLConfig{Rules: rules}, err
+		},
+		func(c server.AppConfig) (*schema.Registry, error) {
+			if c.SchemaFile == "" {
+				return nil, nil
+			}
+			return schema.Load(c.SchemaFile)
+		},
 	),
 )
@@ -11,11 +11,18 @@ type serverFileConfig struct {
 	Restore       *bool   `json:"restore"`
 	StoreInterval *string `json:"store_interval"`
 	StoreFile     *string `json:"store_file"`
+	StoreGens     *int    `json:"store_generations"`
 	DatabaseDSN   *string `json:"database_dsn"`
 	Key           *string `json:"key"`
 	AuditFile     *string `json:"audit_file"`
 	AuditURL      *string `json:"audit_url"`
 	CryptoKey     *string `json:"crypto_key"`
+	GRPCAddress   *string `json:"grpc_address"`
+	TrustedSubnet *string `json:"trusted_subnet"`
+	WALPath       *string `json:"wal_path"`
+	WALSync       *string `json:"wal_sync"`
+	MetricTTL     *string `json:"metric_ttl"`
+	SchemaFile    *string `json:"schema_file"`
 }
 
 func parseDurationSeconds(raw string) (int, error) {
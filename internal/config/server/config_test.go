@@ -211,3 +211,175 @@ func TestBuildServerConfig_EnvOverridesConfigFile(t *testing.T) {
 		})
 	})
 }
+
+func TestBuildServerConfig_GRPCAddressPriority(t *testing.T) {
+	withEnv(EnvGRPCAddressVarName, "", func() {
+		withArgs([]string{"-grpc-address", ":3300"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.GRPCAddress != ":3300" {
+				t.Fatalf("flag grpc address expected, got %q", cfg.GRPCAddress)
+			}
+		})
+	})
+	withEnv(EnvGRPCAddressVarName, ":3200", func() {
+		withArgs([]string{"-grpc-address", ":3300"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.GRPCAddress != ":3200" {
+				t.Fatalf("env grpc address must win: got %q", cfg.GRPCAddress)
+			}
+		})
+	})
+}
+
+func TestBuildServerConfig_TrustedSubnetPriority(t *testing.T) {
+	withEnv(EnvTrustedSubnetVarName, "10.0.0.0/8", func() {
+		withArgs([]string{"-t", "192.168.0.0/16"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.TrustedSubnet != "10.0.0.0/8" {
+				t.Fatalf("env trusted subnet must win: got %q", cfg.TrustedSubnet)
+			}
+		})
+	})
+	withEnv(EnvTrustedSubnetVarName, "", func() {
+		withArgs([]string{"-t", "192.168.0.0/16"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.TrustedSubnet != "192.168.0.0/16" {
+				t.Fatalf("flag trusted subnet expected, got %q", cfg.TrustedSubnet)
+			}
+		})
+	})
+}
+
+func TestBuildServerConfig_WALPriority(t *testing.T) {
+	withEnv(EnvWALSyncVarName, "1s", func() {
+		withArgs([]string{"-wal", "/tmp/m.wal", "-wal-sync", "none"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.WALPath != "/tmp/m.wal" {
+				t.Fatalf("flag wal path expected, got %q", cfg.WALPath)
+			}
+			if cfg.WALSync != "1s" {
+				t.Fatalf("env wal sync must win: got %q", cfg.WALSync)
+			}
+		})
+	})
+	withEnv(EnvWALSyncVarName, "", func() {
+		withArgs(nil, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.WALPath != "" || cfg.WALSync != server.DefaultWALSync {
+				t.Fatalf("defaults expected, got %q %q", cfg.WALPath, cfg.WALSync)
+			}
+		})
+	})
+}
+
+func TestBuildServerConfig_WALRequiresFileStoragePath(t *testing.T) {
+	cfgFile := t.TempDir() + "/config.json"
+	if err := os.WriteFile(cfgFile, []byte(`{"store_file": ""}`), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+	withEnv("CONFIG", cfgFile, func() {
+		withArgs([]string{"-wal", "/tmp/m.wal"}, func() {
+			if _, err := buildServerConfig(); err == nil {
+				t.Fatal("expected error for wal without file storage path")
+			}
+		})
+		withArgs(nil, func() {
+			if _, err := buildServerConfig(); err != nil {
+				t.Fatalf("unexpected error without wal: %v", err)
+			}
+		})
+	})
+}
+
+func TestBuildServerConfig_StoreGenerationsPriority(t *testing.T) {
+	withEnv(EnvStoreGensVarName, "5", func() {
+		withArgs([]string{"-store-generations", "2"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.StoreGens != 5 {
+				t.Fatalf("env store generations must win: got %d", cfg.StoreGens)
+			}
+		})
+	})
+	withEnv(EnvStoreGensVarName, "", func() {
+		withArgs([]string{"-store-generations", "2"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.StoreGens != 2 {
+				t.Fatalf("flag store generations expected, got %d", cfg.StoreGens)
+			}
+		})
+	})
+}
+
+func TestBuildServerConfig_MetricTTLPriority(t *testing.T) {
+	withEnv(EnvMetricTTLVarName, "*=1h", func() {
+		withArgs([]string{"-metric-ttl", "*=1m"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.MetricTTL != "*=1h" {
+				t.Fatalf("env metric ttl must win: got %q", cfg.MetricTTL)
+			}
+		})
+	})
+	withEnv(EnvMetricTTLVarName, "", func() {
+		withArgs([]string{"-metric-ttl", "CPU*=10m"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.MetricTTL != "CPU*=10m" {
+				t.Fatalf("flag metric ttl expected, got %q", cfg.MetricTTL)
+			}
+		})
+	})
+}
+
+func TestBuildServerConfig_SchemaFilePriority(t *testing.T) {
+	withEnv(EnvSchemaFileVarName, "/etc/env-schema.json", func() {
+		withArgs([]string{"-schema", "/etc/flag-schema.json"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.SchemaFile != "/etc/env-schema.json" {
+				t.Fatalf("env schema file must win: got %q", cfg.SchemaFile)
+			}
+		})
+	})
+	withEnv(EnvSchemaFileVarName, "", func() {
+		withArgs([]string{"-schema", "/etc/flag-schema.json"}, func() {
+			cfg, err := buildServerConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.SchemaFile != "/etc/flag-schema.json" {
+				t.Fatalf("flag schema file expected, got %q", cfg.SchemaFile)
+			}
+		})
+	})
+}
@@ -11,11 +11,18 @@ const (
 	EnvAddressVarName       = "ADDRESS"
 	EnvStoreIntervalVarName = "STORE_INTERVAL"
 	EnvFileStorageVarName   = "FILE_STORAGE_PATH"
+	EnvStoreGensVarName     = "STORE_GENERATIONS"
 	EnvRestoreVarName       = "RESTORE"
 	EnvKeyVarName           = "KEY"
 	EnvAuditFileVarName     = "AUDIT_FILE"
 	EnvAuditURLVarName      = "AUDIT_URL"
 	EnvCryptoKeyVarName     = "CRYPTO_KEY"
+	EnvGRPCAddressVarName   = "GRPC_ADDRESS"
+	EnvTrustedSubnetVarName = "TRUSTED_SUBNET"
+	EnvWALPathVarName       = "WAL_PATH"
+	EnvWALSyncVarName       = "WAL_SYNC"
+	EnvMetricTTLVarName     = "METRIC_TTL"
+	EnvSchemaFileVarName    = "SCHEMA_FILE"
 )
 
 type ServerEnvVars struct {
@@ -23,11 +30,18 @@ type ServerEnvVars struct {
 	Port          *int
 	StoreInterval *int
 	FileStorage   string
+	StoreGens     *int
 	Restore       *bool
 	SignKey       string
 	AuditFile     string
 	AuditURL      string
 	CryptoKey     string
+	GRPCAddress   string
+	TrustedSubnet string
+	WALPath       string
+	WALSync       string
+	MetricTTL     string
+	SchemaFile    string
 }
 
 func getEnvVars() (ServerEnvVars, error) {
@@ -40,6 +54,13 @@ func getEnvVars() (ServerEnvVars, error) {
 		}
 	}
 
+	var gens *int
+	if v := os.Getenv(EnvStoreGensVarName); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			gens = &i
+		}
+	}
+
 	var restore *bool
 	if v := os.Getenv(EnvRestoreVarName); v != "" {
 		if b, err := strconv.ParseBool(v); err == nil {
@@ -52,10 +73,17 @@ func getEnvVars() (ServerEnvVars, error) {
 		Port:          hp.Port,
 		StoreInterval: interval,
 		FileStorage:   os.Getenv(EnvFileStorageVarName),
+		StoreGens:     gens,
 		Restore:       restore,
 		SignKey:       os.Getenv(EnvKeyVarName),
 		AuditFile:     os.Getenv(EnvAuditFileVarName),
 		AuditURL:      os.Getenv(EnvAuditURLVarName),
 		CryptoKey:     os.Getenv(EnvCryptoKeyVarName),
+		GRPCAddress:   os.Getenv(EnvGRPCAddressVarName),
+		TrustedSubnet: os.Getenv(EnvTrustedSubnetVarName),
+		WALPath:       os.Getenv(EnvWALPathVarName),
+		WALSync:       os.Getenv(EnvWALSyncVarName),
+		MetricTTL:     os.Getenv(EnvMetricTTLVarName),
+		SchemaFile:    os.Getenv(EnvSchemaFileVarName),
 	}, nil
 }
@@ -14,11 +14,18 @@ type ServerFlags struct {
 	addressFlag   commoncfg.AddressFlagValue
 	storeInterval *int
 	fileStorage   string
+	storeGens     *int
 	restore       *bool
 	SignKey       string
 	auditFile     string
 	auditURL      string
 	CryptoKeyPath string
+	grpcAddress   string
+	trustedSubnet string
+	walPath       string
+	walSync       string
+	metricTTL     string
+	schemaFile    string
 	ConfigPath    string
 }
 
@@ -26,6 +33,7 @@ var (
 	defaultAddress       = server.DefaultAppHost + ":" + strconv.Itoa(server.DefaultAppPort)
 	defaultStoreInterval = server.DefaultStoreInterval
 	defaultFileStorage   = server.DefaultFileStoragePath
+	defaultStoreGens     = server.DefaultStoreGens
 	defaultRestore       = server.DefaultRestore
 )
 
@@ -35,11 +43,18 @@ func parseFlags() (ServerFlags, error) {
 	fs.String("a", defaultAddress, "HTTP endpoint, e.g., localhost:8080 or :8080")
 	fs.Int("i", defaultStoreInterval, "store interval in seconds")
 	fs.String("f", defaultFileStorage, "path to file for metrics storage")
+	fs.Int("store-generations", defaultStoreGens, "number of snapshot files to keep")
 	fs.Bool("r", defaultRestore, "restore metrics from file on start")
 	fs.String("k", "", "key for hashing")
 	fs.String("audit-file", "", "path to audit log file")
 	fs.String("audit-url", "", "remote URL for audit events")
 	fs.String("crypto-key", "", "path to private key for decryption")
+	fs.String("t", "", "trusted subnet in CIDR notation; updates from other addresses are rejected")
+	fs.String("grpc-address", "", "gRPC endpoint, e.g., localhost:3200 (default empty, gRPC disabled)")
+	fs.String("wal", "", "path to write-ahead log of in-memory storage, requires a file storage path (default empty, log disabled)")
+	fs.String("wal-sync", "", "write-ahead log fsync policy: always, none or an interval such as 1s")
+	fs.String("schema", "", "path to the JSON schema registry that metric updates must conform to")
+	fs.String("metric-ttl", "", "expire metrics not updated for a while: comma-separated pattern=duration rules, e.g. CPUutilization*=10m,*=24h")
 	fs.String("c", "", "path to configuration file")
 	fs.String("config", "", "path to configuration file")
 
@@ -65,6 +80,13 @@ func parseFlags() (ServerFlags, error) {
 	if set["f"] {
 		flags.fileStorage = fs.Lookup("f").Value.String()
 	}
+	if set["store-generations"] {
+		v, err := strconv.Atoi(fs.Lookup("store-generations").Value.String())
+		if err != nil {
+			return ServerFlags{}, err
+		}
+		flags.storeGens = &v
+	}
 	if set["r"] {
 		b, err := strconv.ParseBool(fs.Lookup("r").Value.String())
 		if err != nil {
@@ -87,6 +109,27 @@ func parseFlags() (ServerFlags, error) {
 		flags.CryptoKeyPath = fs.Lookup("crypto-key").Value.String()
 	}
 
+	if set["t"] {
+		flags.trustedSubnet = fs.Lookup("t").Value.String()
+	}
+
+	if set["grpc-address"] {
+		flags.grpcAddress = fs.Lookup("grpc-address").Value.String()
+	}
+
+	if set["wal"] {
+		flags.walPath = fs.Lookup("wal").Value.String()
+	}
+	if set["wal-sync"] {
+		flags.walSync = fs.Lookup("wal-sync").Value.String()
+	}
+	if set["metric-ttl"] {
+		flags.metricTTL = fs.Lookup("metric-ttl").Value.String()
+	}
+	if set["schema"] {
+		flags.schemaFile = fs.Lookup("schema").Value.String()
+	}
+
 	if set["config"] {
 		flags.ConfigPath = fs.Lookup("config").Value.String()
 	} else if set["c"] {
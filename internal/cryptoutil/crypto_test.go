@@ -405,7 +405,7 @@ func TestMiddleware(t *testing.T) {
 
 	t.Run("no crypto header", func(t *testing.T) {
 		router := gin.New()
-		router.POST("/", Middleware(nil), func(c *gin.Context) {
+		router.POST("/", Middleware(nil, nil), func(c *gin.Context) {
 			data, _ := io.ReadAll(c.Request.Body)
 			if string(data) != "plain" {
 				t.Fatalf("expected plain body, got %s", data)
@@ -423,7 +423,7 @@ func TestMiddleware(t *testing.T) {
 
 	t.Run("nil decryptor", func(t *testing.T) {
 		router := gin.New()
-		router.POST("/", Middleware(nil))
+		router.POST("/", Middleware(nil, nil))
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("data"))
 		req.Header.Set(CryptoKeyHeader, "key")
@@ -436,7 +436,7 @@ func TestMiddleware(t *testing.T) {
 
 	t.Run("read body error", func(t *testing.T) {
 		router := gin.New()
-		router.POST("/", Middleware(fakeDecryptor{plain: []byte("ignored")}))
+		router.POST("/", Middleware(fakeDecryptor{plain: []byte("ignored")}, nil))
 
 		req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(errReader{}))
 		req.Header.Set(CryptoKeyHeader, "key")
@@ -450,7 +450,7 @@ func TestMiddleware(t *testing.T) {
 	t.Run("decrypt error", func(t *testing.T) {
 		router := gin.New()
 		dec := &test.FakeDecryptor{Err: errors.New("boom")}
-		router.POST("/", Middleware(dec))
+		router.POST("/", Middleware(dec, nil))
 
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("data"))
 		req.Header.Set(CryptoKeyHeader, "key")
@@ -464,7 +464,7 @@ func TestMiddleware(t *testing.T) {
 	t.Run("body too large", func(t *testing.T) {
 		router := gin.New()
 		called := false
-		router.POST("/", Middleware(&test.FakeDecryptor{Plaintext: []byte("ignored")}))
+		router.POST("/", Middleware(&test.FakeDecryptor{Plaintext: []byte("ignored")}, nil))
 
 		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(bytes.Repeat([]byte("a"), maxEncryptedBodySize+1)))
 		req.Header.Set(CryptoKeyHeader, "key")
@@ -481,7 +481,7 @@ func TestMiddleware(t *testing.T) {
 
 	t.Run("success", func(t *testing.T) {
 		router := gin.New()
-		router.POST("/", Middleware(fakeDecryptor{plain: []byte("plain")}), func(c *gin.Context) {
+		router.POST("/", Middleware(fakeDecryptor{plain: []byte("plain")}, nil), func(c *gin.Context) {
 			data, _ := io.ReadAll(c.Request.Body)
 			if string(data) != "plain" {
 				t.Fatalf("expected decrypted body, got %s", data)
@@ -3,6 +3,7 @@ package cryptoutil
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
@@ -11,8 +12,27 @@ import (
 
 const maxEncryptedBodySize = 10 << 20
 
+// Errors passed to AbortFunc for the requests that Middleware rejects.
+var (
+	// ErrDecryptionUnavailable reports an encrypted request to a server without a private key.
+	ErrDecryptionUnavailable = errors.New("encrypted requests are not accepted")
+	// ErrBodyTooLarge reports an encrypted body over 10 MiB.
+	ErrBodyTooLarge = errors.New("encrypted request body is too large")
+	// ErrBodyUnreadable reports an encrypted body that cannot be read.
+	ErrBodyUnreadable = errors.New("encrypted request body cannot be read")
+	// ErrDecryptFailed reports a body that cannot be decrypted with the private key.
+	ErrDecryptFailed = errors.New("request body cannot be decrypted")
+)
+
+// AbortFunc ends a request that Middleware rejects with status because of err.
+type AbortFunc func(c *gin.Context, status int, err error)
+
 // Middleware decrypts incoming requests using the provided Decryptor.
-func Middleware(dec Decryptor) gin.HandlerFunc {
+// Rejected requests are ended by abort with one of the errors above; a nil abort replies with an empty body.
+func Middleware(dec Decryptor, abort AbortFunc) gin.HandlerFunc {
+	if abort == nil {
+		abort = func(c *gin.Context, status int, _ error) { c.AbortWithStatus(status) }
+	}
 	return func(c *gin.Context) {
 		encryptedKey := c.GetHeader(CryptoKeyHeader)
 		if encryptedKey == "" {
@@ -20,7 +40,7 @@ func Middleware(dec Decryptor) gin.HandlerFunc {
 			return
 		}
 		if dec == nil {
-			c.AbortWithStatus(http.StatusBadRequest)
+			abort(c, http.StatusBadRequest, ErrDecryptionUnavailable)
 			return
 		}
 
@@ -35,16 +55,16 @@ func Middleware(dec Decryptor) gin.HandlerFunc {
 		if err != nil {
 			var maxBytesErr *http.MaxBytesError
 			if errors.As(err, &maxBytesErr) {
-				c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+				abort(c, http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
 				return
 			}
-			c.AbortWithStatus(http.StatusBadRequest)
+			abort(c, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrBodyUnreadable, err))
 			return
 		}
 
 		plain, err := dec.Decrypt(body, encryptedKey)
 		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
+			abort(c, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrDecryptFailed, err))
 			return
 		}
 
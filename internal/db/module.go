@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -11,6 +12,8 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/lib/pq"
 	"github.com/pressly/goose/v3"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/migrations"
 
@@ -21,8 +24,19 @@ var (
 	ErrMissConfig = fmt.Errorf("missing DB config")
 )
 
+// DefaultHistoryRetention is how long metric samples are kept when history is enabled.
+const DefaultHistoryRetention = 7 * 24 * time.Hour
+
 type Config struct {
 	DSN string
+	// RedisDSN selects the Redis backend, e.g. redis://localhost:6379/0, when DSN is empty.
+	RedisDSN string
+	// BoltPath selects the embedded bbolt file backend when neither DSN nor RedisDSN is set.
+	BoltPath string
+	// History enables recording of every metric update into the samples tables.
+	History bool
+	// HistoryRetention limits how long samples are kept; zero keeps them forever.
+	HistoryRetention time.Duration
 }
 
 type Pool interface {
@@ -67,6 +81,55 @@ func newPool(ctx context.Context, _ migrated, cfg *Config) (Pool, error) {
 	return open(ctx, cfg.DSN)
 }
 
+// newRedisClient returns a client for cfg.RedisDSN, or nil when Redis is not configured.
+func newRedisClient(cfg *Config) (*redis.Client, error) {
+	if cfg == nil || cfg.RedisDSN == "" {
+		return nil, nil
+	}
+	opts, err := redis.ParseURL(cfg.RedisDSN)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis dsn: %w", err)
+	}
+	return redis.NewClient(opts), nil
+}
+
+func closeRedisClient(lc fx.Lifecycle, c *redis.Client) {
+	if c == nil {
+		return
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return c.Close()
+		},
+	})
+}
+
+// boltOpenTimeout bounds the wait for the file lock held by another process.
+const boltOpenTimeout = 5 * time.Second
+
+// newBoltDB opens the bbolt file at cfg.BoltPath, or returns nil when another backend is configured.
+func newBoltDB(cfg *Config) (*bolt.DB, error) {
+	if cfg == nil || cfg.BoltPath == "" || cfg.DSN != "" || cfg.RedisDSN != "" {
+		return nil, nil
+	}
+	b, err := bolt.Open(cfg.BoltPath, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt file: %w", err)
+	}
+	return b, nil
+}
+
+func closeBoltDB(lc fx.Lifecycle, b *bolt.DB) {
+	if b == nil {
+		return
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return b.Close()
+		},
+	})
+}
+
 func closePool(lc fx.Lifecycle, pool Pool) {
 	if pool == nil {
 		return
@@ -81,6 +144,6 @@ func closePool(lc fx.Lifecycle, pool Pool) {
 
 var Module = fx.Module(
 	"db",
-	fx.Provide(runMigrations, newPool),
-	fx.Invoke(closePool),
+	fx.Provide(runMigrations, newPool, newRedisClient, newBoltDB),
+	fx.Invoke(closePool, closeRedisClient, closeBoltDB),
 )
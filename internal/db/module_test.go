@@ -3,11 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxtest"
 
@@ -43,6 +45,25 @@ func TestNewPool_EmptyDSN(t *testing.T) {
 	}
 }
 
+func TestNewBoltDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	if b, err := newBoltDB(&Config{BoltPath: path, DSN: "postgres://"}); err != nil || b != nil {
+		t.Fatalf("bolt must not be opened when a DSN is set, got %v %v", b, err)
+	}
+
+	app := fxtest.New(t,
+		fx.Supply(&Config{BoltPath: path}),
+		fx.Provide(newBoltDB),
+		fx.Invoke(closeBoltDB),
+		fx.Invoke(func(b *bolt.DB) {
+			if b == nil || b.Path() != path {
+				t.Fatalf("want bolt file at %s, got %v", path, b)
+			}
+		}),
+	)
+	app.RequireStart().RequireStop()
+}
+
 func TestNewPool_OpenAndClose(t *testing.T) {
 	lc := fxtest.NewLifecycle(t)
 	cfg := &Config{DSN: "postgres://user@localhost/db"}
@@ -0,0 +1,48 @@
+// Package grpcapi contains the helpers shared by the gRPC metrics server and the agent gRPC sender:
+// conversion between models.Metrics and the wire types, and request sealing (signing and encryption).
+package grpcapi
+
+import (
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// ToProto converts a metric to its wire representation.
+func ToProto(m *models.Metrics) *metricspb.Metric {
+	p := &metricspb.Metric{
+		Id:     m.ID,
+		Type:   string(m.MType),
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.Labels.Clone(),
+	}
+	if m.Histogram != nil {
+		p.Histogram = &metricspb.Histogram{
+			Bounds: append([]float64(nil), m.Histogram.Bounds...),
+			Counts: append([]uint64(nil), m.Histogram.Counts...),
+			Sum:    m.Histogram.Sum,
+			Count:  m.Histogram.Count,
+		}
+	}
+	return p
+}
+
+// FromProto converts a wire metric back to the model. The metric is not validated.
+func FromProto(p *metricspb.Metric) models.Metrics {
+	m := models.Metrics{
+		ID:     p.GetId(),
+		MType:  models.MetricType(p.GetType()),
+		Delta:  p.Delta,
+		Value:  p.Value,
+		Labels: models.Labels(p.GetLabels()).Clone(),
+	}
+	if h := p.GetHistogram(); h != nil {
+		m.Histogram = &models.Histogram{
+			Bounds: append([]float64(nil), h.GetBounds()...),
+			Counts: append([]uint64(nil), h.GetCounts()...),
+			Sum:    h.GetSum(),
+			Count:  h.GetCount(),
+		}
+	}
+	return m
+}
@@ -0,0 +1,106 @@
+package grpcapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
+	"google.golang.org/protobuf/proto"
+)
+
+// HashMetadataKey carries the HMAC-SHA256 signature of a gRPC response, like the HashSHA256 HTTP header.
+const HashMetadataKey = "hashsha256"
+
+// InstanceMetadataKey carries the agent instance identifier, like the X-Instance-ID HTTP header.
+var InstanceMetadataKey = strings.ToLower(models.InstanceHeader)
+
+// RealIPMetadataKey carries the agent address, like the X-Real-IP HTTP header.
+var RealIPMetadataKey = strings.ToLower(subnet.RealIPHeader)
+
+var (
+	// ErrInvalidSignature indicates that the request hash does not match its payload.
+	ErrInvalidSignature = errors.New("invalid request signature")
+	// ErrDecryptorMissing indicates an encrypted request reached a server without a private key.
+	ErrDecryptorMissing = errors.New("encrypted request but no decryptor configured")
+)
+
+var marshalOptions = proto.MarshalOptions{Deterministic: true}
+
+// SealRequest builds the request for a batch of metrics.
+// The plain payload is signed with key when it is set and then encrypted with enc when it is not nil.
+func SealRequest(metrics []*metricspb.Metric, key sign.SignKey, enc cryptoutil.Encryptor) (*metricspb.UpdateMetricsRequest, error) {
+	plain := &metricspb.UpdateMetricsRequest{Metrics: metrics}
+	if key == "" && enc == nil {
+		return plain, nil
+	}
+	payload, err := marshalOptions.Marshal(plain)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	req := plain
+	if enc != nil {
+		ciphertext, encryptedKey, err := enc.Encrypt(payload)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt request: %w", err)
+		}
+		req = &metricspb.UpdateMetricsRequest{Encrypted: ciphertext, EncryptedKey: encryptedKey}
+	}
+	if key != "" {
+		req.Hash = sign.NewSignerSHA256().Sign(payload, key)
+	}
+	return req, nil
+}
+
+// OpenRequest reverses SealRequest in place: it decrypts the payload and checks the signature.
+// As with the HTTP middleware, an unsigned request is accepted even when the server has a key.
+func OpenRequest(req *metricspb.UpdateMetricsRequest, s sign.Signer, key sign.SignKey, dec cryptoutil.Decryptor) error {
+	var payload []byte
+	if req.GetEncryptedKey() != "" {
+		if dec == nil {
+			return ErrDecryptorMissing
+		}
+		var err error
+		payload, err = dec.Decrypt(req.GetEncrypted(), req.GetEncryptedKey())
+		if err != nil {
+			return fmt.Errorf("decrypt request: %w", err)
+		}
+		var inner metricspb.UpdateMetricsRequest
+		if err := proto.Unmarshal(payload, &inner); err != nil {
+			return fmt.Errorf("unmarshal request: %w", err)
+		}
+		req.Metrics = inner.GetMetrics()
+		req.Encrypted = nil
+		req.EncryptedKey = ""
+	}
+	if key == "" || req.GetHash() == "" {
+		return nil
+	}
+	if payload == nil {
+		var err error
+		payload, err = marshalOptions.Marshal(&metricspb.UpdateMetricsRequest{Metrics: req.GetMetrics()})
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+	}
+	if !s.Verify(payload, key, req.GetHash()) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SignResponse returns the signature of a response message, or "" when no key is configured.
+func SignResponse(resp proto.Message, s sign.Signer, key sign.SignKey) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	payload, err := marshalOptions.Marshal(resp)
+	if err != nil {
+		return "", fmt.Errorf("marshal response: %w", err)
+	}
+	return s.Sign(payload, key), nil
+}
@@ -0,0 +1,76 @@
+package grpcapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func TestConvert_RoundTrip(t *testing.T) {
+	v := 1.5
+	h := models.NewHistogram([]float64{1, 2})
+	h.Observe(1.5)
+	in := []models.Metrics{
+		{ID: "g", MType: models.GaugeType, Value: &v, Labels: models.Labels{"host": "a"}},
+		{ID: "h", MType: models.HistogramType, Histogram: h},
+	}
+	for _, m := range in {
+		got := FromProto(ToProto(&m))
+		if got.Key() != m.Key() || got.MType != m.MType {
+			t.Fatalf("round trip mismatch: %+v vs %+v", got, m)
+		}
+		if m.Value != nil && *got.Value != *m.Value {
+			t.Fatalf("value lost: %+v", got)
+		}
+		if m.Histogram != nil && (got.Histogram.Count != 1 || got.Histogram.Counts[1] != 1) {
+			t.Fatalf("histogram lost: %+v", got.Histogram)
+		}
+	}
+}
+
+func TestSealOpen_SignedAndEncrypted(t *testing.T) {
+	const key = sign.SignKey("secret")
+	d := int64(3)
+	metrics := []*metricspb.Metric{{Id: "c", Type: string(models.CounterType), Delta: &d}}
+
+	req, err := SealRequest(metrics, key, &test.FakeEncryptor{EncryptedKey: "wrapped"})
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if len(req.GetMetrics()) != 0 || len(req.GetEncrypted()) == 0 || req.GetHash() == "" {
+		t.Fatalf("request not sealed: %+v", req)
+	}
+
+	if err := OpenRequest(req, sign.NewSignerSHA256(), key, &test.FakeDecryptor{}); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(req.GetMetrics()) != 1 || req.GetMetrics()[0].GetDelta() != 3 || req.GetEncryptedKey() != "" {
+		t.Fatalf("unexpected opened request: %+v", req)
+	}
+}
+
+func TestOpenRequest_Errors(t *testing.T) {
+	const key = sign.SignKey("secret")
+	v := 1.0
+	metrics := []*metricspb.Metric{{Id: "g", Type: string(models.GaugeType), Value: &v}}
+
+	req, _ := SealRequest(metrics, key, nil)
+	req.Metrics[0].Id = "tampered"
+	if err := OpenRequest(req, sign.NewSignerSHA256(), key, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("want ErrInvalidSignature, got %v", err)
+	}
+
+	req, _ = SealRequest(metrics, "", &test.FakeEncryptor{EncryptedKey: "wrapped"})
+	if err := OpenRequest(req, sign.NewSignerSHA256(), "", nil); !errors.Is(err, ErrDecryptorMissing) {
+		t.Fatalf("want ErrDecryptorMissing, got %v", err)
+	}
+
+	unsigned := &metricspb.UpdateMetricsRequest{Metrics: metrics}
+	if err := OpenRequest(unsigned, sign.NewSignerSHA256(), key, nil); err != nil {
+		t.Fatalf("unsigned request must be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// trustedUnaryInterceptor rejects clients outside the trusted subnet, the gRPC counterpart of subnet.Middleware.
+func trustedUnaryInterceptor(t subnet.Trusted) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !t.Allows(clientIP(ctx)) {
+			return nil, status.Error(codes.PermissionDenied, subnet.ErrUntrusted.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// trustedStreamInterceptor applies trustedUnaryInterceptor to streams.
+func trustedStreamInterceptor(t subnet.Trusted) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !t.Allows(clientIP(ss.Context())) {
+			return status.Error(codes.PermissionDenied, subnet.ErrUntrusted.Error())
+		}
+		return handler(srv, ss)
+	}
+}
+
+// clientIP prefers the address reported by the agent and falls back to the connection peer.
+func clientIP(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(grpcapi.RealIPMetadataKey); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+	return peerIP(ctx)
+}
+
+// envelopeUnaryInterceptor opens sealed requests and signs responses, the gRPC counterpart of
+// cryptoutil.Middleware and sign.Middleware.
+func envelopeUnaryInterceptor(s sign.Signer, key sign.SignKey, dec cryptoutil.Decryptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if r, ok := req.(*metricspb.UpdateMetricsRequest); ok {
+			if err := grpcapi.OpenRequest(r, s, key, dec); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := resp.(proto.Message); ok {
+			sig, err := grpcapi.SignResponse(m, s, key)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			if sig != "" {
+				_ = grpc.SetHeader(ctx, metadata.Pairs(grpcapi.HashMetadataKey, sig))
+			}
+		}
+		return resp, nil
+	}
+}
+
+// envelopeStreamInterceptor applies envelopeUnaryInterceptor to every message of a stream.
+func envelopeStreamInterceptor(s sign.Signer, key sign.SignKey, dec cryptoutil.Decryptor) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &envelopeStream{ServerStream: ss, signer: s, key: key, dec: dec})
+	}
+}
+
+type envelopeStream struct {
+	grpc.ServerStream
+	signer sign.Signer
+	key    sign.SignKey
+	dec    cryptoutil.Decryptor
+}
+
+func (e *envelopeStream) RecvMsg(m any) error {
+	if err := e.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if r, ok := m.(*metricspb.UpdateMetricsRequest); ok {
+		if err := grpcapi.OpenRequest(r, e.signer, e.key, e.dec); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return nil
+}
+
+func (e *envelopeStream) SendMsg(m any) error {
+	if pm, ok := m.(proto.Message); ok {
+		sig, err := grpcapi.SignResponse(pm, e.signer, e.key)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if sig != "" {
+			_ = e.ServerStream.SetHeader(metadata.Pairs(grpcapi.HashMetadataKey, sig))
+		}
+	}
+	return e.ServerStream.SendMsg(m)
+}
+
+// auditUnaryInterceptor publishes an audit event once an update RPC succeeds, like audit.Middleware.
+func auditUnaryInterceptor(pub audit.Publisher, l logger.Logger, clock audit.Clock) grpc.UnaryServerInterceptor {
+	if pub == nil {
+		return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			return handler(ctx, req)
+		}
+	}
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			if r, ok := req.(*metricspb.UpdateMetricsRequest); ok {
+				publish(ctx, pub, l, clock, metricIDs(nil, r))
+			}
+		}
+		return resp, err
+	}
+}
+
+// auditStreamInterceptor publishes a single audit event covering every metric received on a successful stream.
+func auditStreamInterceptor(pub audit.Publisher, l logger.Logger, clock audit.Clock) grpc.StreamServerInterceptor {
+	if pub == nil {
+		return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, ss)
+		}
+	}
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		as := &auditStream{ServerStream: ss}
+		err := handler(srv, as)
+		if err == nil {
+			publish(ss.Context(), pub, l, clock, as.ids)
+		}
+		return err
+	}
+}
+
+type auditStream struct {
+	grpc.ServerStream
+	ids []string
+}
+
+func (a *auditStream) RecvMsg(m any) error {
+	if err := a.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if r, ok := m.(*metricspb.UpdateMetricsRequest); ok {
+		a.ids = metricIDs(a.ids, r)
+	}
+	return nil
+}
+
+func metricIDs(dst []string, r *metricspb.UpdateMetricsRequest) []string {
+	for _, m := range r.GetMetrics() {
+		if m.GetId() != "" {
+			dst = append(dst, m.GetId())
+		}
+	}
+	return dst
+}
+
+func publish(ctx context.Context, pub audit.Publisher, l logger.Logger, clock audit.Clock, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	now := time.Now()
+	if clock != nil {
+		now = clock.Now()
+	}
+	event := audit.Event{
+		Timestamp: now.Unix(),
+		Metrics:   ids,
+		IPAddress: peerIP(ctx),
+	}
+	if err := pub.Publish(ctx, event); err != nil && l != nil {
+		l.WriteError("audit publish failed", "error", err)
+	}
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
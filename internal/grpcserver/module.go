@@ -0,0 +1,9 @@
+package grpcserver
+
+import "go.uber.org/fx"
+
+// Module provides the gRPC server; it is started by the server lifecycle when an address is configured.
+var Module = fx.Module(
+	"grpcserver",
+	fx.Provide(New),
+)
@@ -0,0 +1,184 @@
+// Package grpcserver exposes the metrics update API over gRPC, next to the Gin HTTP server.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Config describes the gRPC listener. An empty Address disables the gRPC server.
+type Config struct {
+	Address string
+}
+
+// Server implements the Metrics gRPC service on top of the metric service.
+type Server struct {
+	metricspb.UnimplementedMetricsServer
+
+	service     service.MetricServiceInterface
+	afterUpdate func()
+	addr        string
+	grpc        *grpc.Server
+}
+
+// Params lists the dependencies of the gRPC server; they mirror the HTTP middleware chain.
+type Params struct {
+	fx.In
+	Config    Config
+	Service   service.MetricServiceInterface
+	Logger    logger.Logger
+	Signer    sign.Signer
+	Key       sign.SignKey
+	Audit     audit.Publisher      `optional:"true"`
+	Clock     audit.Clock          `optional:"true"`
+	Decryptor cryptoutil.Decryptor `optional:"true"`
+	Trusted   subnet.Trusted       `optional:"true"`
+}
+
+// New constructs the gRPC server, or returns nil when no address is configured.
+// Clients outside the trusted subnet are rejected, requests are decrypted and their signature verified, responses are signed and successful updates are audited,
+// exactly like the HTTP API.
+func New(p Params) *Server {
+	if p.Config.Address == "" {
+		return nil
+	}
+	s := &Server{service: p.Service, addr: p.Config.Address}
+	s.grpc = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			trustedUnaryInterceptor(p.Trusted),
+			envelopeUnaryInterceptor(p.Signer, p.Key, p.Decryptor),
+			auditUnaryInterceptor(p.Audit, p.Logger, p.Clock),
+		),
+		grpc.ChainStreamInterceptor(
+			trustedStreamInterceptor(p.Trusted),
+			envelopeStreamInterceptor(p.Signer, p.Key, p.Decryptor),
+			auditStreamInterceptor(p.Audit, p.Logger, p.Clock),
+		),
+	)
+	metricspb.RegisterMetricsServer(s.grpc, s)
+	return s
+}
+
+// Address returns the configured listen address.
+func (s *Server) Address() string { return s.addr }
+
+// Serve accepts connections on lis until the server is stopped.
+func (s *Server) Serve(lis net.Listener) error {
+	err := s.grpc.Serve(lis)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown waits for in-flight RPCs to finish and forcibly closes the remaining ones once ctx is done.
+func (s *Server) Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.grpc.Stop()
+	}
+}
+
+// SetAfterUpdateHook installs a callback that is executed after each successful update.
+func (s *Server) SetAfterUpdateHook(fn func()) { s.afterUpdate = fn }
+
+// UpdateMetrics stores a batch of metrics.
+func (s *Server) UpdateMetrics(ctx context.Context, req *metricspb.UpdateMetricsRequest) (*metricspb.UpdateMetricsResponse, error) {
+	n, err := s.update(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &metricspb.UpdateMetricsResponse{Accepted: n}, nil
+}
+
+// StreamMetrics stores every received batch until the client closes the stream.
+func (s *Server) StreamMetrics(stream grpc.ClientStreamingServer[metricspb.UpdateMetricsRequest, metricspb.UpdateMetricsResponse]) error {
+	var total uint64
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&metricspb.UpdateMetricsResponse{Accepted: total})
+		}
+		if err != nil {
+			return err
+		}
+		n, err := s.update(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+}
+
+func (s *Server) update(ctx context.Context, req *metricspb.UpdateMetricsRequest) (uint64, error) {
+	if len(req.GetMetrics()) == 0 {
+		return 0, nil
+	}
+	instance := requestInstance(ctx)
+	metrics := make([]models.Metrics, len(req.GetMetrics()))
+	for i, p := range req.GetMetrics() {
+		metrics[i] = grpcapi.FromProto(p)
+		if metrics[i].ID == "" || !metrics[i].MType.IsValid() {
+			return 0, status.Errorf(codes.InvalidArgument, "metric %q: id and a valid type are required", metrics[i].ID)
+		}
+		metrics[i].WithInstance(instance)
+	}
+	if err := s.service.ProcessUpdates(ctx, metrics); err != nil {
+		return 0, status.Error(errorCode(err), err.Error())
+	}
+	if s.afterUpdate != nil {
+		s.afterUpdate()
+	}
+	return uint64(len(metrics)), nil
+}
+
+// errorCode maps request cancellation and storage backend failures onto gRPC codes;
+// anything else is a problem with the submitted metrics.
+func errorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, storage.ErrStorageUnavailable):
+		return codes.Unavailable
+	case errors.Is(err, storage.ErrStorageFailure):
+		return codes.Internal
+	}
+	return codes.InvalidArgument
+}
+
+func requestInstance(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(grpcapi.InstanceMetadataKey); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package grpcserver_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcserver"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sender"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testKey = sign.SignKey("secret")
+
+func startServer(t *testing.T, pub audit.Publisher) (string, service.MetricServiceInterface) {
+	t.Helper()
+	svc := service.NewMetricService(storage.NewMemStorage())
+	srv := grpcserver.New(grpcserver.Params{
+		Config:    grpcserver.Config{Address: "127.0.0.1:0"},
+		Service:   svc,
+		Logger:    &test.FakeLogger{},
+		Signer:    sign.NewSignerSHA256(),
+		Key:       testKey,
+		Audit:     pub,
+		Decryptor: &test.FakeDecryptor{},
+	})
+	lis, err := net.Listen("tcp", srv.Address())
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return lis.Addr().String(), svc
+}
+
+func TestNew_DisabledWithoutAddress(t *testing.T) {
+	if srv := grpcserver.New(grpcserver.Params{}); srv != nil {
+		t.Fatalf("expected nil server when no address is configured")
+	}
+}
+
+func TestGRPC_SenderRoundTrip(t *testing.T) {
+	pub := &test.FakePublisher[audit.Event]{}
+	addr, svc := startServer(t, pub)
+
+	s, err := sender.NewGRPCSender(addr, &test.FakeLogger{}, testKey, &test.FakeEncryptor{EncryptedKey: "wrapped"})
+	if err != nil {
+		t.Fatalf("new sender: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	s.SetInstance("host-1")
+
+	g := 2.5
+	d := int64(4)
+	metrics := []*models.Metrics{
+		{ID: "Alloc", MType: models.GaugeType, Value: &g},
+		{ID: "PollCount", MType: models.CounterType, Delta: &d},
+	}
+	s.SendBatch(metrics)
+	s.Send(metrics)
+
+	key := models.SeriesKey("PollCount", models.Labels{models.InstanceLabel: "host-1"})
+	got, err := svc.ProcessGetValue(context.Background(), key, models.CounterType)
+	if err != nil {
+		t.Fatalf("counter not stored: %v", err)
+	}
+	if *got.Delta != 8 {
+		t.Fatalf("want counter 8 after batch and stream, got %d", *got.Delta)
+	}
+
+	events := pub.GetEvents()
+	if len(events) != 2 || len(events[0].Metrics) != 2 || events[0].IPAddress != "127.0.0.1" {
+		t.Fatalf("unexpected audit events: %+v", events)
+	}
+}
+
+func TestGRPC_RejectsBadSignatureAndSignsResponse(t *testing.T) {
+	addr, _ := startServer(t, nil)
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := metricspb.NewMetricsClient(conn)
+
+	v := 1.0
+	req := &metricspb.UpdateMetricsRequest{
+		Metrics: []*metricspb.Metric{{Id: "g", Type: string(models.GaugeType), Value: &v}},
+		Hash:    "bogus",
+	}
+	_, err = client.UpdateMetrics(context.Background(), req)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("want InvalidArgument, got %v", err)
+	}
+
+	req, _ = grpcapi.SealRequest(req.GetMetrics(), testKey, nil)
+	var header metadata.MD
+	resp, err := client.UpdateMetrics(context.Background(), req, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	want, _ := grpcapi.SignResponse(resp, sign.NewSignerSHA256(), testKey)
+	if got := header.Get(grpcapi.HashMetadataKey); len(got) != 1 || got[0] != want {
+		t.Fatalf("response signature %v, want %q", got, want)
+	}
+
+	bad := &metricspb.UpdateMetricsRequest{Metrics: []*metricspb.Metric{{Id: "g", Type: "bogus"}}}
+	if _, err := client.UpdateMetrics(context.Background(), bad); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("want InvalidArgument for invalid metric, got %v", err)
+	}
+}
+
+func TestGRPC_RejectsUntrustedClient(t *testing.T) {
+	trusted, _ := subnet.ParseTrusted("10.0.0.0/8")
+	srv := grpcserver.New(grpcserver.Params{
+		Config:  grpcserver.Config{Address: "127.0.0.1:0"},
+		Service: &test.FakeMetricService{},
+		Logger:  &test.FakeLogger{},
+		Signer:  sign.NewSignerSHA256(),
+		Trusted: trusted,
+	})
+	lis, err := net.Listen("tcp", srv.Address())
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := metricspb.NewMetricsClient(conn)
+
+	if _, err := client.UpdateMetrics(context.Background(), &metricspb.UpdateMetricsRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("loopback peer must be rejected, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), grpcapi.RealIPMetadataKey, "10.1.2.3")
+	if _, err := client.UpdateMetrics(ctx, &metricspb.UpdateMetricsRequest{}); err != nil {
+		t.Fatalf("trusted real ip must be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+)
+
+// deleteResponse reports how many of the requested metrics existed and were removed.
+type deleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// RegisterDelete registers the endpoints that remove metrics and reset counters.
+func (h *GinHandler) RegisterDelete(r *gin.Engine) {
+	r.DELETE("/value/:type/:name", func(c *gin.Context) {
+		h.DeleteValuePlain(c)
+	})
+
+	r.DELETE("/values", func(c *gin.Context) {
+		h.DeleteValuesJSON(c)
+	})
+
+	r.POST("/reset/counter/:name", func(c *gin.Context) {
+		h.ResetCounter(c)
+	})
+}
+
+// DeleteValuePlain handles DELETE /value/:type/:name requests and responds with 404 when the metric does not exist.
+// The name is a series key; the instance query parameter scopes it to a single agent instance.
+func (h *GinHandler) DeleteValuePlain(c *gin.Context) {
+	ref := &models.Metrics{ID: c.Param("name"), MType: models.MetricType(c.Param("type"))}
+	if !ref.MType.IsValid() {
+		abortPlainError(c, http.StatusNotFound, models.ErrMetricInvalidType, ref)
+		return
+	}
+
+	key, err := instanceKey(c, ref.ID)
+	if err == nil && key == "" {
+		err = models.ErrMetricUnknownName
+	}
+	if err != nil {
+		abortPlainError(c, http.StatusBadRequest, err, ref)
+		return
+	}
+	m := models.Metrics{MType: ref.MType}
+	m.SetKey(key)
+
+	n, err := h.service.ProcessDelete(requestContext(c), []models.Metrics{m})
+	if err != nil {
+		abortPlainError(c, deleteStatus(err), err, ref)
+		return
+	}
+	if n == 0 {
+		abortPlainError(c, http.StatusNotFound, service.ErrMetricNotFound, ref)
+		return
+	}
+
+	audit.SetRequestAction(c, audit.ActionDelete)
+	audit.AddRequestMetrics(c, c.Param("name"))
+	if h.afterUpdate != nil {
+		h.afterUpdate()
+	}
+	c.String(http.StatusOK, "ok")
+}
+
+// DeleteValuesJSON handles DELETE /values requests whose JSON body lists the metrics to remove by id, type and labels.
+// Protocol Buffers and MessagePack bodies are accepted too; the response is always JSON.
+// Metrics that do not exist are skipped; the response reports how many were removed.
+func (h *GinHandler) DeleteValuesJSON(c *gin.Context) {
+	cd, ok := requestCodec(c)
+	if !ok {
+		return
+	}
+	var metrics []models.Metrics
+	if err := cd.Decode(c.Request.Body, &metrics); err != nil {
+		abortError(c, http.StatusBadRequest, fmt.Errorf("%w: %w", errMalformedBody, err), nil)
+		return
+	}
+	instance := requestInstance(c)
+	for i := range metrics {
+		metrics[i].WithInstance(instance)
+	}
+
+	n, err := h.service.ProcessDelete(requestContext(c), metrics)
+	if err != nil {
+		abortError(c, deleteStatus(err), err, nil)
+		return
+	}
+
+	audit.SetRequestAction(c, audit.ActionDelete)
+	for i := range metrics {
+		audit.AddRequestMetrics(c, metrics[i].ID)
+	}
+	if n > 0 && h.afterUpdate != nil {
+		h.afterUpdate()
+	}
+	c.JSON(http.StatusOK, deleteResponse{Deleted: n})
+}
+
+// ResetCounter handles POST /reset/counter/:name requests that set an existing counter to zero.
+func (h *GinHandler) ResetCounter(c *gin.Context) {
+	ref := &models.Metrics{ID: c.Param("name"), MType: models.CounterType}
+	key, err := instanceKey(c, ref.ID)
+	if err == nil && key == "" {
+		err = models.ErrMetricUnknownName
+	}
+	if err != nil {
+		abortPlainError(c, http.StatusBadRequest, err, ref)
+		return
+	}
+
+	err = h.service.ProcessResetCounter(requestContext(c), key)
+	switch {
+	case errors.Is(err, service.ErrMetricNotFound):
+		abortPlainError(c, http.StatusNotFound, err, ref)
+		return
+	case err != nil:
+		abortPlainError(c, http.StatusBadRequest, err, ref)
+		return
+	}
+
+	audit.SetRequestAction(c, audit.ActionReset)
+	audit.AddRequestMetrics(c, c.Param("name"))
+	if h.afterUpdate != nil {
+		h.afterUpdate()
+	}
+	c.String(http.StatusOK, "ok")
+}
+
+// deleteStatus is the status of a failed deletion.
+func deleteStatus(err error) int {
+	if errors.Is(err, service.ErrDeleteUnsupported) {
+		return http.StatusNotImplemented
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func newDeleteRouter(s service.MetricServiceInterface, pub audit.Publisher) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(audit.Middleware(pub, nil, nil))
+	newTestGinHandler(s).RegisterDelete(r)
+	return r
+}
+
+func doRequest(r *gin.Engine, method, url, body, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDeleteValuePlain(t *testing.T) {
+	st := storage.NewMemStorage()
+	st.UpdateGauge(`g{instance="a"}`, 1)
+	pub := &test.FakePublisher[audit.Event]{}
+	r := newDeleteRouter(service.NewMetricService(st), pub)
+
+	if w := doRequest(r, http.MethodDelete, "/value/gauge/g?instance=a", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d", w.Code)
+	}
+	if _, err := st.GetGauge(`g{instance="a"}`); err == nil {
+		t.Fatalf("instance series must be removed")
+	}
+	if w := doRequest(r, http.MethodDelete, "/value/gauge/g?instance=a", "", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("second delete: status %d, want 404", w.Code)
+	}
+	if w := doRequest(r, http.MethodDelete, "/value/bogus/g", "", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("invalid type: status %d, want 404", w.Code)
+	}
+
+	events := pub.GetEvents()
+	if len(events) != 1 || events[0].Action != audit.ActionDelete || events[0].Metrics[0] != "g" {
+		t.Fatalf("want one delete audit event, got %+v", events)
+	}
+}
+
+func TestDeleteValuesJSON(t *testing.T) {
+	fs := &test.FakeMetricService{}
+	pub := &test.FakePublisher[audit.Event]{}
+	r := newDeleteRouter(fs, pub)
+
+	body := `[{"id":"g","type":"gauge"},{"id":"c","type":"counter"}]`
+	w := doRequest(r, http.MethodDelete, "/values", body, "application/json")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"deleted":2}` {
+		t.Fatalf("batch delete: %d %s", w.Code, w.Body.String())
+	}
+	if len(fs.Deleted) != 2 || fs.Deleted[1].MType != models.CounterType {
+		t.Fatalf("service got %+v", fs.Deleted)
+	}
+	if events := pub.GetEvents(); len(events) != 1 || len(events[0].Metrics) != 2 || events[0].Action != audit.ActionDelete {
+		t.Fatalf("want one delete audit event for both metrics, got %+v", events)
+	}
+
+	if w := doRequest(r, http.MethodDelete, "/values", body, "text/plain"); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("content type: status %d", w.Code)
+	}
+	unsupported := newDeleteRouter(service.NewMetricService(test.NewFakeStorage()), nil)
+	if w := doRequest(unsupported, http.MethodDelete, "/values", body, "application/json"); w.Code != http.StatusNotImplemented {
+		t.Fatalf("backend without deletion: status %d, want 501", w.Code)
+	}
+}
+
+func TestResetCounter(t *testing.T) {
+	st := storage.NewMemStorage()
+	st.UpdateCounter("c", 9)
+	pub := &test.FakePublisher[audit.Event]{}
+	r := newDeleteRouter(service.NewMetricService(st), pub)
+
+	if w := doRequest(r, http.MethodPost, "/reset/counter/c", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("reset: status %d", w.Code)
+	}
+	if v, _ := st.GetCounter("c"); v != 0 {
+		t.Fatalf("counter must be zero, got %d", v)
+	}
+	if w := doRequest(r, http.MethodPost, "/reset/counter/missing", "", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing counter: status %d, want 404", w.Code)
+	}
+	if events := pub.GetEvents(); len(events) != 1 || events[0].Action != audit.ActionReset {
+		t.Fatalf("want one reset audit event, got %+v", events)
+	}
+}
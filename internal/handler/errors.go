@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/schema"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
+)
+
+// Error codes reported in ErrorResponse.Code.
+const (
+	CodeBadRequest            = "bad_request"
+	CodeUnsupportedMediaType  = "unsupported_media_type"
+	CodeInvalidName           = "invalid_name"
+	CodeInvalidType           = "invalid_type"
+	CodeInvalidValue          = "invalid_value"
+	CodeMissingValue          = "missing_value"
+	CodeAmbiguousValue        = "ambiguous_value"
+	CodeTypeMismatch          = "type_mismatch"
+	CodeInvalidLabel          = "invalid_label"
+	CodeInvalidHistogram      = "invalid_histogram"
+	CodeInvalidQuery          = "invalid_query"
+	CodeInvalidIdempotencyKey = "invalid_idempotency_key"
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"
+	CodeInvalidSignature      = "invalid_signature"
+	CodeDecryptionFailed      = "decryption_failed"
+	CodeBodyTooLarge          = "body_too_large"
+	CodeForbidden             = "forbidden"
+	CodeSchemaViolation       = "schema_violation"
+	CodeNotFound              = "not_found"
+	CodeNotImplemented        = "not_implemented"
+	CodeRequestCanceled       = "request_canceled"
+	CodeTimeout               = "timeout"
+	CodeStorageUnavailable    = "storage_unavailable"
+	CodeStorageFailure        = "storage_failure"
+	CodeInternal              = "internal"
+)
+
+// ErrorResponse is the body of every error reply of the HTTP API.
+// Field names the offending request field and ID the metric, when they are known;
+// Violations lists the schema violations of a rejected update.
+type ErrorResponse struct {
+	Code       string             `json:"code"`
+	Message    string             `json:"message"`
+	Field      string             `json:"field,omitempty"`
+	ID         string             `json:"id,omitempty"`
+	Violations []schema.Violation `json:"violations,omitempty"`
+}
+
+var (
+	errUnsupportedStreamType = errors.New("content type must be " + NDJSONContentType)
+	errUnsupportedBodyType   = errors.New("content type must be " + strings.Join(codec.ContentTypes(), ", "))
+	errMalformedBody         = errors.New("malformed request body")
+	errInvalidQuery          = errors.New("invalid query parameter")
+	errStreamUnavailable     = errors.New("update stream is not enabled")
+)
+
+// valueField stands for the value field of the metric type: value, delta or histogram.
+const valueField = "value"
+
+// errorCodes maps error classes onto codes and the request field they concern; the first match wins.
+var errorCodes = []struct {
+	err         error
+	code, field string
+}{
+	{context.Canceled, CodeRequestCanceled, ""},
+	{context.DeadlineExceeded, CodeTimeout, ""},
+	{storage.ErrStorageUnavailable, CodeStorageUnavailable, ""},
+	{storage.ErrStorageFailure, CodeStorageFailure, ""},
+	{idempotency.ErrStoreUnavailable, CodeStorageUnavailable, ""},
+	{idempotency.ErrInvalidKey, CodeInvalidIdempotencyKey, ""},
+	{idempotency.ErrKeyReused, CodeIdempotencyKeyReused, ""},
+	{idempotency.ErrBodyUnreadable, CodeBadRequest, ""},
+	{subnet.ErrUntrusted, CodeForbidden, ""},
+	{sign.ErrSignatureMismatch, CodeInvalidSignature, ""},
+	{sign.ErrBodyTooLarge, CodeBodyTooLarge, ""},
+	{cryptoutil.ErrDecryptionUnavailable, CodeDecryptionFailed, ""},
+	{cryptoutil.ErrDecryptFailed, CodeDecryptionFailed, ""},
+	{cryptoutil.ErrBodyTooLarge, CodeBodyTooLarge, ""},
+	{schema.ErrSchemaViolation, CodeSchemaViolation, ""},
+	{service.ErrMetricNotFound, CodeNotFound, ""},
+	{service.ErrInvalidListQuery, CodeInvalidQuery, ""},
+	{errInvalidQuery, CodeInvalidQuery, ""},
+	{service.ErrHistoryUnsupported, CodeNotImplemented, ""},
+	{service.ErrHistogramUnsupported, CodeNotImplemented, ""},
+	{service.ErrDeleteUnsupported, CodeNotImplemented, ""},
+	{errStreamUnavailable, CodeNotImplemented, ""},
+	{errUnsupportedStreamType, CodeUnsupportedMediaType, ""},
+	{errUnsupportedBodyType, CodeUnsupportedMediaType, ""},
+	{errMalformedBody, CodeBadRequest, ""},
+	{models.ErrMetricUnknownName, CodeInvalidName, "id"},
+	{models.ErrMetricInvalidType, CodeInvalidType, "type"},
+	{models.ErrMetricNameTypeMismatch, CodeTypeMismatch, "type"},
+	{models.ErrMetricInvalidLabel, CodeInvalidLabel, "labels"},
+	{models.ErrHistogramBucketsMismatch, CodeInvalidHistogram, "histogram"},
+	{models.ErrMetricMissingValue, CodeMissingValue, valueField},
+	{models.ErrMetricAmbiguousValue, CodeAmbiguousValue, valueField},
+	{models.ErrMetricInvalidValueType, CodeInvalidValue, valueField},
+}
+
+// newErrorResponse describes err. m names the metric the request concerns and may be nil;
+// a *models.MetricError in the chain takes precedence over it.
+func newErrorResponse(status int, err error, m *models.Metrics) ErrorResponse {
+	resp := ErrorResponse{Code: statusCode(status), Message: err.Error()}
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			resp.Code, resp.Field = e.code, e.field
+			break
+		}
+	}
+
+	var mtype models.MetricType
+	var me *models.MetricError
+	switch {
+	case errors.As(err, &me):
+		resp.ID, mtype = me.ID, me.Type
+	case m != nil:
+		resp.ID, mtype = m.ID, m.MType
+	}
+	if resp.Field == valueField {
+		switch mtype {
+		case models.CounterType:
+			resp.Field = "delta"
+		case models.HistogramType:
+			resp.Field = "histogram"
+		}
+	}
+
+	var ve *schema.ValidationError
+	if errors.As(err, &ve) {
+		resp.Message = schema.ErrSchemaViolation.Error()
+		resp.Violations = ve.Violations
+	}
+	if status >= http.StatusInternalServerError {
+		// Backend errors may reveal internals, such as SQL statements.
+		resp.Message = http.StatusText(status)
+	}
+	return resp
+}
+
+// requireIDAndType rejects a request metric that does not name the metric and its type.
+func requireIDAndType(m *models.Metrics) error {
+	switch {
+	case m.ID == "":
+		return fmt.Errorf("%w: empty name", models.ErrMetricUnknownName)
+	case m.MType == "":
+		return fmt.Errorf("%w: empty type", models.ErrMetricInvalidType)
+	}
+	return nil
+}
+
+// statusCode is the code of errors that belong to no known class.
+func statusCode(status int) string {
+	switch {
+	case status == http.StatusForbidden:
+		return CodeForbidden
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusRequestEntityTooLarge:
+		return CodeBodyTooLarge
+	case status == http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case status == http.StatusNotImplemented:
+		return CodeNotImplemented
+	case status >= http.StatusInternalServerError:
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// abortError ends the request with the error envelope for err in JSON.
+// Cancellation and storage failures replace status with the one reported by storageStatus.
+func abortError(c *gin.Context, status int, err error, m *models.Metrics) {
+	if s, ok := storageStatus(err); ok {
+		status = s
+	}
+	c.AbortWithStatusJSON(status, newErrorResponse(status, err, m))
+}
+
+// abortMiddlewareError ends a request rejected by one of the request middlewares, e.g. the idempotency
+// or the trusted subnet check, with the error envelope.
+func abortMiddlewareError(c *gin.Context, status int, err error) {
+	abortError(c, status, err, nil)
+}
+
+// abortPlainError is abortError for endpoints that answer in plain text: the envelope is sent as JSON
+// only when the client prefers it through the Accept header, otherwise the body is the error message.
+func abortPlainError(c *gin.Context, status int, err error, m *models.Metrics) {
+	if s, ok := storageStatus(err); ok {
+		status = s
+	}
+	resp := newErrorResponse(status, err, m)
+	if c.Request != nil && c.NegotiateFormat(gin.MIMEPlain, gin.MIMEJSON) == gin.MIMEJSON {
+		c.AbortWithStatusJSON(status, resp)
+		return
+	}
+	c.Abort()
+	c.String(status, resp.Message)
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/schema"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("error body is %q, want JSON: %s", ct, w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func TestNewErrorResponse(t *testing.T) {
+	counter := &models.Metrics{ID: "PollCount", MType: models.CounterType}
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		m      *models.Metrics
+		want   ErrorResponse
+	}{
+		{"invalid type", http.StatusBadRequest, models.ErrMetricInvalidType, &models.Metrics{ID: "a", MType: "x"},
+			ErrorResponse{Code: CodeInvalidType, Message: "invalid metric type", Field: "type", ID: "a"}},
+		{"counter value", http.StatusBadRequest, fmt.Errorf("%w: parse", models.ErrMetricInvalidValueType), counter,
+			ErrorResponse{Code: CodeInvalidValue, Message: "invalid value type for metric: parse", Field: "delta", ID: "PollCount"}},
+		{"attributed", http.StatusBadRequest, &models.MetricError{ID: "lat", Type: models.HistogramType, Err: models.ErrMetricMissingValue}, nil,
+			ErrorResponse{Code: CodeMissingValue, Message: `histogram "lat": missing value for metric`, Field: "histogram", ID: "lat"}},
+		{"not found", http.StatusNotFound, service.ErrMetricNotFound, counter,
+			ErrorResponse{Code: CodeNotFound, Message: "metric not found", ID: "PollCount"}},
+		{"storage", http.StatusServiceUnavailable, fmt.Errorf("%w: dial tcp", storage.ErrStorageUnavailable), nil,
+			ErrorResponse{Code: CodeStorageUnavailable, Message: "Service Unavailable"}},
+		{"unknown", http.StatusBadRequest, fmt.Errorf("boom"), nil,
+			ErrorResponse{Code: CodeBadRequest, Message: "boom"}},
+	}
+	for _, tt := range tests {
+		got := newErrorResponse(tt.status, tt.err, tt.m)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlainErrors_ContentNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	newTestGinHandler(&test.FakeMetricService{}).RegisterUpdate(r)
+
+	w := doRequest(r, http.MethodPost, "/update/counter/PollCount/1.5", "", "")
+	if w.Code != http.StatusBadRequest || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("plain error: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(w.Body.String(), models.ErrMetricInvalidValueType.Error()) {
+		t.Fatalf("plain error body: %q", w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/update/counter/PollCount/1.5", http.NoBody)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	resp := decodeError(t, w)
+	if w.Code != http.StatusBadRequest || resp.Code != CodeInvalidValue || resp.Field != "delta" || resp.ID != "PollCount" {
+		t.Fatalf("negotiated error: %d %+v", w.Code, resp)
+	}
+}
+
+func TestJSONErrors_Envelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	newTestGinHandler(&test.FakeMetricService{Err: storage.ErrStorageUnavailable}).RegisterGetValue(r)
+
+	tests := []struct {
+		name, body, ct string
+		status         int
+		code, field    string
+	}{
+		{"media type", `{}`, "text/plain", http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, ""},
+		{"malformed", `{`, "application/json", http.StatusBadRequest, CodeBadRequest, ""},
+		{"missing id", `{"type":"gauge"}`, "application/json", http.StatusBadRequest, CodeInvalidName, "id"},
+		{"storage", `{"id":"a","type":"gauge"}`, "application/json", http.StatusServiceUnavailable, CodeStorageUnavailable, ""},
+	}
+	for _, tt := range tests {
+		w := doRequest(r, http.MethodPost, "/value", tt.body, tt.ct)
+		resp := decodeError(t, w)
+		if w.Code != tt.status || resp.Code != tt.code || resp.Field != tt.field {
+			t.Fatalf("%s: %d %+v", tt.name, w.Code, resp)
+		}
+	}
+}
+
+func TestMiddlewareErrors_Envelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	trusted, err := subnet.ParseTrusted("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRouter := func(mw gin.HandlerFunc) *gin.Engine {
+		r := gin.New()
+		r.Use(mw)
+		r.POST("/updates", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		r      *gin.Engine
+		header map[string]string
+		status int
+		code   string
+	}{
+		{"untrusted", newRouter(subnet.Middleware(trusted, abortMiddlewareError)),
+			map[string]string{subnet.RealIPHeader: "192.0.2.1"}, http.StatusForbidden, CodeForbidden},
+		{"signature", newRouter(sign.Middleware(sign.NewSignerSHA256(), "k", abortMiddlewareError)),
+			map[string]string{"HashSHA256": "bad"}, http.StatusBadRequest, CodeInvalidSignature},
+		{"decryption", newRouter(cryptoutil.Middleware(nil, abortMiddlewareError)),
+			map[string]string{cryptoutil.CryptoKeyHeader: "key"}, http.StatusBadRequest, CodeDecryptionFailed},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader("[]"))
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		tt.r.ServeHTTP(w, req)
+		resp := decodeError(t, w)
+		if w.Code != tt.status || resp.Code != tt.code {
+			t.Fatalf("%s: %d %+v", tt.name, w.Code, resp)
+		}
+	}
+}
+
+func newSchemaRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	reg, err := schema.Parse([]byte(`{"strict":true,"metrics":[{"name":"Alloc","type":"gauge","min":0}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewMetricService(storage.NewMemStorage())
+	svc.SetSchema(reg)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	newTestGinHandler(svc).RegisterUpdate(r)
+	return r
+}
+
+func TestUpdate_SchemaViolation(t *testing.T) {
+	r := newSchemaRouter(t)
+
+	tests := []struct {
+		name, url, body, ct string
+		wantIDs             []string
+	}{
+		{"plain", "/update/gauge/Alloc/-1", "", "text/plain", []string{"Alloc"}},
+		{"json", "/update/", `{"id":"Other","type":"gauge","value":1}`, "application/json", []string{"Other"}},
+		{"batch", "/updates/", `[{"id":"Alloc","type":"gauge","value":-1},{"id":"Other","type":"gauge","value":1}]`, "application/json", []string{"Alloc", "Other"}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.ct)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, want 400", tt.name, w.Code)
+		}
+		resp := decodeError(t, w)
+		if resp.Code != CodeSchemaViolation || len(resp.Violations) != len(tt.wantIDs) {
+			t.Fatalf("%s: unexpected body %+v", tt.name, resp)
+		}
+		for i, id := range tt.wantIDs {
+			if resp.Violations[i].ID != id {
+				t.Fatalf("%s: violation %d is for %q, want %q", tt.name, i, resp.Violations[i].ID, id)
+			}
+		}
+	}
+
+	if w := doRequest(r, http.MethodPost, "/update/gauge/Alloc/5", "", "text/plain"); w.Code != http.StatusOK {
+		t.Fatalf("conforming update: status %d", w.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
+)
+
+// requestCodec returns the codec selected by the Content-Type of the request,
+// or aborts with 415 when the format is not supported.
+func requestCodec(c *gin.Context) (codec.Codec, bool) {
+	cd, ok := codec.ForContentType(c.GetHeader("Content-Type"))
+	if !ok {
+		abortError(c, http.StatusUnsupportedMediaType, errUnsupportedBodyType, nil)
+	}
+	return cd, ok
+}
+
+// responseCodec returns the codec of the response: the format preferred by the Accept header,
+// or the format of the request when the client accepts any of them or none.
+func responseCodec(c *gin.Context, req codec.Codec) codec.Codec {
+	offered := append([]string{req.ContentType()}, codec.ContentTypes()...)
+	if cd, ok := codec.ForContentType(c.NegotiateFormat(offered...)); ok {
+		return cd
+	}
+	return req
+}
+
+// render writes v in the format of the codec. Errors are still reported as JSON.
+func render(c *gin.Context, status int, cd codec.Codec, v any) {
+	body, err := cd.Marshal(v)
+	if err != nil {
+		abortError(c, http.StatusInternalServerError, fmt.Errorf("encode response: %w", err), nil)
+		return
+	}
+	c.Data(status, cd.ContentType(), body)
+}
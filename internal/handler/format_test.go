@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+)
+
+func newFormatRouter() (*gin.Engine, *storage.MemStorage) {
+	gin.SetMode(gin.TestMode)
+	st := storage.NewMemStorage()
+	h := newTestGinHandler(service.NewMetricService(st))
+	r := gin.New()
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+	return r, st
+}
+
+func postCodec(t *testing.T, r http.Handler, path string, cd codec.Codec, accept string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := cd.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", cd.ContentType())
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeCodec(t *testing.T, w *httptest.ResponseRecorder, cd codec.Codec, v any) {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != cd.ContentType() {
+		t.Fatalf("Content-Type = %q, want %q: %s", ct, cd.ContentType(), w.Body.String())
+	}
+	if err := cd.Decode(w.Body, v); err != nil {
+		t.Fatalf("decode %s response: %v", cd.ContentType(), err)
+	}
+}
+
+func TestBinaryFormats_UpdateUpdatesValue(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.Protobuf, codec.MsgPack} {
+		r, st := newFormatRouter()
+
+		value := 2.5
+		w := postCodec(t, r, "/update", cd, "", models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: &value})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: /update status %d: %s", cd.ContentType(), w.Code, w.Body.String())
+		}
+		var m models.Metrics
+		decodeCodec(t, w, cd, &m)
+		if m.ID != "Alloc" || m.Value == nil || *m.Value != value {
+			t.Fatalf("%s: /update response %+v", cd.ContentType(), m)
+		}
+
+		d1, d2 := int64(2), int64(3)
+		batch := []models.Metrics{
+			{ID: "PollCount", MType: models.CounterType, Delta: &d1},
+			{ID: "PollCount", MType: models.CounterType, Delta: &d2},
+		}
+		w = postCodec(t, r, "/updates", cd, "", batch)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: /updates status %d: %s", cd.ContentType(), w.Code, w.Body.String())
+		}
+		var list []models.Metrics
+		decodeCodec(t, w, cd, &list)
+		if len(list) != 2 {
+			t.Fatalf("%s: /updates response %+v", cd.ContentType(), list)
+		}
+		if v, _ := st.GetCounter("PollCount"); v != 5 {
+			t.Fatalf("%s: counter = %d", cd.ContentType(), v)
+		}
+
+		w = postCodec(t, r, "/value", cd, "", models.Metrics{ID: "PollCount", MType: models.CounterType})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: /value status %d: %s", cd.ContentType(), w.Code, w.Body.String())
+		}
+		m = models.Metrics{}
+		decodeCodec(t, w, cd, &m)
+		if m.Delta == nil || *m.Delta != 5 {
+			t.Fatalf("%s: /value response %+v", cd.ContentType(), m)
+		}
+	}
+}
+
+func TestBinaryFormats_AcceptSelectsResponse(t *testing.T) {
+	r, _ := newFormatRouter()
+	value := 1.0
+	m := models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: &value}
+
+	tests := []struct {
+		accept string
+		want   codec.Codec
+	}{
+		{"application/msgpack", codec.MsgPack},
+		{"application/json", codec.JSON},
+		{"application/msgpack, application/x-protobuf", codec.MsgPack},
+		{"*/*", codec.Protobuf},
+		{"text/plain", codec.Protobuf},
+	}
+	for _, tt := range tests {
+		w := postCodec(t, r, "/update", codec.Protobuf, tt.accept, m)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status %d", tt.accept, w.Code)
+		}
+		var got models.Metrics
+		decodeCodec(t, w, tt.want, &got)
+		if got.ID != "Alloc" {
+			t.Fatalf("Accept %q: response %+v", tt.accept, got)
+		}
+	}
+}
+
+func TestBinaryFormats_ListAndDelete(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.Protobuf, codec.MsgPack} {
+		r, st := newFormatRouter()
+		h := newTestGinHandler(service.NewMetricService(st))
+		h.RegisterValues(r)
+		h.RegisterDelete(r)
+		st.UpdateGauge("Alloc", 1)
+		st.UpdateGauge("HeapAlloc", 2)
+
+		var query []byte
+		switch cd {
+		case codec.Protobuf:
+			query, _ = proto.Marshal(&metricspb.ListQuery{Ids: []string{"Alloc"}})
+		case codec.MsgPack:
+			query, _ = msgpack.Marshal(map[string]any{"ids": []string{"Alloc"}})
+		}
+		req := httptest.NewRequest(http.MethodPost, "/values", bytes.NewReader(query))
+		req.Header.Set("Content-Type", cd.ContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: POST /values status %d: %s", cd.ContentType(), w.Code, w.Body.String())
+		}
+		var list []models.Metrics
+		decodeCodec(t, w, cd, &list)
+		if len(list) != 1 || list[0].ID != "Alloc" {
+			t.Fatalf("%s: POST /values response %+v", cd.ContentType(), list)
+		}
+
+		body, err := cd.Marshal([]models.Metrics{{ID: "HeapAlloc", MType: models.GaugeType}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = httptest.NewRequest(http.MethodDelete, "/values", bytes.NewReader(body))
+		req.Header.Set("Content-Type", cd.ContentType())
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != `{"deleted":1}` {
+			t.Fatalf("%s: DELETE /values: %d %s", cd.ContentType(), w.Code, w.Body.String())
+		}
+		if _, err := st.GetGauge("HeapAlloc"); err == nil {
+			t.Fatalf("%s: HeapAlloc must be deleted", cd.ContentType())
+		}
+	}
+}
+
+func TestBinaryFormats_ErrorsStayJSON(t *testing.T) {
+	r, _ := newFormatRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/update", bytes.NewBufferString("\xff\xff"))
+	req.Header.Set("Content-Type", codec.MediaTypeProtobuf)
+	req.Header.Set("Accept", codec.MediaTypeProtobuf)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if resp := decodeError(t, w); resp.Code != CodeBadRequest {
+		t.Fatalf("unexpected body %+v", resp)
+	}
+
+	w = postCodec(t, r, "/value", codec.MsgPack, "", models.Metrics{ID: "missing", MType: models.GaugeType})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if resp := decodeError(t, w); resp.Code != CodeNotFound {
+		t.Fatalf("unexpected body %+v", resp)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/updates", bytes.NewBufferString("x"))
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if resp := decodeError(t, w); w.Code != http.StatusUnsupportedMediaType || resp.Code != CodeUnsupportedMediaType {
+		t.Fatalf("status %d, body %+v", w.Code, resp)
+	}
+}
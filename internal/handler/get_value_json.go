@@ -1,44 +1,44 @@
 package handler
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
 )
 
-// GetValueJSON handles POST /value requests returning the metric value as JSON.
+// GetValueJSON handles POST /value requests returning the metric value as JSON,
+// or as Protocol Buffers or MessagePack as selected by Content-Type and Accept.
 func (h *GinHandler) GetValueJSON(c *gin.Context) {
-	if !strings.HasPrefix(c.GetHeader("Content-Type"), "application/json") {
-		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+	cd, ok := requestCodec(c)
+	if !ok {
 		return
 	}
 
 	var q models.Metrics
-	if err := json.NewDecoder(c.Request.Body).Decode(&q); err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+	if err := cd.Decode(c.Request.Body, &q); err != nil {
+		abortError(c, http.StatusBadRequest, fmt.Errorf("%w: %w", errMalformedBody, err), nil)
 		return
 	}
 
-	if q.ID == "" || q.MType == "" {
-		c.AbortWithStatus(http.StatusBadRequest)
+	if err := requireIDAndType(&q); err != nil {
+		abortError(c, http.StatusBadRequest, err, &q)
 		return
 	}
 
-	metric, err := h.service.ProcessGetValue(q.ID, q.MType)
+	q.WithInstance(requestInstance(c))
+	metric, err := h.service.ProcessGetValue(requestContext(c), q.Key(), q.MType)
 	switch {
 	case errors.Is(err, service.ErrMetricNotFound), errors.Is(err, models.ErrMetricUnknownName):
-		c.AbortWithStatus(http.StatusNotFound)
+		abortError(c, http.StatusNotFound, err, &q)
 		return
 	case err != nil:
-		c.AbortWithStatus(http.StatusBadRequest)
+		abortError(c, http.StatusBadRequest, err, &q)
 		return
 	}
 
-	c.Header("Content-Type", "application/json")
-	c.JSON(http.StatusOK, metric)
+	render(c, http.StatusOK, responseCodec(c, cd), metric)
 }
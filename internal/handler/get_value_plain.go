@@ -11,50 +11,55 @@ import (
 )
 
 // GetValuePlain handles GET /value/:type/:name requests returning metric values as plain text.
+// Histograms have no scalar value and are returned as a JSON object instead.
+// The instance query parameter reads the value reported by a single agent instance.
 func (h *GinHandler) GetValuePlain(c *gin.Context) {
-	metricType := models.MetricType(c.Param("type"))
-	if !metricType.IsValid() {
-		c.AbortWithStatus(http.StatusNotFound)
+	ref := &models.Metrics{ID: c.Param("name"), MType: models.MetricType(c.Param("type"))}
+	if !ref.MType.IsValid() {
+		abortPlainError(c, http.StatusNotFound, models.ErrMetricInvalidType, ref)
 		return
 	}
 
-	metricName := c.Param("name")
-	if metricName == "" {
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
+	metricName, err := instanceKey(c, ref.ID)
+	if err == nil && metricName == "" {
+		err = models.ErrMetricUnknownName
 	}
-
-	v, err := h.service.ProcessGetValue(metricName, metricType)
-	if errors.Is(err, models.ErrMetricInvalidType) {
-		c.AbortWithStatus(http.StatusNotFound)
+	if err != nil {
+		abortPlainError(c, http.StatusBadRequest, err, ref)
 		return
 	}
 
-	if errors.Is(err, service.ErrMetricNotFound) {
-		c.AbortWithStatus(http.StatusNotFound)
+	v, err := h.service.ProcessGetValue(requestContext(c), metricName, ref.MType)
+	switch {
+	case errors.Is(err, models.ErrMetricInvalidType), errors.Is(err, service.ErrMetricNotFound):
+		abortPlainError(c, http.StatusNotFound, err, ref)
 		return
-	}
-
-	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+	case err != nil:
+		abortPlainError(c, http.StatusBadRequest, err, ref)
 		return
 	}
 
 	switch v.MType {
 	case models.GaugeType:
 		if v.Value == nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortPlainError(c, http.StatusInternalServerError, models.ErrMetricMissingValue, ref)
 			return
 		}
 		c.String(http.StatusOK, strconv.FormatFloat(*v.Value, 'f', -1, 64))
 	case models.CounterType:
 		if v.Delta == nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
+			abortPlainError(c, http.StatusInternalServerError, models.ErrMetricMissingValue, ref)
 			return
 		}
 		c.String(http.StatusOK, strconv.FormatInt(*v.Delta, 10))
+	case models.HistogramType:
+		if v.Histogram == nil {
+			abortPlainError(c, http.StatusInternalServerError, models.ErrMetricMissingValue, ref)
+			return
+		}
+		c.JSON(http.StatusOK, v.Histogram)
 	default:
-		c.AbortWithStatus(http.StatusBadRequest)
+		abortPlainError(c, http.StatusBadRequest, models.ErrMetricInvalidType, ref)
 		return
 	}
 
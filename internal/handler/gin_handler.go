@@ -8,9 +8,12 @@ import (
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
 )
 
 // GinHandler exposes HTTP handlers that implement the metrics API using Gin.
@@ -19,6 +22,7 @@ type GinHandler struct {
 	afterUpdate func()
 	logger      logger.Logger
 	jsonPool    *jsonMetricsPool
+	broker      *stream.Broker
 }
 
 // NewGinHandler constructs a GinHandler that proxies requests to the provided metric service.
@@ -47,6 +51,10 @@ func (h *GinHandler) RegisterUpdate(r *gin.Engine) {
 		h.UpdatesJSON(c)
 	})
 
+	r.POST("/updates/stream", func(c *gin.Context) {
+		h.UpdatesStream(c)
+	})
+
 	r.POST("/update/:type/:name/:value", func(c *gin.Context) {
 		h.UpdatePlain(c)
 	})
@@ -67,6 +75,13 @@ func (h *GinHandler) RegisterGetValue(r *gin.Engine) {
 	})
 }
 
+// RegisterMetrics registers the Prometheus scrape endpoint that exposes every stored metric.
+func (h *GinHandler) RegisterMetrics(r *gin.Engine) {
+	r.GET("/metrics", func(c *gin.Context) {
+		h.MetricsPrometheus(c)
+	})
+}
+
 // RegisterPing registers the database liveness endpoint that responds with HTTP 200 when the pool is ready.
 func (h *GinHandler) RegisterPing(r *gin.Engine, pool db.Pool) {
 	r.GET("/ping", func(c *gin.Context) {
@@ -78,6 +93,11 @@ func (h *GinHandler) RegisterPing(r *gin.Engine, pool db.Pool) {
 func RegisterRoutes(r *gin.Engine, h *GinHandler, pool db.Pool) {
 	h.RegisterUpdate(r)
 	h.RegisterGetValue(r)
+	h.RegisterValues(r)
+	h.RegisterDelete(r)
+	h.RegisterStream(r)
+	h.RegisterMetrics(r)
+	h.RegisterHistory(r)
 	h.RegisterInfo(r)
 	if pool != nil {
 		h.RegisterPing(r, pool)
@@ -96,21 +116,30 @@ func register(p struct {
 	Clock audit.Clock          `optional:"true"`
 	Pool  db.Pool              `optional:"true"`
 	D     cryptoutil.Decryptor `optional:"true"`
+	T     subnet.Trusted       `optional:"true"`
+	B     *stream.Broker       `optional:"true"`
+	I     idempotency.Store    `optional:"true"`
 }) {
 	p.H.SetLogger(p.L)
+	p.H.SetBroker(p.B)
 	p.R.Use(logger.Middleware(p.L))
-	p.R.Use(cryptoutil.Middleware(p.D))
-	p.R.Use(sign.Middleware(p.S, p.K))
+	p.R.Use(subnet.Middleware(p.T, abortMiddlewareError))
+	p.R.Use(cryptoutil.Middleware(p.D, abortMiddlewareError))
+	p.R.Use(sign.Middleware(p.S, p.K, abortMiddlewareError))
 	p.R.Use(compression.Middleware(p.C))
 	if p.A != nil {
 		p.R.Use(audit.Middleware(p.A, p.L, p.Clock))
 	}
+	p.R.Use(idempotency.Middleware(p.I, p.L, abortMiddlewareError))
 	RegisterRoutes(p.R, p.H, p.Pool)
 }
 
 // SetAfterUpdateHook installs a callback that is executed after each successful update request.
 func (h *GinHandler) SetAfterUpdateHook(fn func()) { h.afterUpdate = fn }
 
+// SetBroker installs the broker that feeds the live update stream.
+func (h *GinHandler) SetBroker(b *stream.Broker) { h.broker = b }
+
 // SetLogger configures the structured logger used by the handler.
 func (h *GinHandler) SetLogger(l logger.Logger) { h.logger = l }
 
@@ -2,7 +2,7 @@ package handler
 
 import (
 	"bytes"
-	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -11,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
@@ -38,50 +39,68 @@ func setupBenchmarkServer(b *testing.B) (*httptest.Server, *http.Client) {
 	return server, client
 }
 
-func BenchmarkGinHandlerUpdateJSONNetwork(b *testing.B) {
-	server, client := setupBenchmarkServer(b)
-
-	value := 123.456
-	metric := models.Metrics{
-		ID:    "Alloc",
-		MType: models.GaugeType,
-		Value: &value,
-	}
+// benchmarkCodecs lists the body formats compared by the benchmarks.
+var benchmarkCodecs = []struct {
+	name  string
+	codec codec.Codec
+}{
+	{"json", codec.JSON},
+	{"protobuf", codec.Protobuf},
+	{"msgpack", codec.MsgPack},
+}
 
-	payload, err := json.Marshal(metric)
-	if err != nil {
-		b.Fatalf("failed to marshal metric: %v", err)
-	}
+// benchmarkPost posts v to path in every format, each in its own sub-benchmark.
+func benchmarkPost(b *testing.B, path string, v any) {
+	server, client := setupBenchmarkServer(b)
 
-	endpoint, err := url.JoinPath(server.URL, "update")
+	endpoint, err := url.JoinPath(server.URL, path)
 	if err != nil {
 		b.Fatalf("failed to build request URL: %v", err)
 	}
 
-	b.ReportAllocs()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
-		if err != nil {
-			b.Fatalf("failed to create request: %v", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := client.Do(req)
-		if err != nil {
-			b.Fatalf("failed to send request: %v", err)
-		}
-
-		_ = resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			b.Fatalf("unexpected status: %s", resp.Status)
-		}
+	for _, bc := range benchmarkCodecs {
+		b.Run(bc.name, func(b *testing.B) {
+			payload, err := bc.codec.Marshal(v)
+			if err != nil {
+				b.Fatalf("failed to marshal payload: %v", err)
+			}
+			b.SetBytes(int64(len(payload)))
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+				if err != nil {
+					b.Fatalf("failed to create request: %v", err)
+				}
+				req.Header.Set("Content-Type", bc.codec.ContentType())
+				req.Header.Set("Accept", bc.codec.ContentType())
+
+				resp, err := client.Do(req)
+				if err != nil {
+					b.Fatalf("failed to send request: %v", err)
+				}
+
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					b.Fatalf("unexpected status: %s", resp.Status)
+				}
+			}
+		})
 	}
 }
 
-func BenchmarkGinHandlerUpdatesJSONNetwork(b *testing.B) {
-	server, client := setupBenchmarkServer(b)
+func BenchmarkGinHandlerUpdateJSONNetwork(b *testing.B) {
+	value := 123.456
+	benchmarkPost(b, "update", models.Metrics{
+		ID:    "Alloc",
+		MType: models.GaugeType,
+		Value: &value,
+	})
+}
 
+func BenchmarkGinHandlerUpdatesJSONNetwork(b *testing.B) {
 	metrics := make([]models.Metrics, 0, len(models.GaugeNames)+len(models.CounterNames))
 	for i, name := range models.GaugeNames {
 		value := float64(i)
@@ -101,33 +120,5 @@ func BenchmarkGinHandlerUpdatesJSONNetwork(b *testing.B) {
 		})
 	}
 
-	payload, err := json.Marshal(metrics)
-	if err != nil {
-		b.Fatalf("failed to marshal metrics: %v", err)
-	}
-
-	endpoint, err := url.JoinPath(server.URL, "updates")
-	if err != nil {
-		b.Fatalf("failed to build request URL: %v", err)
-	}
-
-	b.ReportAllocs()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
-		if err != nil {
-			b.Fatalf("failed to create request: %v", err)
-		}
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := client.Do(req)
-		if err != nil {
-			b.Fatalf("failed to send request: %v", err)
-		}
-
-		_ = resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			b.Fatalf("unexpected status: %s", resp.Status)
-		}
-	}
+	benchmarkPost(b, "updates", metrics)
 }
@@ -13,11 +13,14 @@ import (
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 	"go.uber.org/fx"
 )
@@ -191,6 +194,9 @@ func Test_register_AddsMiddlewareAndRegisters(t *testing.T) {
 		Clock audit.Clock          `optional:"true"`
 		Pool  db.Pool              `optional:"true"`
 		D     cryptoutil.Decryptor `optional:"true"`
+		T     subnet.Trusted       `optional:"true"`
+		B     *stream.Broker       `optional:"true"`
+		I     idempotency.Store    `optional:"true"`
 	}{R: r, H: h, L: l, C: c, S: sign.NewSignerSHA256(), K: "", D: nil})
 
 	if len(r.Handlers) == 0 {
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+)
+
+// DefaultHistoryWindow is the range returned by /history when "from" is omitted.
+const DefaultHistoryWindow = time.Hour
+
+type historyResponse struct {
+	ID      string            `json:"id"`
+	MType   models.MetricType `json:"type"`
+	From    time.Time         `json:"from"`
+	To      time.Time         `json:"to"`
+	Step    string            `json:"step,omitempty"`
+	Samples []models.Sample   `json:"samples"`
+}
+
+// GetHistory handles GET /history/:type/:name?from=&to=&step= requests returning recorded samples as JSON.
+// from and to accept RFC 3339 timestamps or unix seconds, step accepts Go durations or seconds.
+func (h *GinHandler) GetHistory(c *gin.Context) {
+	ref := &models.Metrics{ID: c.Param("name"), MType: models.MetricType(c.Param("type"))}
+	metricType := ref.MType
+	if !metricType.IsValid() {
+		abortError(c, http.StatusNotFound, models.ErrMetricInvalidType, ref)
+		return
+	}
+
+	metricName, err := instanceKey(c, ref.ID)
+	if err == nil && metricName == "" {
+		err = models.ErrMetricUnknownName
+	}
+	if err != nil {
+		abortError(c, http.StatusBadRequest, err, ref)
+		return
+	}
+
+	to := time.Now().UTC()
+	if raw := c.Query("to"); raw != "" {
+		t, err := parseHistoryTime(raw)
+		if err != nil {
+			abortError(c, http.StatusBadRequest, fmt.Errorf("%w: to: %w", errInvalidQuery, err), ref)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-DefaultHistoryWindow)
+	if raw := c.Query("from"); raw != "" {
+		t, err := parseHistoryTime(raw)
+		if err != nil {
+			abortError(c, http.StatusBadRequest, fmt.Errorf("%w: from: %w", errInvalidQuery, err), ref)
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		abortError(c, http.StatusBadRequest, fmt.Errorf("%w: from is after to", errInvalidQuery), ref)
+		return
+	}
+
+	var step time.Duration
+	if raw := c.Query("step"); raw != "" {
+		d, err := parseHistoryStep(raw)
+		if err != nil {
+			abortError(c, http.StatusBadRequest, fmt.Errorf("%w: step: %w", errInvalidQuery, err), ref)
+			return
+		}
+		step = d
+	}
+
+	samples, err := h.service.ProcessGetHistory(requestContext(c), metricName, metricType, from, to, step)
+	switch {
+	case errors.Is(err, service.ErrHistoryUnsupported):
+		abortError(c, http.StatusNotImplemented, err, ref)
+		return
+	case errors.Is(err, models.ErrMetricInvalidType):
+		abortError(c, http.StatusNotFound, err, ref)
+		return
+	case err != nil:
+		abortError(c, http.StatusInternalServerError, err, ref)
+		return
+	}
+	if samples == nil {
+		samples = []models.Sample{}
+	}
+
+	resp := historyResponse{ID: metricName, MType: metricType, From: from, To: to, Samples: samples}
+	if step > 0 {
+		resp.Step = step.String()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RegisterHistory registers the metric history range query endpoint.
+func (h *GinHandler) RegisterHistory(r *gin.Engine) {
+	r.GET("/history/:type/:name", h.GetHistory)
+}
+
+func parseHistoryTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %q", raw)
+}
+
+func parseHistoryStep(raw string) (time.Duration, error) {
+	if d, err := time.ParseDuration(raw); err == nil && d >= 0 {
+		return d, nil
+	}
+	if sec, err := strconv.Atoi(raw); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, nil
+	}
+	return 0, fmt.Errorf("invalid step: %q", raw)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func newHistoryRouter(s service.MetricServiceInterface) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	newTestGinHandler(s).RegisterHistory(r)
+	return r
+}
+
+func TestGetHistory_Success(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := 1.5
+	fs := &test.FakeMetricService{History: []models.Sample{{Timestamp: ts, Value: &v}}}
+
+	w := test.DoGET(newHistoryRouter(fs), "/history/gauge/Alloc?from=2025-01-01T00:00:00Z&to=1735693200&step=1m", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		ID      string            `json:"id"`
+		MType   models.MetricType `json:"type"`
+		From    time.Time         `json:"from"`
+		To      time.Time         `json:"to"`
+		Step    string            `json:"step"`
+		Samples []models.Sample   `json:"samples"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.ID != "Alloc" || resp.MType != models.GaugeType || resp.Step != "1m0s" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if !resp.From.Equal(ts) || !resp.To.Equal(ts.Add(time.Hour)) {
+		t.Fatalf("unexpected range: %v..%v", resp.From, resp.To)
+	}
+	if len(resp.Samples) != 1 || *resp.Samples[0].Value != v {
+		t.Fatalf("unexpected samples: %+v", resp.Samples)
+	}
+	if fs.Metric.ID != "Alloc" || fs.Metric.MType != models.GaugeType {
+		t.Fatalf("service called with %+v", fs.Metric)
+	}
+}
+
+func TestGetHistory_EmptySamplesIsArray(t *testing.T) {
+	w := test.DoGET(newHistoryRouter(&test.FakeMetricService{}), "/history/counter/PollCount", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp map[string]json.RawMessage
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if string(resp["samples"]) != "[]" {
+		t.Fatalf("want empty array, got %s", resp["samples"])
+	}
+}
+
+func TestGetHistory_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		url  string
+		svc  *test.FakeMetricService
+		want int
+	}{
+		{"unknown type", "/history/bogus/x", &test.FakeMetricService{}, http.StatusNotFound},
+		{"bad from", "/history/gauge/x?from=yesterday", &test.FakeMetricService{}, http.StatusBadRequest},
+		{"bad to", "/history/gauge/x?to=tomorrow", &test.FakeMetricService{}, http.StatusBadRequest},
+		{"bad step", "/history/gauge/x?step=-5", &test.FakeMetricService{}, http.StatusBadRequest},
+		{"reversed", "/history/gauge/x?from=200&to=100", &test.FakeMetricService{}, http.StatusBadRequest},
+		{"unsupported", "/history/gauge/x", &test.FakeMetricService{Err: service.ErrHistoryUnsupported}, http.StatusNotImplemented},
+		{"storage", "/history/gauge/x", &test.FakeMetricService{Err: errors.New("boom")}, http.StatusInternalServerError},
+		{"storage unavailable", "/history/gauge/x", &test.FakeMetricService{Err: storage.ErrStorageUnavailable}, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := test.DoGET(newHistoryRouter(tc.svc), tc.url, "")
+			if w.Code != tc.want {
+				t.Fatalf("want %d, got %d", tc.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestGetHistory_MemStorageNotImplemented(t *testing.T) {
+	svc := service.NewMetricService(storage.NewMemStorage())
+	w := test.DoGET(newHistoryRouter(svc), "/history/gauge/Alloc", "")
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("want 501, got %d", w.Code)
+	}
+}
@@ -1,14 +1,238 @@
 package handler
 
 import (
+	"bytes"
+	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 )
 
-// Info responds with a minimal HTML page for the service root.
+const (
+	// DefaultDashboardRefresh is the auto-refresh period of the dashboard in seconds.
+	DefaultDashboardRefresh = 10
+	maxDashboardRefresh     = 3600
+)
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Metrics</title>
+{{- if gt .Refresh 0}}
+<meta http-equiv="refresh" content="{{.Refresh}}">
+{{- end}}
+<style>
+body{font-family:sans-serif;margin:2em}
+table{border-collapse:collapse}
+th,td{border:1px solid #ccc;padding:4px 8px;text-align:left}
+th a{color:inherit}
+td.num{text-align:right;font-family:monospace}
+</style>
+</head>
+<body>
+<h1>Metrics</h1>
+<form method="get" action="/">
+<input type="text" name="q" value="{{.Query}}" placeholder="filter by name">
+<input type="text" name="instance" value="{{.Instance}}" placeholder="instance">
+<select name="type">
+<option value=""{{if eq .Type ""}} selected{{end}}>all types</option>
+{{- range .Types}}
+<option value="{{.}}"{{if eq $.Type (print .)}} selected{{end}}>{{.}}</option>
+{{- end}}
+</select>
+<input type="hidden" name="sort" value="{{.Sort}}">
+<input type="hidden" name="order" value="{{.Order}}">
+<input type="hidden" name="refresh" value="{{.Refresh}}">
+<button type="submit">Apply</button>
+</form>
+<p>{{len .Rows}} of {{.Total}} metrics</p>
+<table>
+<thead>
+<tr>
+{{- range .Columns}}
+<th><a href="{{.Link}}">{{.Title}}{{.Arrow}}</a></th>
+{{- end}}
+</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr><td>{{.Name}}</td><td>{{.Type}}</td><td class="num">{{.Value}}</td><td>{{.UpdatedAt}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+type dashboardRow struct {
+	Name      string
+	Type      models.MetricType
+	Value     string
+	UpdatedAt string
+
+	num     float64
+	updated time.Time
+}
+
+type dashboardColumn struct {
+	Title string
+	Link  string
+	Arrow string
+}
+
+type dashboardView struct {
+	Query    string
+	Instance string
+	Type     string
+	Sort     string
+	Order    string
+	Refresh  int
+	Total    int
+	Types    []models.MetricType
+	Columns  []dashboardColumn
+	Rows     []dashboardRow
+}
+
+var dashboardColumns = []struct{ key, title string }{
+	{"name", "Name"},
+	{"type", "Type"},
+	{"value", "Value"},
+	{"updated", "Updated at"},
+}
+
+// Info renders an HTML dashboard listing every stored metric.
+// The table is filtered and sorted server-side using the q, instance, type, sort and order query parameters
+// and reloads itself every refresh seconds.
 func (h *GinHandler) Info(c *gin.Context) {
-	c.Data(http.StatusOK, gin.MIMEHTML, []byte("<html><body></body></html>"))
+	metrics, err := h.service.ProcessGetAll(requestContext(c))
+	if err != nil {
+		abortPlainError(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+	times, err := h.service.ProcessGetUpdateTimes(requestContext(c))
+	if err != nil {
+		abortPlainError(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	view := dashboardView{
+		Query:    c.Query("q"),
+		Instance: requestInstance(c),
+		Type:     c.Query("type"),
+		Sort:     c.DefaultQuery("sort", "name"),
+		Order:    c.DefaultQuery("order", "asc"),
+		Refresh:  DefaultDashboardRefresh,
+		Types:    models.MetricTypes,
+	}
+	metrics = filterInstance(metrics, view.Instance)
+	view.Total = len(metrics)
+	if v, err := strconv.Atoi(c.Query("refresh")); err == nil && v >= 0 && v <= maxDashboardRefresh {
+		view.Refresh = v
+	}
+	if view.Order != "desc" {
+		view.Order = "asc"
+	}
+
+	query := strings.ToLower(view.Query)
+	for i := range metrics {
+		m := &metrics[i]
+		if view.Type != "" && string(m.MType) != view.Type {
+			continue
+		}
+		key := m.Key()
+		if query != "" && !strings.Contains(strings.ToLower(key), query) {
+			continue
+		}
+		row := dashboardRow{Name: key, Type: m.MType}
+		switch {
+		case m.Value != nil:
+			row.num = *m.Value
+			row.Value = strconv.FormatFloat(*m.Value, 'f', -1, 64)
+		case m.Delta != nil:
+			row.num = float64(*m.Delta)
+			row.Value = strconv.FormatInt(*m.Delta, 10)
+		case m.Histogram != nil:
+			row.num = float64(m.Histogram.Count)
+			row.Value = fmt.Sprintf("count=%d sum=%s", m.Histogram.Count, strconv.FormatFloat(m.Histogram.Sum, 'f', -1, 64))
+		}
+		if ts, ok := times[m.MType][key]; ok {
+			row.updated = ts
+			row.UpdatedAt = ts.UTC().Format(time.RFC3339)
+		}
+		view.Rows = append(view.Rows, row)
+	}
+	sortDashboardRows(view.Rows, view.Sort, view.Order == "desc")
+
+	for _, col := range dashboardColumns {
+		order := "asc"
+		arrow := ""
+		if col.key == view.Sort {
+			if view.Order == "asc" {
+				order = "desc"
+				arrow = " ▲"
+			} else {
+				arrow = " ▼"
+			}
+		}
+		q := url.Values{}
+		q.Set("q", view.Query)
+		if view.Instance != "" {
+			q.Set(InstanceQueryParam, view.Instance)
+		}
+		q.Set("type", view.Type)
+		q.Set("sort", col.key)
+		q.Set("order", order)
+		q.Set("refresh", strconv.Itoa(view.Refresh))
+		view.Columns = append(view.Columns, dashboardColumn{Title: col.title, Link: "/?" + q.Encode(), Arrow: arrow})
+	}
+
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, view); err != nil {
+		abortPlainError(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+	c.Data(http.StatusOK, gin.MIMEHTML+"; charset=utf-8", buf.Bytes())
+}
+
+func sortDashboardRows(rows []dashboardRow, key string, desc bool) {
+	less := func(a, b *dashboardRow) bool { return a.Name < b.Name }
+	switch key {
+	case "type":
+		less = func(a, b *dashboardRow) bool {
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+			return a.Name < b.Name
+		}
+	case "value":
+		less = func(a, b *dashboardRow) bool {
+			if a.num != b.num {
+				return a.num < b.num
+			}
+			return a.Name < b.Name
+		}
+	case "updated":
+		less = func(a, b *dashboardRow) bool {
+			if !a.updated.Equal(b.updated) {
+				return a.updated.Before(b.updated)
+			}
+			return a.Name < b.Name
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if desc {
+			return less(&rows[j], &rows[i])
+		}
+		return less(&rows[i], &rows[j])
+	})
 }
 
 // RegisterInfo registers the root informational endpoint.
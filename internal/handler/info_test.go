@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	pgxmock "github.com/pashagolub/pgxmock/v4"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func newInfoRouter(s service.MetricServiceInterface) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	newTestGinHandler(s).RegisterInfo(r)
+	return r
+}
+
+func dashboardNames(body string) []string {
+	re := regexp.MustCompile(`<tr><td>([^<]*)</td>`)
+	var names []string
+	for _, m := range re.FindAllStringSubmatch(body, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+func TestInfo_ListsAllMetricsSortedByName(t *testing.T) {
+	st := storage.NewMemStorage()
+	st.UpdateGauge("Zeta", 1)
+	st.UpdateGauge("Alpha", 3.5)
+	st.UpdateCounter("PollCount", 4)
+
+	w := test.DoGET(newInfoRouter(service.NewMetricService(st)), "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body := w.Body.String()
+	if got := strings.Join(dashboardNames(body), ","); got != "Alpha,PollCount,Zeta" {
+		t.Fatalf("unexpected rows order: %s", got)
+	}
+	if !strings.Contains(body, `<meta http-equiv="refresh" content="10">`) {
+		t.Fatalf("missing auto refresh")
+	}
+	if !strings.Contains(body, `<td class="num">3.5</td>`) {
+		t.Fatalf("missing gauge value")
+	}
+}
+
+func TestInfo_FilterSortAndRefresh(t *testing.T) {
+	g1, g2 := 5.0, 1.0
+	d := int64(9)
+	fs := &test.FakeMetricService{All: []models.Metrics{
+		{ID: "HeapAlloc", MType: models.GaugeType, Value: &g1},
+		{ID: "HeapSys", MType: models.GaugeType, Value: &g2},
+		{ID: "HeapCount", MType: models.CounterType, Delta: &d},
+		{ID: "Other", MType: models.GaugeType, Value: &g1},
+	}}
+	r := newInfoRouter(fs)
+
+	w := test.DoGET(r, "/?q=heap&type=gauge&sort=value&order=desc&refresh=0", "")
+	body := w.Body.String()
+	if got := strings.Join(dashboardNames(body), ","); got != "HeapAlloc,HeapSys" {
+		t.Fatalf("unexpected rows: %s", got)
+	}
+	if strings.Contains(body, "http-equiv") {
+		t.Fatalf("refresh=0 must disable auto refresh")
+	}
+
+	w = test.DoGET(r, "/?sort=type", "")
+	if got := strings.Join(dashboardNames(w.Body.String()), ","); got != "HeapCount,HeapAlloc,HeapSys,Other" {
+		t.Fatalf("unexpected rows for type sort: %s", got)
+	}
+}
+
+func TestInfo_EscapesNames(t *testing.T) {
+	v := 1.0
+	fs := &test.FakeMetricService{All: []models.Metrics{{ID: "<script>", MType: models.GaugeType, Value: &v}}}
+	w := test.DoGET(newInfoRouter(fs), "/", "")
+	if strings.Contains(w.Body.String(), "<script>") {
+		t.Fatalf("metric name must be escaped")
+	}
+}
+
+func TestInfo_DBStorageShowsUpdatedAt(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	hts := ts.Add(time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, value FROM gauges`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).AddRow("g", 1.0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, value FROM counters`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, bounds, counts, sum, count FROM histograms`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "bounds", "counts", "sum", "count"}).
+			AddRow("lat", []float64{1}, []int64{2, 0}, 1.5, int64(2)))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, updated_at FROM gauges`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "updated_at"}).AddRow("g", ts))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, updated_at FROM counters`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "updated_at"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, updated_at FROM histograms`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "updated_at"}).AddRow("lat", hts))
+
+	w := test.DoGET(newInfoRouter(service.NewMetricService(storage.NewDBStorage(mock))), "/", "")
+	if !strings.Contains(w.Body.String(), "<td>2025-01-02T03:04:05Z</td>") {
+		t.Fatalf("updated_at not rendered: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `<tr><td>lat</td><td>histogram</td><td class="num">count=2 sum=1.5</td><td>2025-01-02T04:04:05Z</td></tr>`) {
+		t.Fatalf("histogram updated_at not rendered: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestInfo_MemStorageShowsHistogramUpdatedAt(t *testing.T) {
+	st := storage.NewMemStorage()
+	if err := st.UpdateHistogram("lat", *models.NewHistogram([]float64{1})); err != nil {
+		t.Fatal(err)
+	}
+
+	w := test.DoGET(newInfoRouter(service.NewMetricService(st)), "/", "")
+	re := regexp.MustCompile(`<tr><td>lat</td><td>histogram</td><td class="num">count=0 sum=0</td><td>([^<]+)</td></tr>`)
+	m := re.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("histogram row not rendered: %s", w.Body.String())
+	}
+	if _, err := time.Parse(time.RFC3339, m[1]); err != nil {
+		t.Fatalf("histogram updated_at %q: %v", m[1], err)
+	}
+}
+
+func TestInfo_ServiceError(t *testing.T) {
+	fs := &test.FakeMetricService{Err: errors.New("boom")}
+	w := test.DoGET(newInfoRouter(fs), "/", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
+
+func TestInfo_Gzip(t *testing.T) {
+	v := 1.0
+	fs := &test.FakeMetricService{All: []models.Metrics{{ID: "Alloc", MType: models.GaugeType, Value: &v}}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(compression.Middleware(compression.NewGzip(compression.BestSpeed)))
+	newTestGinHandler(fs).RegisterInfo(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip encoding, got %q", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	if !strings.Contains(string(plain), "<td>Alloc</td>") {
+		t.Fatalf("decompressed body misses metric: %s", plain)
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// InstanceQueryParam selects an agent instance on read and listing endpoints.
+const InstanceQueryParam = "instance"
+
+// requestInstance returns the agent instance a request is scoped to.
+// Agents identify themselves with models.InstanceHeader; readers may use the instance query parameter instead.
+func requestInstance(c *gin.Context) string {
+	if c.Request == nil {
+		return ""
+	}
+	if v := c.GetHeader(models.InstanceHeader); v != "" {
+		return v
+	}
+	return c.Query(InstanceQueryParam)
+}
+
+// instanceKey scopes a series key taken from the URL to the request instance.
+func instanceKey(c *gin.Context, key string) (string, error) {
+	instance := requestInstance(c)
+	if instance == "" {
+		return key, nil
+	}
+	name, labels, err := models.ParseSeriesKey(key)
+	if err != nil {
+		return "", err
+	}
+	m := models.Metrics{ID: name, Labels: labels}
+	m.WithInstance(instance)
+	return m.Key(), nil
+}
+
+// filterInstance keeps only metrics reported by the instance; an empty instance keeps everything.
+func filterInstance(metrics []models.Metrics, instance string) []models.Metrics {
+	if instance == "" {
+		return metrics
+	}
+	out := metrics[:0:0]
+	for i := range metrics {
+		if metrics[i].Labels[models.InstanceLabel] == instance {
+			out = append(out, metrics[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func newInstanceRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+	h.RegisterMetrics(r)
+	h.RegisterInfo(r)
+	return r
+}
+
+func postAsInstance(r *gin.Engine, path, instance string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if instance != "" {
+		req.Header.Set(models.InstanceHeader, instance)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestInstance_ScopesWritesAndReads(t *testing.T) {
+	r := newInstanceRouter()
+
+	postAsInstance(r, "/update", "host-a", map[string]any{"id": "Alloc", "type": "gauge", "value": 1})
+	postAsInstance(r, "/updates", "host-b", []map[string]any{{"id": "Alloc", "type": "gauge", "value": 2}})
+	postAsInstance(r, "/update/counter/PollCount/3", "host-a", nil)
+	postAsInstance(r, "/update", "", map[string]any{"id": "Alloc", "type": "gauge", "value": 3})
+
+	for instance, want := range map[string]string{"host-a": "1", "host-b": "2", "": "3"} {
+		w := test.DoGET(r, "/value/gauge/Alloc?instance="+instance, "")
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Fatalf("instance %q: got %d %q, want %q", instance, w.Code, w.Body.String(), want)
+		}
+	}
+
+	w := postAsInstance(r, "/value", "host-b", map[string]any{"id": "Alloc", "type": "gauge"})
+	var got models.Metrics
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Value == nil || *got.Value != 2 || got.Labels[models.InstanceLabel] != "host-b" {
+		t.Fatalf("unexpected JSON value: %+v", got)
+	}
+
+	w = test.DoGET(r, "/metrics?instance=host-a", "")
+	want := "# TYPE Alloc gauge\nAlloc{instance=\"host-a\"} 1\n" +
+		"# TYPE PollCount counter\nPollCount{instance=\"host-a\"} 3\n"
+	if w.Body.String() != want {
+		t.Fatalf("unexpected scrape:\n%s", w.Body.String())
+	}
+
+	w = test.DoGET(r, "/?instance=host-b", "")
+	if rows := dashboardNames(w.Body.String()); len(rows) != 1 || !strings.Contains(rows[0], "host-b") {
+		t.Fatalf("unexpected dashboard rows: %v", rows)
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+)
+
+// NextCursorHeader carries the cursor of the next page of a bulk read; it is absent on the last page.
+const NextCursorHeader = "X-Next-Cursor"
+
+// RegisterValues registers the bulk read endpoints.
+func (h *GinHandler) RegisterValues(r *gin.Engine) {
+	r.GET("/values", func(c *gin.Context) {
+		h.GetValues(c)
+	})
+
+	r.POST("/values", func(c *gin.Context) {
+		h.GetValuesJSON(c)
+	})
+}
+
+// GetValues handles GET /values?type=&id=&prefix=&regex=&limit=&cursor= requests returning the matching metrics as JSON.
+// id may be repeated to select several metric names. The instance header or query parameter
+// keeps the series of one agent instance, as on the other read endpoints.
+func (h *GinHandler) GetValues(c *gin.Context) {
+	opts := models.ListOptions{
+		Type:   models.MetricType(c.Query("type")),
+		IDs:    c.QueryArray("id"),
+		Prefix: c.Query("prefix"),
+		Regex:  c.Query("regex"),
+		Cursor: c.Query("cursor"),
+	}
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			abortError(c, http.StatusBadRequest, fmt.Errorf("%w: invalid limit %q", service.ErrInvalidListQuery, raw), nil)
+			return
+		}
+		opts.Limit = n
+	}
+	h.listValues(c, opts, codec.JSON)
+}
+
+// GetValuesJSON handles POST /values requests whose JSON body carries the filters of GET /values,
+// with the metric names listed in "ids". Protocol Buffers and MessagePack bodies are accepted too,
+// and the metrics are returned in the format negotiated as for the other bulk endpoints.
+func (h *GinHandler) GetValuesJSON(c *gin.Context) {
+	cd, ok := requestCodec(c)
+	if !ok {
+		return
+	}
+	var opts models.ListOptions
+	if err := cd.Decode(c.Request.Body, &opts); err != nil {
+		abortError(c, http.StatusBadRequest, fmt.Errorf("%w: %w", errMalformedBody, err), nil)
+		return
+	}
+	h.listValues(c, opts, responseCodec(c, cd))
+}
+
+func (h *GinHandler) listValues(c *gin.Context, opts models.ListOptions, cd codec.Codec) {
+	if instance := requestInstance(c); instance != "" {
+		opts.Instance = instance
+	}
+	metrics, next, err := h.service.ProcessList(requestContext(c), opts)
+	switch {
+	case errors.Is(err, service.ErrInvalidListQuery):
+		abortError(c, http.StatusBadRequest, err, nil)
+		return
+	case err != nil:
+		abortError(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+	if metrics == nil {
+		metrics = []models.Metrics{}
+	}
+
+	if next != "" {
+		c.Header(NextCursorHeader, next)
+	}
+	render(c, http.StatusOK, cd, metrics)
+}
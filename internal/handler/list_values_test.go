@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func newValuesRouter(s service.MetricServiceInterface) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	newTestGinHandler(s).RegisterValues(r)
+	return r
+}
+
+func TestGetValues(t *testing.T) {
+	st := storage.NewMemStorage()
+	st.UpdateGauge("Alloc", 1)
+	st.UpdateGauge("HeapAlloc", 2)
+	st.UpdateCounter("PollCount", 3)
+	st.UpdateGauge(`Alloc{instance="a"}`, 4)
+	r := newValuesRouter(service.NewMetricService(st))
+
+	w := doRequest(r, http.MethodGet, "/values?limit=1&prefix=", "", "")
+	var page []models.Metrics
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &page) != nil || len(page) != 1 || page[0].ID != "Alloc" {
+		t.Fatalf("first page: %d %s", w.Code, w.Body.String())
+	}
+	next := w.Header().Get(NextCursorHeader)
+	if next == "" {
+		t.Fatalf("next cursor expected")
+	}
+	w = doRequest(r, http.MethodGet, "/values?limit=5&cursor="+next, "", "")
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &page) != nil || len(page) != 3 || w.Header().Get(NextCursorHeader) != "" {
+		t.Fatalf("last page: %d %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(r, http.MethodGet, "/values?type=counter&id=PollCount&id=Alloc", "", "")
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &page) != nil || len(page) != 1 || *page[0].Delta != 3 {
+		t.Fatalf("filtered: %d %s", w.Code, w.Body.String())
+	}
+	w = doRequest(r, http.MethodGet, "/values?instance=a", "", "")
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &page) != nil || len(page) != 1 || *page[0].Value != 4 {
+		t.Fatalf("instance: %d %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(r, http.MethodGet, "/values?regex=^Z", "", ""); w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Fatalf("no match must return an empty list: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, url := range []string{"/values?limit=x", "/values?regex=(", "/values?type=bogus"} {
+		if w := doRequest(r, http.MethodGet, url, "", ""); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, want 400", url, w.Code)
+		}
+	}
+}
+
+func TestGetValuesJSON(t *testing.T) {
+	fs := &test.FakeMetricService{All: []models.Metrics{{ID: "g", MType: models.GaugeType}}, Next: "abc"}
+	r := newValuesRouter(fs)
+
+	w := doRequest(r, http.MethodPost, "/values", `{"ids":["g","h"],"type":"gauge","limit":10}`, "application/json")
+	if w.Code != http.StatusOK || w.Header().Get(NextCursorHeader) != "abc" {
+		t.Fatalf("status %d, cursor %q", w.Code, w.Header().Get(NextCursorHeader))
+	}
+	if len(fs.Listed.IDs) != 2 || fs.Listed.Type != models.GaugeType || fs.Listed.Limit != 10 {
+		t.Fatalf("service got %+v", fs.Listed)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/values", strings.NewReader(`{"instance":"b"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(models.InstanceHeader, "a")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if fs.Listed.Instance != "a" {
+		t.Fatalf("the instance header must scope the listing, got %+v", fs.Listed)
+	}
+
+	if w := doRequest(r, http.MethodPost, "/values", `{}`, "text/plain"); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("content type: status %d", w.Code)
+	}
+	if w := doRequest(r, http.MethodPost, "/values", `[`, "application/json"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad body: status %d", w.Code)
+	}
+	fs.Err = storage.ErrStorageUnavailable
+	if w := doRequest(r, http.MethodPost, "/values", `{}`, "application/json"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("storage down: status %d, want 503", w.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// PrometheusContentType is the media type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricsPrometheus handles GET /metrics requests rendering all stored metrics in Prometheus text format.
+// The optional instance query parameter limits the output to a single agent instance.
+func (h *GinHandler) MetricsPrometheus(c *gin.Context) {
+	metrics, err := h.service.ProcessGetAll(requestContext(c))
+	if err != nil {
+		abortPlainError(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, filterInstance(metrics, requestInstance(c)))
+	c.Data(http.StatusOK, PrometheusContentType, buf.Bytes())
+}
+
+// prometheusFamily collects the series written under one sanitized metric name.
+type prometheusFamily struct {
+	name   string
+	mtype  models.MetricType
+	series []*models.Metrics
+	keys   map[string]struct{}
+}
+
+// writePrometheus writes the metrics grouped into families by sanitized name, in the order the families
+// first appear. Distinct metric IDs may sanitize to the same name: a family keeps the type of its first
+// series, and of the series that end up with the same key only the first is written.
+func writePrometheus(buf *bytes.Buffer, metrics []models.Metrics) {
+	var families []*prometheusFamily
+	byName := make(map[string]*prometheusFamily, len(metrics))
+	for i := range metrics {
+		m := &metrics[i]
+		switch {
+		case m.MType == models.GaugeType && m.Value != nil:
+		case m.MType == models.CounterType && m.Delta != nil:
+		case m.MType == models.HistogramType && m.Histogram != nil:
+		default:
+			continue
+		}
+
+		name := prometheusName(m.ID)
+		f, ok := byName[name]
+		if !ok {
+			f = &prometheusFamily{name: name, mtype: m.MType, keys: make(map[string]struct{})}
+			byName[name] = f
+			families = append(families, f)
+		}
+		if f.mtype != m.MType {
+			continue
+		}
+		key := models.SeriesKey(name, m.Labels)
+		if _, dup := f.keys[key]; dup {
+			continue
+		}
+		f.keys[key] = struct{}{}
+		f.series = append(f.series, m)
+	}
+
+	for _, f := range families {
+		buf.WriteString("# TYPE ")
+		buf.WriteString(f.name)
+		buf.WriteByte(' ')
+		buf.WriteString(string(f.mtype))
+		buf.WriteByte('\n')
+
+		for _, m := range f.series {
+			if m.Histogram != nil {
+				writePrometheusHistogram(buf, f.name, m.Labels, m.Histogram)
+				continue
+			}
+			// Series keys already follow the exposition format: label names are validated and values escaped.
+			buf.WriteString(models.SeriesKey(f.name, m.Labels))
+			buf.WriteByte(' ')
+			if m.MType == models.GaugeType {
+				buf.WriteString(prometheusFloat(*m.Value))
+			} else {
+				buf.WriteString(strconv.FormatInt(*m.Delta, 10))
+			}
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+// writePrometheusHistogram emits cumulative _bucket series followed by _sum and _count.
+func writePrometheusHistogram(buf *bytes.Buffer, name string, labels models.Labels, h *models.Histogram) {
+	bucketLabels := make(models.Labels, len(labels)+1)
+	for k, v := range labels {
+		bucketLabels[k] = v
+	}
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = prometheusFloat(h.Bounds[i])
+		}
+		bucketLabels["le"] = le
+		buf.WriteString(models.SeriesKey(name+"_bucket", bucketLabels))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatUint(cumulative, 10))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(models.SeriesKey(name+"_sum", labels))
+	buf.WriteByte(' ')
+	buf.WriteString(prometheusFloat(h.Sum))
+	buf.WriteByte('\n')
+	buf.WriteString(models.SeriesKey(name+"_count", labels))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatUint(h.Count, 10))
+	buf.WriteByte('\n')
+}
+
+// prometheusName maps an arbitrary metric identifier onto the [a-zA-Z_:][a-zA-Z0-9_:]* alphabet.
+func prometheusName(id string) string {
+	if id == "" {
+		return "_"
+	}
+	out := make([]byte, 0, len(id)+1)
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch == '_', ch == ':':
+			out = append(out, ch)
+		case ch >= '0' && ch <= '9':
+			if i == 0 {
+				out = append(out, '_')
+			}
+			out = append(out, ch)
+		default:
+			out = append(out, '_')
+		}
+	}
+	return string(out)
+}
+
+func prometheusFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
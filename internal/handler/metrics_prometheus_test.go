@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	pgxmock "github.com/pashagolub/pgxmock/v4"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func newMetricsRouter(s service.MetricServiceInterface) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	newTestGinHandler(s).RegisterMetrics(r)
+	return r
+}
+
+func TestMetricsPrometheus_MemStorage(t *testing.T) {
+	st := storage.NewMemStorage()
+	st.UpdateGauge("Alloc", 1.5)
+	st.UpdateGauge("CPU.utilization-1", 42)
+	st.UpdateCounter("PollCount", 7)
+
+	w := test.DoGET(newMetricsRouter(service.NewMetricService(st)), "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != PrometheusContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	want := "# TYPE Alloc gauge\nAlloc 1.5\n" +
+		"# TYPE CPU_utilization_1 gauge\nCPU_utilization_1 42\n" +
+		"# TYPE PollCount counter\nPollCount 7\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("unexpected body:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricsPrometheus_DBStorage(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, value FROM gauges`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).AddRow("HeapAlloc", 12.25))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, value FROM counters`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).AddRow("hits", int64(3)))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, bounds, counts, sum, count FROM histograms`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "bounds", "counts", "sum", "count"}))
+
+	svc := service.NewMetricService(storage.NewDBStorage(mock))
+	w := test.DoGET(newMetricsRouter(svc), "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, line := range []string{"# TYPE HeapAlloc gauge", "HeapAlloc 12.25", "# TYPE hits counter", "hits 3"} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("body %q does not contain %q", body, line)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestMetricsPrometheus_ServiceError(t *testing.T) {
+	fs := &test.FakeMetricService{Err: errors.New("boom")}
+	w := test.DoGET(newMetricsRouter(fs), "/metrics", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
+
+func TestWritePrometheus_TypeConflictAndMissingValues(t *testing.T) {
+	g := 1.0
+	d := int64(2)
+	fs := &test.FakeMetricService{All: []models.Metrics{
+		{ID: "a.b", MType: models.GaugeType, Value: &g},
+		{ID: "a_b", MType: models.CounterType, Delta: &d},
+		{ID: "empty", MType: models.GaugeType},
+		{ID: "9lives", MType: models.CounterType, Delta: &d},
+	}}
+
+	w := test.DoGET(newMetricsRouter(fs), "/metrics", "")
+	want := "# TYPE a_b gauge\na_b 1\n# TYPE _9lives counter\n_9lives 2\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("unexpected body:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWritePrometheus_GroupsBySanitizedName(t *testing.T) {
+	v1, v2, v3, v4 := 1.0, 2.0, 3.0, 4.0
+	fs := &test.FakeMetricService{All: []models.Metrics{
+		{ID: "a.b", MType: models.GaugeType, Value: &v1},
+		{ID: "a_a", MType: models.GaugeType, Value: &v2},
+		{ID: "a_b", MType: models.GaugeType, Value: &v3},
+		{ID: "a_b", MType: models.GaugeType, Value: &v4, Labels: models.Labels{"host": "x"}},
+	}}
+
+	w := test.DoGET(newMetricsRouter(fs), "/metrics", "")
+	want := "# TYPE a_b gauge\na_b 1\na_b{host=\"x\"} 4\n" +
+		"# TYPE a_a gauge\na_a 2\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("unexpected body:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrometheusFloat_Special(t *testing.T) {
+	cases := map[float64]string{math.Inf(1): "+Inf", math.Inf(-1): "-Inf", 0.25: "0.25"}
+	for in, want := range cases {
+		if got := prometheusFloat(in); got != want {
+			t.Errorf("prometheusFloat(%v) = %q, want %q", in, got, want)
+		}
+	}
+	if got := prometheusFloat(math.NaN()); got != "NaN" {
+		t.Errorf("prometheusFloat(NaN) = %q", got)
+	}
+}
+
+func TestMetricsPrometheus_Labels(t *testing.T) {
+	v1, v2 := 1.0, 2.0
+	fs := &test.FakeMetricService{All: []models.Metrics{
+		{ID: "CPU", MType: models.GaugeType, Value: &v1, Labels: models.Labels{"cpu": "0"}},
+		{ID: "CPU", MType: models.GaugeType, Value: &v2, Labels: models.Labels{"cpu": "1", "host": `a"b`}},
+	}}
+	w := test.DoGET(newMetricsRouter(fs), "/metrics", "")
+
+	want := "# TYPE CPU gauge\n" +
+		"CPU{cpu=\"0\"} 1\n" +
+		"CPU{cpu=\"1\",host=\"a\\\"b\"} 2\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("unexpected body:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricsPrometheus_Histogram(t *testing.T) {
+	h := models.NewHistogram([]float64{0.5, 1})
+	h.Observe(0.25)
+	h.Observe(0.75)
+	h.Observe(3)
+	fs := &test.FakeMetricService{All: []models.Metrics{
+		{ID: "lat", MType: models.HistogramType, Histogram: h, Labels: models.Labels{"host": "a"}},
+	}}
+	w := test.DoGET(newMetricsRouter(fs), "/metrics", "")
+
+	want := "# TYPE lat histogram\n" +
+		"lat_bucket{host=\"a\",le=\"0.5\"} 1\n" +
+		"lat_bucket{host=\"a\",le=\"1\"} 2\n" +
+		"lat_bucket{host=\"a\",le=\"+Inf\"} 3\n" +
+		"lat_sum{host=\"a\"} 4\n" +
+		"lat_count{host=\"a\"} 3\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("unexpected body:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -2,16 +2,20 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
 )
 
+var errDatabaseUnavailable = errors.New("database is unavailable")
+
 // Ping handles GET /ping requests by checking database connectivity.
 func (h *GinHandler) Ping(c *gin.Context, pool db.Pool) {
 	if pool == nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+		abortPlainError(c, http.StatusInternalServerError, errDatabaseUnavailable, nil)
 		return
 	}
 
@@ -20,9 +24,9 @@ func (h *GinHandler) Ping(c *gin.Context, pool db.Pool) {
 		ctx = c.Request.Context()
 	}
 
-	err := pool.Ping(ctx)
-	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+	if err := pool.Ping(ctx); err != nil {
+		abortPlainError(c, http.StatusInternalServerError, fmt.Errorf("%w: %w", errDatabaseUnavailable, err), nil)
+		return
 	}
 
 	c.Status(http.StatusOK)
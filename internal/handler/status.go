@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+)
+
+// StatusClientClosedRequest is reported when the client goes away before the request is served.
+// It is not a standard HTTP status; the code follows the nginx convention.
+const StatusClientClosedRequest = 499
+
+// storageStatus maps request cancellation and storage backend failures onto HTTP statuses.
+// It reports false for any other error, which the caller maps according to the endpoint.
+func storageStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, true
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, true
+	case errors.Is(err, storage.ErrStorageUnavailable):
+		return http.StatusServiceUnavailable, true
+	case errors.Is(err, storage.ErrStorageFailure):
+		return http.StatusInternalServerError, true
+	}
+	return 0, false
+}
+
+// requestContext returns the context of the HTTP request, which is cancelled when the client goes away.
+func requestContext(c *gin.Context) context.Context {
+	if c.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
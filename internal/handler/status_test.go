@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func TestStorageStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+		ok   bool
+	}{
+		{context.Canceled, StatusClientClosedRequest, true},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, true},
+		{fmt.Errorf("%w: dial tcp", storage.ErrStorageUnavailable), http.StatusServiceUnavailable, true},
+		{fmt.Errorf("%w: constraint", storage.ErrStorageFailure), http.StatusInternalServerError, true},
+		{errors.New("bad metric"), 0, false},
+		{nil, 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := storageStatus(tc.err)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("storageStatus(%v) = %d, %v; want %d, %v", tc.err, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestUpdateJSON_StorageUnavailable(t *testing.T) {
+	fs := &test.FakeMetricService{Err: fmt.Errorf("%w: connection refused", storage.ErrStorageUnavailable)}
+	r := setupRouterWithUpdateJSON(fs)
+
+	w := test.DoJSON(r, "/update", map[string]any{"id": "g", "type": "gauge", "value": 1.0}, "application/json")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
+)
+
+// streamKeepAlive is how often an idle update stream sends a comment so that proxies keep it open.
+var streamKeepAlive = 15 * time.Second
+
+// RegisterStream registers the live update stream endpoint.
+func (h *GinHandler) RegisterStream(r *gin.Engine) {
+	r.GET("/stream", h.Stream)
+}
+
+// Stream handles GET /stream?type=&regex= requests, pushing every accepted update that matches the filters
+// as a server-sent "metric" event; regex matches the metric name. A client that falls behind, or a server
+// that shuts down, ends the stream with an "error" event.
+func (h *GinHandler) Stream(c *gin.Context) {
+	if h.broker == nil {
+		abortPlainError(c, http.StatusNotImplemented, errStreamUnavailable, nil)
+		return
+	}
+
+	f := stream.Filter{Type: models.MetricType(c.Query("type"))}
+	if f.Type != "" && !f.Type.IsValid() {
+		abortPlainError(c, http.StatusBadRequest, models.ErrMetricInvalidType, &models.Metrics{MType: f.Type})
+		return
+	}
+	if raw := c.Query("regex"); raw != "" {
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			abortPlainError(c, http.StatusBadRequest, fmt.Errorf("%w: regex: %w", errInvalidQuery, err), nil)
+			return
+		}
+		f.Pattern = re
+	}
+
+	sub := h.broker.Subscribe(f)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	done := c.Request.Context().Done()
+	for {
+		select {
+		case m, ok := <-sub.C():
+			if !ok {
+				if err := sub.Err(); err != nil {
+					c.SSEvent("error", err.Error())
+					c.Writer.Flush()
+				}
+				return
+			}
+			c.SSEvent("metric", m)
+		case <-ticker.C:
+			_, _ = io.WriteString(c.Writer, ": keep-alive\n\n")
+		case <-done:
+			return
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+// readEvent returns the next server-sent event from the stream as "event: data".
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event + ": " + data
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	b := stream.NewBroker()
+	svc := service.NewMetricService(storage.NewMemStorage())
+	svc.SetBroker(b)
+
+	r := gin.New()
+	r.Use(sign.Middleware(sign.NewSignerSHA256(), "secret", nil))
+	h := newTestGinHandler(svc)
+	h.SetBroker(b)
+	h.RegisterStream(r)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream?type=gauge&regex=^CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for deadline := time.Now().Add(time.Second); b.Subscribers() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	v, d := 5.0, int64(1)
+	if err := svc.ProcessUpdates(context.Background(), []models.Metrics{
+		{ID: "Alloc", MType: models.GaugeType, Value: &v},
+		{ID: "CPUcount", MType: models.CounterType, Delta: &d},
+		{ID: "CPUutilization1", MType: models.GaugeType, Value: &v},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := bufio.NewReader(resp.Body)
+	if got := readEvent(t, rd); got != `metric: {"id":"CPUutilization1","type":"gauge","value":5}` {
+		t.Fatalf("unexpected event %q", got)
+	}
+	b.Close()
+	if got := readEvent(t, rd); got != "error: "+stream.ErrClosed.Error() {
+		t.Fatalf("unexpected event %q", got)
+	}
+}
+
+func TestStream_BadRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := newTestGinHandler(&test.FakeMetricService{})
+	h.RegisterStream(r)
+	if w := doRequest(r, http.MethodGet, "/stream", "", ""); w.Code != http.StatusNotImplemented {
+		t.Fatalf("without a broker: status %d, want 501", w.Code)
+	}
+
+	h.SetBroker(stream.NewBroker())
+	for _, url := range []string{"/stream?type=bogus", "/stream?regex=("} {
+		if w := doRequest(r, http.MethodGet, url, "", ""); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, want 400", url, w.Code)
+		}
+	}
+}
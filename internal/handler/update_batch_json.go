@@ -1,39 +1,77 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 )
 
+// PartialQueryParam switches POST /updates into partial-success mode when set to true.
+const PartialQueryParam = "partial"
+
+// Statuses of the updates listed in a partial-success response.
+const (
+	BatchItemAccepted = "accepted"
+	BatchItemRejected = "rejected"
+)
+
+// batchItemResult reports the outcome of one update of a partial-success batch.
+type batchItemResult struct {
+	Index  int               `json:"index"`
+	ID     string            `json:"id"`
+	Type   models.MetricType `json:"type"`
+	Status string            `json:"status"`
+	Error  *ErrorResponse    `json:"error,omitempty"`
+}
+
+// batchResponse is the body of a partial-success response; Results follows the order of the request.
+type batchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []batchItemResult `json:"results"`
+}
+
 // UpdatesJSON handles POST /updates requests that submit batches of metrics in JSON format.
+// The batch is applied entirely or rejected as a whole, unless the partial query parameter is true.
+// Protocol Buffers and MessagePack bodies are accepted too; the partial-success response is always JSON.
 func (h *GinHandler) UpdatesJSON(c *gin.Context) {
-	if !strings.HasPrefix(c.GetHeader("Content-Type"), "application/json") {
-		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+	cd, ok := requestCodec(c)
+	if !ok {
 		return
 	}
 	pool := h.jsonMetricsPool()
 	batch := pool.AcquireBatch()
 	defer pool.ReleaseBatch(batch)
 
+	if err := cd.Decode(c.Request.Body, batch); err != nil {
+		abortError(c, http.StatusBadRequest, fmt.Errorf("%w: %w", errMalformedBody, err), nil)
+		return
+	}
 	metrics := *batch
-	if err := json.NewDecoder(c.Request.Body).Decode(&metrics); err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+	partial, err := strconv.ParseBool(c.DefaultQuery(PartialQueryParam, "false"))
+	if err != nil {
+		abortError(c, http.StatusBadRequest, fmt.Errorf("%w: %s: %w", errInvalidQuery, PartialQueryParam, err), nil)
+		return
+	}
+	if partial {
+		h.updatesPartial(c, metrics)
 		return
 	}
-	*batch = metrics
-	metrics = *batch
-	for _, m := range metrics {
-		if m.ID == "" || m.MType == "" {
-			c.AbortWithStatus(http.StatusBadRequest)
+	instance := requestInstance(c)
+	for i := range metrics {
+		if err := requireIDAndType(&metrics[i]); err != nil {
+			abortError(c, http.StatusBadRequest, err, &metrics[i])
 			return
 		}
+		metrics[i].WithInstance(instance)
 	}
-	if err := h.service.ProcessUpdates(metrics); err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+	if err := h.service.ProcessUpdates(requestContext(c), metrics); err != nil {
+		abortError(c, http.StatusBadRequest, err, nil)
 		return
 	}
 
@@ -44,6 +82,65 @@ func (h *GinHandler) UpdatesJSON(c *gin.Context) {
 	if h.afterUpdate != nil {
 		h.afterUpdate()
 	}
-	c.Header("Content-Type", "application/json")
-	c.JSON(http.StatusOK, metrics)
+	render(c, http.StatusOK, responseCodec(c, cd), metrics)
+}
+
+// updatesPartial applies the acceptable updates of a batch and responds with the status of every update:
+// 200 when all of them were accepted, 207 when some were rejected. Only accepted metrics are audited.
+// Storage failures reject the whole batch as in the default mode. A histogram whose stored bounds changed
+// between the check of the batch and its write fails the batch with 409, so the client can resubmit it.
+func (h *GinHandler) updatesPartial(c *gin.Context, metrics []models.Metrics) {
+	resp := batchResponse{Results: make([]batchItemResult, len(metrics))}
+	valid := make([]models.Metrics, 0, len(metrics))
+	index := make([]int, 0, len(metrics))
+	instance := requestInstance(c)
+	for i := range metrics {
+		m := &metrics[i]
+		resp.Results[i] = batchItemResult{Index: i, ID: m.ID, Type: m.MType, Status: BatchItemAccepted}
+		if err := requireIDAndType(m); err != nil {
+			resp.reject(i, err, m)
+			continue
+		}
+		m.WithInstance(instance)
+		valid = append(valid, *m)
+		index = append(index, i)
+	}
+
+	rejected, err := h.service.ProcessUpdatesPartial(requestContext(c), valid)
+	switch {
+	case errors.Is(err, models.ErrHistogramBucketsMismatch):
+		abortError(c, http.StatusConflict, err, nil)
+		return
+	case err != nil:
+		abortError(c, http.StatusInternalServerError, err, nil)
+		return
+	}
+	for j, err := range rejected {
+		if err != nil {
+			resp.reject(index[j], err, &valid[j])
+		}
+	}
+
+	for _, r := range resp.Results {
+		if r.Status == BatchItemAccepted {
+			audit.AddRequestMetrics(c, r.ID)
+		}
+	}
+	resp.Accepted = len(metrics) - resp.Rejected
+	if resp.Accepted > 0 && h.afterUpdate != nil {
+		h.afterUpdate()
+	}
+
+	status := http.StatusOK
+	if resp.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, resp)
+}
+
+func (r *batchResponse) reject(i int, err error, m *models.Metrics) {
+	e := newErrorResponse(http.StatusBadRequest, err, m)
+	r.Results[i].Status = BatchItemRejected
+	r.Results[i].Error = &e
+	r.Rejected++
 }
@@ -2,12 +2,21 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 )
 
@@ -81,3 +90,200 @@ func setupRouterWithUpdatesJSON(srvc *test.FakeMetricService) *gin.Engine {
 	r.POST("/updates/", h.UpdatesJSON)
 	return r
 }
+
+func TestUpdatesJSON_HistogramsMerge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+
+	hist := map[string]any{"bounds": []float64{1}, "counts": []uint64{1, 0}, "sum": 0.5, "count": 1}
+	batch := []map[string]any{
+		{"id": "lat", "type": "histogram", "histogram": hist},
+		{"id": "lat", "type": "histogram", "histogram": hist},
+	}
+	if w := test.DoJSON(r, "/updates", batch, "application/json"); w.Code != http.StatusOK {
+		t.Fatalf("updates status = %d", w.Code)
+	}
+
+	w := test.DoJSON(r, "/value", map[string]any{"id": "lat", "type": "histogram"}, "application/json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("value status = %d", w.Code)
+	}
+	var got models.Metrics
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Histogram == nil || got.Histogram.Count != 2 || got.Histogram.Sum != 1 {
+		t.Fatalf("unexpected metric: %+v", got)
+	}
+
+	bad := []map[string]any{{"id": "lat", "type": "histogram", "histogram": map[string]any{"bounds": []float64{2}, "counts": []uint64{0, 0}}}}
+	if w := test.DoJSON(r, "/updates", bad, "application/json"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bucket mismatch status = %d", w.Code)
+	}
+}
+
+func TestUpdatesJSON_Partial(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pub := &test.FakePublisher[audit.Event]{}
+	r := gin.New()
+	r.Use(audit.Middleware(pub, nil, nil))
+	h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+
+	batch := []map[string]any{
+		{"id": "Alloc", "type": "gauge", "value": 1.5},
+		{"type": "gauge", "value": 1.0},
+		{"id": "PollCount", "type": "counter", "value": 1.0},
+		{"id": "PollCount", "type": "counter", "delta": 3},
+	}
+	w := test.DoJSON(r, "/updates?partial=true", batch, "application/json")
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusMultiStatus, w.Body.String())
+	}
+	var resp batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 2 || resp.Rejected != 2 || len(resp.Results) != 4 {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	wantCodes := []string{"", CodeInvalidName, CodeMissingValue, ""}
+	for i, want := range wantCodes {
+		res := resp.Results[i]
+		if res.Index != i {
+			t.Fatalf("result %d has index %d", i, res.Index)
+		}
+		if want == "" {
+			if res.Status != BatchItemAccepted || res.Error != nil {
+				t.Fatalf("result %d: %+v, want accepted", i, res)
+			}
+			continue
+		}
+		if res.Status != BatchItemRejected || res.Error == nil || res.Error.Code != want {
+			t.Fatalf("result %d: %+v, want rejected with %s", i, res, want)
+		}
+	}
+	if resp.Results[2].Error.Field != "delta" || resp.Results[2].Error.ID != "PollCount" {
+		t.Fatalf("rejection must name the metric and field: %+v", resp.Results[2].Error)
+	}
+
+	if w := test.DoJSON(r, "/value", map[string]any{"id": "PollCount", "type": "counter"}, "application/json"); !bytes.Contains(w.Body.Bytes(), []byte(`"delta":3`)) {
+		t.Fatalf("accepted counter not applied: %s", w.Body.String())
+	}
+	if len(pub.Events) != 1 || len(pub.Events[0].Metrics) != 2 ||
+		pub.Events[0].Metrics[0] != "Alloc" || pub.Events[0].Metrics[1] != "PollCount" {
+		t.Fatalf("audit must list only accepted metrics: %+v", pub.Events)
+	}
+
+	ok := []map[string]any{{"id": "Alloc", "type": "gauge", "value": 2.0}}
+	if w := test.DoJSON(r, "/updates?partial=true", ok, "application/json"); w.Code != http.StatusOK {
+		t.Fatalf("fully accepted batch: status = %d", w.Code)
+	}
+	if w := test.DoJSON(r, "/updates?partial=maybe", ok, "application/json"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid partial flag: status = %d", w.Code)
+	}
+}
+
+func TestUpdatesJSON_PartialBoundsChangedAfterCheck(t *testing.T) {
+	// The fake service fails the write as the storage does when another request changed the bounds.
+	fs := &test.FakeMetricService{Err: fmt.Errorf("%w: %q", models.ErrHistogramBucketsMismatch, "lat")}
+	r := setupRouterWithUpdatesJSON(fs)
+
+	batch := []map[string]any{{"id": "Alloc", "type": "gauge", "value": 1.5}}
+	w := test.DoJSON(r, "/updates?partial=true", batch, "application/json")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != CodeInvalidHistogram {
+		t.Fatalf("want %s envelope, got %s", CodeInvalidHistogram, w.Body.String())
+	}
+}
+
+func TestUpdatesJSON_IdempotentRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pub := &test.FakePublisher[audit.Event]{}
+	r := gin.New()
+	r.Use(audit.Middleware(pub, nil, nil))
+	r.Use(idempotency.Middleware(idempotency.NewMemoryStore(0, 0), nil, nil))
+	h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader(`[{"id":"PollCount","type":"counter","delta":3}]`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(models.IdempotencyKeyHeader, "batch-1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	first, retry := send(), send()
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Fatalf("retry %d %q, first %d %q", retry.Code, retry.Body.String(), first.Code, first.Body.String())
+	}
+	if w := test.DoJSON(r, "/value", map[string]any{"id": "PollCount", "type": "counter"}, "application/json"); !bytes.Contains(w.Body.Bytes(), []byte(`"delta":3`)) {
+		t.Fatalf("retried delta must be applied once: %s", w.Body.String())
+	}
+	if n := len(pub.GetEvents()); n != 1 {
+		t.Fatalf("audit events = %d, want 1", n)
+	}
+}
+
+type unavailableIdempotencyStore struct{}
+
+func (unavailableIdempotencyStore) Get(context.Context, string) (idempotency.Response, bool, error) {
+	return idempotency.Response{}, false, errors.New("down")
+}
+
+func (unavailableIdempotencyStore) Put(context.Context, string, idempotency.Response) error {
+	return nil
+}
+
+func TestUpdatesJSON_IdempotencyErrorsUseEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(store idempotency.Store) *gin.Engine {
+		r := gin.New()
+		r.Use(idempotency.Middleware(store, nil, abortMiddlewareError))
+		h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+		h.RegisterUpdate(r)
+		return r
+	}
+	send := func(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(models.IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	r := newRouter(idempotency.NewMemoryStore(0, 0))
+	if w := send(r, "k", `[{"id":"PollCount","type":"counter","delta":1}]`); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", w.Code)
+	}
+	tests := []struct {
+		name   string
+		r      *gin.Engine
+		key    string
+		status int
+		code   string
+	}{
+		{"reused key", r, "k", http.StatusUnprocessableEntity, CodeIdempotencyKeyReused},
+		{"long key", r, strings.Repeat("k", idempotency.MaxKeyLength+1), http.StatusBadRequest, CodeInvalidIdempotencyKey},
+		{"store down", newRouter(unavailableIdempotencyStore{}), "k", http.StatusServiceUnavailable, CodeStorageUnavailable},
+	}
+	for _, tt := range tests {
+		w := send(tt.r, tt.key, `[{"id":"PollCount","type":"counter","delta":2}]`)
+		if w.Code != tt.status {
+			t.Fatalf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if resp := decodeError(t, w); resp.Code != tt.code {
+			t.Fatalf("%s: code = %q, want %q", tt.name, resp.Code, tt.code)
+		}
+	}
+}
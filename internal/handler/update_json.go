@@ -1,18 +1,18 @@
 package handler
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
 )
 
-// UpdateJSON handles POST /update requests that transmit metrics in JSON format.
+// UpdateJSON handles POST /update requests that transmit metrics in JSON format,
+// or in Protocol Buffers or MessagePack as selected by Content-Type and Accept.
 func (h *GinHandler) UpdateJSON(c *gin.Context) {
-	if !strings.HasPrefix(c.GetHeader("Content-Type"), "application/json") {
-		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+	cd, ok := requestCodec(c)
+	if !ok {
 		return
 	}
 
@@ -20,19 +20,18 @@ func (h *GinHandler) UpdateJSON(c *gin.Context) {
 	in := pool.AcquireMetric()
 	defer pool.ReleaseMetric(in)
 
-	if err := json.NewDecoder(c.Request.Body).Decode(in); err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+	if err := cd.Decode(c.Request.Body, in); err != nil {
+		abortError(c, http.StatusBadRequest, fmt.Errorf("%w: %w", errMalformedBody, err), nil)
 		return
 	}
-	if in.ID == "" || in.MType == "" {
-		c.AbortWithStatus(http.StatusBadRequest)
+	if err := requireIDAndType(in); err != nil {
+		abortError(c, http.StatusBadRequest, err, in)
 		return
 	}
 
-	err := h.service.ProcessUpdate(in)
-
-	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+	in.WithInstance(requestInstance(c))
+	if err := h.service.ProcessUpdate(requestContext(c), in); err != nil {
+		abortError(c, http.StatusBadRequest, err, in)
 		return
 	}
 
@@ -42,6 +41,5 @@ func (h *GinHandler) UpdateJSON(c *gin.Context) {
 		h.afterUpdate()
 	}
 
-	c.Header("Content-Type", "application/json")
-	c.JSON(http.StatusOK, in)
+	render(c, http.StatusOK, responseCodec(c, cd), in)
 }
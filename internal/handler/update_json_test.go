@@ -10,6 +10,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 )
 
@@ -157,3 +159,38 @@ func setupRouterWithUpdateJSON(srvc *test.FakeMetricService) *gin.Engine {
 	r.POST("/update/", h.UpdateJSON)
 	return r
 }
+
+func TestUpdateJSON_LabelsRoundTrip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+
+	body := map[string]any{"id": "CPUutilization", "type": "gauge", "value": 12.5, "labels": map[string]string{"cpu": "3"}}
+	if w := test.DoJSON(r, "/update", body, "application/json"); w.Code != http.StatusOK {
+		t.Fatalf("update status = %d", w.Code)
+	}
+
+	w := test.DoJSON(r, "/value", map[string]any{"id": "CPUutilization", "type": "gauge", "labels": map[string]string{"cpu": "3"}}, "application/json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("value status = %d", w.Code)
+	}
+	var got models.Metrics
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "CPUutilization" || got.Labels["cpu"] != "3" || got.Value == nil || *got.Value != 12.5 {
+		t.Fatalf("unexpected metric: %+v", got)
+	}
+
+	w = test.DoJSON(r, "/value", map[string]any{"id": "CPUutilization", "type": "gauge"}, "application/json")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("label-less series must be distinct, status = %d", w.Code)
+	}
+
+	bad := map[string]any{"id": "x", "type": "gauge", "value": 1, "labels": map[string]string{"bad-name": "1"}}
+	if w := test.DoJSON(r, "/update", bad, "application/json"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid label status = %d", w.Code)
+	}
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,29 +9,49 @@ import (
 )
 
 // UpdatePlain handles POST /update/:type/:name/:value requests that encode metrics in the URL path.
+// The name may carry labels in series key form, e.g. CPUutilization{cpu="3"}.
+// For histograms the value is a single observation bucketed by the optional buckets query parameter
+// (comma-separated upper bounds) or models.DefaultHistogramBuckets.
 func (h *GinHandler) UpdatePlain(c *gin.Context) {
-	metricType := models.MetricType(c.Param("type"))
-	if !metricType.IsValid() {
-		c.AbortWithStatus(http.StatusBadRequest)
+	metricName := c.Param("name")
+	ref := &models.Metrics{ID: metricName, MType: models.MetricType(c.Param("type"))}
+	if !ref.MType.IsValid() {
+		abortPlainError(c, http.StatusBadRequest, models.ErrMetricInvalidType, ref)
 		return
 	}
-
-	metricName := c.Param("name")
 	if metricName == "" {
-		c.AbortWithStatus(http.StatusBadRequest)
+		abortPlainError(c, http.StatusBadRequest, models.ErrMetricUnknownName, ref)
 		return
 	}
 
-	m, err := models.NewMetrics(metricName, c.Param("value"), metricType)
-	if errors.Is(err, models.ErrMetricUnknownName) {
-		c.AbortWithStatus(http.StatusBadRequest)
+	name, labels, err := models.ParseSeriesKey(metricName)
+	if err != nil {
+		abortPlainError(c, http.StatusBadRequest, err, ref)
 		return
 	}
 
-	err = h.service.ProcessUpdate(m)
-
+	m, err := models.NewMetrics(name, c.Param("value"), ref.MType)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		abortPlainError(c, http.StatusBadRequest, err, ref)
+		return
+	}
+	m.Labels = labels
+	m.WithInstance(requestInstance(c))
+	if m.Histogram != nil {
+		if raw := c.Query("buckets"); raw != "" {
+			bounds, err := models.ParseHistogramBuckets(raw)
+			if err != nil {
+				abortPlainError(c, http.StatusBadRequest, err, ref)
+				return
+			}
+			h := models.NewHistogram(bounds)
+			h.Observe(m.Histogram.Sum)
+			m.Histogram = h
+		}
+	}
+
+	if err := h.service.ProcessUpdate(requestContext(c), m); err != nil {
+		abortPlainError(c, http.StatusBadRequest, err, ref)
 		return
 	}
 
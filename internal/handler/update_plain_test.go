@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 )
 
@@ -132,3 +135,69 @@ func TestUpdatePlain_AfterUpdateHook(t *testing.T) {
 		t.Fatalf("afterUpdate not called, got %d", called)
 	}
 }
+
+func TestUpdatePlain_SeriesKeyName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+
+	key := url.PathEscape(`CPUutilization{cpu="3"}`)
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/"+key+"/7.5", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = test.DoGET(r, "/value/gauge/"+key, "")
+	if w.Code != http.StatusOK || w.Body.String() != "7.5" {
+		t.Fatalf("value = %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/update/gauge/"+url.PathEscape(`CPU{cpu}`)+"/1", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed labels status = %d", w.Code)
+	}
+}
+
+func TestUpdatePlain_HistogramObservations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := newTestGinHandler(service.NewMetricService(storage.NewMemStorage()))
+	h.RegisterUpdate(r)
+	h.RegisterGetValue(r)
+
+	post := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+	if code := post("/update/histogram/lat/0.2?buckets=0.1,1"); code != http.StatusOK {
+		t.Fatalf("first observation status = %d", code)
+	}
+	if code := post("/update/histogram/lat/5?buckets=0.1,1"); code != http.StatusOK {
+		t.Fatalf("second observation status = %d", code)
+	}
+	if code := post("/update/histogram/lat/5"); code != http.StatusBadRequest {
+		t.Fatalf("bucket mismatch status = %d", code)
+	}
+	if code := post("/update/histogram/lat/5?buckets=1,0.1"); code != http.StatusBadRequest {
+		t.Fatalf("invalid buckets status = %d", code)
+	}
+
+	w := test.DoGET(r, "/value/histogram/lat", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("value status = %d", w.Code)
+	}
+	var got models.Histogram
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 2 || got.Counts[1] != 1 || got.Counts[2] != 1 {
+		t.Fatalf("unexpected histogram: %+v", got)
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+const (
+	// NDJSONContentType is the content type of POST /updates/stream: one JSON metric per line.
+	NDJSONContentType = "application/x-ndjson"
+	// UpdatesStreamChunkSize is how many metrics of a stream are applied together.
+	UpdatesStreamChunkSize = 1000
+	// maxStreamLineSize bounds the length of a stream line.
+	maxStreamLineSize = 1 << 20
+)
+
+// streamResponse is the body of a POST /updates/stream response. Applied counts the metrics written
+// before the stream ended; on failure the error envelope is merged into it.
+type streamResponse struct {
+	Applied int `json:"applied"`
+	*ErrorResponse
+}
+
+// UpdatesStream handles POST /updates/stream requests that submit newline-delimited JSON metrics.
+// Unlike UpdatesJSON it never holds more than UpdatesStreamChunkSize metrics: they are applied in chunks
+// through ProcessUpdates as the body is read. Signed and encrypted bodies are the exception: the sign and
+// cryptoutil middlewares read them whole before verifying, so they are held in memory, compressed,
+// and limited to 10 MiB. Each chunk is applied entirely or not at all, so a stream that
+// fails midway has its preceding chunks applied; the response tells how many metrics that is.
+func (h *GinHandler) UpdatesStream(c *gin.Context) {
+	if !strings.HasPrefix(c.GetHeader("Content-Type"), NDJSONContentType) {
+		abortError(c, http.StatusUnsupportedMediaType, errUnsupportedStreamType, nil)
+		return
+	}
+	ctx := requestContext(c)
+	instance := requestInstance(c)
+	chunk := make([]models.Metrics, 0, UpdatesStreamChunkSize)
+	applied, line, first := 0, 0, 0
+
+	fail := func(status int, err error, m *models.Metrics) {
+		if s, ok := storageStatus(err); ok {
+			status = s
+		}
+		if applied > 0 {
+			// A retry with the same idempotency key must not apply the preceding chunks again.
+			idempotency.KeepResponse(c)
+			if h.afterUpdate != nil {
+				h.afterUpdate()
+			}
+		}
+		resp := newErrorResponse(status, err, m)
+		c.AbortWithStatusJSON(status, streamResponse{Applied: applied, ErrorResponse: &resp})
+	}
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := h.service.ProcessUpdates(ctx, chunk); err != nil {
+			return fmt.Errorf("lines %d-%d: %w", first, line, err)
+		}
+		for i := range chunk {
+			audit.AddRequestMetrics(c, chunk[i].ID)
+		}
+		applied += len(chunk)
+		chunk = chunk[:0]
+		return nil
+	}
+
+	sc := bufio.NewScanner(c.Request.Body)
+	sc.Buffer(make([]byte, 0, 64<<10), maxStreamLineSize)
+	for sc.Scan() {
+		line++
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		// Every line is decoded into a fresh value: decoding into a reused one would write through its pointers.
+		var m models.Metrics
+		if err := json.Unmarshal(b, &m); err != nil {
+			fail(http.StatusBadRequest, fmt.Errorf("%w: line %d: %w", errMalformedBody, line, err), nil)
+			return
+		}
+		if err := requireIDAndType(&m); err != nil {
+			fail(http.StatusBadRequest, fmt.Errorf("line %d: %w", line, err), &m)
+			return
+		}
+		m.WithInstance(instance)
+		if len(chunk) == 0 {
+			first = line
+		}
+		chunk = append(chunk, m)
+		if len(chunk) == UpdatesStreamChunkSize {
+			if err := flush(); err != nil {
+				fail(http.StatusBadRequest, err, nil)
+				return
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("line %d: %w", line+1, err)
+		}
+		fail(http.StatusBadRequest, fmt.Errorf("%w: %w", errMalformedBody, err), nil)
+		return
+	}
+	if err := flush(); err != nil {
+		fail(http.StatusBadRequest, err, nil)
+		return
+	}
+
+	if applied > 0 && h.afterUpdate != nil {
+		h.afterUpdate()
+	}
+	c.JSON(http.StatusOK, streamResponse{Applied: applied})
+}
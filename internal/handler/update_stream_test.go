@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+// chunkRecorder records the size of every batch applied through ProcessUpdates.
+type chunkRecorder struct {
+	service.MetricServiceInterface
+	sizes []int
+}
+
+func (r *chunkRecorder) ProcessUpdates(ctx context.Context, metrics []models.Metrics) error {
+	r.sizes = append(r.sizes, len(metrics))
+	return r.MetricServiceInterface.ProcessUpdates(ctx, metrics)
+}
+
+func postStream(r http.Handler, body string) (*httptest.ResponseRecorder, streamResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/updates/stream", strings.NewReader(body))
+	req.Header.Set("Content-Type", NDJSONContentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp streamResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func newStreamRouter(pub audit.Publisher) (*gin.Engine, *chunkRecorder, *storage.MemStorage) {
+	gin.SetMode(gin.TestMode)
+	st := storage.NewMemStorage()
+	rec := &chunkRecorder{MetricServiceInterface: service.NewMetricService(st)}
+	r := gin.New()
+	if pub != nil {
+		r.Use(audit.Middleware(pub, nil, nil))
+	}
+	newTestGinHandler(rec).RegisterUpdate(r)
+	return r, rec, st
+}
+
+func TestUpdatesStream_AppliesInChunks(t *testing.T) {
+	pub := &test.FakePublisher[audit.Event]{}
+	r, rec, st := newStreamRouter(pub)
+
+	n := 2*UpdatesStreamChunkSize + 500
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `{"id":"g%d","type":"gauge","value":%d}`+"\n", i, i)
+		if i == 10 {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString(`{"id":"PollCount","type":"counter","delta":2}`)
+
+	w, resp := postStream(r, b.String())
+	if w.Code != http.StatusOK || resp.Applied != n+1 || resp.ErrorResponse != nil {
+		t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+	}
+	want := []int{UpdatesStreamChunkSize, UpdatesStreamChunkSize, 501}
+	if fmt.Sprint(rec.sizes) != fmt.Sprint(want) {
+		t.Fatalf("chunks %v, want %v", rec.sizes, want)
+	}
+	if v, err := st.GetGauge(fmt.Sprintf("g%d", n-1)); err != nil || v != float64(n-1) {
+		t.Fatalf("last gauge = %v, %v", v, err)
+	}
+	if v, _ := st.GetCounter("PollCount"); v != 2 {
+		t.Fatalf("counter = %d", v)
+	}
+	events := pub.GetEvents()
+	if len(events) != 1 || len(events[0].Metrics) != n+1 {
+		t.Fatalf("audit must report every applied metric once: %d events", len(events))
+	}
+}
+
+func TestUpdatesStream_FailureReportsApplied(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < UpdatesStreamChunkSize; i++ {
+		fmt.Fprintf(&b, `{"id":"g%d","type":"gauge","value":1}`+"\n", i)
+	}
+	prefix := b.String()
+	line := UpdatesStreamChunkSize + 2
+
+	tests := []struct {
+		name, tail string
+		code, id   string
+	}{
+		{"malformed", `{"id":"a","type":"gauge","value":1}` + "\n{\n", CodeBadRequest, ""},
+		{"missing name", `{"id":"a","type":"gauge","value":1}` + "\n" + `{"type":"gauge","value":1}`, CodeInvalidName, ""},
+		{"invalid value", `{"id":"a","type":"gauge","value":1}` + "\n" + `{"id":"c","type":"counter","value":1}`, CodeMissingValue, "c"},
+	}
+	for _, tt := range tests {
+		r, _, st := newStreamRouter(nil)
+		w, resp := postStream(r, prefix+tt.tail)
+		if w.Code != http.StatusBadRequest || resp.ErrorResponse == nil {
+			t.Fatalf("%s: status %d, body %s", tt.name, w.Code, w.Body.String())
+		}
+		if resp.Applied != UpdatesStreamChunkSize || resp.Code != tt.code || resp.ID != tt.id {
+			t.Fatalf("%s: unexpected body %s", tt.name, w.Body.String())
+		}
+		if !strings.Contains(resp.Message, fmt.Sprint(line)) {
+			t.Fatalf("%s: message %q does not name line %d", tt.name, resp.Message, line)
+		}
+		if _, err := st.GetGauge("g0"); err != nil {
+			t.Fatalf("%s: preceding chunk must stay applied: %v", tt.name, err)
+		}
+		if _, err := st.GetGauge("a"); err == nil {
+			t.Fatalf("%s: failed chunk must not be applied", tt.name)
+		}
+	}
+}
+
+func TestUpdatesStream_RejectsOtherContentTypes(t *testing.T) {
+	r, _, _ := newStreamRouter(nil)
+	w := test.DoJSON(r, "/updates/stream", []models.Metrics{}, "application/json")
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+	if resp := decodeError(t, w); resp.Code != CodeUnsupportedMediaType {
+		t.Fatalf("unexpected body %+v", resp)
+	}
+}
+
+// brokenReader fails like the body of a request whose client went away.
+type brokenReader struct{}
+
+func (brokenReader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
+
+func TestUpdatesStream_RetryOfHalfAppliedStreamIsReplayed(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < UpdatesStreamChunkSize; i++ {
+		b.WriteString(`{"id":"PollCount","type":"counter","delta":1}` + "\n")
+	}
+	prefix := b.String()
+	full := prefix + `{"id":"c","type":"counter","value":1}` + "\n"
+
+	tests := []struct {
+		name  string
+		first io.Reader
+	}{
+		{"rejected line", strings.NewReader(full)},
+		{"client gone", io.MultiReader(strings.NewReader(prefix), brokenReader{})},
+	}
+	for _, tt := range tests {
+		gin.SetMode(gin.TestMode)
+		st := storage.NewMemStorage()
+		r := gin.New()
+		r.Use(idempotency.Middleware(idempotency.NewMemoryStore(0, 0), nil, nil))
+		newTestGinHandler(service.NewMetricService(st)).RegisterUpdate(r)
+
+		send := func(body io.Reader) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/updates/stream", body)
+			req.Header.Set("Content-Type", NDJSONContentType)
+			req.Header.Set(models.IdempotencyKeyHeader, "k1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+		first := send(tt.first)
+		if first.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, body %s", tt.name, first.Code, first.Body.String())
+		}
+		retry := send(strings.NewReader(full))
+		if retry.Header().Get(idempotency.ReplayedHeader) != "true" || retry.Body.String() != first.Body.String() {
+			t.Fatalf("%s: retry was not replayed: %d %s", tt.name, retry.Code, retry.Body.String())
+		}
+		if v, _ := st.GetCounter("PollCount"); v != UpdatesStreamChunkSize {
+			t.Fatalf("%s: counter = %d, want %d", tt.name, v, UpdatesStreamChunkSize)
+		}
+	}
+}
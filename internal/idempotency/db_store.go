@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	sqlGetResponse = `SELECT fingerprint, status, content_type, body FROM idempotency_keys WHERE key = $1 AND created_at > $2`
+
+	sqlPutResponse = `INSERT INTO idempotency_keys (key, fingerprint, status, content_type, body, created_at)
+VALUES ($1, $2, $3, $4, $5, NOW())
+ON CONFLICT (key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status = EXCLUDED.status,
+    content_type = EXCLUDED.content_type, body = EXCLUDED.body, created_at = EXCLUDED.created_at
+WHERE idempotency_keys.created_at <= $6`
+
+	// sqlPruneResponses drops expired responses and the oldest ones beyond the capacity.
+	sqlPruneResponses = `DELETE FROM idempotency_keys
+WHERE created_at <= $1
+   OR key IN (SELECT key FROM idempotency_keys ORDER BY created_at DESC OFFSET $2)`
+)
+
+// Querier is the part of the database pool used by DBStore.
+type Querier interface {
+	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
+	QueryRow(context.Context, string, ...any) pgx.Row
+}
+
+// DBStore is a Store kept in the idempotency_keys table, so that every server sharing the database
+// recognises a retried request. Responses are kept for ttl and at most capacity of them are kept.
+type DBStore struct {
+	q        Querier
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+var _ Store = (*DBStore)(nil)
+
+// NewDBStore creates a DBStore; non-positive arguments select DefaultCapacity and DefaultTTL.
+func NewDBStore(q Querier, capacity int, ttl time.Duration) *DBStore {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &DBStore{q: q, capacity: capacity, ttl: ttl, now: time.Now}
+}
+
+// Get returns the response recorded for the key unless it has expired.
+func (s *DBStore) Get(ctx context.Context, key string) (Response, bool, error) {
+	var r Response
+	err := s.q.QueryRow(ctx, sqlGetResponse, key, s.now().Add(-s.ttl)).Scan(&r.Fingerprint, &r.Status, &r.ContentType, &r.Body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Response{}, false, nil
+	}
+	if err != nil {
+		return Response{}, false, fmt.Errorf("get idempotent response: %w", err)
+	}
+	return r, true, nil
+}
+
+// Put records the response, replacing an expired one, and prunes the table down to the capacity.
+func (s *DBStore) Put(ctx context.Context, key string, r Response) error {
+	expired := s.now().Add(-s.ttl)
+	if _, err := s.q.Exec(ctx, sqlPutResponse, key, r.Fingerprint, r.Status, r.ContentType, r.Body, expired); err != nil {
+		return fmt.Errorf("put idempotent response: %w", err)
+	}
+	if _, err := s.q.Exec(ctx, sqlPruneResponses, expired, s.capacity); err != nil {
+		return fmt.Errorf("prune idempotent responses: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+const (
+	// ReplayedHeader marks a response that was recorded for an earlier request with the same key.
+	ReplayedHeader = "Idempotent-Replayed"
+	// MaxKeyLength bounds the length of an idempotency key.
+	MaxKeyLength = 255
+	// keepResponseKey marks a request whose response is recorded even if it reports a failure.
+	keepResponseKey = "idempotency_keep_response"
+)
+
+// Errors passed to AbortFunc for the requests that Middleware rejects.
+var (
+	// ErrInvalidKey reports an idempotency key longer than MaxKeyLength.
+	ErrInvalidKey = errors.New("idempotency key is too long")
+	// ErrKeyReused reports a key that was recorded for a different request.
+	ErrKeyReused = errors.New("idempotency key was used for a different request")
+	// ErrStoreUnavailable reports that the recorded responses cannot be read.
+	ErrStoreUnavailable = errors.New("idempotency store is unavailable")
+	// ErrBodyUnreadable reports a request body that cannot be read to compare it with the recorded request.
+	ErrBodyUnreadable = errors.New("request body cannot be read")
+)
+
+// AbortFunc ends a request that Middleware rejects with status because of err.
+type AbortFunc func(c *gin.Context, status int, err error)
+
+// KeepResponse makes Middleware record the response to the request even if it reports a failure.
+// Handlers call it once a failing request has had effects that a retry must not repeat,
+// such as a stream that failed after some of its chunks were applied.
+func KeepResponse(c *gin.Context) {
+	c.Set(keepResponseKey, true)
+}
+
+// Middleware makes POST requests carrying models.IdempotencyKeyHeader idempotent.
+// The first request with a key is served normally and its successful response is recorded; a repeated
+// request with the key gets the recorded response without reaching the handler, so updates are not applied
+// twice and not audited twice. A repeated request that arrives while the first one is still being served
+// waits for it. Reusing a key for a different request is answered with 422, an invalid key with 400,
+// and a store that cannot be read with 503. Failed responses are not recorded, so they can be retried,
+// unless the handler called KeepResponse. If the body of such a request cannot be read to the end,
+// the response is recorded for the request target alone and replayed to any request with the key and target.
+//
+// Rejected requests are ended by abort, which gets one of the errors above; a nil abort replies
+// with an empty body.
+//
+// The middleware must run after the body has been decrypted and decompressed and before the response
+// is compressed or signed.
+func Middleware(store Store, l logger.Logger, abort AbortFunc) gin.HandlerFunc {
+	if store == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	if abort == nil {
+		abort = func(c *gin.Context, status int, _ error) { c.AbortWithStatus(status) }
+	}
+	var locks keyLocks
+	return func(c *gin.Context) {
+		key := c.GetHeader(models.IdempotencyKeyHeader)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		if len(key) > MaxKeyLength {
+			abort(c, http.StatusBadRequest, ErrInvalidKey)
+			return
+		}
+
+		ctx := c.Request.Context()
+		if !locks.lock(c, key) {
+			abort(c, http.StatusServiceUnavailable, ErrStoreUnavailable)
+			return
+		}
+		defer locks.unlock(key)
+
+		recorded, ok, err := store.Get(ctx, key)
+		if err != nil {
+			if l != nil {
+				l.WriteError("idempotency store get failed", "error", err)
+			}
+			abort(c, http.StatusServiceUnavailable, ErrStoreUnavailable)
+			return
+		}
+		fp := newFingerprint(c.Request)
+		target := fp.Sum(nil)
+		if ok {
+			if bytes.Equal(recorded.Fingerprint, target) {
+				replay(c, recorded)
+				return
+			}
+			if _, err := io.Copy(fp, c.Request.Body); err != nil {
+				abort(c, http.StatusBadRequest, ErrBodyUnreadable)
+				return
+			}
+			if !bytes.Equal(recorded.Fingerprint, fp.Sum(nil)) {
+				abort(c, http.StatusUnprocessableEntity, ErrKeyReused)
+				return
+			}
+			replay(c, recorded)
+			return
+		}
+
+		// The body is hashed as the handler reads it, so that streamed bodies are not buffered.
+		body := c.Request.Body
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(body, fp), body}
+		rw := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = rw
+		c.Next()
+		c.Writer = rw.ResponseWriter
+
+		status := rw.Status()
+		keep := c.GetBool(keepResponseKey)
+		if !keep && (status < http.StatusOK || status >= http.StatusMultipleChoices) {
+			return
+		}
+		fingerprint := target
+		if _, err := io.Copy(fp, body); err == nil {
+			fingerprint = fp.Sum(nil)
+		} else if !keep {
+			return
+		}
+		resp := Response{
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: rw.Header().Get("Content-Type"),
+			Body:        append([]byte{}, rw.body.Bytes()...),
+		}
+		// The response is recorded even if the client has gone away: it is what a retry must get.
+		if err := store.Put(context.WithoutCancel(ctx), key, resp); err != nil && l != nil {
+			l.WriteError("idempotency store put failed", "error", err)
+		}
+	}
+}
+
+func replay(c *gin.Context, recorded Response) {
+	c.Header(ReplayedHeader, "true")
+	c.Data(recorded.Status, recorded.ContentType, recorded.Body)
+	c.Abort()
+}
+
+// newFingerprint starts the hash that identifies the request by its target and decoded body.
+func newFingerprint(r *http.Request) hash.Hash {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	return h
+}
+
+// recordingWriter passes the response through and keeps a copy of the body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// keyLocks serialises the requests that share an idempotency key.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// lock waits until no other request holds the key and reports false when the client goes away first.
+func (l *keyLocks) lock(c *gin.Context, key string) bool {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	select {
+	case kl.ch <- struct{}{}:
+		return true
+	case <-c.Request.Context().Done():
+		l.release(key, kl)
+		return false
+	}
+}
+
+func (l *keyLocks) unlock(key string) {
+	l.mu.Lock()
+	kl := l.locks[key]
+	l.mu.Unlock()
+	<-kl.ch
+	l.release(key, kl)
+}
+
+func (l *keyLocks) release(key string, kl *keyLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	kl.refs--
+	if kl.refs == 0 {
+		delete(l.locks, key)
+	}
+}
@@ -0,0 +1,150 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func newCountingRouter(store Store, calls *atomic.Int32, status int, delay time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(store, nil, nil))
+	r.POST("/updates", func(c *gin.Context) {
+		n := calls.Add(1)
+		time.Sleep(delay)
+		c.JSON(status, gin.H{"call": n})
+	})
+	return r
+}
+
+func post(r http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(models.IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware_ReplaysRecordedResponse(t *testing.T) {
+	var calls atomic.Int32
+	r := newCountingRouter(NewMemoryStore(0, 0), &calls, http.StatusOK, 0)
+
+	first := post(r, "k1", `[1]`)
+	second := post(r, "k1", `[1]`)
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() ||
+		second.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Fatalf("replay %d %q differs from %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get(ReplayedHeader) != "true" || first.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("only the replay must be marked")
+	}
+
+	post(r, "k2", `[1]`)
+	post(r, "", `[1]`)
+	post(r, "", `[1]`)
+	if calls.Load() != 4 {
+		t.Fatalf("handler called %d times, want 4", calls.Load())
+	}
+}
+
+func TestMiddleware_RejectsReusedKey(t *testing.T) {
+	var calls atomic.Int32
+	r := newCountingRouter(NewMemoryStore(0, 0), &calls, http.StatusOK, 0)
+
+	post(r, "k", `[1]`)
+	if w := post(r, "k", `[2]`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	if w := post(r, strings.Repeat("k", MaxKeyLength+1), `[1]`); w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+}
+
+func TestMiddleware_AbortGetsReason(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got error
+	r := gin.New()
+	r.Use(Middleware(NewMemoryStore(0, 0), nil, func(c *gin.Context, status int, err error) {
+		got = err
+		c.AbortWithStatus(status)
+	}))
+	r.POST("/updates", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	post(r, "k", `[1]`)
+	if w := post(r, "k", `[2]`); w.Code != http.StatusUnprocessableEntity || !errors.Is(got, ErrKeyReused) {
+		t.Fatalf("status = %d, err = %v", w.Code, got)
+	}
+	if w := post(r, strings.Repeat("k", MaxKeyLength+1), `[1]`); w.Code != http.StatusBadRequest || !errors.Is(got, ErrInvalidKey) {
+		t.Fatalf("status = %d, err = %v", w.Code, got)
+	}
+}
+
+func TestMiddleware_DoesNotRecordFailures(t *testing.T) {
+	var calls atomic.Int32
+	r := newCountingRouter(NewMemoryStore(0, 0), &calls, http.StatusServiceUnavailable, 0)
+
+	post(r, "k", `[1]`)
+	post(r, "k", `[1]`)
+	if calls.Load() != 2 {
+		t.Fatalf("failed request must be retried, handler called %d times", calls.Load())
+	}
+}
+
+func TestMiddleware_ConcurrentRetryWaits(t *testing.T) {
+	var calls atomic.Int32
+	r := newCountingRouter(NewMemoryStore(0, 0), &calls, http.StatusOK, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 4)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = post(r, "k", `[1]`).Body.String()
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+	for _, b := range bodies[1:] {
+		if b != bodies[0] {
+			t.Fatalf("responses differ: %q and %q", b, bodies[0])
+		}
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Get(context.Context, string) (Response, bool, error) {
+	return Response{}, false, context.DeadlineExceeded
+}
+func (failingStore) Put(context.Context, string, Response) error { return nil }
+
+func TestMiddleware_StoreUnavailable(t *testing.T) {
+	var calls atomic.Int32
+	r := newCountingRouter(failingStore{}, &calls, http.StatusOK, 0)
+
+	if w := post(r, "k", `[1]`); w.Code != http.StatusServiceUnavailable || calls.Load() != 0 {
+		t.Fatalf("status = %d, calls = %d", w.Code, calls.Load())
+	}
+}
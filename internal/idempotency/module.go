@@ -0,0 +1,25 @@
+package idempotency
+
+import (
+	"go.uber.org/fx"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
+)
+
+// newStore keeps the responses in the database when the server stores metrics there,
+// so that servers sharing it recognise each other's requests, and in memory otherwise.
+func newStore(p struct {
+	fx.In
+	Pool db.Pool `optional:"true"`
+}) Store {
+	if p.Pool != nil {
+		return NewDBStore(p.Pool, 0, 0)
+	}
+	return NewMemoryStore(0, 0)
+}
+
+// Module provides the store of responses to idempotent requests.
+var Module = fx.Module(
+	"idempotency",
+	fx.Provide(newStore),
+)
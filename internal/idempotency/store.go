@@ -0,0 +1,117 @@
+// Package idempotency lets clients retry update requests safely: the response to a request carrying
+// an idempotency key is recorded, and a repeated request with the same key gets the recorded response
+// instead of being applied again.
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCapacity is how many responses a store keeps at most.
+	DefaultCapacity = 10000
+	// DefaultTTL is how long a response is replayed for repeated keys.
+	DefaultTTL = 24 * time.Hour
+)
+
+// Response is the recorded response to a request.
+// Fingerprint identifies the request, so that a key reused for a different request is detected.
+type Response struct {
+	Fingerprint []byte
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store keeps the responses to requests by idempotency key.
+type Store interface {
+	// Get returns the response recorded for the key and reports whether there is one.
+	Get(ctx context.Context, key string) (Response, bool, error)
+	// Put records the response for the key; a response already recorded for the key is kept.
+	Put(ctx context.Context, key string, r Response) error
+}
+
+// MemoryStore is a Store that keeps up to capacity responses in memory for ttl,
+// evicting the least recently used response first.
+type MemoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+}
+
+type memoryEntry struct {
+	key    string
+	resp   Response
+	stored time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a MemoryStore; non-positive arguments select DefaultCapacity and DefaultTTL.
+func NewMemoryStore(capacity int, ttl time.Duration) *MemoryStore {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &MemoryStore{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Get returns the response recorded for the key unless it has expired.
+func (s *MemoryStore) Get(_ context.Context, key string) (Response, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return Response{}, false, nil
+	}
+	e := el.Value.(*memoryEntry)
+	if s.now().Sub(e.stored) >= s.ttl {
+		s.remove(el)
+		return Response{}, false, nil
+	}
+	s.order.MoveToFront(el)
+	return e.resp, true, nil
+}
+
+// Put records the response and evicts the least recently used ones beyond the capacity.
+func (s *MemoryStore) Put(_ context.Context, key string, r Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		if s.now().Sub(el.Value.(*memoryEntry).stored) < s.ttl {
+			return nil
+		}
+		s.remove(el)
+	}
+	s.items[key] = s.order.PushFront(&memoryEntry{key: key, resp: r, stored: s.now()})
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of recorded responses, including expired ones not yet evicted.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+func (s *MemoryStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.items, el.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,99 @@
+package idempotency
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+)
+
+func TestMemoryStore_KeepsFirstResponse(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(0, 0)
+
+	if _, ok, err := s.Get(ctx, "k"); ok || err != nil {
+		t.Fatalf("empty store: %v %v", ok, err)
+	}
+	_ = s.Put(ctx, "k", Response{Status: 200, Body: []byte("first")})
+	_ = s.Put(ctx, "k", Response{Status: 200, Body: []byte("second")})
+	r, ok, err := s.Get(ctx, "k")
+	if !ok || err != nil || string(r.Body) != "first" {
+		t.Fatalf("got %+v %v %v, want the first response", r, ok, err)
+	}
+}
+
+func TestMemoryStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2, time.Hour)
+
+	_ = s.Put(ctx, "a", Response{Status: 200})
+	_ = s.Put(ctx, "b", Response{Status: 200})
+	_, _, _ = s.Get(ctx, "a")
+	_ = s.Put(ctx, "c", Response{Status: 200})
+
+	if s.Len() != 2 {
+		t.Fatalf("len = %d, want 2", s.Len())
+	}
+	if _, ok, _ := s.Get(ctx, "b"); ok {
+		t.Fatalf("least recently used key must be evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok, _ := s.Get(ctx, k); !ok {
+			t.Fatalf("key %q must be kept", k)
+		}
+	}
+}
+
+func TestMemoryStore_Expires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryStore(0, time.Minute)
+	s.now = func() time.Time { return now }
+
+	_ = s.Put(ctx, "k", Response{Status: 200, Body: []byte("old")})
+	now = now.Add(time.Minute)
+	if _, ok, _ := s.Get(ctx, "k"); ok {
+		t.Fatalf("expired response must not be replayed")
+	}
+	_ = s.Put(ctx, "k", Response{Status: 200, Body: []byte("new")})
+	if r, ok, _ := s.Get(ctx, "k"); !ok || string(r.Body) != "new" {
+		t.Fatalf("got %+v %v, want the new response", r, ok)
+	}
+}
+
+func TestDBStore(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	now := time.Unix(1700000000, 0)
+	s := NewDBStore(mock, 10, time.Hour)
+	s.now = func() time.Time { return now }
+	expired := now.Add(-time.Hour)
+	fp := []byte{1, 2}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetResponse)).WithArgs("k", expired).
+		WillReturnRows(pgxmock.NewRows([]string{"fingerprint", "status", "content_type", "body"}))
+	mock.ExpectExec(regexp.QuoteMeta(sqlPutResponse)).WithArgs("k", fp, 200, "application/json", []byte("{}"), expired).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(regexp.QuoteMeta(sqlPruneResponses)).WithArgs(expired, 10).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetResponse)).WithArgs("k", expired).
+		WillReturnRows(pgxmock.NewRows([]string{"fingerprint", "status", "content_type", "body"}).
+			AddRow(fp, 200, "application/json", []byte("{}")))
+
+	ctx := context.Background()
+	if _, ok, err := s.Get(ctx, "k"); ok || err != nil {
+		t.Fatalf("unknown key: %v %v", ok, err)
+	}
+	if err := s.Put(ctx, "k", Response{Fingerprint: fp, Status: 200, ContentType: "application/json", Body: []byte("{}")}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	r, ok, err := s.Get(ctx, "k")
+	if !ok || err != nil || r.Status != 200 || string(r.Body) != "{}" {
+		t.Fatalf("got %+v %v %v", r, ok, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrHistogramBucketsMismatch indicates an attempt to merge histograms with different bucket bounds.
+var ErrHistogramBucketsMismatch = errors.New("histogram bucket bounds mismatch")
+
+// DefaultHistogramBuckets are used when a histogram observation does not specify bucket bounds.
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram is a bucketed distribution of observations.
+// Bounds are strictly increasing upper bounds; Counts has one extra trailing slot for observations above the last bound.
+// Counts are per bucket (not cumulative), so histograms with equal bounds merge by element-wise addition.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// NewHistogram returns an empty histogram with a copy of the supplied bucket bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe records a single value into the matching bucket.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Validate reports whether the bounds are increasing and the counts are consistent with them.
+func (h *Histogram) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: %d bounds require %d counts, got %d", ErrMetricInvalidValueType, len(h.Bounds), len(h.Bounds)+1, len(h.Counts))
+	}
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || (i > 0 && b <= h.Bounds[i-1]) {
+			return fmt.Errorf("%w: histogram bounds must be strictly increasing", ErrMetricInvalidValueType)
+		}
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("%w: histogram count %d does not match bucket total %d", ErrMetricInvalidValueType, h.Count, total)
+	}
+	return nil
+}
+
+// Merge returns the sum of two histograms with identical bounds. Neither operand is modified.
+func (h Histogram) Merge(o Histogram) (Histogram, error) {
+	if len(h.Bounds) != len(o.Bounds) || len(h.Counts) != len(o.Counts) {
+		return Histogram{}, ErrHistogramBucketsMismatch
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != o.Bounds[i] {
+			return Histogram{}, ErrHistogramBucketsMismatch
+		}
+	}
+	out := Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: make([]uint64, len(h.Counts)),
+		Sum:    h.Sum + o.Sum,
+		Count:  h.Count + o.Count,
+	}
+	for i := range h.Counts {
+		out.Counts[i] = h.Counts[i] + o.Counts[i]
+	}
+	return out, nil
+}
+
+// Clone returns a deep copy of the histogram.
+func (h Histogram) Clone() Histogram {
+	h.Bounds = append([]float64(nil), h.Bounds...)
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// ParseHistogramBuckets parses a comma-separated list of bucket upper bounds such as "0.1,0.5,1".
+func ParseHistogramBuckets(raw string) ([]float64, error) {
+	parts := strings.Split(raw, ",")
+	bounds := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bucket %q: %v", ErrMetricInvalidValueType, p, err)
+		}
+		bounds = append(bounds, v)
+	}
+	if err := NewHistogram(bounds).Validate(); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+}
+
+// IsHistogram reports whether the metric type is HistogramType.
+func IsHistogram(t MetricType) bool {
+	return t == HistogramType
+}
+
+// NewHistogramMetrics constructs a histogram metric with the provided name and distribution.
+func NewHistogramMetrics(name string, h *Histogram) (*Metrics, error) {
+	return &Metrics{
+		ID:        name,
+		MType:     HistogramType,
+		Histogram: h,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram_ObserveAndMerge(t *testing.T) {
+	t.Parallel()
+
+	a := NewHistogram([]float64{1, 5})
+	a.Observe(0.5)
+	a.Observe(1)
+	a.Observe(7)
+	if !reflect.DeepEqual(a.Counts, []uint64{2, 0, 1}) || a.Count != 3 || a.Sum != 8.5 {
+		t.Fatalf("unexpected histogram: %+v", a)
+	}
+
+	b := NewHistogram([]float64{1, 5})
+	b.Observe(3)
+	merged, err := a.Merge(*b)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if !reflect.DeepEqual(merged.Counts, []uint64{2, 1, 1}) || merged.Count != 4 || merged.Sum != 11.5 {
+		t.Fatalf("unexpected merge: %+v", merged)
+	}
+	if a.Count != 3 || a.Counts[1] != 0 {
+		t.Fatalf("merge must not mutate operands: %+v", a)
+	}
+
+	if _, err := a.Merge(*NewHistogram([]float64{1, 10})); !errors.Is(err, ErrHistogramBucketsMismatch) {
+		t.Fatalf("want ErrHistogramBucketsMismatch, got %v", err)
+	}
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	t.Parallel()
+
+	cases := []Histogram{
+		{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1},
+		{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}},
+		{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 5},
+	}
+	for i, h := range cases {
+		if err := h.Validate(); !errors.Is(err, ErrMetricInvalidValueType) {
+			t.Fatalf("case %d: want ErrMetricInvalidValueType, got %v", i, err)
+		}
+	}
+	if err := NewHistogram(DefaultHistogramBuckets).Validate(); err != nil {
+		t.Fatalf("default buckets invalid: %v", err)
+	}
+}
+
+func TestParseHistogramBuckets(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseHistogramBuckets("0.1, 0.5,1")
+	if err != nil || !reflect.DeepEqual(got, []float64{0.1, 0.5, 1}) {
+		t.Fatalf("unexpected: %v %v", got, err)
+	}
+	for _, raw := range []string{"", "a", "1,1", "2,1"} {
+		if _, err := ParseHistogramBuckets(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestNewMetrics_Histogram(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewMetrics("lat", "0.2", HistogramType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Histogram == nil || m.Histogram.Count != 1 || len(m.Histogram.Bounds) != len(DefaultHistogramBuckets) {
+		t.Fatalf("unexpected histogram: %+v", m.Histogram)
+	}
+	if _, err := NewMetrics("lat", "x", HistogramType); !errors.Is(err, ErrMetricInvalidValueType) {
+		t.Fatalf("want ErrMetricInvalidValueType, got %v", err)
+	}
+
+	b, _ := json.Marshal(m)
+	var back Metrics
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.MType != HistogramType || !reflect.DeepEqual(back.Histogram, m.Histogram) {
+		t.Fatalf("json round trip mismatch: %+v", back)
+	}
+}
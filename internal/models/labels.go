@@ -0,0 +1,201 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrMetricInvalidLabel indicates that a label name or a series key could not be parsed.
+var ErrMetricInvalidLabel = errors.New("invalid metric label")
+
+const (
+	// InstanceLabel is the label that scopes a series to the agent instance that reported it.
+	InstanceLabel = "instance"
+	// InstanceHeader carries the agent instance identifier on HTTP requests.
+	InstanceHeader = "X-Instance-ID"
+	// IdempotencyKeyHeader carries the key that lets the server recognise a retried update request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+// seriesKeyChars delimit the label block of a series key and may not appear in metric names.
+const seriesKeyChars = `{}"=`
+
+// Labels holds the key/value dimensions of a metric series.
+type Labels map[string]string
+
+// Validate reports whether all label names are non-empty identifiers ([a-zA-Z_][a-zA-Z0-9_]*).
+func (l Labels) Validate() error {
+	for name := range l {
+		if !isLabelName(name) {
+			return fmt.Errorf("%w: %q", ErrMetricInvalidLabel, name)
+		}
+	}
+	return nil
+}
+
+// Clone returns an independent copy of the labels, or nil when there are none.
+func (l Labels) Clone() Labels {
+	if len(l) == 0 {
+		return nil
+	}
+	out := make(Labels, len(l))
+	for k, v := range l {
+		out[k] = v
+	}
+	return out
+}
+
+// SeriesKey returns the storage identity of a metric series.
+// Metrics without labels are keyed by their bare name, so label-less payloads keep their historical keys.
+// Labelled series are keyed as name{a="1",b="2"} with label names sorted and values escaped.
+func SeriesKey(name string, labels Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		writeEscapedLabelValue(&b, labels[k])
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseSeriesKey splits a key produced by SeriesKey back into the metric name and its labels.
+// Keys without a label block are returned unchanged with nil labels.
+func ParseSeriesKey(key string) (string, Labels, error) {
+	open := strings.IndexByte(key, '{')
+	if open < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil, nil
+	}
+	name := key[:open]
+	body := key[open+1 : len(key)-1]
+	labels := make(Labels)
+	for len(body) > 0 {
+		eq := strings.Index(body, `="`)
+		if eq <= 0 {
+			return "", nil, fmt.Errorf("%w: %q", ErrMetricInvalidLabel, key)
+		}
+		labelName := body[:eq]
+		if !isLabelName(labelName) {
+			return "", nil, fmt.Errorf("%w: %q", ErrMetricInvalidLabel, labelName)
+		}
+		value, rest, ok := readEscapedLabelValue(body[eq+2:])
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %q", ErrMetricInvalidLabel, key)
+		}
+		labels[labelName] = value
+		if rest != "" {
+			if rest[0] != ',' {
+				return "", nil, fmt.Errorf("%w: %q", ErrMetricInvalidLabel, key)
+			}
+			rest = rest[1:]
+		}
+		body = rest
+	}
+	if len(labels) == 0 {
+		return name, nil, nil
+	}
+	return name, labels, nil
+}
+
+// WithInstance scopes the metric to an agent instance by setting the instance label.
+// An empty instance leaves the metric in the shared namespace.
+func (m *Metrics) WithInstance(instance string) {
+	if instance == "" {
+		return
+	}
+	labels := m.Labels.Clone()
+	if labels == nil {
+		labels = make(Labels, 1)
+	}
+	labels[InstanceLabel] = instance
+	m.Labels = labels
+}
+
+// Key returns the series identity of the metric: its name combined with its labels.
+func (m *Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// SetKey fills the metric name and labels from a series key.
+// Keys that do not parse are kept verbatim as the metric name.
+func (m *Metrics) SetKey(key string) {
+	name, labels, err := ParseSeriesKey(key)
+	if err != nil {
+		m.ID, m.Labels = key, nil
+		return
+	}
+	m.ID, m.Labels = name, labels
+}
+
+func isLabelName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch == '_':
+		case ch >= '0' && ch <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func writeEscapedLabelValue(b *strings.Builder, v string) {
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+}
+
+// readEscapedLabelValue reads a quoted value up to its closing quote and returns the remainder.
+func readEscapedLabelValue(s string) (string, string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], true
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", false
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
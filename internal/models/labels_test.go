@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSeriesKey_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		labels Labels
+		key    string
+	}{
+		{"Alloc", nil, "Alloc"},
+		{"Alloc", Labels{}, "Alloc"},
+		{"CPUutilization", Labels{"host": "a", "cpu": "3"}, `CPUutilization{cpu="3",host="a"}`},
+		{"req", Labels{"path": `/a"b\c` + "\n"}, `req{path="/a\"b\\c\n"}`},
+		{"empty", Labels{"v": ""}, `empty{v=""}`},
+	}
+	for _, tc := range cases {
+		key := SeriesKey(tc.name, tc.labels)
+		if key != tc.key {
+			t.Fatalf("SeriesKey(%q, %v) = %q, want %q", tc.name, tc.labels, key, tc.key)
+		}
+		name, labels, err := ParseSeriesKey(key)
+		if err != nil {
+			t.Fatalf("ParseSeriesKey(%q): %v", key, err)
+		}
+		if name != tc.name {
+			t.Fatalf("name = %q, want %q", name, tc.name)
+		}
+		if len(tc.labels) == 0 {
+			if labels != nil {
+				t.Fatalf("expected nil labels, got %v", labels)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(labels, tc.labels) {
+			t.Fatalf("labels = %v, want %v", labels, tc.labels)
+		}
+	}
+}
+
+func TestParseSeriesKey_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, key := range []string{`m{cpu}`, `m{1a="x"}`, `m{a="x}`, `m{a="x"b="y"}`, `m{="x"}`} {
+		if _, _, err := ParseSeriesKey(key); !errors.Is(err, ErrMetricInvalidLabel) {
+			t.Fatalf("ParseSeriesKey(%q) err = %v, want ErrMetricInvalidLabel", key, err)
+		}
+	}
+}
+
+func TestSeriesKey_NameCannotCollideWithLabels(t *testing.T) {
+	t.Parallel()
+
+	v := 1.0
+	bare := Metrics{ID: `a{b="c"}`, MType: GaugeType, Value: &v}
+	labelled := Metrics{ID: "a", MType: GaugeType, Value: &v, Labels: Labels{"b": "c"}}
+	if bare.Key() != labelled.Key() {
+		t.Fatalf("keys differ: %q and %q", bare.Key(), labelled.Key())
+	}
+	if err := labelled.Validate(); err != nil {
+		t.Fatalf("labelled series must be valid: %v", err)
+	}
+	if err := bare.Validate(); !errors.Is(err, ErrMetricUnknownName) {
+		t.Fatalf("a name that spells the labelled key must be rejected, got %v", err)
+	}
+}
+
+func TestLabels_Validate(t *testing.T) {
+	t.Parallel()
+
+	if err := (Labels{"host": "a", "_cpu2": "1"}).Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"", "2cpu", "a-b", "a b"} {
+		if err := (Labels{name: "x"}).Validate(); !errors.Is(err, ErrMetricInvalidLabel) {
+			t.Fatalf("label %q: err = %v, want ErrMetricInvalidLabel", name, err)
+		}
+	}
+}
+
+func TestMetrics_LabelsJSON(t *testing.T) {
+	t.Parallel()
+
+	v := 1.5
+	plain, err := json.Marshal(&Metrics{ID: "Alloc", MType: GaugeType, Value: &v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(plain), "labels") {
+		t.Fatalf("label-less metric must not emit labels: %s", plain)
+	}
+
+	var m Metrics
+	if err := json.Unmarshal([]byte(`{"id":"CPU","type":"gauge","value":2,"labels":{"cpu":"1"}}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Key() != `CPU{cpu="1"}` {
+		t.Fatalf("unexpected key %q", m.Key())
+	}
+
+	var back Metrics
+	back.SetKey(m.Key())
+	if back.ID != "CPU" || !reflect.DeepEqual(back.Labels, m.Labels) {
+		t.Fatalf("SetKey mismatch: %+v", back)
+	}
+	back.SetKey(`bad{`)
+	if back.ID != "bad{" || back.Labels != nil {
+		t.Fatalf("unparsable key must be kept verbatim: %+v", back)
+	}
+}
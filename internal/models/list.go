@@ -0,0 +1,15 @@
+package models
+
+// ListOptions selects the metrics returned by a bulk read. Zero-valued fields do not filter.
+// IDs and Regex match the metric name, Prefix the series key, e.g. name{instance="a"}.
+// Instance keeps the series reported by one agent instance.
+// Cursor is the opaque value returned with the previous page.
+type ListOptions struct {
+	Type     MetricType `json:"type,omitempty"`
+	IDs      []string   `json:"ids,omitempty"`
+	Prefix   string     `json:"prefix,omitempty"`
+	Regex    string     `json:"regex,omitempty"`
+	Instance string     `json:"instance,omitempty"`
+	Cursor   string     `json:"cursor,omitempty"`
+	Limit    int        `json:"limit,omitempty"`
+}
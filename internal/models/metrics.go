@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type (
@@ -15,7 +18,7 @@ type (
 	Counter int64
 )
 
-// MetricType describes the domain-specific type of a metric (gauge or counter).
+// MetricType describes the domain-specific type of a metric (gauge, counter or histogram).
 type MetricType string
 
 const (
@@ -23,24 +26,37 @@ const (
 	GaugeType MetricType = "gauge"
 	// CounterType indicates counter metrics (integer values).
 	CounterType MetricType = "counter"
+	// HistogramType indicates bucketed distributions that are merged across updates.
+	HistogramType MetricType = "histogram"
 )
 
 // MetricTypes enumerates all supported metric types.
 var MetricTypes = []MetricType{
 	GaugeType,
 	CounterType,
+	HistogramType,
 }
 
 // IsValid reports whether the metric type is supported by the service.
 func (t MetricType) IsValid() bool {
 	switch t {
-	case GaugeType, CounterType:
+	case GaugeType, CounterType, HistogramType:
 		return true
 	default:
 		return false
 	}
 }
 
+// Rank orders metric types as listed in MetricTypes; unsupported types sort last.
+func (t MetricType) Rank() int {
+	for i, mt := range MetricTypes {
+		if mt == t {
+			return i
+		}
+	}
+	return len(MetricTypes)
+}
+
 // ParseMetricType converts a string into a MetricType and returns an error for unsupported values.
 func ParseMetricType(s string) (MetricType, error) {
 	mt := MetricType(s)
@@ -81,12 +97,28 @@ var (
 	ErrMetricInvalidValueType = errors.New("invalid value type for metric")
 	// ErrMetricMissingValue is returned when a required metric value is absent.
 	ErrMetricMissingValue = errors.New("missing value for metric")
-	// ErrMetricAmbiguousValue reports that both gauge and counter values were provided simultaneously.
-	ErrMetricAmbiguousValue = errors.New("both gauge and counter values are set")
+	// ErrMetricAmbiguousValue reports that a metric carries the value fields of more than one type.
+	ErrMetricAmbiguousValue = errors.New("metric carries values of more than one type")
 	// ErrMetricNameTypeMismatch indicates a mismatch between metric name and type.
 	ErrMetricNameTypeMismatch = errors.New("metric name does not match the metric type")
 )
 
+// MetricError attributes an error to the metric it concerns.
+type MetricError struct {
+	ID   string
+	Type MetricType
+	Err  error
+}
+
+func (e *MetricError) Error() string {
+	return fmt.Sprintf("%s %q: %v", e.Type, e.ID, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *MetricError) Unwrap() error {
+	return e.Err
+}
+
 func initSets() {
 	GaugeSet = make(map[string]struct{}, len(GaugeNames))
 	for _, n := range GaugeNames {
@@ -106,22 +138,22 @@ func init() {
 // Delta и Value объявлены через указатели, чтобы отличать значение "0" от не заданного значения и
 // соответственно не кодировать его в структуру.
 type Metrics struct {
-	ID    string     `json:"id"`
-	MType MetricType `json:"type"`
-	Delta *int64     `json:"delta,omitempty"`
-	Value *float64   `json:"value,omitempty"`
-	Hash  string     `json:"hash,omitempty"`
+	ID        string     `json:"id"`
+	MType     MetricType `json:"type"`
+	Delta     *int64     `json:"delta,omitempty"`
+	Value     *float64   `json:"value,omitempty"`
+	Hash      string     `json:"hash,omitempty"`
+	Labels    Labels     `json:"labels,omitempty"`
+	Histogram *Histogram `json:"histogram,omitempty"`
 }
 
-// func IsGaugeName(name string) bool {
-// _, ok := GaugeSet[name]
-// return ok
-// }
-
-// func IsCounterName(name string) bool {
-// _, ok := CounterSet[name]
-// return ok
-// }
+// Sample is a single historical observation of a metric.
+// Gauges populate Value, counters populate Delta with the accumulated total at Timestamp.
+type Sample struct {
+	Timestamp time.Time `json:"ts"`
+	Delta     *int64    `json:"delta,omitempty"`
+	Value     *float64  `json:"value,omitempty"`
+}
 
 // IsGauge reports whether the metric type is GaugeType.
 func IsGauge(t MetricType) bool {
@@ -133,15 +165,45 @@ func IsCounter(t MetricType) bool {
 	return t == CounterType
 }
 
+// Validate reports whether the metric is a well-formed update: it is named, has a supported type
+// and carries exactly the value field of that type, which for gauges must be finite.
+// Names must not contain the characters of the series key syntax, so that no name can be mistaken
+// for a labelled series; otherwise they are not restricted here, the server enforces allowed names
+// through its schema registry.
+func (m *Metrics) Validate() error {
+	if m.ID == "" {
+		return fmt.Errorf("%w: empty name", ErrMetricUnknownName)
+	}
+	if strings.ContainsAny(m.ID, seriesKeyChars) {
+		return fmt.Errorf("%w: %q contains one of %s", ErrMetricUnknownName, m.ID, seriesKeyChars)
+	}
+	var missing, ambiguous bool
+	switch m.MType {
+	case GaugeType:
+		missing = m.Value == nil
+		ambiguous = m.Delta != nil || m.Histogram != nil
+	case CounterType:
+		missing = m.Delta == nil
+		ambiguous = m.Value != nil || m.Histogram != nil
+	case HistogramType:
+		missing = m.Histogram == nil
+		ambiguous = m.Value != nil || m.Delta != nil
+	default:
+		return fmt.Errorf("%w: %q", ErrMetricInvalidType, m.MType)
+	}
+	switch {
+	case missing:
+		return ErrMetricMissingValue
+	case ambiguous:
+		return ErrMetricAmbiguousValue
+	case m.Value != nil && (math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0)):
+		return fmt.Errorf("%w: value is not finite", ErrMetricInvalidValueType)
+	}
+	return nil
+}
+
 // NewGaugeMetrics constructs a gauge metric with the provided name and value.
 func NewGaugeMetrics(name string, value *float64) (*Metrics, error) {
-	// if !IsGaugeName(name) {
-	// 	if IsCounterName(name) {
-	// 		return nil, ErrMetricNameTypeMismatch
-	// 	}
-	// 	return nil, fmt.Errorf("%w: %q", ErrMetricUnknownName, name)
-	// }
-
 	return &Metrics{
 		ID:    name,
 		MType: GaugeType,
@@ -151,13 +213,6 @@ func NewGaugeMetrics(name string, value *float64) (*Metrics, error) {
 
 // NewCounterMetrics constructs a counter metric with the provided name and delta.
 func NewCounterMetrics(name string, value *int64) (*Metrics, error) {
-	// if !IsCounterName(name) {
-	// 	if IsGaugeName(name) {
-	// 		return nil, ErrMetricNameTypeMismatch
-	// 	}
-	// 	return nil, fmt.Errorf("%w: %q", ErrMetricUnknownName, name)
-	// }
-
 	return &Metrics{
 		ID:    name,
 		MType: CounterType,
@@ -191,6 +246,19 @@ func NewMetrics(name string, value string, t MetricType) (*Metrics, error) {
 		return NewCounterMetrics(name, p)
 	}
 
+	if IsHistogram(t) {
+		var h *Histogram
+		if value != "" {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: parse float64 for %q: %v", ErrMetricInvalidValueType, name, err)
+			}
+			h = NewHistogram(DefaultHistogramBuckets)
+			h.Observe(v)
+		}
+		return NewHistogramMetrics(name, h)
+	}
+
 	return nil, fmt.Errorf("%w: %q", ErrMetricUnknownName, name)
 }
 
@@ -200,31 +268,6 @@ func (m *Metrics) MarshalJSON() ([]byte, error) {
 		return []byte("null"), nil
 	}
 
-	// switch MetricType(m.MType) {
-	// case GaugeType:
-	// 	if !IsGaugeName(m.ID) {
-	// 		return nil, fmt.Errorf("%w: %q", ErrMetricUnknownName, m.ID)
-	// 	}
-	// 	if m.Value == nil {
-	// 		return nil, ErrMetricMissingValue
-	// 	}
-	// 	if m.Delta != nil {
-	// 		return nil, ErrMetricAmbiguousValue
-	// 	}
-	// case CounterType:
-	// 	if !IsCounterName(m.ID) {
-	// 		return nil, fmt.Errorf("%w: %q", ErrMetricUnknownName, m.ID)
-	// 	}
-	// 	if m.Delta == nil {
-	// 		return nil, ErrMetricMissingValue
-	// 	}
-	// 	if m.Value != nil {
-	// 		return nil, ErrMetricAmbiguousValue
-	// 	}
-	// default:
-	// 	return nil, ErrMetricInvalidType
-	// }
-
 	type alias Metrics
 	return json.Marshal(alias(*m))
 }
@@ -232,11 +275,13 @@ func (m *Metrics) MarshalJSON() ([]byte, error) {
 // UnmarshalJSON deserialises metric JSON payloads into the Metrics struct.
 func (m *Metrics) UnmarshalJSON(data []byte) error {
 	type alias struct {
-		ID    string     `json:"id"`
-		MType MetricType `json:"type"`
-		Delta *int64     `json:"delta,omitempty"`
-		Value *float64   `json:"value,omitempty"`
-		Hash  string     `json:"hash,omitempty"`
+		ID        string     `json:"id"`
+		MType     MetricType `json:"type"`
+		Delta     *int64     `json:"delta,omitempty"`
+		Value     *float64   `json:"value,omitempty"`
+		Hash      string     `json:"hash,omitempty"`
+		Labels    Labels     `json:"labels,omitempty"`
+		Histogram *Histogram `json:"histogram,omitempty"`
 	}
 
 	var a alias
@@ -244,40 +289,11 @@ func (m *Metrics) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	// switch MetricType(a.MType) {
-	// case GaugeType:
-	// 	if a.Value == nil {
-	// 		return ErrMetricMissingValue
-	// 	}
-	// 	if a.Delta != nil {
-	// 		return ErrMetricAmbiguousValue
-	// 	}
-	// 	if !IsGauge(a.MType) {
-	// 		if IsCounter(a.MType) {
-	// 			return ErrMetricNameTypeMismatch
-	// 		}
-	// 		return fmt.Errorf("%w: %q", ErrMetricInvalidType, a.ID)
-	// 	}
-	// case CounterType:
-	// 	if a.Delta == nil {
-	// 		return ErrMetricMissingValue
-	// 	}
-	// 	if a.Value != nil {
-	// 		return ErrMetricAmbiguousValue
-	// 	}
-	// 	if !IsCounter(a.MType) {
-	// 		if IsGauge(a.MType) {
-	// 			return ErrMetricNameTypeMismatch
-	// 		}
-	// 		return fmt.Errorf("%w: %q", ErrMetricInvalidType, a.ID)
-	// 	}
-	// default:
-	// 	return ErrMetricInvalidType
-	// }
-
 	m.ID = a.ID
 	m.MType = a.MType
 	m.Delta = a.Delta
 	m.Value = a.Value
+	m.Labels = a.Labels
+	m.Histogram = a.Histogram
 	return nil
 }
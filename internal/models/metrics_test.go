@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -181,12 +182,25 @@ func TestUnmarshalJSON_Errors(t *testing.T) {
 func TestMetricTypes_OrderAndContents(t *testing.T) {
 	t.Parallel()
 
-	want := []MetricType{GaugeType, CounterType}
+	want := []MetricType{GaugeType, CounterType, HistogramType}
 	if !reflect.DeepEqual(MetricTypes, want) {
 		t.Fatalf("MetricTypes mismatch.\n got: %v\nwant: %v", MetricTypes, want)
 	}
 }
 
+func TestMetricType_Rank(t *testing.T) {
+	t.Parallel()
+
+	for i, mt := range MetricTypes {
+		if got := mt.Rank(); got != i {
+			t.Fatalf("%s rank = %d, want %d", mt, got, i)
+		}
+	}
+	if got := MetricType("summary").Rank(); got != len(MetricTypes) {
+		t.Fatalf("unknown type rank = %d, want %d", got, len(MetricTypes))
+	}
+}
+
 func TestMetricType_IsValid(t *testing.T) {
 	t.Parallel()
 
@@ -241,3 +255,48 @@ func TestParseMetricType(t *testing.T) {
 		t.Fatalf("expected ErrMetricInvalidType for empty, got %v", err)
 	}
 }
+
+func TestMetrics_Validate(t *testing.T) {
+	t.Parallel()
+
+	v := 1.5
+	d := int64(2)
+	nan := math.NaN()
+	h := &Histogram{}
+
+	tests := []struct {
+		name string
+		m    Metrics
+		want error
+	}{
+		{"gauge", Metrics{ID: "a", MType: GaugeType, Value: &v}, nil},
+		{"counter", Metrics{ID: "a", MType: CounterType, Delta: &d}, nil},
+		{"histogram", Metrics{ID: "a", MType: HistogramType, Histogram: h}, nil},
+		{"empty name", Metrics{MType: GaugeType, Value: &v}, ErrMetricUnknownName},
+		{"name with label block", Metrics{ID: `a{b="c"}`, MType: GaugeType, Value: &v}, ErrMetricUnknownName},
+		{"name with brace", Metrics{ID: "a}", MType: GaugeType, Value: &v}, ErrMetricUnknownName},
+		{"name with equals", Metrics{ID: "a=b", MType: GaugeType, Value: &v}, ErrMetricUnknownName},
+		{"name with quote", Metrics{ID: `a"`, MType: GaugeType, Value: &v}, ErrMetricUnknownName},
+		{"bad type", Metrics{ID: "a", MType: "weird", Value: &v}, ErrMetricInvalidType},
+		{"gauge without value", Metrics{ID: "a", MType: GaugeType}, ErrMetricMissingValue},
+		{"counter without delta", Metrics{ID: "a", MType: CounterType, Value: &v}, ErrMetricMissingValue},
+		{"histogram without buckets", Metrics{ID: "a", MType: HistogramType}, ErrMetricMissingValue},
+		{"gauge with delta", Metrics{ID: "a", MType: GaugeType, Value: &v, Delta: &d}, ErrMetricAmbiguousValue},
+		{"counter with histogram", Metrics{ID: "a", MType: CounterType, Delta: &d, Histogram: h}, ErrMetricAmbiguousValue},
+		{"gauge NaN", Metrics{ID: "a", MType: GaugeType, Value: &nan}, ErrMetricInvalidValueType},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.m.Validate()
+			if tt.want == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
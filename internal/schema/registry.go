@@ -0,0 +1,189 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// UnitLabel is the label through which an update may state the unit of its value.
+const UnitLabel = "unit"
+
+var (
+	// ErrInvalidSchema indicates a schema file that cannot be read or declares an invalid rule.
+	ErrInvalidSchema = errors.New("invalid metric schema")
+	// ErrSchemaViolation is matched by every *ValidationError.
+	ErrSchemaViolation = errors.New("metric violates schema")
+)
+
+// Rule declares the metrics whose name equals Name or matches Pattern in path.Match syntax.
+// Min and Max bound gauge values and counter deltas; Unit is the only unit an update may state.
+type Rule struct {
+	Name    string            `json:"name,omitempty"`
+	Pattern string            `json:"pattern,omitempty"`
+	Type    models.MetricType `json:"type"`
+	Min     *float64          `json:"min,omitempty"`
+	Max     *float64          `json:"max,omitempty"`
+	Unit    string            `json:"unit,omitempty"`
+}
+
+func (r Rule) matches(name string) bool {
+	if r.Name != "" {
+		return r.Name == name
+	}
+	ok, _ := path.Match(r.Pattern, name)
+	return ok
+}
+
+// Registry holds the declared metrics. The first rule matching a metric name applies;
+// metrics matching no rule are accepted unless the registry is strict.
+// A nil *Registry accepts every metric.
+type Registry struct {
+	Strict bool   `json:"strict"`
+	Rules  []Rule `json:"metrics"`
+}
+
+// Load reads a registry from a JSON file.
+func Load(file string) (*Registry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes a registry from JSON and checks its rules.
+func Parse(data []byte) (*Registry, error) {
+	var r Registry
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	for i, rule := range r.Rules {
+		if err := rule.check(); err != nil {
+			return nil, fmt.Errorf("%w: rule %d: %s", ErrInvalidSchema, i, err)
+		}
+	}
+	return &r, nil
+}
+
+func (r Rule) check() error {
+	switch {
+	case (r.Name == "") == (r.Pattern == ""):
+		return errors.New("exactly one of name and pattern is required")
+	case !r.Type.IsValid():
+		return fmt.Errorf("invalid type %q", r.Type)
+	case r.Min != nil && r.Max != nil && *r.Min > *r.Max:
+		return errors.New("min is above max")
+	}
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q", r.Pattern)
+	}
+	return nil
+}
+
+// Lookup returns the rule that applies to the metric name.
+func (r *Registry) Lookup(name string) (Rule, bool) {
+	if r == nil {
+		return Rule{}, false
+	}
+	for _, rule := range r.Rules {
+		if rule.matches(name) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Validate checks the metrics against the registry and returns a *ValidationError listing every violation,
+// or nil when all of them conform.
+func (r *Registry) Validate(metrics ...models.Metrics) error {
+	if r == nil {
+		return nil
+	}
+	var violations []Violation
+	for i := range metrics {
+		violations = r.check(violations, &metrics[i])
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+func (r *Registry) check(violations []Violation, m *models.Metrics) []Violation {
+	add := func(field, format string, args ...any) {
+		violations = append(violations, Violation{ID: m.ID, Type: m.MType, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	rule, ok := r.Lookup(m.ID)
+	if !ok {
+		if r.Strict {
+			add("id", "metric is not declared in the schema")
+		}
+		return violations
+	}
+	if rule.Type != m.MType {
+		add("type", "metric is declared as %s", rule.Type)
+		return violations
+	}
+
+	var (
+		field string
+		value float64
+	)
+	switch {
+	case m.Value != nil:
+		field, value = "value", *m.Value
+	case m.Delta != nil:
+		field, value = "delta", float64(*m.Delta)
+	}
+	if field != "" {
+		if rule.Min != nil && value < *rule.Min {
+			add(field, "%v is below the minimum %v", value, *rule.Min)
+		}
+		if rule.Max != nil && value > *rule.Max {
+			add(field, "%v is above the maximum %v", value, *rule.Max)
+		}
+	}
+	if unit, ok := m.Labels[UnitLabel]; ok && rule.Unit != "" && unit != rule.Unit {
+		add("labels."+UnitLabel, "unit must be %q", rule.Unit)
+	}
+	return violations
+}
+
+// Violation describes why a metric does not conform to the schema.
+type Violation struct {
+	ID      string            `json:"id"`
+	Type    models.MetricType `json:"type"`
+	Field   string            `json:"field"`
+	Message string            `json:"message"`
+}
+
+// ValidationError lists the schema violations found in an update.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString(ErrSchemaViolation.Error())
+	for i, v := range e.Violations {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%s %s: %s", v.ID, v.Field, v.Message)
+	}
+	return b.String()
+}
+
+// Is reports whether target is ErrSchemaViolation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrSchemaViolation
+}
@@ -0,0 +1,148 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+const testSchema = `{
+	"strict": true,
+	"metrics": [
+		{"name": "Alloc", "type": "gauge", "min": 0, "unit": "bytes"},
+		{"name": "PollCount", "type": "counter", "max": 100},
+		{"pattern": "cpu_*", "type": "gauge", "min": 0, "max": 100, "unit": "percent"}
+	]
+}`
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.GaugeType, Value: &v}
+}
+
+func counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.CounterType, Delta: &d}
+}
+
+func TestParse_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"syntax":          `{`,
+		"no name":         `{"metrics":[{"type":"gauge"}]}`,
+		"name and match":  `{"metrics":[{"name":"a","pattern":"a*","type":"gauge"}]}`,
+		"bad type":        `{"metrics":[{"name":"a","type":"weird"}]}`,
+		"min above max":   `{"metrics":[{"name":"a","type":"gauge","min":2,"max":1}]}`,
+		"invalid pattern": `{"metrics":[{"pattern":"[","type":"gauge"}]}`,
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: Parse() = %v, want ErrInvalidSchema", name, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(file, []byte(testSchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(file)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !r.Strict || len(r.Rules) != 3 {
+		t.Fatalf("unexpected registry: %+v", r)
+	}
+	if rule, ok := r.Lookup("cpu_0"); !ok || rule.Unit != "percent" {
+		t.Fatalf("Lookup(cpu_0) = %+v, %v", rule, ok)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("Load(missing) = %v, want ErrInvalidSchema", err)
+	}
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	t.Parallel()
+
+	r, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	withUnit := func(m models.Metrics, unit string) models.Metrics {
+		m.Labels = models.Labels{UnitLabel: unit}
+		return m
+	}
+
+	tests := []struct {
+		name  string
+		m     models.Metrics
+		field string
+	}{
+		{"declared gauge", withUnit(gauge("Alloc", 10), "bytes"), ""},
+		{"pattern gauge", gauge("cpu_1", 50), ""},
+		{"counter in range", counter("PollCount", 5), ""},
+		{"undeclared", gauge("Other", 1), "id"},
+		{"type mismatch", counter("Alloc", 1), "type"},
+		{"below min", gauge("Alloc", -1), "value"},
+		{"above max", gauge("cpu_1", 101), "value"},
+		{"delta above max", counter("PollCount", 101), "delta"},
+		{"wrong unit", withUnit(gauge("cpu_1", 1), "ratio"), "labels.unit"},
+	}
+	for _, tt := range tests {
+		err := r.Validate(tt.m)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		var ve *ValidationError
+		if !errors.As(err, &ve) || !errors.Is(err, ErrSchemaViolation) {
+			t.Errorf("%s: Validate() = %v, want *ValidationError", tt.name, err)
+			continue
+		}
+		if len(ve.Violations) != 1 || ve.Violations[0].Field != tt.field || ve.Violations[0].ID != tt.m.ID {
+			t.Errorf("%s: violations = %+v, want field %q", tt.name, ve.Violations, tt.field)
+		}
+	}
+}
+
+func TestRegistry_ValidateCollectsEveryViolation(t *testing.T) {
+	t.Parallel()
+
+	r, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	err = r.Validate(gauge("Alloc", 1), gauge("Other", 1), counter("PollCount", 500))
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Violations) != 2 {
+		t.Fatalf("Validate() = %v, want two violations", err)
+	}
+}
+
+func TestRegistry_NilAcceptsEverything(t *testing.T) {
+	t.Parallel()
+
+	var r *Registry
+	if err := r.Validate(gauge("anything", -1)); err != nil {
+		t.Fatalf("nil registry: %v", err)
+	}
+	if _, ok := r.Lookup("anything"); ok {
+		t.Fatal("nil registry found a rule")
+	}
+
+	lax, err := Parse([]byte(`{"metrics":[{"name":"a","type":"gauge"}]}`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := lax.Validate(counter("undeclared", 1)); err != nil {
+		t.Fatalf("non-strict registry rejected an undeclared metric: %v", err)
+	}
+}
@@ -17,3 +17,10 @@ type ContextualSender interface {
 	SenderInterface
 	SendWithContext(ctx context.Context, metrics []*models.Metrics)
 }
+
+// StreamingSender is implemented by senders that submit a whole report in one request;
+// the agent hands them all the metrics of a report at once instead of one metric per call.
+type StreamingSender interface {
+	SenderInterface
+	SendStream(ctx context.Context, metrics []*models.Metrics)
+}
@@ -0,0 +1,186 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcapi/metricspb"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/retrier"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrGRPCSenderDial indicates that the gRPC client could not be created for the target address.
+	ErrGRPCSenderDial = errors.New("grpc dial failed")
+	// ErrGRPCSenderSeal indicates that signing or encrypting the request failed.
+	ErrGRPCSenderSeal = errors.New("seal request failed")
+)
+
+// GRPCSender sends metrics over the gRPC Metrics service.
+// Send streams metrics one message per metric, SendBatch uses the unary batch RPC.
+type GRPCSender struct {
+	addr    string
+	conn    *grpc.ClientConn
+	client  metricspb.MetricsClient
+	log     logger.Logger
+	signKey sign.SignKey
+	enc     cryptoutil.Encryptor
+	delays  []time.Duration
+
+	instance string
+	realIP   string
+}
+
+// NewGRPCSender constructs a GRPCSender for the server gRPC address. The connection is established lazily.
+func NewGRPCSender(addr string, l logger.Logger, k sign.SignKey, e cryptoutil.Encryptor) (*GRPCSender, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGRPCSenderDial, err)
+	}
+	return &GRPCSender{
+		addr:    addr,
+		conn:    conn,
+		client:  metricspb.NewMetricsClient(conn),
+		log:     l,
+		signKey: k,
+		enc:     e,
+		delays:  retrier.DefaultDelays,
+	}, nil
+}
+
+// SetInstance makes the sender identify itself with the given agent instance on every call.
+func (s *GRPCSender) SetInstance(instance string) {
+	s.instance = instance
+}
+
+// SetRealIP makes the sender report the agent address so the server can check it against its trusted subnet.
+func (s *GRPCSender) SetRealIP(ip string) {
+	s.realIP = ip
+}
+
+// Close releases the underlying connection.
+func (s *GRPCSender) Close() error {
+	return s.conn.Close()
+}
+
+// Send streams metrics to the server, one message per metric.
+func (s *GRPCSender) Send(metrics []*models.Metrics) {
+	s.SendWithContext(context.Background(), metrics)
+}
+
+// SendWithContext streams metrics using the provided context, applying a timeout to the whole stream.
+func (s *GRPCSender) SendWithContext(ctx context.Context, metrics []*models.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sendCtx, cancel := context.WithTimeout(s.outgoingContext(ctx), 10*time.Second)
+	defer cancel()
+
+	reqs := make([]*metricspb.UpdateMetricsRequest, 0, len(metrics))
+	for _, m := range metrics {
+		if m == nil {
+			continue
+		}
+		req, err := grpcapi.SealRequest([]*metricspb.Metric{grpcapi.ToProto(m)}, s.signKey, s.enc)
+		if err != nil {
+			s.log.WriteError(ErrGRPCSenderSeal.Error(), "id", m.ID, "type", m.MType, "error", err)
+			return
+		}
+		reqs = append(reqs, req)
+	}
+
+	var accepted uint64
+	err := retrier.Do(sendCtx, func() error {
+		stream, err := s.client.StreamMetrics(sendCtx)
+		if err != nil {
+			return err
+		}
+		for _, req := range reqs {
+			if err := stream.Send(req); err != nil {
+				// The real cause is reported by CloseAndRecv.
+				break
+			}
+		}
+		resp, err := stream.CloseAndRecv()
+		if err != nil {
+			return err
+		}
+		accepted = resp.GetAccepted()
+		return nil
+	}, isRetriableGRPCError, s.delays)
+	if err != nil {
+		s.log.WriteError("stream metrics failed", "addr", s.addr, "error", err)
+		return
+	}
+
+	s.log.WriteInfo("metrics streamed (grpc)", "count", accepted, "addr", s.addr)
+}
+
+// SendBatch sends all metrics in a single UpdateMetrics call.
+func (s *GRPCSender) SendBatch(metrics []*models.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(s.outgoingContext(context.Background()), 10*time.Second)
+	defer cancel()
+
+	pm := make([]*metricspb.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if m != nil {
+			pm = append(pm, grpcapi.ToProto(m))
+		}
+	}
+	req, err := grpcapi.SealRequest(pm, s.signKey, s.enc)
+	if err != nil {
+		s.log.WriteError(ErrGRPCSenderSeal.Error(), "error", err)
+		return
+	}
+
+	var resp *metricspb.UpdateMetricsResponse
+	err = retrier.Do(ctx, func() error {
+		var err error
+		resp, err = s.client.UpdateMetrics(ctx, req)
+		return err
+	}, isRetriableGRPCError, s.delays)
+	if err != nil {
+		s.log.WriteError("update metrics failed", "addr", s.addr, "error", err)
+		return
+	}
+
+	s.log.WriteInfo("metrics batch sent (grpc)", "count", resp.GetAccepted(), "addr", s.addr)
+}
+
+func (s *GRPCSender) outgoingContext(ctx context.Context) context.Context {
+	if s.instance != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, grpcapi.InstanceMetadataKey, s.instance)
+	}
+	if s.realIP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, grpcapi.RealIPMetadataKey, s.realIP)
+	}
+	return ctx
+}
+
+func isRetriableGRPCError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+var _ ContextualSender = (*GRPCSender)(nil)
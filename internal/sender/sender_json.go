@@ -3,35 +3,39 @@ package sender
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/retrier"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
 )
 
 var (
-	// ErrJSONSenderMarshal indicates that serialising metrics to JSON failed.
+	// ErrJSONSenderMarshal indicates that serialising metrics failed.
 	ErrJSONSenderMarshal = errors.New("marshal metric failed")
 	// ErrJSONSenderEncodeBody indicates that request body compression failed.
 	ErrJSONSenderEncodeBody = errors.New("encode body failed")
 	// ErrJSONSenderBuildRequest indicates that an HTTP request could not be constructed.
 	ErrJSONSenderBuildRequest = errors.New("build request failed")
-	// ErrJSONSenderUnexpectedContentType indicates that the response content type was not JSON.
+	// ErrJSONSenderUnexpectedContentType indicates that the response content type was not the requested format.
 	ErrJSONSenderUnexpectedContentType = errors.New("unexpected content-type")
 	// ErrJSONSenderUnexpectedStatus indicates that the server returned a non-200 status code.
 	ErrJSONSenderUnexpectedStatus = errors.New("unexpected status")
 )
 
 // JSONSender sends metrics encoded as JSON, optionally compressed.
+// SetCodec switches /update and /updates bodies to another format.
 type JSONSender struct {
 	baseURL string
 	port    int
@@ -40,6 +44,10 @@ type JSONSender struct {
 	comp    compression.Compressor
 	signKey sign.SignKey
 	enc     cryptoutil.Encryptor
+	codec   codec.Codec
+
+	instance string
+	realIP   string
 }
 
 // NewJSONSender constructs a JSONSender for communicating with the server.
@@ -54,10 +62,27 @@ func NewJSONSender(baseURL string, port int, client *http.Client, l logger.Logge
 		comp:    c,
 		signKey: k,
 		enc:     e,
+		codec:   codec.JSON,
 	}
 }
 
-// Send posts metrics one-by-one to the /update JSON endpoint.
+// SetCodec makes the sender encode the bodies of /update and /updates requests, and ask for the responses,
+// in the format of the codec.
+func (s *JSONSender) SetCodec(c codec.Codec) {
+	s.codec = c
+}
+
+// SetInstance makes the sender identify itself with the given agent instance on every request.
+func (s *JSONSender) SetInstance(instance string) {
+	s.instance = instance
+}
+
+// SetRealIP makes the sender report the agent address so the server can check it against its trusted subnet.
+func (s *JSONSender) SetRealIP(ip string) {
+	s.realIP = ip
+}
+
+// Send posts metrics one-by-one to the /update endpoint.
 func (s *JSONSender) Send(metrics []*models.Metrics) {
 	s.SendWithContext(context.Background(), metrics)
 }
@@ -75,7 +100,7 @@ func (s *JSONSender) SendWithContext(ctx context.Context, metrics []*models.Metr
 	}
 }
 
-// SendBatch posts multiple metrics to the /updates JSON endpoint.
+// SendBatch posts multiple metrics to the /updates endpoint.
 func (s *JSONSender) SendBatch(metrics []*models.Metrics) {
 	if len(metrics) == 0 {
 		return
@@ -108,7 +133,7 @@ func (s *JSONSender) SendBatch(metrics []*models.Metrics) {
 	}
 	defer resp.Body.Close()
 
-	if err := s.validateResponse(resp); err != nil {
+	if err := s.validateResponse(resp, s.codec.ContentType()); err != nil {
 		s.log.WriteError(err.Error(), "url", s.baseURL+"/updates")
 		return
 	}
@@ -142,7 +167,7 @@ func (s *JSONSender) postMetric(ctx context.Context, m *models.Metrics) {
 	}
 	defer resp.Body.Close()
 
-	if err := s.validateResponse(resp); err != nil {
+	if err := s.validateResponse(resp, s.codec.ContentType()); err != nil {
 		s.log.WriteError(err.Error(), "url", s.baseURL+"/update")
 		return
 	}
@@ -151,7 +176,7 @@ func (s *JSONSender) postMetric(ctx context.Context, m *models.Metrics) {
 }
 
 func (s *JSONSender) marshalMetric(m *models.Metrics) ([]byte, error) {
-	b, err := json.Marshal(m)
+	b, err := s.codec.Marshal(m)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrJSONSenderMarshal, err)
 	}
@@ -190,7 +215,23 @@ func (s *JSONSender) encryptBody(body []byte) ([]byte, string, error) {
 }
 
 func (s *JSONSender) buildRequest(ctx context.Context, body []byte) (*http.Request, error) {
-	u := s.baseURL + "/update"
+	return s.newCodecRequest(ctx, "/update", body)
+}
+
+// newCodecRequest builds a request whose body, and the expected response, are in the format of the codec.
+func (s *JSONSender) newCodecRequest(ctx context.Context, path string, body []byte) (*http.Request, error) {
+	req, err := s.newRequest(ctx, path, s.codec.ContentType(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", s.codec.ContentType())
+	return req, nil
+}
+
+// newRequest builds a POST of the encoded body to path: it encrypts the body when a key is configured
+// and sets the headers that describe the body and identify the agent and the request.
+func (s *JSONSender) newRequest(ctx context.Context, path, contentType string, body []byte) (*http.Request, error) {
+	u := s.baseURL + path
 	cipherBody, encryptedKey, err := s.encryptBody(body)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrJSONSenderEncodeBody, err)
@@ -199,7 +240,7 @@ func (s *JSONSender) buildRequest(ctx context.Context, body []byte) (*http.Reque
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrJSONSenderBuildRequest, err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	if s.comp != nil {
 		enc := s.comp.ContentEncoding()
 		req.Header.Set("Content-Encoding", enc)
@@ -211,12 +252,23 @@ func (s *JSONSender) buildRequest(ctx context.Context, body []byte) (*http.Reque
 	if s.signKey != "" {
 		req.Header.Set("HashSHA256", sign.NewSignerSHA256().Sign(body, s.signKey))
 	}
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJSONSenderBuildRequest, err)
+	}
+	req.Header.Set(models.IdempotencyKeyHeader, key)
+	if s.instance != "" {
+		req.Header.Set(models.InstanceHeader, s.instance)
+	}
+	if s.realIP != "" {
+		req.Header.Set(subnet.RealIPHeader, s.realIP)
+	}
 	return req, nil
 }
 
-func (s *JSONSender) validateResponse(resp *http.Response) error {
+func (s *JSONSender) validateResponse(resp *http.Response, contentType string) error {
 	ct := resp.Header.Get("Content-Type")
-	if !strings.HasPrefix(ct, "application/json") {
+	if !strings.HasPrefix(ct, contentType) {
 		return fmt.Errorf("%w: got %q", ErrJSONSenderUnexpectedContentType, ct)
 	}
 	if resp.StatusCode != http.StatusOK {
@@ -226,7 +278,7 @@ func (s *JSONSender) validateResponse(resp *http.Response) error {
 }
 
 func (s *JSONSender) marshalMetrics(m []*models.Metrics) ([]byte, error) {
-	b, err := json.Marshal(m)
+	b, err := s.codec.Marshal(m)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrJSONSenderMarshal, err)
 	}
@@ -234,29 +286,17 @@ func (s *JSONSender) marshalMetrics(m []*models.Metrics) ([]byte, error) {
 }
 
 func (s *JSONSender) buildBatchRequest(ctx context.Context, body []byte) (*http.Request, error) {
-	u := s.baseURL + "/updates"
-	cipherBody, encryptedKey, err := s.encryptBody(body)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrJSONSenderEncodeBody, err)
-	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(cipherBody))
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrJSONSenderBuildRequest, err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	if s.comp != nil {
-		enc := s.comp.ContentEncoding()
-		req.Header.Set("Content-Encoding", enc)
-		req.Header.Set("Accept-Encoding", enc)
-	}
-	if encryptedKey != "" {
-		req.Header.Set(cryptoutil.CryptoKeyHeader, encryptedKey)
-	}
-	if s.signKey != "" {
-		req.Header.Set("HashSHA256", sign.NewSignerSHA256().Sign(body, s.signKey))
-	}
-	return req, nil
+	return s.newCodecRequest(ctx, "/updates", body)
+}
 
+// newIdempotencyKey returns a random key for a request. Retries of the request reuse it,
+// so the server applies the request at most once.
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate idempotency key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
 }
 
 var _ SenderInterface = NewJSONSender("", 0, nil, nil, nil, "", nil)
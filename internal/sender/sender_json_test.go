@@ -21,9 +21,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/handler"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sender"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 )
 
@@ -599,3 +606,104 @@ func TestJSONSender_SendBatch_SendsAll(t *testing.T) {
 type roundTripperFunc func(*http.Request) (*http.Response, error)
 
 func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestJSONSender_SetInstance_SendsHeader(t *testing.T) {
+	var single, batch, realIP string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/updates" {
+			batch = r.Header.Get(models.InstanceHeader)
+		} else {
+			single = r.Header.Get(models.InstanceHeader)
+		}
+		realIP = r.Header.Get(subnet.RealIPHeader)
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	host, port := hostPortFromServer(t, srv)
+	s := sender.NewJSONSender(host, port, srv.Client(), &test.FakeLogger{}, nil, "", nil)
+	s.SetInstance("host-1")
+	s.SetRealIP("10.0.0.7")
+	g := 1.0
+	m := []*models.Metrics{{ID: "Alloc", MType: models.GaugeType, Value: &g}}
+	s.Send(m)
+	s.SendBatch(m)
+
+	if single != "host-1" || batch != "host-1" {
+		t.Fatalf("instance header not sent: single=%q batch=%q", single, batch)
+	}
+	if realIP != "10.0.0.7" {
+		t.Fatalf("real ip header not sent: %q", realIP)
+	}
+}
+
+func TestJSONSender_SendBatch_RetryKeepsIdempotencyKey(t *testing.T) {
+	var keys []string
+	cl := &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			keys = append(keys, r.Header.Get(models.IdempotencyKeyHeader))
+			if len(keys) == 1 {
+				return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(bytes.NewReader(nil)),
+			}, nil
+		}),
+	}
+	s := sender.NewJSONSender("localhost", 1, cl, &test.FakeLogger{}, nil, "", nil)
+	g := 1.0
+	m := []*models.Metrics{{ID: "Alloc", MType: models.GaugeType, Value: &g}}
+	s.SendBatch(m)
+	s.SendBatch(m)
+
+	if len(keys) != 3 || keys[0] == "" {
+		t.Fatalf("unexpected keys %q", keys)
+	}
+	if keys[1] != keys[0] {
+		t.Fatalf("retry must reuse the key: %q", keys)
+	}
+	if keys[2] == keys[0] {
+		t.Fatalf("a new batch must get a new key: %q", keys)
+	}
+}
+
+func TestJSONSender_SetCodec_SendsFormat(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.Protobuf, codec.MsgPack} {
+		gin.SetMode(gin.TestMode)
+		st := storage.NewMemStorage()
+		r := gin.New()
+		r.Use(compression.Middleware(compression.NewGzip(compression.BestSpeed)))
+		handler.NewGinHandler(service.NewMetricService(st), nil).RegisterUpdate(r)
+		var types []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			types = append(types, req.Header.Get("Content-Type"))
+			r.ServeHTTP(w, req)
+		}))
+
+		host, port := hostPortFromServer(t, srv)
+		log := &test.FakeLogger{}
+		s := sender.NewJSONSender(host, port, srv.Client(), log, compression.NewGzip(compression.BestSpeed), "", nil)
+		s.SetCodec(cd)
+		g, d := 1.5, int64(2)
+		s.Send([]*models.Metrics{{ID: "Alloc", MType: models.GaugeType, Value: &g}})
+		s.SendBatch([]*models.Metrics{{ID: "PollCount", MType: models.CounterType, Delta: &d}})
+		srv.Close()
+
+		if errs := log.GetErrorMessages(); len(errs) != 0 {
+			t.Fatalf("%s: unexpected errors: %v", cd.ContentType(), errs)
+		}
+		if len(types) != 2 || types[0] != cd.ContentType() || types[1] != cd.ContentType() {
+			t.Fatalf("%s: request content types %q", cd.ContentType(), types)
+		}
+		if v, err := st.GetGauge("Alloc"); err != nil || v != g {
+			t.Fatalf("%s: gauge = %v, %v", cd.ContentType(), v, err)
+		}
+		if v, err := st.GetCounter("PollCount"); err != nil || v != d {
+			t.Fatalf("%s: counter = %d, %v", cd.ContentType(), v, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/codec"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/retrier"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+)
+
+// NDJSONSender sends every report as one newline-delimited JSON request to the /updates/stream endpoint,
+// which applies it in chunks, so reports of any size can be sent. Compression, signing and encryption
+// are applied as in JSONSender.
+type NDJSONSender struct {
+	*JSONSender
+}
+
+// NewNDJSONSender constructs an NDJSONSender for communicating with the server.
+func NewNDJSONSender(baseURL string, port int, client *http.Client, l logger.Logger, c compression.Compressor, k sign.SignKey, e cryptoutil.Encryptor) *NDJSONSender {
+	return &NDJSONSender{JSONSender: NewJSONSender(baseURL, port, client, l, c, k, e)}
+}
+
+// Send posts the metrics as one stream.
+func (s *NDJSONSender) Send(metrics []*models.Metrics) {
+	s.SendStream(context.Background(), metrics)
+}
+
+// SendWithContext posts the metrics as one stream using the provided context.
+func (s *NDJSONSender) SendWithContext(ctx context.Context, metrics []*models.Metrics) {
+	s.SendStream(ctx, metrics)
+}
+
+// SendBatch posts the metrics as one stream.
+func (s *NDJSONSender) SendBatch(metrics []*models.Metrics) {
+	s.SendStream(context.Background(), metrics)
+}
+
+// SendStream posts the metrics to /updates/stream, one JSON object per line.
+func (s *NDJSONSender) SendStream(ctx context.Context, metrics []*models.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	u := s.baseURL + "/updates/stream"
+
+	body, err := marshalNDJSON(metrics)
+	if err != nil {
+		s.log.WriteError(ErrJSONSenderMarshal.Error(), "error", err)
+		return
+	}
+
+	encoded, err := s.encodeBody(body)
+	if err != nil {
+		s.log.WriteError(ErrJSONSenderEncodeBody.Error(), "error", err)
+		return
+	}
+
+	req, err := s.newRequest(ctx, "/updates/stream", "application/x-ndjson", encoded)
+	if err != nil {
+		s.log.WriteError(ErrJSONSenderBuildRequest.Error(), "url", u, "error", err)
+		return
+	}
+
+	resp, err := doRequest(ctx, s.client, req, retrier.DefaultDelays)
+	if err != nil {
+		s.log.WriteError("post metric failed", "url", u, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if err := s.validateResponse(resp, codec.MediaTypeJSON); err != nil {
+		s.log.WriteError(err.Error(), "url", u)
+		return
+	}
+
+	s.log.WriteInfo("metrics stream sent", "count", len(metrics), "endpoint", u)
+}
+
+func marshalNDJSON(metrics []*models.Metrics) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, m := range metrics {
+		if err := enc.Encode(m); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrJSONSenderMarshal, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+var _ StreamingSender = NewNDJSONSender("", 0, nil, nil, nil, "", nil)
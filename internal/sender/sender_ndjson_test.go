@@ -0,0 +1,101 @@
+package sender_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/compression"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/cryptoutil"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/handler"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/idempotency"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sender"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func writeKeyPair(t *testing.T) (pubPath, privPath string) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	pubPath, privPath = filepath.Join(dir, "key.pub"), filepath.Join(dir, "key")
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	if err := os.WriteFile(privPath, privPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return pubPath, privPath
+}
+
+func TestNDJSONSender_SendStream_ThroughMiddlewares(t *testing.T) {
+	pubPath, privPath := writeKeyPair(t)
+	enc, err := cryptoutil.NewEncryptorFromPublicKeyFile(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := cryptoutil.NewDecryptorFromPrivateKeyFile(privPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const key sign.SignKey = "secret"
+	gz := compression.NewGzip(compression.BestSpeed)
+
+	// The middlewares are installed in the order used by the server.
+	gin.SetMode(gin.TestMode)
+	st := storage.NewMemStorage()
+	r := gin.New()
+	r.Use(cryptoutil.Middleware(dec, nil))
+	r.Use(sign.Middleware(sign.NewSignerSHA256(), key, nil))
+	r.Use(compression.Middleware(gz))
+	r.Use(idempotency.Middleware(idempotency.NewMemoryStore(0, 0), nil, nil))
+	handler.NewGinHandler(service.NewMetricService(st), nil).RegisterUpdate(r)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	host, port := hostPortFromServer(t, srv)
+	log := &test.FakeLogger{}
+	s := sender.NewNDJSONSender(host, port, srv.Client(), log, gz, key, enc)
+	s.SetInstance("host-1")
+
+	metrics := make([]*models.Metrics, 0, handler.UpdatesStreamChunkSize+1)
+	for i := 0; i < handler.UpdatesStreamChunkSize; i++ {
+		v := float64(i)
+		metrics = append(metrics, &models.Metrics{ID: fmt.Sprintf("g%d", i), MType: models.GaugeType, Value: &v})
+	}
+	var delta int64 = 3
+	metrics = append(metrics, &models.Metrics{ID: "PollCount", MType: models.CounterType, Delta: &delta})
+	s.SendStream(context.Background(), metrics)
+
+	if errs := log.GetErrorMessages(); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	series := models.SeriesKey("PollCount", map[string]string{models.InstanceLabel: "host-1"})
+	if v, err := st.GetCounter(series); err != nil || v != 3 {
+		t.Fatalf("counter %q = %d, %v", series, v, err)
+	}
+	series = models.SeriesKey(fmt.Sprintf("g%d", handler.UpdatesStreamChunkSize-1), map[string]string{models.InstanceLabel: "host-1"})
+	if v, err := st.GetGauge(series); err != nil || v != float64(handler.UpdatesStreamChunkSize-1) {
+		t.Fatalf("gauge %q = %v, %v", series, v, err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/retrier"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/subnet"
 )
 
 var (
@@ -36,6 +37,9 @@ type PlainSender struct {
 	client  *http.Client
 	log     logger.Logger
 	signKey sign.SignKey
+
+	instance string
+	realIP   string
 }
 
 // NewPlainSender constructs a PlainSender for communicating with the server.
@@ -51,6 +55,16 @@ func NewPlainSender(baseURL string, port int, client *http.Client, l logger.Logg
 	}
 }
 
+// SetInstance makes the sender identify itself with the given agent instance on every request.
+func (s *PlainSender) SetInstance(instance string) {
+	s.instance = instance
+}
+
+// SetRealIP makes the sender report the agent address so the server can check it against its trusted subnet.
+func (s *PlainSender) SetRealIP(ip string) {
+	s.realIP = ip
+}
+
 // Send posts each metric individually to the /update plain-text endpoint.
 func (s *PlainSender) Send(metrics []*models.Metrics) {
 	s.SendWithContext(context.Background(), metrics)
@@ -80,6 +94,10 @@ func (s *PlainSender) postMetric(ctx context.Context, m *models.Metrics) {
 		}
 		return
 	}
+	if m.MType == models.HistogramType {
+		// The plain route accepts single observations only, aggregated histograms are sent as JSON.
+		return
+	}
 	raw, ok := plainValue(m)
 	if !ok {
 		if s.log != nil {
@@ -88,7 +106,7 @@ func (s *PlainSender) postMetric(ctx context.Context, m *models.Metrics) {
 		return
 	}
 
-	u, err := url.JoinPath(s.baseURL, "update", string(m.MType), url.PathEscape(m.ID), url.PathEscape(raw))
+	u, err := url.JoinPath(s.baseURL, "update", string(m.MType), url.PathEscape(m.Key()), url.PathEscape(raw))
 	if err != nil {
 		if s.log != nil {
 			s.log.WriteError(ErrSenderBuildURL.Error())
@@ -107,6 +125,12 @@ func (s *PlainSender) postMetric(ctx context.Context, m *models.Metrics) {
 	if s.signKey != "" {
 		req.Header.Set("HashSHA256", sign.NewSignerSHA256().Sign(nil, s.signKey))
 	}
+	if s.instance != "" {
+		req.Header.Set(models.InstanceHeader, s.instance)
+	}
+	if s.realIP != "" {
+		req.Header.Set(subnet.RealIPHeader, s.realIP)
+	}
 
 	resp, err := doRequest(ctx, s.client, req, retrier.DefaultDelays)
 	if err != nil {
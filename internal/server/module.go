@@ -3,14 +3,19 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcserver"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/handler"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
 	"go.uber.org/fx"
 )
 
@@ -20,11 +25,18 @@ type AppConfig struct {
 	Port            int
 	StoreInterval   int
 	FileStoragePath string
+	StoreGens       int
 	Restore         bool
 	SignKey         sign.SignKey
 	AuditFile       string
 	AuditURL        string
 	CryptoKeyPath   string
+	GRPCAddress     string
+	TrustedSubnet   string
+	WALPath         string
+	WALSync         string
+	MetricTTL       string
+	SchemaFile      string
 }
 
 const (
@@ -36,10 +48,24 @@ const (
 	DefaultStoreInterval = 300
 	// DefaultFileStoragePath is the default path for the metrics snapshot file.
 	DefaultFileStoragePath = "/tmp/metrics-db.json"
+	// DefaultStoreGens is the number of snapshot files kept, including the current one.
+	DefaultStoreGens = 3
 	// DefaultRestore indicates whether the service loads state on start by default.
 	DefaultRestore = true
 	// DefaultCryptoKeyPath is the default path for key used for encryption metrics.
 	DefaultCryptoKeyPath = ""
+	// DefaultGRPCAddress leaves the gRPC server disabled.
+	DefaultGRPCAddress = ""
+	// DefaultTrustedSubnet accepts updates from any client.
+	DefaultTrustedSubnet = ""
+	// DefaultWALPath leaves the write-ahead log disabled.
+	DefaultWALPath = ""
+	// DefaultWALSync syncs the write-ahead log after every record.
+	DefaultWALSync = "always"
+	// DefaultMetricTTL keeps metrics until they are deleted explicitly.
+	DefaultMetricTTL = ""
+	// DefaultSchemaFile leaves metric updates unconstrained by a schema registry.
+	DefaultSchemaFile = ""
 )
 
 // DefaultAppConfig provides baseline server configuration values.
@@ -48,6 +74,7 @@ var DefaultAppConfig = AppConfig{
 	Port:            DefaultAppPort,
 	StoreInterval:   DefaultStoreInterval,
 	FileStoragePath: DefaultFileStoragePath,
+	StoreGens:       DefaultStoreGens,
 	Restore:         DefaultRestore,
 }
 
@@ -65,9 +92,12 @@ var (
 	serverShutdown = func(ctx context.Context, srv *http.Server) error {
 		return srv.Shutdown(ctx)
 	}
+	grpcListen = func(addr string) (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	}
 )
 
-func run(lc fx.Lifecycle, r *gin.Engine, cfg *AppConfig, l logger.Logger, h *handler.GinHandler) {
+func run(lc fx.Lifecycle, r *gin.Engine, cfg *AppConfig, l logger.Logger, h *handler.GinHandler, gs *grpcserver.Server, b *stream.Broker) {
 	var (
 		stopSaver chan struct{}
 		srv       *http.Server
@@ -75,8 +105,12 @@ func run(lc fx.Lifecycle, r *gin.Engine, cfg *AppConfig, l logger.Logger, h *han
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			if cfg.Restore {
-				if err := h.Service().LoadFile(cfg.FileStoragePath); err != nil {
-					l.WriteError("restore failed", "error", err)
+				// A snapshot or WAL that cannot be restored would be overwritten by the next save, so the server
+				// does not start; only histograms the backend cannot keep are skipped with a warning.
+				if err := h.Service().LoadFile(cfg.FileStoragePath); errors.Is(err, storage.ErrHistogramsUnsupported) {
+					l.WriteError("restore incomplete", "error", err)
+				} else if err != nil {
+					return fmt.Errorf("restore: %w", err)
 				}
 			}
 
@@ -97,11 +131,15 @@ func run(lc fx.Lifecycle, r *gin.Engine, cfg *AppConfig, l logger.Logger, h *han
 					}
 				}()
 			} else {
-				h.SetAfterUpdateHook(func() {
+				saveNow := func() {
 					if err := h.Service().SaveFile(cfg.FileStoragePath); err != nil {
 						l.WriteError("save failed", "error", err)
 					}
-				})
+				}
+				h.SetAfterUpdateHook(saveNow)
+				if gs != nil {
+					gs.SetAfterUpdateHook(saveNow)
+				}
 			}
 			go func() {
 				addr := cfg.Host + ":" + strconv.Itoa(cfg.Port)
@@ -113,9 +151,30 @@ func run(lc fx.Lifecycle, r *gin.Engine, cfg *AppConfig, l logger.Logger, h *han
 					l.WriteError("server failed", "error", err)
 				}
 			}()
+			if gs != nil {
+				lis, err := grpcListen(gs.Address())
+				if err != nil {
+					return err
+				}
+				go func() {
+					l.WriteInfo("grpc server listening", "addr", lis.Addr().String())
+
+					if err := gs.Serve(lis); err != nil {
+						l.WriteError("grpc server failed", "error", err)
+					}
+				}()
+			}
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
+			// Live update streams never finish on their own, so they are ended before the HTTP server
+			// waits for active requests.
+			b.Close()
+			if gs != nil {
+				shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				gs.Shutdown(shutdownCtx)
+				cancel()
+			}
 			if srv != nil {
 				shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 				defer cancel()
@@ -7,13 +7,20 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/grpcserver"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/handler"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/service"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/sign"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 	"go.uber.org/fx"
 )
@@ -44,7 +51,7 @@ func TestRun_OnStart_SuccessPath_CoversGoroutine(t *testing.T) {
 
 	logger := &test.FakeLogger{}
 	hand := handler.NewGinHandler(&test.FakeMetricService{}, handler.NewJSONMetricsPool())
-	run(lc, engine, cfg, logger, hand)
+	run(lc, engine, cfg, logger, hand, nil, nil)
 
 	if len(lc.hooks) != 1 {
 		t.Fatalf("expected 1 hook, got %d", len(lc.hooks))
@@ -97,7 +104,7 @@ func TestRun_OnStart_FailurePath_CoversFatal(t *testing.T) {
 	logger := &test.FakeLogger{}
 
 	hand := handler.NewGinHandler(&test.FakeMetricService{}, handler.NewJSONMetricsPool())
-	run(lc, engine, cfg, logger, hand)
+	run(lc, engine, cfg, logger, hand, nil, nil)
 
 	if len(lc.hooks) != 1 {
 		t.Fatalf("expected 1 hook, got %d", len(lc.hooks))
@@ -121,6 +128,39 @@ func TestRun_OnStart_FailurePath_CoversFatal(t *testing.T) {
 	}
 }
 
+func TestRun_OnStart_FailsWhenRestoreFails(t *testing.T) {
+	t.Cleanup(resetHooksOverrides())
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "m.wal")
+	if err := os.WriteFile(walPath, []byte("garbage\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	w, err := storage.OpenWAL(storage.WALConfig{Path: walPath}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ms := storage.NewMemStorage()
+	ms.AttachWAL(w)
+
+	var started atomic.Bool
+	serverRunner = func(*http.Server) error { started.Store(true); return nil }
+
+	lc := &fakeLifecycle{}
+	cfg := &AppConfig{Host: "localhost", Port: 9999, Restore: true, FileStoragePath: filepath.Join(dir, "m.json")}
+	hand := handler.NewGinHandler(service.NewMetricService(ms), handler.NewJSONMetricsPool())
+	run(lc, gin.New(), cfg, &test.FakeLogger{}, hand, nil, nil)
+
+	if err := lc.hooks[0].OnStart(context.Background()); !errors.Is(err, storage.ErrWALCorrupted) {
+		t.Fatalf("want ErrWALCorrupted, got %v", err)
+	}
+	if started.Load() {
+		t.Fatal("server must not start after a failed restore")
+	}
+}
+
 func sprintf(format string, v ...any) string {
 	return fmt.Sprintf(format, v...)
 }
@@ -214,3 +254,70 @@ func swapServerRunner(t *testing.T, fn func(*http.Server) error) (restore func()
 	serverRunner = fn
 	return func() { serverRunner = old }
 }
+
+func TestRun_StartsAndStopsGRPCServer(t *testing.T) {
+	t.Cleanup(resetHooksOverrides())
+	gin.SetMode(gin.TestMode)
+
+	serverRunner = func(*http.Server) error { return nil }
+	serverShutdown = func(context.Context, *http.Server) error { return nil }
+
+	svc := &test.FakeMetricService{}
+	gs := grpcserver.New(grpcserver.Params{
+		Config:  grpcserver.Config{Address: "127.0.0.1:0"},
+		Service: svc,
+		Logger:  &test.FakeLogger{},
+		Signer:  sign.NewSignerSHA256(),
+	})
+
+	lc := &fakeLifecycle{}
+	logger := &test.FakeLogger{}
+	hand := handler.NewGinHandler(svc, handler.NewJSONMetricsPool())
+	cfg := &AppConfig{Host: "127.0.0.1", Port: 18081, FileStoragePath: t.TempDir() + "/m.json"}
+	run(lc, gin.New(), cfg, logger, hand, gs, nil)
+
+	if err := lc.hooks[0].OnStart(context.Background()); err != nil {
+		t.Fatalf("OnStart error: %v", err)
+	}
+	if err := lc.hooks[0].OnStop(context.Background()); err != nil {
+		t.Fatalf("OnStop error: %v", err)
+	}
+}
+
+func TestRun_OnStop_EndsStreamsBeforeShutdown(t *testing.T) {
+	t.Cleanup(resetHooksOverrides())
+	gin.SetMode(gin.TestMode)
+
+	lc := &fakeLifecycle{}
+	cfg := &AppConfig{Host: "127.0.0.1", Port: 18081}
+	b := stream.NewBroker()
+	sub := b.Subscribe(stream.Filter{})
+
+	started := make(chan struct{})
+	serverRunner = func(*http.Server) error {
+		close(started)
+		return nil
+	}
+	var streamsLeft int
+	serverShutdown = func(context.Context, *http.Server) error {
+		streamsLeft = b.Subscribers()
+		return nil
+	}
+
+	hand := handler.NewGinHandler(&test.FakeMetricService{}, handler.NewJSONMetricsPool())
+	run(lc, gin.New(), cfg, &test.FakeLogger{}, hand, nil, b)
+	if err := lc.hooks[0].OnStart(context.Background()); err != nil {
+		t.Fatalf("OnStart error: %v", err)
+	}
+	<-started
+	if err := lc.hooks[0].OnStop(context.Background()); err != nil {
+		t.Fatalf("OnStop error: %v", err)
+	}
+
+	if streamsLeft != 0 {
+		t.Fatalf("streams must end before the HTTP server shuts down, %d left", streamsLeft)
+	}
+	if _, ok := <-sub.C(); ok || !errors.Is(sub.Err(), stream.ErrClosed) {
+		t.Fatalf("subscription must end with ErrClosed, got %v", sub.Err())
+	}
+}
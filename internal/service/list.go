@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+)
+
+const (
+	// DefaultListLimit is the page size of ProcessList when none is requested.
+	DefaultListLimit = 1000
+	// MaxListLimit caps the page size of ProcessList.
+	MaxListLimit = 10000
+)
+
+// ErrInvalidListQuery indicates a metric listing with a malformed filter, cursor or limit.
+var ErrInvalidListQuery = fmt.Errorf("invalid metric list query")
+
+// ProcessList returns one page of the metrics matching opts, ordered by type and then by series key,
+// together with the cursor of the next page, which is empty on the last one.
+func (s *MetricService) ProcessList(ctx context.Context, opts models.ListOptions) ([]models.Metrics, string, error) {
+	q, err := listQuery(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := q.Limit
+	q.Limit++
+
+	metrics, err := storage.Query(ctx, s.store, q)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(metrics) <= limit {
+		return metrics, "", nil
+	}
+	metrics = metrics[:limit]
+	return metrics, encodeListCursor(metrics[limit-1]), nil
+}
+
+// listQuery validates the options and converts them into a storage query.
+func listQuery(o models.ListOptions) (storage.MetricQuery, error) {
+	q := storage.MetricQuery{Type: o.Type, Names: o.IDs, Prefix: o.Prefix, Instance: o.Instance, Limit: o.Limit}
+	if q.Type != "" && !q.Type.IsValid() {
+		return q, fmt.Errorf("%w: %w", ErrInvalidListQuery, models.ErrMetricInvalidType)
+	}
+	switch {
+	case q.Limit < 0:
+		return q, fmt.Errorf("%w: negative limit", ErrInvalidListQuery)
+	case q.Limit == 0:
+		q.Limit = DefaultListLimit
+	case q.Limit > MaxListLimit:
+		q.Limit = MaxListLimit
+	}
+	if o.Regex != "" {
+		re, err := regexp.Compile(o.Regex)
+		if err != nil {
+			return q, fmt.Errorf("%w: %w", ErrInvalidListQuery, err)
+		}
+		q.Pattern = re
+	}
+	if o.Cursor != "" {
+		c, err := decodeListCursor(o.Cursor)
+		if err != nil {
+			return q, err
+		}
+		q.After = c
+	}
+	return q, nil
+}
+
+// encodeListCursor returns the cursor resuming a listing after m.
+func encodeListCursor(m models.Metrics) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(string(m.MType) + ":" + m.Key()))
+}
+
+func decodeListCursor(raw string) (storage.QueryCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return storage.QueryCursor{}, fmt.Errorf("%w: bad cursor", ErrInvalidListQuery)
+	}
+	t, key, ok := strings.Cut(string(b), ":")
+	if !ok || !models.MetricType(t).IsValid() {
+		return storage.QueryCursor{}, fmt.Errorf("%w: bad cursor", ErrInvalidListQuery)
+	}
+	return storage.QueryCursor{Type: models.MetricType(t), Key: key}, nil
+}
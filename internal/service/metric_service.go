@@ -1,49 +1,125 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"sort"
+	"time"
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/schema"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
 )
 
 var (
 	// ErrMetricNotFound indicates that the requested metric does not exist in the storage backend.
 	ErrMetricNotFound = fmt.Errorf("metric not found")
+	// ErrHistoryUnsupported indicates that the storage backend does not record metric history.
+	ErrHistoryUnsupported = fmt.Errorf("metric history is not supported")
+	// ErrHistogramUnsupported indicates that the storage backend cannot keep histogram metrics.
+	ErrHistogramUnsupported = fmt.Errorf("histogram metrics are not supported")
+	// ErrDeleteUnsupported indicates that the storage backend cannot remove metrics.
+	ErrDeleteUnsupported = fmt.Errorf("metric deletion is not supported")
 )
 
 // MetricServiceInterface describes operations supported by metric services.
 type MetricServiceInterface interface {
-	ProcessUpdate(*models.Metrics) error
-	ProcessUpdates([]models.Metrics) error
-	ProcessGetValue(name string, metricType models.MetricType) (*models.Metrics, error)
+	ProcessUpdate(ctx context.Context, m *models.Metrics) error
+	ProcessUpdates(ctx context.Context, metrics []models.Metrics) error
+	ProcessUpdatesPartial(ctx context.Context, metrics []models.Metrics) ([]error, error)
+	ProcessGetValue(ctx context.Context, name string, metricType models.MetricType) (*models.Metrics, error)
+	ProcessGetAll(ctx context.Context) ([]models.Metrics, error)
+	ProcessList(ctx context.Context, opts models.ListOptions) ([]models.Metrics, string, error)
+	ProcessGetUpdateTimes(ctx context.Context) (map[models.MetricType]map[string]time.Time, error)
+	ProcessGetHistory(ctx context.Context, name string, metricType models.MetricType, from, to time.Time, step time.Duration) ([]models.Sample, error)
+	ProcessDelete(ctx context.Context, metrics []models.Metrics) (int, error)
+	ProcessResetCounter(ctx context.Context, name string) error
 	SaveFile(path string) error
 	LoadFile(path string) error
 }
 
 // MetricService implements MetricServiceInterface using a MetricStorage backend.
+// Gauges and counters go through the context-aware storage.MetricStorageV2 view of the backend and histograms
+// through storage.HistogramStorageV2, so request cancellation and backend failures reach the caller.
 type MetricService struct {
-	store storage.MetricStorage
+	store       storage.MetricStorage
+	v2          storage.MetricStorageV2
+	hist        storage.HistogramStorageV2
+	generations int
+	updates     *stream.Broker
+	schema      *schema.Registry
 }
 
 // NewMetricService creates a new MetricService for the provided storage implementation.
 func NewMetricService(store storage.MetricStorage) *MetricService {
-	return &MetricService{store: store}
+	hist, _ := storage.AsHistogramV2(store)
+	return &MetricService{store: store, v2: storage.AsV2(store), hist: hist, generations: DefaultSnapshotGenerations}
+}
+
+// SetSnapshotGenerations sets how many rotated snapshot files SaveFile keeps and LoadFile falls back to.
+func (s *MetricService) SetSnapshotGenerations(n int) {
+	s.generations = n
+}
+
+// SetSchema installs the registry that accepted updates must conform to; nil accepts any well-formed update.
+func (s *MetricService) SetSchema(r *schema.Registry) {
+	s.schema = r
+}
+
+// SetBroker installs the broker that receives every update accepted by ProcessUpdate and ProcessUpdates.
+func (s *MetricService) SetBroker(b *stream.Broker) {
+	s.updates = b
 }
 
 // ProcessUpdate applies a single metric update to the storage.
-func (s *MetricService) ProcessUpdate(m *models.Metrics) error {
+// Malformed updates and updates violating the schema are rejected before the storage is touched.
+func (s *MetricService) ProcessUpdate(ctx context.Context, m *models.Metrics) error {
 	if m == nil {
 		return ErrMetricNotFound
 	}
+	if err := validateMetric(m); err != nil {
+		return err
+	}
+	if err := s.schema.Validate(*m); err != nil {
+		return err
+	}
+	if err := s.apply(ctx, m); err != nil {
+		return err
+	}
+	s.updates.Publish([]models.Metrics{*m})
+	return nil
+}
 
+// apply writes a validated update to the storage.
+func (s *MetricService) apply(ctx context.Context, m *models.Metrics) error {
 	switch m.MType {
 	case models.GaugeType:
-		s.store.UpdateGauge(m.ID, *m.Value)
+		return s.v2.UpdateGaugeContext(ctx, m.Key(), *m.Value)
 	case models.CounterType:
-		s.store.UpdateCounter(m.ID, *m.Delta)
+		return s.v2.UpdateCounterContext(ctx, m.Key(), *m.Delta)
+	case models.HistogramType:
+		if s.hist == nil {
+			return ErrHistogramUnsupported
+		}
+		return s.hist.UpdateHistogramContext(ctx, m.Key(), *m.Histogram)
+	}
+	return nil
+}
+
+// validateMetric checks that the update is well formed, so that storages never see a missing value.
+// The error is a *models.MetricError naming the rejected metric.
+func validateMetric(m *models.Metrics) error {
+	err := m.Validate()
+	if err == nil {
+		err = m.Labels.Validate()
+	}
+	if err == nil && m.MType == models.HistogramType {
+		err = m.Histogram.Validate()
+	}
+	if err != nil {
+		return &models.MetricError{ID: m.ID, Type: m.MType, Err: err}
 	}
 	return nil
 }
@@ -55,28 +131,163 @@ type batchUpdater interface {
 var processUpdateFn = (*MetricService).ProcessUpdate
 
 // ProcessUpdates applies a batch of metric updates, using storage-level batching when available.
-func (s *MetricService) ProcessUpdates(metrics []models.Metrics) error {
+// The batch is rejected before the storage is touched when any update is malformed or violates the schema.
+func (s *MetricService) ProcessUpdates(ctx context.Context, metrics []models.Metrics) error {
 	if len(metrics) == 0 {
 		return nil
 	}
+	for i := range metrics {
+		if err := validateMetric(&metrics[i]); err != nil {
+			return err
+		}
+	}
+	if err := s.schema.Validate(metrics...); err != nil {
+		return err
+	}
+	return s.applyBatch(ctx, metrics)
+}
+
+// ProcessUpdatesPartial applies the acceptable updates of a batch and rejects the others.
+// The returned slice holds the rejection reason of every update, nil for the accepted ones.
+// Besides malformed updates and schema violations, histograms whose buckets cannot be merged are rejected,
+// so the accepted updates are written together as in ProcessUpdates on every backend; a storage error
+// fails all of them and is returned as the second result.
+func (s *MetricService) ProcessUpdatesPartial(ctx context.Context, metrics []models.Metrics) ([]error, error) {
+	rejected := make([]error, len(metrics))
+	accepted := make([]models.Metrics, 0, len(metrics))
+	var pending map[string]models.Histogram
+	for i := range metrics {
+		m := &metrics[i]
+		err := validateMetric(m)
+		if err == nil {
+			err = s.schema.Validate(*m)
+		}
+		if err == nil && m.MType == models.HistogramType {
+			if pending == nil {
+				pending = make(map[string]models.Histogram)
+			}
+			rejection, failure := s.checkHistogram(ctx, m, pending)
+			if failure != nil {
+				return nil, failure
+			}
+			err = rejection
+		}
+		if err != nil {
+			rejected[i] = err
+			continue
+		}
+		accepted = append(accepted, *m)
+	}
+	if len(accepted) > 0 {
+		if err := s.applyBatch(ctx, accepted); err != nil {
+			return nil, err
+		}
+	}
+	return rejected, nil
+}
+
+// checkHistogram reports whether the histogram update merges with the stored series and with the earlier
+// updates of the series in the batch, which pending accumulates. A failure to read the storage is returned
+// separately from the rejection of the update.
+func (s *MetricService) checkHistogram(ctx context.Context, m *models.Metrics, pending map[string]models.Histogram) (rejection, failure error) {
+	if s.hist == nil {
+		return &models.MetricError{ID: m.ID, Type: m.MType, Err: ErrHistogramUnsupported}, nil
+	}
+	key := m.Key()
+	cur, ok := pending[key]
+	if !ok {
+		stored, err := s.hist.GetHistogramContext(ctx, key)
+		if errors.Is(err, storage.ErrMetricNotFound) {
+			pending[key] = *m.Histogram
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		cur = stored
+	}
+	merged, err := cur.Merge(*m.Histogram)
+	if err != nil {
+		return &models.MetricError{ID: m.ID, Type: m.MType, Err: err}, nil
+	}
+	pending[key] = merged
+	return nil, nil
+}
+
+// applyBatch writes validated updates, using storage-level batching when available, and publishes them.
+func (s *MetricService) applyBatch(ctx context.Context, metrics []models.Metrics) error {
+	if bu, ok := s.store.(storage.BatchStorageV2); ok {
+		if err := bu.UpdateBatchContext(ctx, metrics); err != nil {
+			return err
+		}
+		s.updates.Publish(metrics)
+		return nil
+	}
 	if bu, ok := s.store.(batchUpdater); ok {
-		return bu.UpdateBatch(metrics)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := bu.UpdateBatch(metrics); err != nil {
+			return err
+		}
+		s.updates.Publish(metrics)
+		return nil
 	}
 	for i := 0; i < len(metrics); i++ {
-		if err := processUpdateFn(s, &metrics[i]); err != nil {
+		if err := processUpdateFn(s, ctx, &metrics[i]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// ProcessDelete removes the metrics identified by their type and series key and returns how many existed.
+// The request is rejected before anything is removed when a metric has no name or an invalid type.
+func (s *MetricService) ProcessDelete(ctx context.Context, metrics []models.Metrics) (int, error) {
+	ds, ok := s.store.(storage.DeleteStorage)
+	if !ok {
+		return 0, ErrDeleteUnsupported
+	}
+	for i := range metrics {
+		m := &metrics[i]
+		var err error
+		switch {
+		case m.ID == "":
+			err = models.ErrMetricUnknownName
+		case !m.MType.IsValid():
+			err = models.ErrMetricInvalidType
+		default:
+			err = m.Labels.Validate()
+		}
+		if err != nil {
+			return 0, &models.MetricError{ID: m.ID, Type: m.MType, Err: err}
+		}
+	}
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+	return ds.DeleteContext(ctx, metrics)
+}
+
+// ProcessResetCounter sets an existing counter to zero.
+func (s *MetricService) ProcessResetCounter(ctx context.Context, name string) error {
+	if _, err := s.v2.GetCounterContext(ctx, name); err != nil {
+		if errors.Is(err, storage.ErrMetricNotFound) {
+			return ErrMetricNotFound
+		}
+		return err
+	}
+	return s.v2.SetCounterContext(ctx, name, 0)
+}
+
 // ProcessGetValue fetches the current value of the requested metric.
-func (s *MetricService) ProcessGetValue(metricName string, metricType models.MetricType) (*models.Metrics, error) {
+// metricName is a series key, so labelled series are addressed as name{label="value"}.
+func (s *MetricService) ProcessGetValue(ctx context.Context, metricName string, metricType models.MetricType) (*models.Metrics, error) {
 	var m *models.Metrics
 
 	switch {
 	case models.IsGauge(metricType):
-		v, err := s.store.GetGauge(metricName)
+		v, err := s.v2.GetGaugeContext(ctx, metricName)
 		if err == storage.ErrMetricNotFound {
 			return nil, ErrMetricNotFound
 		}
@@ -89,7 +300,7 @@ func (s *MetricService) ProcessGetValue(metricName string, metricType models.Met
 		}
 
 	case models.IsCounter(metricType):
-		v, err := s.store.GetCounter(metricName)
+		v, err := s.v2.GetCounterContext(ctx, metricName)
 		if err == storage.ErrMetricNotFound {
 			return nil, ErrMetricNotFound
 		}
@@ -101,57 +312,165 @@ func (s *MetricService) ProcessGetValue(metricName string, metricType models.Met
 			return nil, err
 		}
 
+	case models.IsHistogram(metricType):
+		if s.hist == nil {
+			return nil, ErrMetricNotFound
+		}
+		h, err := s.hist.GetHistogramContext(ctx, metricName)
+		if err == storage.ErrMetricNotFound {
+			return nil, ErrMetricNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		m, err = models.NewHistogramMetrics(metricName, &h)
+		if err != nil {
+			return nil, err
+		}
+
 	default:
 		return nil, models.ErrMetricUnknownName
 	}
 
+	m.SetKey(metricName)
 	return m, nil
 }
 
-// SaveFile persists all metrics to the specified file when the storage supports snapshots.
+// ProcessGetAll returns every metric known to the storage, ordered by type, name and labels.
+func (s *MetricService) ProcessGetAll(ctx context.Context) ([]models.Metrics, error) {
+	gauges, err := s.v2.AllGaugesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := s.v2.AllCountersContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]models.Metrics, 0, len(gauges)+len(counters))
+	for name, value := range gauges {
+		v := value
+		m := models.Metrics{MType: models.GaugeType, Value: &v}
+		m.SetKey(name)
+		metrics = append(metrics, m)
+	}
+	for name, value := range counters {
+		v := value
+		m := models.Metrics{MType: models.CounterType, Delta: &v}
+		m.SetKey(name)
+		metrics = append(metrics, m)
+	}
+	if s.hist != nil {
+		histograms, err := s.hist.AllHistogramsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range histograms {
+			h := value
+			m := models.Metrics{MType: models.HistogramType, Histogram: &h}
+			m.SetKey(name)
+			metrics = append(metrics, m)
+		}
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType.Rank() < metrics[j].MType.Rank()
+		}
+		if metrics[i].ID != metrics[j].ID {
+			return metrics[i].ID < metrics[j].ID
+		}
+		return metrics[i].Key() < metrics[j].Key()
+	})
+	return metrics, nil
+}
+
+// ProcessGetUpdateTimes returns last update timestamps grouped by metric type.
+// It returns nil when the storage backend does not track update times.
+func (s *MetricService) ProcessGetUpdateTimes(ctx context.Context) (map[models.MetricType]map[string]time.Time, error) {
+	ts, ok := s.store.(storage.UpdateTimesStorage)
+	if !ok {
+		return nil, nil
+	}
+	gauges, err := ts.GaugeUpdateTimesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := ts.CounterUpdateTimesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	times := map[models.MetricType]map[string]time.Time{
+		models.GaugeType:   gauges,
+		models.CounterType: counters,
+	}
+	if hs, ok := s.store.(storage.HistogramUpdateTimesStorage); ok {
+		histograms, err := hs.HistogramUpdateTimesContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		times[models.HistogramType] = histograms
+	}
+	return times, nil
+}
+
+// ProcessGetHistory returns samples of the metric recorded within [from, to], optionally downsampled to step.
+func (s *MetricService) ProcessGetHistory(ctx context.Context, name string, metricType models.MetricType, from, to time.Time, step time.Duration) ([]models.Sample, error) {
+	hs, ok := s.store.(storage.HistoryStorage)
+	if !ok {
+		return nil, ErrHistoryUnsupported
+	}
+	samples, err := hs.HistoryContext(ctx, metricType, name, from, to, step)
+	if errors.Is(err, storage.ErrHistoryDisabled) {
+		return nil, ErrHistoryUnsupported
+	}
+	return samples, err
+}
+
+// SaveFile persists all metrics of the storage backend to the specified file.
+// The file is replaced atomically and the previous snapshots are kept as path.1, path.2 and so on.
 func (s *MetricService) SaveFile(path string) error {
 	if path == "" {
 		return nil
 	}
-	metrics := make([]models.Metrics, 0)
+	write := func(metrics []models.Metrics) error {
+		return writeSnapshot(path, s.generations, metrics, time.Now())
+	}
 	if ms, ok := s.store.(*storage.MemStorage); ok {
-		metrics = append(metrics, ms.Snapshot()...)
+		// Checkpoint compacts the write-ahead log once the snapshot is on disk.
+		return ms.Checkpoint(write)
 	}
-	b, err := json.Marshal(metrics)
+	// A failed export leaves the existing generations untouched.
+	metrics, err := storage.Export(context.Background(), s.store)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, 0o666)
+	return write(metrics)
 }
 
-// LoadFile restores metrics from the specified file when the storage supports snapshots.
+// LoadFile restores metrics from the newest valid snapshot generation. Missing files are treated as an empty snapshot.
+// The in-memory storage then replays its write-ahead log, if any. Other backends keep their own data and import
+// the snapshot only while empty, so that restarting a database-backed server does not roll it back to an older file.
 func (s *MetricService) LoadFile(path string) error {
-	if path == "" {
-		return nil
-	}
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return err
+	ctx := context.Background()
+	ms, isMem := s.store.(*storage.MemStorage)
+	if !isMem {
+		empty, err := storage.IsEmpty(ctx, s.store)
+		if err != nil || !empty {
+			return err
+		}
 	}
 	var metrics []models.Metrics
-	if err := json.Unmarshal(b, &metrics); err != nil {
-		return err
-	}
-	if ms, ok := s.store.(*storage.MemStorage); ok {
-		for _, m := range metrics {
-			switch m.MType {
-			case models.GaugeType:
-				if m.Value != nil {
-					ms.UpdateGauge(m.ID, *m.Value)
-				}
-			case models.CounterType:
-				if m.Delta != nil {
-					ms.SetCounter(m.ID, *m.Delta)
-				}
-			}
+	if path != "" {
+		var err error
+		if metrics, err = readSnapshot(path, s.generations); err != nil {
+			return err
 		}
 	}
-	return nil
+	if isMem {
+		return ms.Restore(metrics)
+	}
+	return storage.Import(ctx, s.store, metrics)
 }
 
 var _ MetricServiceInterface = NewMetricService(nil)
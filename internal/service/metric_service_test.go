@@ -1,21 +1,28 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	pgxmock "github.com/pashagolub/pgxmock/v4"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/schema"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
 )
 
 func TestProcessUpdate_Gauge(t *testing.T) {
 	svc := NewMetricService(storage.NewMemStorage())
 	m := &models.Metrics{ID: "g1", MType: models.GaugeType, Value: Float64Ptr(3.14)}
-	err := svc.ProcessUpdate(m)
+	err := svc.ProcessUpdate(context.Background(), m)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -25,13 +32,13 @@ func TestProcessUpdate_Counter(t *testing.T) {
 	svc := NewMetricService(storage.NewMemStorage())
 
 	m := &models.Metrics{ID: "c1", MType: models.CounterType, Delta: Int64Ptr(10)}
-	err := svc.ProcessUpdate(m)
+	err := svc.ProcessUpdate(context.Background(), m)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
 	m = &models.Metrics{ID: "c1", MType: models.CounterType, Delta: Int64Ptr(5)}
-	err = svc.ProcessUpdate(m)
+	err = svc.ProcessUpdate(context.Background(), m)
 	if err != nil {
 		t.Fatalf("expected no error on accumulation, got %v", err)
 	}
@@ -49,7 +56,7 @@ func TestProcessUpdate_Concurrent(t *testing.T) {
 		for i := 0; i < n; i++ {
 			f := float64(i)
 			m, _ := models.NewGaugeMetrics(models.GaugeNames[0], &f)
-			err := svc.ProcessUpdate(m)
+			err := svc.ProcessUpdate(context.Background(), m)
 			if err != nil {
 				t.Errorf("gauge update error: %v", err)
 			}
@@ -61,7 +68,7 @@ func TestProcessUpdate_Concurrent(t *testing.T) {
 		for i := 0; i < n; i++ {
 			j := int64(i)
 			m, _ := models.NewCounterMetrics(models.CounterNames[0], &j)
-			err := svc.ProcessUpdate(m)
+			err := svc.ProcessUpdate(context.Background(), m)
 			if err != nil {
 				t.Errorf("counter update error: %v", err)
 			}
@@ -75,9 +82,9 @@ func TestProcessGet_Gauge(t *testing.T) {
 	svc := NewMetricService(storage.NewMemStorage())
 	f := float64(2.71)
 	m, _ := models.NewGaugeMetrics(models.GaugeNames[0], &f)
-	_ = svc.ProcessUpdate(m)
+	_ = svc.ProcessUpdate(context.Background(), m)
 
-	val, err := svc.ProcessGetValue(m.ID, m.MType)
+	val, err := svc.ProcessGetValue(context.Background(), m.ID, m.MType)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -90,9 +97,9 @@ func TestProcessGet_Counter(t *testing.T) {
 	svc := NewMetricService(storage.NewMemStorage())
 	j := int64(42)
 	m, _ := models.NewCounterMetrics(models.CounterNames[0], &j)
-	_ = svc.ProcessUpdate(m)
+	_ = svc.ProcessUpdate(context.Background(), m)
 
-	val, err := svc.ProcessGetValue(m.ID, m.MType)
+	val, err := svc.ProcessGetValue(context.Background(), m.ID, m.MType)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -103,7 +110,7 @@ func TestProcessGet_Counter(t *testing.T) {
 
 func TestProcessGet_NotFound(t *testing.T) {
 	svc := NewMetricService(storage.NewMemStorage())
-	_, err := svc.ProcessGetValue("not_exist", models.GaugeType)
+	_, err := svc.ProcessGetValue(context.Background(), "not_exist", models.GaugeType)
 	if err == nil {
 		t.Errorf("expected error for missing gauge, got nil")
 	}
@@ -113,10 +120,10 @@ func TestMetricService_SaveLoadFile(t *testing.T) {
 	svc := NewMetricService(storage.NewMemStorage())
 	f := float64(1.23)
 	g, _ := models.NewGaugeMetrics("g", &f)
-	_ = svc.ProcessUpdate(g)
+	_ = svc.ProcessUpdate(context.Background(), g)
 	cval := int64(7)
 	c, _ := models.NewCounterMetrics("c", &cval)
-	_ = svc.ProcessUpdate(c)
+	_ = svc.ProcessUpdate(context.Background(), c)
 
 	tmp := filepath.Join(t.TempDir(), "m.json")
 	if err := svc.SaveFile(tmp); err != nil {
@@ -127,11 +134,11 @@ func TestMetricService_SaveLoadFile(t *testing.T) {
 	if err := svc2.LoadFile(tmp); err != nil {
 		t.Fatalf("LoadFile error: %v", err)
 	}
-	gv, err := svc2.ProcessGetValue("g", models.GaugeType)
+	gv, err := svc2.ProcessGetValue(context.Background(), "g", models.GaugeType)
 	if err != nil || *gv.Value != f {
 		t.Fatalf("gauge mismatch: %v %v", gv, err)
 	}
-	cv, err := svc2.ProcessGetValue("c", models.CounterType)
+	cv, err := svc2.ProcessGetValue(context.Background(), "c", models.CounterType)
 	if err != nil || *cv.Delta != cval {
 		t.Fatalf("counter mismatch: %v %v", cv, err)
 	}
@@ -149,10 +156,10 @@ func TestMetricService_SaveLoadFile_EmptyPath(t *testing.T) {
 
 func TestProcessUpdates_EmptySlice(t *testing.T) {
 	s := &MetricService{store: test.NewFakeStorage()}
-	if err := s.ProcessUpdates(nil); err != nil {
+	if err := s.ProcessUpdates(context.Background(), nil); err != nil {
 		t.Fatalf("want nil, got %v", err)
 	}
-	if err := s.ProcessUpdates([]models.Metrics{}); err != nil {
+	if err := s.ProcessUpdates(context.Background(), []models.Metrics{}); err != nil {
 		t.Fatalf("want nil, got %v", err)
 	}
 }
@@ -162,8 +169,8 @@ func TestProcessUpdates_Batch_Success(t *testing.T) {
 	fb := &test.FakeBatchStore{FakeStorage: base}
 	s := &MetricService{store: fb}
 
-	in := []models.Metrics{{ID: "a"}, {ID: "b"}, {ID: "c"}}
-	if err := s.ProcessUpdates(in); err != nil {
+	in := []models.Metrics{gaugeUpdate("a"), gaugeUpdate("b"), gaugeUpdate("c")}
+	if err := s.ProcessUpdates(context.Background(), in); err != nil {
 		t.Fatalf("want nil, got %v", err)
 	}
 	if !reflect.DeepEqual(fb.Got, in) {
@@ -177,8 +184,8 @@ func TestProcessUpdates_Batch_Error(t *testing.T) {
 	fb := &test.FakeBatchStore{FakeStorage: base, Err: wantErr}
 	s := &MetricService{store: fb}
 
-	in := []models.Metrics{{ID: "x"}}
-	err := s.ProcessUpdates(in)
+	in := []models.Metrics{gaugeUpdate("x")}
+	err := s.ProcessUpdates(context.Background(), in)
 	if !errors.Is(err, wantErr) {
 		t.Fatalf("want %v, got %v", wantErr, err)
 	}
@@ -189,15 +196,15 @@ func TestProcessUpdates_Fallback_Success(t *testing.T) {
 	t.Cleanup(func() { processUpdateFn = old })
 
 	var called []string
-	processUpdateFn = func(_ *MetricService, m *models.Metrics) error {
+	processUpdateFn = func(_ *MetricService, _ context.Context, m *models.Metrics) error {
 		called = append(called, m.ID)
 		return nil
 	}
 
 	s := &MetricService{store: &test.FakeNoBatchStore{FakeStorage: test.NewFakeStorage()}}
-	in := []models.Metrics{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	in := []models.Metrics{gaugeUpdate("1"), gaugeUpdate("2"), gaugeUpdate("3")}
 
-	if err := s.ProcessUpdates(in); err != nil {
+	if err := s.ProcessUpdates(context.Background(), in); err != nil {
 		t.Fatalf("want nil, got %v", err)
 	}
 	want := []string{"1", "2", "3"}
@@ -214,7 +221,7 @@ func TestProcessUpdates_Fallback_StopsOnFirstError(t *testing.T) {
 	var calls int
 	wantErr := errors.New("fail")
 
-	processUpdateFn = func(_ *MetricService, _ *models.Metrics) error {
+	processUpdateFn = func(_ *MetricService, _ context.Context, _ *models.Metrics) error {
 		if calls == failAt {
 			calls++
 			return wantErr
@@ -224,9 +231,9 @@ func TestProcessUpdates_Fallback_StopsOnFirstError(t *testing.T) {
 	}
 
 	s := &MetricService{store: &test.FakeNoBatchStore{FakeStorage: test.NewFakeStorage()}}
-	in := []models.Metrics{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	in := []models.Metrics{gaugeUpdate("a"), gaugeUpdate("b"), gaugeUpdate("c")}
 
-	err := s.ProcessUpdates(in)
+	err := s.ProcessUpdates(context.Background(), in)
 	if !errors.Is(err, wantErr) {
 		t.Fatalf("want %v, got %v", wantErr, err)
 	}
@@ -237,3 +244,425 @@ func TestProcessUpdates_Fallback_StopsOnFirstError(t *testing.T) {
 
 func Float64Ptr(v float64) *float64 { return &v }
 func Int64Ptr(v int64) *int64       { return &v }
+
+func gaugeUpdate(id string) models.Metrics {
+	return models.Metrics{ID: id, MType: models.GaugeType, Value: Float64Ptr(1)}
+}
+
+func TestProcessGetAll_SortedGaugesThenCounters(t *testing.T) {
+	st := storage.NewMemStorage()
+	st.UpdateGauge("b", 2)
+	st.UpdateGauge("a", 1)
+	st.UpdateCounter("c", 3)
+	svc := NewMetricService(st)
+
+	got, err := svc.ProcessGetAll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("want 3 metrics, got %d", len(got))
+	}
+	if got[0].ID != "a" || got[1].ID != "b" || got[2].ID != "c" {
+		t.Fatalf("unexpected order: %+v", got)
+	}
+	if got[2].MType != models.CounterType || *got[2].Delta != 3 {
+		t.Fatalf("unexpected counter: %+v", got[2])
+	}
+}
+
+func TestProcessGetUpdateTimes_UnsupportedStorage(t *testing.T) {
+	svc := NewMetricService(test.NewFakeStorage())
+	times, err := svc.ProcessGetUpdateTimes(context.Background())
+	if err != nil || times != nil {
+		t.Fatalf("want nil,nil got %v,%v", times, err)
+	}
+}
+
+func TestProcessGetHistory(t *testing.T) {
+	svc := NewMetricService(storage.NewMemStorage())
+	if _, err := svc.ProcessGetHistory(context.Background(), "g", models.GaugeType, time.Time{}, time.Now(), 0); !errors.Is(err, ErrHistoryUnsupported) {
+		t.Fatalf("want ErrHistoryUnsupported for memory storage, got %v", err)
+	}
+
+	svc = NewMetricService(storage.NewDBStorage(nil))
+	if _, err := svc.ProcessGetHistory(context.Background(), "g", models.GaugeType, time.Time{}, time.Now(), 0); !errors.Is(err, ErrHistoryUnsupported) {
+		t.Fatalf("want ErrHistoryUnsupported when history is disabled, got %v", err)
+	}
+}
+
+func TestProcessUpdate_LabelsDefineSeries(t *testing.T) {
+	svc := NewMetricService(storage.NewMemStorage())
+	for _, cpu := range []string{"0", "1"} {
+		m := &models.Metrics{ID: "CPU", MType: models.GaugeType, Value: Float64Ptr(1), Labels: models.Labels{"cpu": cpu}}
+		if cpu == "1" {
+			m.Value = Float64Ptr(2)
+		}
+		if err := svc.ProcessUpdate(context.Background(), m); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	if err := svc.ProcessUpdate(context.Background(), &models.Metrics{ID: "CPU", MType: models.GaugeType, Value: Float64Ptr(3)}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	got, err := svc.ProcessGetValue(context.Background(), `CPU{cpu="1"}`, models.GaugeType)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.ID != "CPU" || got.Labels["cpu"] != "1" || *got.Value != 2 {
+		t.Fatalf("unexpected metric: %+v", got)
+	}
+
+	all, _ := svc.ProcessGetAll(context.Background())
+	var keys []string
+	for i := range all {
+		keys = append(keys, all[i].Key())
+	}
+	want := []string{"CPU", `CPU{cpu="0"}`, `CPU{cpu="1"}`}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("keys = %v, want %v", keys, want)
+	}
+
+	bad := []models.Metrics{{ID: "x", MType: models.GaugeType, Value: Float64Ptr(1), Labels: models.Labels{"bad-name": "1"}}}
+	if err := svc.ProcessUpdates(context.Background(), bad); !errors.Is(err, models.ErrMetricInvalidLabel) {
+		t.Fatalf("want ErrMetricInvalidLabel, got %v", err)
+	}
+}
+
+func TestMetricService_SaveLoadFile_Labels(t *testing.T) {
+	svc := NewMetricService(storage.NewMemStorage())
+	_ = svc.ProcessUpdates(context.Background(), []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: Int64Ptr(4), Labels: models.Labels{"host": "a"}},
+		{ID: "PollCount", MType: models.CounterType, Delta: Int64Ptr(5)},
+	})
+
+	tmp := filepath.Join(t.TempDir(), "m.json")
+	if err := svc.SaveFile(tmp); err != nil {
+		t.Fatalf("SaveFile error: %v", err)
+	}
+	svc2 := NewMetricService(storage.NewMemStorage())
+	if err := svc2.LoadFile(tmp); err != nil {
+		t.Fatalf("LoadFile error: %v", err)
+	}
+	if v, err := svc2.ProcessGetValue(context.Background(), `PollCount{host="a"}`, models.CounterType); err != nil || *v.Delta != 4 {
+		t.Fatalf("labelled counter mismatch: %v %v", v, err)
+	}
+	if v, err := svc2.ProcessGetValue(context.Background(), "PollCount", models.CounterType); err != nil || *v.Delta != 5 {
+		t.Fatalf("plain counter mismatch: %v %v", v, err)
+	}
+}
+
+func TestProcessUpdate_HistogramMergesAcrossAgents(t *testing.T) {
+	svc := NewMetricService(storage.NewMemStorage())
+	for _, v := range []float64{0.003, 0.7} {
+		h := models.NewHistogram(models.DefaultHistogramBuckets)
+		h.Observe(v)
+		if err := svc.ProcessUpdate(context.Background(), &models.Metrics{ID: "lat", MType: models.HistogramType, Histogram: h}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+
+	got, err := svc.ProcessGetValue(context.Background(), "lat", models.HistogramType)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Histogram.Count != 2 || got.Histogram.Sum != 0.703 {
+		t.Fatalf("unexpected histogram: %+v", got.Histogram)
+	}
+
+	err = svc.ProcessUpdate(context.Background(), &models.Metrics{ID: "lat", MType: models.HistogramType})
+	if !errors.Is(err, models.ErrMetricMissingValue) {
+		t.Fatalf("want ErrMetricMissingValue, got %v", err)
+	}
+	bad := &models.Histogram{Bounds: []float64{1}, Counts: []uint64{1}}
+	if err := svc.ProcessUpdate(context.Background(), &models.Metrics{ID: "lat", MType: models.HistogramType, Histogram: bad}); !errors.Is(err, models.ErrMetricInvalidValueType) {
+		t.Fatalf("want ErrMetricInvalidValueType, got %v", err)
+	}
+
+	v := 1.0
+	_ = svc.ProcessUpdate(context.Background(), &models.Metrics{ID: "g", MType: models.GaugeType, Value: &v})
+	all, _ := svc.ProcessGetAll(context.Background())
+	if len(all) != 2 || all[0].MType != models.GaugeType || all[1].MType != models.HistogramType {
+		t.Fatalf("unexpected ordering: %+v", all)
+	}
+
+	tmp := filepath.Join(t.TempDir(), "m.json")
+	if err := svc.SaveFile(tmp); err != nil {
+		t.Fatal(err)
+	}
+	svc2 := NewMetricService(storage.NewMemStorage())
+	if err := svc2.LoadFile(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := svc2.ProcessGetValue(context.Background(), "lat", models.HistogramType); err != nil || got.Histogram.Count != 2 {
+		t.Fatalf("histogram not restored: %+v %v", got, err)
+	}
+}
+
+func TestProcessUpdate_HistogramUnsupportedStorage(t *testing.T) {
+	svc := NewMetricService(test.NewFakeStorage())
+	h := models.NewHistogram([]float64{1})
+	if err := svc.ProcessUpdate(context.Background(), &models.Metrics{ID: "lat", MType: models.HistogramType, Histogram: h}); !errors.Is(err, ErrHistogramUnsupported) {
+		t.Fatalf("want ErrHistogramUnsupported, got %v", err)
+	}
+	if _, err := svc.ProcessGetValue(context.Background(), "lat", models.HistogramType); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+}
+
+func TestProcessDelete(t *testing.T) {
+	st := storage.NewMemStorage()
+	svc := NewMetricService(st)
+	st.UpdateGauge(`g{host="a"}`, 1)
+	st.UpdateGauge(`g{host="b"}`, 2)
+
+	refs := []models.Metrics{{ID: "g", MType: models.GaugeType, Labels: models.Labels{"host": "a"}}}
+	if n, err := svc.ProcessDelete(context.Background(), refs); err != nil || n != 1 {
+		t.Fatalf("want 1 removed, got %d %v", n, err)
+	}
+	if _, err := st.GetGauge(`g{host="a"}`); !errors.Is(err, storage.ErrMetricNotFound) {
+		t.Fatalf("labelled series must be removed, got %v", err)
+	}
+	if v, _ := st.GetGauge(`g{host="b"}`); v != 2 {
+		t.Fatalf("other series must be kept, got %v", v)
+	}
+
+	bad := []models.Metrics{{ID: "g", MType: models.GaugeType}, {ID: "x", MType: "bogus"}}
+	if _, err := svc.ProcessDelete(context.Background(), bad); !errors.Is(err, models.ErrMetricInvalidType) {
+		t.Fatalf("want ErrMetricInvalidType, got %v", err)
+	}
+	if _, err := NewMetricService(test.NewFakeStorage()).ProcessDelete(context.Background(), refs); !errors.Is(err, ErrDeleteUnsupported) {
+		t.Fatalf("want ErrDeleteUnsupported, got %v", err)
+	}
+}
+
+func TestProcessResetCounter(t *testing.T) {
+	st := storage.NewMemStorage()
+	svc := NewMetricService(st)
+	st.UpdateCounter("c", 5)
+
+	if err := svc.ProcessResetCounter(context.Background(), "c"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := st.GetCounter("c"); err != nil || v != 0 {
+		t.Fatalf("want counter reset to 0, got %d %v", v, err)
+	}
+	if err := svc.ProcessResetCounter(context.Background(), "missing"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+}
+
+func TestProcessList(t *testing.T) {
+	st := storage.NewMemStorage()
+	svc := NewMetricService(st)
+	st.UpdateGauge("a", 1)
+	st.UpdateGauge("b", 2)
+	st.UpdateCounter("c", 3)
+	ctx := context.Background()
+
+	var ids []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		metrics, next, err := svc.ProcessList(ctx, models.ListOptions{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		for _, m := range metrics {
+			ids = append(ids, m.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Fatalf("pages must cover every metric once in order, got %v", ids)
+	}
+
+	metrics, next, err := svc.ProcessList(ctx, models.ListOptions{Type: models.CounterType})
+	if err != nil || next != "" || len(metrics) != 1 || metrics[0].ID != "c" {
+		t.Fatalf("type filter: %+v %q %v", metrics, next, err)
+	}
+
+	for _, opts := range []models.ListOptions{
+		{Type: "bogus"},
+		{Regex: "("},
+		{Cursor: "!!"},
+		{Limit: -1},
+	} {
+		if _, _, err := svc.ProcessList(ctx, opts); !errors.Is(err, ErrInvalidListQuery) {
+			t.Fatalf("%+v: want ErrInvalidListQuery, got %v", opts, err)
+		}
+	}
+}
+
+func TestProcessUpdate_PublishesAcceptedUpdates(t *testing.T) {
+	b := stream.NewBroker()
+	sub := b.Subscribe(stream.Filter{})
+	svc := NewMetricService(storage.NewMemStorage())
+	svc.SetBroker(b)
+	ctx := context.Background()
+
+	v := 1.5
+	if err := svc.ProcessUpdate(ctx, &models.Metrics{ID: "g", MType: models.GaugeType, Value: &v}); err != nil {
+		t.Fatal(err)
+	}
+	d := int64(2)
+	if err := svc.ProcessUpdates(ctx, []models.Metrics{{ID: "c", MType: models.CounterType, Delta: &d}}); err != nil {
+		t.Fatal(err)
+	}
+	bad := []models.Metrics{{ID: "g", MType: models.GaugeType, Value: &v, Labels: models.Labels{"": "x"}}}
+	if err := svc.ProcessUpdates(ctx, bad); err == nil {
+		t.Fatalf("invalid batch must be rejected")
+	}
+
+	if got := len(sub.C()); got != 2 {
+		t.Fatalf("want 2 published updates, got %d", got)
+	}
+	if m := <-sub.C(); m.ID != "g" || *m.Value != 1.5 {
+		t.Fatalf("unexpected update %+v", m)
+	}
+	if m := <-sub.C(); m.ID != "c" || *m.Delta != 2 {
+		t.Fatalf("unexpected update %+v", m)
+	}
+}
+
+func TestProcessUpdate_RejectsMalformed(t *testing.T) {
+	svc := NewMetricService(storage.NewMemStorage())
+	ctx := context.Background()
+
+	if err := svc.ProcessUpdate(ctx, &models.Metrics{ID: "g", MType: models.GaugeType}); !errors.Is(err, models.ErrMetricMissingValue) {
+		t.Fatalf("want ErrMetricMissingValue, got %v", err)
+	}
+	d := int64(1)
+	batch := []models.Metrics{gaugeUpdate("a"), {ID: "c", MType: models.CounterType, Delta: &d, Value: Float64Ptr(1)}}
+	if err := svc.ProcessUpdates(ctx, batch); !errors.Is(err, models.ErrMetricAmbiguousValue) {
+		t.Fatalf("want ErrMetricAmbiguousValue, got %v", err)
+	}
+	if _, err := svc.ProcessGetValue(ctx, "a", models.GaugeType); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("rejected batch must not be applied, got %v", err)
+	}
+}
+
+func TestProcessUpdate_SchemaViolation(t *testing.T) {
+	reg, err := schema.Parse([]byte(`{"strict":true,"metrics":[{"name":"a","type":"gauge","max":10}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewMetricService(storage.NewMemStorage())
+	svc.SetSchema(reg)
+	ctx := context.Background()
+
+	if err := svc.ProcessUpdate(ctx, &models.Metrics{ID: "a", MType: models.GaugeType, Value: Float64Ptr(11)}); !errors.Is(err, schema.ErrSchemaViolation) {
+		t.Fatalf("want ErrSchemaViolation, got %v", err)
+	}
+	err = svc.ProcessUpdates(ctx, []models.Metrics{gaugeUpdate("a"), gaugeUpdate("b")})
+	var ve *schema.ValidationError
+	if !errors.As(err, &ve) || len(ve.Violations) != 1 || ve.Violations[0].ID != "b" {
+		t.Fatalf("want violation for b, got %v", err)
+	}
+	if _, err := svc.ProcessGetValue(ctx, "a", models.GaugeType); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("rejected batch must not be applied, got %v", err)
+	}
+	if err := svc.ProcessUpdate(ctx, &models.Metrics{ID: "a", MType: models.GaugeType, Value: Float64Ptr(10)}); err != nil {
+		t.Fatalf("conforming update rejected: %v", err)
+	}
+}
+
+// partialBatch holds an acceptable gauge, a counter without delta and a histogram whose buckets
+// differ from the stored "lat" series with bounds [1].
+func partialBatch() []models.Metrics {
+	return []models.Metrics{
+		gaugeUpdate("g"),
+		{ID: "c", MType: models.CounterType},
+		{ID: "lat", MType: models.HistogramType, Histogram: models.NewHistogram([]float64{2})},
+	}
+}
+
+func checkPartialRejections(t *testing.T, rejected []error) {
+	t.Helper()
+	if len(rejected) != 3 || rejected[0] != nil {
+		t.Fatalf("unexpected rejections %v", rejected)
+	}
+	if !errors.Is(rejected[1], models.ErrMetricMissingValue) {
+		t.Fatalf("want ErrMetricMissingValue for c, got %v", rejected[1])
+	}
+	if !errors.Is(rejected[2], models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want ErrHistogramBucketsMismatch for lat, got %v", rejected[2])
+	}
+}
+
+func TestProcessUpdatesPartial_MemStorage(t *testing.T) {
+	st := storage.NewMemStorage()
+	if err := st.UpdateHistogram("lat", *models.NewHistogram([]float64{1})); err != nil {
+		t.Fatal(err)
+	}
+	b := stream.NewBroker()
+	sub := b.Subscribe(stream.Filter{})
+	svc := NewMetricService(st)
+	svc.SetBroker(b)
+	ctx := context.Background()
+
+	rejected, err := svc.ProcessUpdatesPartial(ctx, partialBatch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartialRejections(t, rejected)
+	if _, err := svc.ProcessGetValue(ctx, "g", models.GaugeType); err != nil {
+		t.Fatalf("accepted gauge not applied: %v", err)
+	}
+	if h, _ := st.GetHistogram("lat"); len(h.Bounds) != 1 || h.Bounds[0] != 1 {
+		t.Fatalf("rejected histogram changed the stored one: %+v", h)
+	}
+	if got := len(sub.C()); got != 1 {
+		t.Fatalf("want only the accepted update published, got %d", got)
+	}
+}
+
+func TestProcessUpdatesPartial_DBStorage(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	svc := NewMetricService(storage.NewDBStorage(mock))
+
+	mock.ExpectQuery("FROM histograms").WithArgs("lat").
+		WillReturnRows(pgxmock.NewRows([]string{"bounds", "counts", "sum", "count"}).AddRow([]float64{1}, []int64{0, 0}, 0.0, int64(0)))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO gauges").
+		WithArgs([]string{"g"}, []float64{1}, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	rejected, err := svc.ProcessUpdatesPartial(context.Background(), partialBatch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPartialRejections(t, rejected)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessUpdatesPartial_StorageFailureRejectsBatch(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	svc := NewMetricService(storage.NewDBStorage(mock))
+
+	mock.ExpectBegin().WillReturnError(fmt.Errorf("%w: down", storage.ErrStorageUnavailable))
+	rejected, err := svc.ProcessUpdatesPartial(context.Background(), []models.Metrics{gaugeUpdate("g")})
+	if err == nil || rejected != nil {
+		t.Fatalf("want a batch-level error, got %v %v", rejected, err)
+	}
+}
+
+func TestProcessGetValue_HistogramStorageFailure(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	svc := NewMetricService(storage.NewDBStorage(mock))
+
+	mock.ExpectQuery("SELECT bounds, counts, sum, count FROM histograms").WithArgs("lat").
+		WillReturnError(errors.New("relation does not exist"))
+	if _, err := svc.ProcessGetValue(context.Background(), "lat", models.HistogramType); !errors.Is(err, storage.ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+}
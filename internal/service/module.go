@@ -1,20 +1,194 @@
 package service
 
 import (
+	"context"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/logger"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/schema"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/stream"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
 	"go.uber.org/fx"
 )
 
-func provideStorage(cfg *db.Config, pool db.Pool) storage.MetricStorage {
+var (
+	// historyPruneInterval controls how often expired history samples are deleted.
+	historyPruneInterval = time.Minute
+	// ttlSweepInterval controls how often series are checked against their TTL.
+	ttlSweepInterval = time.Minute
+)
+
+// provideStorage selects PostgreSQL when a database DSN is configured, then Redis, then the embedded
+// bbolt file, and falls back to memory.
+func provideStorage(cfg *db.Config, pool db.Pool, rc *redis.Client, bdb *bolt.DB) (storage.MetricStorage, error) {
 	if cfg != nil && cfg.DSN != "" && pool != nil {
-		return storage.NewDBStorage(pool)
+		var opts []storage.DBOption
+		if cfg.History {
+			opts = append(opts, storage.WithHistory())
+		}
+		return storage.NewDBStorage(pool, opts...), nil
+	}
+	if cfg != nil && cfg.RedisDSN != "" && rc != nil {
+		return storage.NewRedisStorage(rc), nil
+	}
+	if cfg != nil && cfg.BoltPath != "" && bdb != nil {
+		return storage.NewBoltStorage(bdb)
+	}
+	return storage.NewMemStorage(), nil
+}
+
+func newMetricService(st storage.MetricStorage, cfg SnapshotConfig, b *stream.Broker, reg *schema.Registry) MetricServiceInterface {
+	s := NewMetricService(st)
+	s.SetSnapshotGenerations(cfg.Generations)
+	s.SetSchema(reg)
+	s.SetBroker(b)
+	return s
+}
+
+func runHistoryRetention(lc fx.Lifecycle, cfg *db.Config, st storage.MetricStorage, l logger.Logger) {
+	hs, ok := st.(storage.HistoryStorage)
+	if !ok || cfg == nil || !cfg.History || cfg.HistoryRetention <= 0 {
+		return
 	}
-	return storage.NewMemStorage()
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				ticker := time.NewTicker(historyPruneInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if err := hs.PruneHistoryContext(runCtx, time.Now().Add(-cfg.HistoryRetention)); err != nil && runCtx.Err() == nil {
+							l.WriteError("history prune failed", "error", err)
+						}
+					case <-runCtx.Done():
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	})
 }
 
-func newMetricService(st storage.MetricStorage) MetricServiceInterface {
-	return NewMetricService(st)
+type ttlSweeperParams struct {
+	fx.In
+	LC    fx.Lifecycle
+	Cfg   TTLConfig `optional:"true"`
+	St    storage.MetricStorage
+	L     logger.Logger
+	A     audit.Publisher `optional:"true"`
+	Clock audit.Clock     `optional:"true"`
+}
+
+// runTTLSweeper periodically evicts series that outlived their TTL, logging and auditing every eviction.
+func runTTLSweeper(p ttlSweeperParams) {
+	if len(p.Cfg.Rules) == 0 {
+		return
+	}
+	if _, ok := p.St.(storage.ExpiringStorage); !ok {
+		p.L.WriteError("metric ttl ignored", "error", ErrExpiryUnsupported)
+		return
+	}
+	now := time.Now
+	if p.Clock != nil {
+		now = p.Clock.Now
+	}
+
+	sweep := func(ctx context.Context) {
+		ts := now()
+		evicted, err := expireStale(ctx, p.St, p.Cfg, ts)
+		if err != nil {
+			p.L.WriteError("metric expiry failed", "error", err)
+		}
+		if len(evicted) == 0 {
+			return
+		}
+		keys := make([]string, len(evicted))
+		for i := range evicted {
+			keys[i] = evicted[i].Key()
+			p.L.WriteInfo("metric expired", "type", evicted[i].MType, "id", keys[i])
+		}
+		if p.A == nil {
+			return
+		}
+		event := audit.Event{Timestamp: ts.Unix(), Metrics: keys, Action: audit.ActionExpire}
+		if err := p.A.Publish(ctx, event); err != nil {
+			p.L.WriteError("audit publish failed", "error", err)
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	p.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				ticker := time.NewTicker(ttlSweepInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						sweep(context.Background())
+					case <-stop:
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	})
+}
+
+// attachWAL opens the write-ahead log of the in-memory storage before the server restores its snapshot
+// and closes it after the final snapshot on shutdown.
+func attachWAL(lc fx.Lifecycle, cfg storage.WALConfig, st storage.MetricStorage, l logger.Logger) {
+	ms, ok := st.(*storage.MemStorage)
+	if !ok || cfg.Path == "" {
+		return
+	}
+
+	var w *storage.WAL
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			var err error
+			w, err = storage.OpenWAL(cfg, func(err error) {
+				l.WriteError("wal write failed", "error", err)
+			})
+			if err != nil {
+				return err
+			}
+			ms.AttachWAL(w)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			return w.Close()
+		},
+	})
 }
 
 var Module = fx.Module(
@@ -23,4 +197,5 @@ var Module = fx.Module(
 		provideStorage,
 		newMetricService,
 	),
+	fx.Invoke(runHistoryRetention, attachWAL, runTTLSweeper),
 )
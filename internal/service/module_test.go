@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	pgxmock "github.com/pashagolub/pgxmock/v4"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/audit"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/db"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/fx/fxtest"
+)
+
+func mustProvideStorage(t *testing.T, cfg *db.Config, pool db.Pool, rc *redis.Client, bdb *bolt.DB) storage.MetricStorage {
+	t.Helper()
+	st, err := provideStorage(cfg, pool, rc, bdb)
+	if err != nil {
+		t.Fatalf("provideStorage: %v", err)
+	}
+	return st
+}
+
+func TestProvideStorage(t *testing.T) {
+	if _, ok := mustProvideStorage(t, nil, nil, nil, nil).(*storage.MemStorage); !ok {
+		t.Fatalf("want MemStorage without config")
+	}
+
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	st := mustProvideStorage(t, &db.Config{DSN: "postgres://", History: true}, mock, nil, nil)
+	ds, ok := st.(*storage.DBStorage)
+	if !ok {
+		t.Fatalf("want DBStorage, got %T", st)
+	}
+	if err := ds.PruneHistoryContext(context.Background(), time.Now()); err == nil {
+		t.Fatalf("history must be enabled and hit the database")
+	}
+
+	rc := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	defer rc.Close()
+	if _, ok := mustProvideStorage(t, &db.Config{RedisDSN: "redis://127.0.0.1:0"}, nil, rc, nil).(*storage.RedisStorage); !ok {
+		t.Fatalf("want RedisStorage with a Redis DSN")
+	}
+
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	bdb, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	if _, ok := mustProvideStorage(t, &db.Config{BoltPath: path}, nil, nil, bdb).(*storage.BoltStorage); !ok {
+		t.Fatalf("want BoltStorage with a bolt path")
+	}
+}
+
+type fakeHistoryStore struct {
+	*test.FakeStorage
+	mu     sync.Mutex
+	prunes []time.Time
+}
+
+func (f *fakeHistoryStore) HistoryContext(context.Context, models.MetricType, string, time.Time, time.Time, time.Duration) ([]models.Sample, error) {
+	return nil, nil
+}
+
+func (f *fakeHistoryStore) PruneHistoryContext(_ context.Context, before time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prunes = append(f.prunes, before)
+	return nil
+}
+
+func (f *fakeHistoryStore) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.prunes)
+}
+
+func TestRunHistoryRetention_PrunesPeriodically(t *testing.T) {
+	old := historyPruneInterval
+	historyPruneInterval = 5 * time.Millisecond
+	t.Cleanup(func() { historyPruneInterval = old })
+
+	st := &fakeHistoryStore{FakeStorage: test.NewFakeStorage()}
+	lc := fxtest.NewLifecycle(t)
+	runHistoryRetention(lc, &db.Config{History: true, HistoryRetention: time.Hour}, st, &test.FakeLogger{})
+	lc.RequireStart()
+
+	deadline := time.Now().Add(time.Second)
+	for st.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	lc.RequireStop()
+
+	if st.count() == 0 {
+		t.Fatalf("expected at least one prune")
+	}
+	if age := time.Since(st.prunes[0]); age < time.Hour || age > time.Hour+time.Minute {
+		t.Fatalf("prune cutoff should be retention ago, got %v", age)
+	}
+}
+
+func TestRunHistoryRetention_DisabledRegistersNothing(t *testing.T) {
+	st := &fakeHistoryStore{FakeStorage: test.NewFakeStorage()}
+	lc := fxtest.NewLifecycle(t)
+	runHistoryRetention(lc, &db.Config{History: true}, st, &test.FakeLogger{})
+	runHistoryRetention(lc, &db.Config{HistoryRetention: time.Hour}, st, &test.FakeLogger{})
+	runHistoryRetention(lc, &db.Config{History: true, HistoryRetention: time.Hour}, test.NewFakeStorage(), &test.FakeLogger{})
+	lc.RequireStart()
+	lc.RequireStop()
+	if st.count() != 0 {
+		t.Fatalf("no pruning expected")
+	}
+}
+
+func TestAttachWAL_ReplaysOnLoad(t *testing.T) {
+	dir := t.TempDir()
+	cfg := storage.WALConfig{Path: filepath.Join(dir, "m.wal")}
+	snapshot := filepath.Join(dir, "m.json")
+
+	st := storage.NewMemStorage()
+	lc := fxtest.NewLifecycle(t)
+	attachWAL(lc, cfg, st, &test.FakeLogger{})
+	lc.RequireStart()
+	st.UpdateCounter("c", 4)
+	lc.RequireStop()
+
+	restored := storage.NewMemStorage()
+	lc = fxtest.NewLifecycle(t)
+	attachWAL(lc, cfg, restored, &test.FakeLogger{})
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	svc := NewMetricService(restored)
+	if err := svc.LoadFile(snapshot); err != nil {
+		t.Fatalf("missing snapshot must not fail the restore: %v", err)
+	}
+	if v, _ := restored.GetCounter("c"); v != 4 {
+		t.Fatalf("wal must be replayed, got %d", v)
+	}
+}
+
+func TestRunTTLSweeper_ExpiresAndAudits(t *testing.T) {
+	old := ttlSweepInterval
+	ttlSweepInterval = 5 * time.Millisecond
+	t.Cleanup(func() { ttlSweepInterval = old })
+
+	st := storage.NewMemStorage()
+	st.UpdateGauge("g", 1)
+	pub := &test.FakePublisher[audit.Event]{}
+	lc := fxtest.NewLifecycle(t)
+	runTTLSweeper(ttlSweeperParams{
+		LC:  lc,
+		Cfg: TTLConfig{Rules: []TTLRule{{Pattern: "*", TTL: time.Nanosecond}}},
+		St:  st,
+		L:   &test.FakeLogger{},
+		A:   pub,
+	})
+	lc.RequireStart()
+
+	deadline := time.Now().Add(time.Second)
+	for len(pub.GetEvents()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	lc.RequireStop()
+
+	events := pub.GetEvents()
+	if len(events) != 1 || events[0].Action != audit.ActionExpire || events[0].Metrics[0] != "g" {
+		t.Fatalf("want one expire audit event, got %+v", events)
+	}
+	if _, err := st.GetGauge("g"); err == nil {
+		t.Fatalf("expired gauge must be removed")
+	}
+}
+
+func TestRunTTLSweeper_DisabledRegistersNothing(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	runTTLSweeper(ttlSweeperParams{LC: lc, St: storage.NewMemStorage(), L: &test.FakeLogger{}})
+	runTTLSweeper(ttlSweeperParams{
+		LC:  lc,
+		Cfg: TTLConfig{Rules: []TTLRule{{Pattern: "*", TTL: time.Minute}}},
+		St:  test.NewFakeStorage(),
+		L:   &test.FakeLogger{},
+	})
+	lc.RequireStart()
+	lc.RequireStop()
+}
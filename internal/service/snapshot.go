@@ -0,0 +1,164 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+const (
+	// SnapshotVersion is the format version written to the snapshot header.
+	SnapshotVersion = 1
+	// DefaultSnapshotGenerations is the number of snapshot files kept, including the current one.
+	DefaultSnapshotGenerations = 3
+)
+
+var (
+	// ErrSnapshotVersion indicates a snapshot written in an unknown format version.
+	ErrSnapshotVersion = fmt.Errorf("unsupported snapshot version")
+	// ErrSnapshotChecksum indicates a snapshot whose payload does not match its checksum.
+	ErrSnapshotChecksum = fmt.Errorf("snapshot checksum mismatch")
+)
+
+// SnapshotConfig controls how metric snapshots are kept on disk.
+type SnapshotConfig struct {
+	// Generations is the number of rotated snapshot files to keep; values below 1 keep only the current one.
+	Generations int
+}
+
+// snapshotFile is the on-disk layout: a header followed by the metrics it describes.
+// Checksum is the hex SHA-256 of the raw Metrics payload.
+type snapshotFile struct {
+	Version   int             `json:"version"`
+	Timestamp time.Time       `json:"timestamp"`
+	Checksum  string          `json:"checksum"`
+	Metrics   json.RawMessage `json:"metrics"`
+}
+
+// generationPath returns the file holding the given generation: the path itself for the newest one
+// and path.N for older ones.
+func generationPath(path string, gen int) string {
+	if gen == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(gen)
+}
+
+// writeSnapshot stores metrics in a temporary file next to path and renames it into place,
+// shifting the previous snapshots one generation back.
+func writeSnapshot(path string, generations int, metrics []models.Metrics, now time.Time) error {
+	payload, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload)
+	b, err := json.Marshal(snapshotFile{
+		Version:   SnapshotVersion,
+		Timestamp: now.UTC(),
+		Checksum:  hex.EncodeToString(sum[:]),
+		Metrics:   payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeAndSync(tmp, b); err != nil {
+		return err
+	}
+
+	for gen := generations - 1; gen > 0; gen-- {
+		if err := os.Rename(generationPath(path, gen-1), generationPath(path, gen)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func writeAndSync(f *os.File, b []byte) error {
+	_, err := f.Write(b)
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	return errors.Join(err, f.Close())
+}
+
+// syncDir makes the renames in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// readSnapshot returns the metrics of the newest generation that can be decoded and verified.
+// Missing generations are skipped; when none exists the result is empty.
+func readSnapshot(path string, generations int) ([]models.Metrics, error) {
+	var errs []error
+	for gen := 0; gen < max(generations, 1); gen++ {
+		b, err := os.ReadFile(generationPath(path, gen))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			var metrics []models.Metrics
+			if metrics, err = decodeSnapshot(b); err == nil {
+				return metrics, nil
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", generationPath(path, gen), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// decodeSnapshot parses a snapshot file. Files written before the header was introduced hold a bare JSON array.
+func decodeSnapshot(b []byte) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if b[0] == '[' {
+		err := json.Unmarshal(b, &metrics)
+		return metrics, err
+	}
+
+	var f snapshotFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Version != SnapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotVersion, f.Version)
+	}
+	sum := sha256.Sum256(f.Metrics)
+	if hex.EncodeToString(sum[:]) != f.Checksum {
+		return nil, ErrSnapshotChecksum
+	}
+	if err := json.Unmarshal(f.Metrics, &metrics); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	pgxmock "github.com/pashagolub/pgxmock/v4"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func counterSnapshot(v int64) []models.Metrics {
+	return []models.Metrics{{ID: "c", MType: models.CounterType, Delta: &v}}
+}
+
+func TestWriteSnapshot_RotatesGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.json")
+	for i := int64(1); i <= 4; i++ {
+		if err := writeSnapshot(path, 3, counterSnapshot(i), time.Now()); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+
+	for gen, want := range []int64{4, 3, 2} {
+		b, err := os.ReadFile(generationPath(path, gen))
+		if err != nil {
+			t.Fatalf("generation %d: %v", gen, err)
+		}
+		got, err := decodeSnapshot(b)
+		if err != nil || len(got) != 1 || *got[0].Delta != want {
+			t.Fatalf("generation %d: got %+v %v, want %d", gen, got, err, want)
+		}
+	}
+	if _, err := os.Stat(generationPath(path, 3)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("only 3 generations must be kept, stat: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Fatalf("temporary file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestReadSnapshot_FallsBackToValidGeneration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.json")
+	for i := int64(1); i <= 2; i++ {
+		if err := writeSnapshot(path, 3, counterSnapshot(i), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(`{"version":1,"checksum":"00","metrics":[]}`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readSnapshot(path, 3)
+	if err != nil || len(got) != 1 || *got[0].Delta != 1 {
+		t.Fatalf("want previous generation, got %+v %v", got, err)
+	}
+
+	if err := os.WriteFile(generationPath(path, 1), []byte(`{"metrics":`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSnapshot(path, 3); !errors.Is(err, ErrSnapshotChecksum) {
+		t.Fatalf("want every generation error reported, got %v", err)
+	}
+}
+
+func TestDecodeSnapshot_Formats(t *testing.T) {
+	got, err := decodeSnapshot([]byte(`[{"id":"g","type":"gauge","value":1.5}]`))
+	if err != nil || len(got) != 1 || *got[0].Value != 1.5 {
+		t.Fatalf("legacy array must be accepted, got %+v %v", got, err)
+	}
+	if _, err := decodeSnapshot([]byte(`{"version":2,"metrics":[]}`)); !errors.Is(err, ErrSnapshotVersion) {
+		t.Fatalf("want ErrSnapshotVersion, got %v", err)
+	}
+}
+
+func TestMetricService_LoadFile_MissingSnapshot(t *testing.T) {
+	svc := NewMetricService(storage.NewMemStorage())
+	if err := svc.LoadFile(filepath.Join(t.TempDir(), "absent.json")); err != nil {
+		t.Fatalf("missing snapshot must restore nothing, got %v", err)
+	}
+}
+
+func TestMetricService_SaveLoadFile_AcrossBackends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.json")
+
+	src := test.NewFakeStorage()
+	src.SetGauge(`g{host="a"}`, 2.5)
+	src.SetCounter("c", 9)
+	if err := NewMetricService(src).SaveFile(path); err != nil {
+		t.Fatalf("save from fake backend: %v", err)
+	}
+
+	mem := storage.NewMemStorage()
+	if err := NewMetricService(mem).LoadFile(path); err != nil {
+		t.Fatalf("load into memory: %v", err)
+	}
+	if v, _ := mem.GetGauge(`g{host="a"}`); v != 2.5 {
+		t.Fatalf("labelled gauge: got %v", v)
+	}
+	if v, _ := mem.GetCounter("c"); v != 9 {
+		t.Fatalf("counter: got %d", v)
+	}
+
+	mem.SetHistogram("h", *models.NewHistogram([]float64{1}))
+	if err := NewMetricService(mem).SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	dst := test.NewFakeStorage()
+	if err := NewMetricService(dst).LoadFile(path); !errors.Is(err, storage.ErrHistogramsUnsupported) {
+		t.Fatalf("want skipped histograms reported, got %v", err)
+	}
+	if v, _ := dst.GetCounter("c"); v != 9 {
+		t.Fatalf("counter must be imported despite skipped histograms, got %d", v)
+	}
+}
+
+func TestMetricService_LoadFile_KeepsNonEmptyBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.json")
+	if err := writeSnapshot(path, 1, counterSnapshot(1), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	st := test.NewFakeStorage()
+	st.SetCounter("c", 100)
+	if err := NewMetricService(st).LoadFile(path); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if v, _ := st.GetCounter("c"); v != 100 {
+		t.Fatalf("populated backend must not be rolled back, got %d", v)
+	}
+}
+
+func TestMetricService_SaveFile_KeepsSnapshotsWhenExportFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.json")
+	if err := writeSnapshot(path, 2, counterSnapshot(1), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, value FROM gauges`)).WillReturnError(errors.New("boom"))
+
+	if err := NewMetricService(storage.NewDBStorage(mock)).SaveFile(path); !errors.Is(err, storage.ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Fatalf("snapshot was overwritten: %s", after)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("snapshot was rotated: %v", err)
+	}
+}
+
+func TestMetricService_LoadFile_ReportsUnreadableBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.json")
+	if err := writeSnapshot(path, 1, counterSnapshot(1), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, value FROM gauges`)).WillReturnError(errors.New("boom"))
+
+	if err := NewMetricService(storage.NewDBStorage(mock)).LoadFile(path); !errors.Is(err, storage.ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+)
+
+var (
+	// ErrInvalidTTL indicates a metric expiry rule that cannot be parsed.
+	ErrInvalidTTL = fmt.Errorf("invalid metric ttl rule")
+	// ErrExpiryUnsupported indicates that the storage backend does not track update times.
+	ErrExpiryUnsupported = fmt.Errorf("metric expiry is not supported")
+)
+
+// TTLRule expires series of the metrics whose name matches Pattern, in path.Match syntax,
+// once they have not been updated for TTL.
+type TTLRule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// TTLConfig lists the expiry rules applied by the server. The first matching rule wins;
+// metrics matching no rule never expire.
+type TTLConfig struct {
+	Rules []TTLRule
+}
+
+// ParseTTLRules parses comma-separated pattern=duration pairs, e.g. "CPUutilization*=10m,*=24h".
+// A bare duration applies to every metric.
+func ParseTTLRules(raw string) ([]TTLRule, error) {
+	var rules []TTLRule
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, ttl, ok := strings.Cut(part, "=")
+		if !ok {
+			pattern, ttl = "*", part
+		}
+		pattern = strings.TrimSpace(pattern)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("%w: %q: bad pattern", ErrInvalidTTL, part)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(ttl))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: %q: bad duration", ErrInvalidTTL, part)
+		}
+		rules = append(rules, TTLRule{Pattern: pattern, TTL: d})
+	}
+	return rules, nil
+}
+
+// match returns the index of the first rule matching the metric name, or -1.
+func (c TTLConfig) match(name string) int {
+	for i, r := range c.Rules {
+		if ok, _ := path.Match(r.Pattern, name); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// expireStale evicts the series whose last update is older than the TTL of their rule
+// and returns the evicted series.
+func expireStale(ctx context.Context, st storage.MetricStorage, cfg TTLConfig, now time.Time) ([]models.Metrics, error) {
+	es, ok := st.(storage.ExpiringStorage)
+	if !ok {
+		return nil, ErrExpiryUnsupported
+	}
+
+	candidates := make([][]models.Metrics, len(cfg.Rules))
+	collect := func(t models.MetricType, load func(context.Context) (map[string]time.Time, error)) error {
+		times, err := load(ctx)
+		if err != nil {
+			return err
+		}
+		for key, updated := range times {
+			m := models.Metrics{MType: t}
+			m.SetKey(key)
+			i := cfg.match(m.ID)
+			if i < 0 || now.Sub(updated) < cfg.Rules[i].TTL {
+				continue
+			}
+			candidates[i] = append(candidates[i], m)
+		}
+		return nil
+	}
+	if err := collect(models.GaugeType, es.GaugeUpdateTimesContext); err != nil {
+		return nil, err
+	}
+	if err := collect(models.CounterType, es.CounterUpdateTimesContext); err != nil {
+		return nil, err
+	}
+	if err := collect(models.HistogramType, es.HistogramUpdateTimesContext); err != nil {
+		return nil, err
+	}
+
+	var evicted []models.Metrics
+	for i, metrics := range candidates {
+		if len(metrics) == 0 {
+			continue
+		}
+		stale, err := es.ExpireContext(ctx, metrics, now.Add(-cfg.Rules[i].TTL))
+		evicted = append(evicted, stale...)
+		if err != nil {
+			return evicted, err
+		}
+	}
+	return evicted, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/storage"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/test"
+)
+
+func TestParseTTLRules(t *testing.T) {
+	rules, err := ParseTTLRules(" CPUutilization*=10m, 1h ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []TTLRule{{Pattern: "CPUutilization*", TTL: 10 * time.Minute}, {Pattern: "*", TTL: time.Hour}}
+	if len(rules) != len(want) || rules[0] != want[0] || rules[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", rules, want)
+	}
+
+	if rules, err := ParseTTLRules(""); err != nil || rules != nil {
+		t.Fatalf("empty value must disable expiry, got %+v %v", rules, err)
+	}
+	for _, raw := range []string{"g=abc", "g=-1s", "=1m", "[=1m"} {
+		if _, err := ParseTTLRules(raw); !errors.Is(err, ErrInvalidTTL) {
+			t.Fatalf("%q: want ErrInvalidTTL, got %v", raw, err)
+		}
+	}
+}
+
+func TestExpireStale(t *testing.T) {
+	st := storage.NewMemStorage()
+	st.UpdateGauge("CPUutilization1", 1)
+	st.UpdateGauge(`Alloc{instance="a"}`, 2)
+	st.UpdateCounter("PollCount", 3)
+	cfg := TTLConfig{Rules: []TTLRule{{Pattern: "CPU*", TTL: time.Minute}, {Pattern: "Poll*", TTL: time.Hour}}}
+
+	evicted, err := expireStale(context.Background(), st, cfg, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(evicted) != 1 || evicted[0].ID != "CPUutilization1" || evicted[0].MType != models.GaugeType {
+		t.Fatalf("only the gauge past its ttl must expire, got %+v", evicted)
+	}
+	if _, err := st.GetGauge("CPUutilization1"); !errors.Is(err, storage.ErrMetricNotFound) {
+		t.Fatalf("expired gauge must be removed, got %v", err)
+	}
+	if _, err := st.GetCounter("PollCount"); err != nil {
+		t.Fatalf("counter within its ttl must be kept: %v", err)
+	}
+
+	evicted, _ = expireStale(context.Background(), st, cfg, time.Now().Add(2*time.Hour))
+	if len(evicted) != 1 || evicted[0].ID != "PollCount" {
+		t.Fatalf("counter past its ttl must expire, got %+v", evicted)
+	}
+	if _, err := st.GetGauge(`Alloc{instance="a"}`); err != nil {
+		t.Fatalf("metric matching no rule must never expire: %v", err)
+	}
+
+	if _, err := expireStale(context.Background(), test.NewFakeStorage(), cfg, time.Now()); !errors.Is(err, ErrExpiryUnsupported) {
+		t.Fatalf("want ErrExpiryUnsupported, got %v", err)
+	}
+}
+
+func TestExpireStale_Histograms(t *testing.T) {
+	st := storage.NewMemStorage()
+	if err := st.UpdateHistogram("latency", *models.NewHistogram([]float64{1, 10})); err != nil {
+		t.Fatal(err)
+	}
+	cfg := TTLConfig{Rules: []TTLRule{{Pattern: "*", TTL: time.Minute}}}
+
+	evicted, err := expireStale(context.Background(), st, cfg, time.Now().Add(10*time.Minute))
+	if err != nil || len(evicted) != 1 || evicted[0].ID != "latency" || evicted[0].MType != models.HistogramType {
+		t.Fatalf("histogram past its ttl must expire, got %+v %v", evicted, err)
+	}
+	if _, err := st.GetHistogram("latency"); !errors.Is(err, storage.ErrMetricNotFound) {
+		t.Fatalf("expired histogram must be removed, got %v", err)
+	}
+}
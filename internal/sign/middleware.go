@@ -2,7 +2,10 @@ package sign
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"sync"
 
@@ -12,8 +15,24 @@ import (
 const (
 	defaultBufferSize = 4 << 10   // 4KiB
 	maxPooledBuffer   = 256 << 10 // 256KiB
+	maxSignedBodySize = 10 << 20  // 10MiB
+
+	eventStreamType = "text/event-stream"
+)
+
+// Errors passed to AbortFunc for the requests that Middleware rejects.
+var (
+	// ErrBodyTooLarge reports a body over 10 MiB.
+	ErrBodyTooLarge = errors.New("signed request body is too large")
+	// ErrBodyUnreadable reports a body that cannot be read to verify its signature.
+	ErrBodyUnreadable = errors.New("signed request body cannot be read")
+	// ErrSignatureMismatch reports a HashSHA256 header that does not match the body.
+	ErrSignatureMismatch = errors.New("request signature does not match the body")
 )
 
+// AbortFunc ends a request that Middleware rejects with status because of err.
+type AbortFunc func(c *gin.Context, status int, err error)
+
 var bufferPool = sync.Pool{
 	New: func() any {
 		return bytes.NewBuffer(make([]byte, 0, defaultBufferSize))
@@ -38,16 +57,26 @@ func releaseBuffer(buf *bytes.Buffer) {
 }
 
 // Middleware verifies incoming request signatures and signs outgoing responses when a key is configured.
-func Middleware(s Signer, key SignKey) gin.HandlerFunc {
+// The request body is buffered for verification, so bodies over 10 MiB are rejected with 413.
+// Rejected requests are ended by abort with one of the errors above; a nil abort replies with an empty body.
+func Middleware(s Signer, key SignKey, abort AbortFunc) gin.HandlerFunc {
 	if key == "" {
 		return func(c *gin.Context) { c.Next() }
 	}
+	if abort == nil {
+		abort = func(c *gin.Context, status int, _ error) { c.AbortWithStatus(status) }
+	}
 	return func(c *gin.Context) {
 		reqBuf := acquireBuffer()
 		defer releaseBuffer(reqBuf)
 
-		if _, err := reqBuf.ReadFrom(c.Request.Body); err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
+		if _, err := reqBuf.ReadFrom(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize)); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				abort(c, http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
+				return
+			}
+			abort(c, http.StatusBadRequest, fmt.Errorf("%w: %w", ErrBodyUnreadable, err))
 			return
 		}
 		body := reqBuf.Bytes()
@@ -56,7 +85,7 @@ func Middleware(s Signer, key SignKey) gin.HandlerFunc {
 
 		if sig := c.GetHeader("HashSHA256"); sig != "" {
 			if !s.Verify(body, key, sig) {
-				c.AbortWithStatus(http.StatusBadRequest)
+				abort(c, http.StatusBadRequest, ErrSignatureMismatch)
 				return
 			}
 		}
@@ -67,6 +96,11 @@ func Middleware(s Signer, key SignKey) gin.HandlerFunc {
 
 		c.Next()
 
+		if hw.streaming {
+			releaseBuffer(hw.body)
+			c.Writer = orig
+			return
+		}
 		respBody := hw.body.Bytes()
 		sig := s.Sign(respBody, key)
 		orig.Header().Set("HashSHA256", sig)
@@ -84,10 +118,14 @@ func Middleware(s Signer, key SignKey) gin.HandlerFunc {
 	}
 }
 
+// signWriter buffers the response so that it can be signed once complete.
+// Flushing a text/event-stream response switches it to passing writes through unsigned;
+// flushes of any other response are ignored so that it is still signed.
 type signWriter struct {
 	gin.ResponseWriter
-	body   *bytes.Buffer
-	status int
+	body      *bytes.Buffer
+	status    int
+	streaming bool
 }
 
 func newSignWriter(w gin.ResponseWriter) *signWriter {
@@ -95,18 +133,30 @@ func newSignWriter(w gin.ResponseWriter) *signWriter {
 }
 
 func (w *signWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
 	return w.body.Write(b)
 }
 
 func (w *signWriter) WriteString(s string) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.WriteString(s)
+	}
 	return w.body.WriteString(s)
 }
 
 func (w *signWriter) WriteHeader(code int) {
+	if w.streaming {
+		return
+	}
 	w.status = code
 }
 
 func (w *signWriter) Status() int {
+	if w.streaming {
+		return w.ResponseWriter.Status()
+	}
 	if w.status != 0 {
 		return w.status
 	}
@@ -114,11 +164,43 @@ func (w *signWriter) Status() int {
 }
 
 func (w *signWriter) Size() int {
+	if w.streaming {
+		return w.ResponseWriter.Size()
+	}
 	return w.body.Len()
 }
 
 func (w *signWriter) Written() bool {
+	if w.streaming {
+		return w.ResponseWriter.Written()
+	}
 	return w.body.Len() > 0
 }
 
+// Flush sends a buffered event stream unsigned and passes all later writes straight through.
+func (w *signWriter) Flush() {
+	if !w.streaming {
+		if !isEventStream(w.Header().Get("Content-Type")) {
+			return
+		}
+		w.streaming = true
+		status := w.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.ResponseWriter.WriteHeader(status)
+		if w.body.Len() > 0 {
+			_, _ = w.ResponseWriter.Write(w.body.Bytes())
+			w.body.Reset()
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
 func (w *signWriter) WriteHeaderNow() {}
+
+// isEventStream reports whether the Content-Type is that of server-sent events.
+func isEventStream(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mt == eventStreamType
+}
@@ -13,7 +13,7 @@ import (
 func TestMiddleware_SignsAndVerifies(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.Use(Middleware(NewSignerSHA256(), SignKey("secret")))
+	r.Use(Middleware(NewSignerSHA256(), SignKey("secret"), nil))
 	r.POST("/test", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
 
 	body := []byte("hello")
@@ -33,7 +33,7 @@ func TestMiddleware_SignsAndVerifies(t *testing.T) {
 func TestMiddleware_MissingHash(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.Use(Middleware(NewSignerSHA256(), SignKey("secret")))
+	r.Use(Middleware(NewSignerSHA256(), SignKey("secret"), nil))
 	r.POST("/test", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
 
 	req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader([]byte("hello")))
@@ -51,7 +51,7 @@ func TestMiddleware_MissingHash(t *testing.T) {
 func TestMiddleware_BadHash(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.Use(Middleware(NewSignerSHA256(), SignKey("secret")))
+	r.Use(Middleware(NewSignerSHA256(), SignKey("secret"), nil))
 	r.POST("/test", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
 
 	req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader([]byte("hello")))
@@ -66,7 +66,7 @@ func TestMiddleware_BadHash(t *testing.T) {
 func TestMiddleware_DefaultStatus(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.Use(Middleware(NewSignerSHA256(), SignKey("secret")))
+	r.Use(Middleware(NewSignerSHA256(), SignKey("secret"), nil))
 	r.POST("/test", func(c *gin.Context) {
 		_, _ = c.Writer.Write([]byte("ok"))
 	})
@@ -88,7 +88,7 @@ func TestMiddleware_DefaultStatus(t *testing.T) {
 func TestMiddleware_NoKey(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.Use(Middleware(NewSignerSHA256(), ""))
+	r.Use(Middleware(NewSignerSHA256(), "", nil))
 	r.POST("/test", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
 
 	req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader([]byte("body")))
@@ -110,7 +110,7 @@ func (errReader) Close() error               { return nil }
 func TestMiddleware_ReadError(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.Use(Middleware(NewSignerSHA256(), SignKey("secret")))
+	r.Use(Middleware(NewSignerSHA256(), SignKey("secret"), nil))
 	r.POST("/test", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
 
 	req := httptest.NewRequest(http.MethodPost, "/test", errReader{})
@@ -157,3 +157,63 @@ func TestSignWriter(t *testing.T) {
 	}
 	w.WriteHeaderNow()
 }
+
+func TestMiddleware_FlushStreamsUnsigned(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(NewSignerSHA256(), "k", nil))
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream; charset=utf-8")
+		c.Status(http.StatusAccepted)
+		_, _ = c.Writer.WriteString("a")
+		c.Writer.Flush()
+		_, _ = c.Writer.WriteString("b")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "ab" || !w.Flushed {
+		t.Fatalf("got %d %q flushed=%v", w.Code, w.Body.String(), w.Flushed)
+	}
+	if w.Header().Get("HashSHA256") != "" {
+		t.Fatalf("streamed response must not carry a signature")
+	}
+}
+
+func TestMiddleware_FlushKeepsSigningOtherResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewSignerSHA256()
+	r := gin.New()
+	r.Use(Middleware(s, "k", nil))
+	r.GET("/json", func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+		_, _ = c.Writer.WriteString(`{"a":`)
+		c.Writer.Flush()
+		_, _ = c.Writer.WriteString(`1}`)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/json", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"a":1}` {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("HashSHA256"); got != s.Sign([]byte(`{"a":1}`), "k") {
+		t.Fatalf("flushed response must still be signed, got %q", got)
+	}
+}
+
+func TestMiddleware_BodyTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(NewSignerSHA256(), SignKey("secret"), nil))
+	r.POST("/test", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	body := bytes.Repeat([]byte("a"), maxSignedBodySize+1)
+	req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewReader(body))
+	req.Header.Set("HashSHA256", NewSignerSHA256().Sign(body, SignKey("secret")))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status=%d want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func deleteRefs() []models.Metrics {
+	return []models.Metrics{
+		{ID: "g", MType: models.GaugeType},
+		{ID: "c", MType: models.CounterType},
+		{ID: "absent", MType: models.CounterType},
+	}
+}
+
+func TestDeleteContext_Backends(t *testing.T) {
+	bs, bdb := openTestBolt(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer bdb.Close()
+	rs, _ := newTestRedisStorage(t)
+
+	for name, st := range map[string]interface {
+		MetricStorage
+		DeleteStorage
+	}{"memory": NewMemStorage(), "bolt": bs, "redis": rs} {
+		t.Run(name, func(t *testing.T) {
+			st.UpdateGauge("g", 1)
+			st.UpdateGauge("keep", 2)
+			st.UpdateCounter("c", 3)
+
+			n, err := st.DeleteContext(context.Background(), deleteRefs())
+			if err != nil || n != 2 {
+				t.Fatalf("want 2 removed, got %d %v", n, err)
+			}
+			if _, err := st.GetGauge("g"); !errors.Is(err, ErrMetricNotFound) {
+				t.Fatalf("gauge must be removed, got %v", err)
+			}
+			if _, err := st.GetCounter("c"); !errors.Is(err, ErrMetricNotFound) {
+				t.Fatalf("counter must be removed, got %v", err)
+			}
+			if c := st.AllCounters(); len(c) != 0 {
+				t.Fatalf("removed counter must not be listed: %v", c)
+			}
+			if v, _ := st.GetGauge("keep"); v != 2 {
+				t.Fatalf("unlisted gauge must be kept, got %v", v)
+			}
+		})
+	}
+}
+
+func TestMemStorage_DeleteIsReplayedFromWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.wal")
+
+	ms := NewMemStorage()
+	ms.AttachWAL(openTestWAL(t, path))
+	ms.UpdateCounter("c", 2)
+	if _, err := ms.DeleteContext(context.Background(), []models.Metrics{{ID: "c", MType: models.CounterType}}); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewMemStorage()
+	restored.AttachWAL(openTestWAL(t, path))
+	if err := restored.Restore([]models.Metrics{{ID: "c", MType: models.CounterType, Delta: pInt64(10)}}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := restored.GetCounter("c"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("logged delete must be replayed, got %v", err)
+	}
+}
+
+func TestDBStorage_DeleteContext(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlDeleteMetrics)).
+		WithArgs([]string{"g"}, []string{"c", "absent"}, []string(nil)).
+		WillReturnRows(pgxmock.NewRows([]string{"n"}).AddRow(int64(2)))
+	n, err := s.DeleteContext(context.Background(), deleteRefs())
+	if err != nil || n != 2 {
+		t.Fatalf("want 2 removed, got %d %v", n, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlDeleteMetrics)).
+		WithArgs([]string{"g"}, []string{"c", "absent"}, []string(nil)).
+		WillReturnError(errors.New("boom"))
+	if _, err := s.DeleteContext(context.Background(), deleteRefs()); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	if n, err := s.DeleteContext(context.Background(), nil); err != nil || n != 0 {
+		t.Fatalf("empty delete must not hit the database, got %d %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
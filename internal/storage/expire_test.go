@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func TestMemStorage_ExpireContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.wal")
+	ms := NewMemStorage()
+	ms.AttachWAL(openTestWAL(t, path))
+	ms.UpdateGauge("g", 1)
+	ms.UpdateCounter("c", 2)
+
+	if _, ok := ms.GaugeUpdateTimes()["g"]; !ok {
+		t.Fatalf("gauge update time must be tracked")
+	}
+	refs := []models.Metrics{{ID: "g", MType: models.GaugeType}, {ID: "c", MType: models.CounterType}}
+
+	stale, err := ms.ExpireContext(context.Background(), refs, time.Now().Add(-time.Hour))
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("fresh metrics must be kept, got %+v %v", stale, err)
+	}
+	stale, err = ms.ExpireContext(context.Background(), refs[:1], time.Now().Add(time.Hour))
+	if err != nil || len(stale) != 1 || stale[0].ID != "g" {
+		t.Fatalf("want gauge expired, got %+v %v", stale, err)
+	}
+	if _, ok := ms.GaugeUpdateTimes()["g"]; ok {
+		t.Fatalf("expired gauge update time must be dropped")
+	}
+
+	restored := NewMemStorage()
+	restored.AttachWAL(openTestWAL(t, path))
+	if err := restored.Restore(nil); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := restored.GetGauge("g"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("logged expiry must be replayed, got %v", err)
+	}
+	if v, _ := restored.GetCounter("c"); v != 2 {
+		t.Fatalf("counter must survive replay, got %d", v)
+	}
+}
+
+func TestMemStorage_ExpireContextHistogram(t *testing.T) {
+	ms := NewMemStorage()
+	if err := ms.UpdateHistogram("h", *models.NewHistogram([]float64{1})); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ms.HistogramUpdateTimes()["h"]; !ok {
+		t.Fatalf("histogram update time must be tracked")
+	}
+	refs := []models.Metrics{{ID: "h", MType: models.HistogramType}}
+
+	stale, err := ms.ExpireContext(context.Background(), refs, time.Now().Add(-time.Hour))
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("fresh histogram must be kept, got %+v %v", stale, err)
+	}
+	stale, err = ms.ExpireContext(context.Background(), refs, time.Now().Add(time.Hour))
+	if err != nil || len(stale) != 1 || stale[0].ID != "h" {
+		t.Fatalf("want histogram expired, got %+v %v", stale, err)
+	}
+	if _, err := ms.GetHistogram("h"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("expired histogram must be removed, got %v", err)
+	}
+	if _, ok := ms.HistogramUpdateTimes()["h"]; ok {
+		t.Fatalf("expired histogram update time must be dropped")
+	}
+}
+
+func TestDBStorage_ExpireContext(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+	before := time.Unix(1700000000, 0)
+
+	refs := append(deleteRefs(), models.Metrics{ID: "h", MType: models.HistogramType})
+	mock.ExpectQuery(regexp.QuoteMeta(sqlExpireMetrics)).
+		WithArgs([]string{"g"}, []string{"c", "absent"}, []string{"h"}, before).
+		WillReturnRows(pgxmock.NewRows([]string{"type", "id"}).AddRow("gauge", "g").AddRow("histogram", "h"))
+	stale, err := s.ExpireContext(context.Background(), refs, before)
+	if err != nil || len(stale) != 2 || stale[0].ID != "g" || stale[0].MType != models.GaugeType || stale[1].MType != models.HistogramType {
+		t.Fatalf("want gauge and histogram expired, got %+v %v", stale, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlExpireMetrics)).
+		WithArgs([]string{"g"}, []string{"c", "absent"}, []string(nil), before).
+		WillReturnError(errors.New("boom"))
+	if _, err := s.ExpireContext(context.Background(), deleteRefs(), before); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
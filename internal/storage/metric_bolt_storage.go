@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+var (
+	boltGaugesBucket     = []byte("gauges")
+	boltCountersBucket   = []byte("counters")
+	boltHistogramsBucket = []byte("histograms")
+)
+
+// BoltStorage keeps metrics in an embedded bbolt file, so a single server persists every update
+// without an external database. Gauges and counters are stored as 8-byte big-endian values,
+// histograms as JSON. Every write runs in its own bbolt transaction.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage creates the metric buckets in db when missing and returns a storage backed by it.
+func NewBoltStorage(db *bolt.DB) (*BoltStorage, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltGaugesBucket, boltCountersBucket, boltHistogramsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapBoltError(context.Background(), err)
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+func encodeGauge(v float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+func decodeGauge(b []byte) (float64, bool) {
+	if len(b) != 8 {
+		return 0, false
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), true
+}
+
+func encodeCounter(v int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(v))
+}
+
+func decodeCounter(b []byte) (int64, bool) {
+	if len(b) != 8 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(b)), true
+}
+
+// update runs fn in a read-write transaction unless ctx is already done.
+func (s *BoltStorage) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wrapBoltError(ctx, s.db.Update(fn))
+}
+
+// view runs fn in a read-only transaction unless ctx is already done.
+func (s *BoltStorage) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wrapBoltError(ctx, s.db.View(fn))
+}
+
+func putGauge(tx *bolt.Tx, name string, value float64) error {
+	return tx.Bucket(boltGaugesBucket).Put([]byte(name), encodeGauge(value))
+}
+
+func addCounter(tx *bolt.Tx, name string, delta int64) error {
+	b := tx.Bucket(boltCountersBucket)
+	cur, _ := decodeCounter(b.Get([]byte(name)))
+	return b.Put([]byte(name), encodeCounter(cur+delta))
+}
+
+func mergeBoltHistogram(tx *bolt.Tx, name string, h models.Histogram) error {
+	b := tx.Bucket(boltHistogramsBucket)
+	if raw := b.Get([]byte(name)); raw != nil {
+		var cur models.Histogram
+		if err := json.Unmarshal(raw, &cur); err != nil {
+			return err
+		}
+		merged, err := cur.Merge(h)
+		if err != nil {
+			return err
+		}
+		h = merged
+	}
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(name), raw)
+}
+
+// UpdateGauge stores the latest gauge value. Errors are dropped; use UpdateGaugeContext to observe them.
+func (s *BoltStorage) UpdateGauge(name string, value float64) {
+	_ = s.UpdateGaugeContext(context.Background(), name, value)
+}
+
+// UpdateGaugeContext stores the latest gauge value.
+func (s *BoltStorage) UpdateGaugeContext(ctx context.Context, name string, value float64) error {
+	return s.SetGaugeContext(ctx, name, value)
+}
+
+// UpdateCounter increments the counter. Errors are dropped; use UpdateCounterContext to observe them.
+func (s *BoltStorage) UpdateCounter(name string, delta int64) {
+	_ = s.UpdateCounterContext(context.Background(), name, delta)
+}
+
+// UpdateCounterContext increments the counter by delta.
+func (s *BoltStorage) UpdateCounterContext(ctx context.Context, name string, delta int64) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		return addCounter(tx, name, delta)
+	})
+}
+
+// GetGauge retrieves a gauge value.
+func (s *BoltStorage) GetGauge(name string) (float64, error) {
+	return s.GetGaugeContext(context.Background(), name)
+}
+
+// GetGaugeContext retrieves a gauge value.
+func (s *BoltStorage) GetGaugeContext(ctx context.Context, name string) (float64, error) {
+	var (
+		v  float64
+		ok bool
+	)
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		v, ok = decodeGauge(tx.Bucket(boltGaugesBucket).Get([]byte(name)))
+		return nil
+	})
+	if err == nil && !ok {
+		return 0, ErrMetricNotFound
+	}
+	return v, err
+}
+
+// GetCounter retrieves a counter value.
+func (s *BoltStorage) GetCounter(name string) (int64, error) {
+	return s.GetCounterContext(context.Background(), name)
+}
+
+// GetCounterContext retrieves a counter value.
+func (s *BoltStorage) GetCounterContext(ctx context.Context, name string) (int64, error) {
+	var (
+		v  int64
+		ok bool
+	)
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		v, ok = decodeCounter(tx.Bucket(boltCountersBucket).Get([]byte(name)))
+		return nil
+	})
+	if err == nil && !ok {
+		return 0, ErrMetricNotFound
+	}
+	return v, err
+}
+
+// SetGauge overwrites a gauge. Errors are dropped; use SetGaugeContext to observe them.
+func (s *BoltStorage) SetGauge(name string, value float64) {
+	_ = s.SetGaugeContext(context.Background(), name, value)
+}
+
+// SetGaugeContext overwrites a gauge.
+func (s *BoltStorage) SetGaugeContext(ctx context.Context, name string, value float64) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		return putGauge(tx, name, value)
+	})
+}
+
+// SetCounter overwrites a counter. Errors are dropped; use SetCounterContext to observe them.
+func (s *BoltStorage) SetCounter(name string, value int64) {
+	_ = s.SetCounterContext(context.Background(), name, value)
+}
+
+// SetCounterContext overwrites a counter.
+func (s *BoltStorage) SetCounterContext(ctx context.Context, name string, value int64) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltCountersBucket).Put([]byte(name), encodeCounter(value))
+	})
+}
+
+// AllGauges returns all gauges, or an empty map when the file cannot be read.
+func (s *BoltStorage) AllGauges() map[string]float64 {
+	res, err := s.AllGaugesContext(context.Background())
+	if err != nil {
+		return map[string]float64{}
+	}
+	return res
+}
+
+// AllGaugesContext returns all gauges.
+func (s *BoltStorage) AllGaugesContext(ctx context.Context) (map[string]float64, error) {
+	res := make(map[string]float64)
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltGaugesBucket).ForEach(func(k, v []byte) error {
+			if f, ok := decodeGauge(v); ok {
+				res[string(k)] = f
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AllCounters returns all counters, or an empty map when the file cannot be read.
+func (s *BoltStorage) AllCounters() map[string]int64 {
+	res, err := s.AllCountersContext(context.Background())
+	if err != nil {
+		return map[string]int64{}
+	}
+	return res
+}
+
+// AllCountersContext returns all counters.
+func (s *BoltStorage) AllCountersContext(ctx context.Context) (map[string]int64, error) {
+	res := make(map[string]int64)
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(boltCountersBucket).ForEach(func(k, v []byte) error {
+			if n, ok := decodeCounter(v); ok {
+				res[string(k)] = n
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateHistogram merges the distribution into the stored histogram.
+func (s *BoltStorage) UpdateHistogram(name string, h models.Histogram) error {
+	return s.update(context.Background(), func(tx *bolt.Tx) error {
+		return mergeBoltHistogram(tx, name, h)
+	})
+}
+
+// GetHistogram retrieves a histogram.
+func (s *BoltStorage) GetHistogram(name string) (models.Histogram, error) {
+	var (
+		h     models.Histogram
+		found bool
+	)
+	err := s.view(context.Background(), func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltHistogramsBucket).Get([]byte(name))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &h)
+	})
+	if err == nil && !found {
+		return models.Histogram{}, ErrMetricNotFound
+	}
+	return h, err
+}
+
+// SetHistogram overwrites a histogram without merging.
+func (s *BoltStorage) SetHistogram(name string, h models.Histogram) {
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return
+	}
+	_ = s.update(context.Background(), func(tx *bolt.Tx) error {
+		return tx.Bucket(boltHistogramsBucket).Put([]byte(name), raw)
+	})
+}
+
+// AllHistograms returns all histograms, or an empty map when the file cannot be read.
+func (s *BoltStorage) AllHistograms() map[string]models.Histogram {
+	res := make(map[string]models.Histogram)
+	err := s.view(context.Background(), func(tx *bolt.Tx) error {
+		return tx.Bucket(boltHistogramsBucket).ForEach(func(k, v []byte) error {
+			var h models.Histogram
+			if json.Unmarshal(v, &h) == nil {
+				res[string(k)] = h
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return map[string]models.Histogram{}
+	}
+	return res
+}
+
+// UpdateBatch applies a batch of updates in a single transaction.
+func (s *BoltStorage) UpdateBatch(metrics []models.Metrics) error {
+	return s.UpdateBatchContext(context.Background(), metrics)
+}
+
+// UpdateBatchContext applies a batch of updates in a single transaction.
+// A histogram whose buckets do not match the stored one rolls back the whole batch.
+func (s *BoltStorage) UpdateBatchContext(ctx context.Context, metrics []models.Metrics) error {
+	gauges, counters := aggregateMetrics(metrics)
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		for name, v := range gauges {
+			if err := putGauge(tx, name, v); err != nil {
+				return err
+			}
+		}
+		for name, delta := range counters {
+			if err := addCounter(tx, name, delta); err != nil {
+				return err
+			}
+		}
+		for i := range metrics {
+			if metrics[i].MType != models.HistogramType || metrics[i].Histogram == nil {
+				continue
+			}
+			if err := mergeBoltHistogram(tx, metrics[i].Key(), *metrics[i].Histogram); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteContext removes the listed metrics in a single transaction.
+func (s *BoltStorage) DeleteContext(ctx context.Context, metrics []models.Metrics) (int, error) {
+	gauges, counters, histograms := deleteKeys(metrics)
+	n := 0
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		n = 0
+		for _, keys := range []struct {
+			bucket []byte
+			names  []string
+		}{{boltGaugesBucket, gauges}, {boltCountersBucket, counters}, {boltHistogramsBucket, histograms}} {
+			b := tx.Bucket(keys.bucket)
+			for _, name := range keys.names {
+				if b.Get([]byte(name)) == nil {
+					continue
+				}
+				if err := b.Delete([]byte(name)); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// wrapBoltError classifies a bbolt failure as ErrStorageUnavailable when the file is closed
+// and as ErrStorageFailure otherwise. Rejected histogram merges are returned unchanged.
+func wrapBoltError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	if errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		return err
+	}
+	if errors.Is(err, berrors.ErrDatabaseNotOpen) || errors.Is(err, berrors.ErrTimeout) {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+	return fmt.Errorf("%w: %w", ErrStorageFailure, err)
+}
+
+var (
+	_ MetricStorage    = (*BoltStorage)(nil)
+	_ MetricStorageV2  = (*BoltStorage)(nil)
+	_ BatchStorageV2   = (*BoltStorage)(nil)
+	_ HistogramStorage = (*BoltStorage)(nil)
+	_ DeleteStorage    = (*BoltStorage)(nil)
+)
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func openTestBolt(t *testing.T, path string) (*BoltStorage, *bolt.DB) {
+	t.Helper()
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewBoltStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, db
+}
+
+func TestBoltStorage_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	s, db := openTestBolt(t, path)
+
+	s.UpdateGauge(`g{host="a"}`, 1.5)
+	s.UpdateCounter("c", 2)
+	s.UpdateCounter("c", 3)
+	if err := s.UpdateHistogram("h", *models.NewHistogram([]float64{1, 2})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetGauge("missing"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, db = openTestBolt(t, path)
+	defer db.Close()
+	if v, err := s.GetGauge(`g{host="a"}`); err != nil || v != 1.5 {
+		t.Fatalf("gauge: %v %v", v, err)
+	}
+	if c := s.AllCounters(); len(c) != 1 || c["c"] != 5 {
+		t.Fatalf("counters: %v", c)
+	}
+	if h, err := s.GetHistogram("h"); err != nil || len(h.Bounds) != 2 {
+		t.Fatalf("histogram: %+v %v", h, err)
+	}
+}
+
+func TestBoltStorage_UpdateBatchIsAtomic(t *testing.T) {
+	s, db := openTestBolt(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer db.Close()
+
+	g, d := 2.0, int64(4)
+	batch := []models.Metrics{
+		{ID: "g", MType: models.GaugeType, Value: &g},
+		{ID: "c", MType: models.CounterType, Delta: &d},
+		{ID: "c", MType: models.CounterType, Delta: &d},
+		{ID: "h", MType: models.HistogramType, Histogram: models.NewHistogram([]float64{1})},
+	}
+	if err := s.UpdateBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.GetCounter("c"); v != 8 {
+		t.Fatalf("counter: got %d", v)
+	}
+
+	g2 := 7.0
+	bad := []models.Metrics{
+		{ID: "g", MType: models.GaugeType, Value: &g2},
+		{ID: "h", MType: models.HistogramType, Histogram: models.NewHistogram([]float64{1, 5})},
+	}
+	if err := s.UpdateBatch(bad); !errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want bucket mismatch, got %v", err)
+	}
+	if v, _ := s.GetGauge("g"); v != 2 {
+		t.Fatalf("failed batch must be rolled back, gauge %v", v)
+	}
+}
+
+func TestBoltStorage_ErrorsAreClassified(t *testing.T) {
+	s, db := openTestBolt(t, filepath.Join(t.TempDir(), "metrics.db"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.UpdateCounterContext(ctx, "c", 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AllGaugesContext(context.Background()); !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("want ErrStorageUnavailable on a closed file, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	pgxmock "github.com/pashagolub/pgxmock/v4"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func TestDBStorage_UpdateHistogram(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+
+	h := models.NewHistogram([]float64{1, 2})
+	h.Observe(1.5)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlMergeHistogram)).
+		WithArgs("lat", []float64{1, 2}, []int64{0, 1, 0}, 1.5, int64(1), "{}").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("lat"))
+	if err := s.UpdateHistogram("lat", *h); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlMergeHistogram)).
+		WithArgs("lat", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnError(pgx.ErrNoRows)
+	if err := s.UpdateHistogram("lat", *h); !errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want ErrHistogramBucketsMismatch, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBStorage_GetAndAllHistograms(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetHistogram)).WithArgs("lat").
+		WillReturnRows(pgxmock.NewRows([]string{"bounds", "counts", "sum", "count"}).
+			AddRow([]float64{1}, []int64{2, 3}, 9.5, int64(5)))
+	h, err := s.GetHistogram("lat")
+	if err != nil || h.Count != 5 || h.Counts[1] != 3 || h.Sum != 9.5 {
+		t.Fatalf("unexpected: %+v %v", h, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetHistogram)).WithArgs("x").WillReturnError(pgx.ErrNoRows)
+	if _, err := s.GetHistogram("x"); err != ErrMetricNotFound {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlAllHistograms)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "bounds", "counts", "sum", "count"}).
+			AddRow("lat", []float64{1}, []int64{1, 0}, 0.5, int64(1)))
+	all := s.AllHistograms()
+	if len(all) != 1 || all["lat"].Count != 1 {
+		t.Fatalf("unexpected: %+v", all)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlSetHistogram)).
+		WithArgs("lat", []float64{1}, []int64{1, 0}, 0.5, int64(1), "{}").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	s.SetHistogram("lat", all["lat"])
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBStorage_UpdateBatch_Histograms(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+
+	a := models.NewHistogram([]float64{1})
+	a.Observe(0.5)
+	b := models.NewHistogram([]float64{1})
+	b.Observe(3)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(sqlMergeHistogram)).
+		WithArgs("lat", []float64{1}, []int64{1, 1}, 3.5, int64(2), "{}").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("lat"))
+	mock.ExpectCommit()
+	err := s.UpdateBatch([]models.Metrics{
+		{ID: "lat", MType: models.HistogramType, Histogram: a},
+		{ID: "lat", MType: models.HistogramType, Histogram: b},
+	})
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+
+	err = s.UpdateBatch([]models.Metrics{
+		{ID: "lat", MType: models.HistogramType, Histogram: a},
+		{ID: "lat", MType: models.HistogramType, Histogram: models.NewHistogram([]float64{2})},
+	})
+	if !errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want ErrHistogramBucketsMismatch, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBStorage_HistogramContextMethodsReportErrors(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+	h := models.NewHistogram([]float64{1})
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGetHistogram)).WithArgs("lat").
+		WillReturnError(errors.New("relation does not exist"))
+	if _, err := s.GetHistogramContext(context.Background(), "lat"); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlSetHistogram)).
+		WithArgs("lat", pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnError(errors.New("disk full"))
+	if err := s.SetHistogramContext(context.Background(), "lat", *h); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlAllHistograms)).WillReturnError(errors.New("boom"))
+	if _, err := s.AllHistogramsContext(context.Background()); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.UpdateHistogramContext(ctx, "lat", *h); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	pgxmock "github.com/pashagolub/pgxmock/v4"
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func TestWithSamples_WrapsUpsert(t *testing.T) {
+	got := withSamples(sqlUpdateGauges, "gauge_samples")
+	if !strings.HasPrefix(got, "WITH up AS (INSERT INTO gauges") {
+		t.Fatalf("unexpected prefix: %s", got)
+	}
+	if !strings.Contains(got, "RETURNING id, value)") ||
+		!strings.HasSuffix(got, "INSERT INTO gauge_samples(id, value, ts) SELECT id, value, NOW() FROM up;") {
+		t.Fatalf("unexpected statement: %s", got)
+	}
+}
+
+func TestDBStorage_HistoryWrites(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock, WithHistory())
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateGaugesHistory)).
+		WithArgs("g", 1.5, "{}").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	s.UpdateGauge("g", 1.5)
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateCountersHistory)).
+		WithArgs("c", int64(2), "{}").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	s.UpdateCounter("c", 2)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(sqlUpsertGaugesHistory)).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec(regexp.QuoteMeta(sqlUpsertCountersHistory)).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	err := s.UpdateBatch([]models.Metrics{
+		{ID: "g", MType: models.GaugeType, Value: pFloat64(1)},
+		{ID: "c", MType: models.CounterType, Delta: pInt64(1)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBStorage_History_Disabled(t *testing.T) {
+	s := NewDBStorage(nil)
+	if _, err := s.HistoryContext(context.Background(), models.GaugeType, "g", time.Time{}, time.Now(), 0); !errors.Is(err, ErrHistoryDisabled) {
+		t.Fatalf("want ErrHistoryDisabled, got %v", err)
+	}
+	if err := s.PruneHistoryContext(context.Background(), time.Now()); err != nil {
+		t.Fatalf("prune on disabled history must be a no-op, got %v", err)
+	}
+}
+
+func TestDBStorage_History_Queries(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock, WithHistory())
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGaugeHistory)).
+		WithArgs("g", from, to).
+		WillReturnRows(pgxmock.NewRows([]string{"ts", "value"}).
+			AddRow(from, 1.0).
+			AddRow(from.Add(time.Minute), 2.0))
+	got, err := s.HistoryContext(context.Background(), models.GaugeType, "g", from, to, 0)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if len(got) != 2 || *got[1].Value != 2.0 || got[1].Delta != nil {
+		t.Fatalf("unexpected gauge samples: %+v", got)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlCounterHistoryStep)).
+		WithArgs("c", from, to, 60.0).
+		WillReturnRows(pgxmock.NewRows([]string{"bucket", "value"}).AddRow(from, int64(10)))
+	got, err = s.HistoryContext(context.Background(), models.CounterType, "c", from, to, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if len(got) != 1 || *got[0].Delta != 10 || got[0].Value != nil {
+		t.Fatalf("unexpected counter samples: %+v", got)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlGaugeHistoryStep)).
+		WithArgs("g", from, to, 30.0).
+		WillReturnError(errors.New("boom"))
+	if _, err := s.HistoryContext(context.Background(), models.GaugeType, "g", from, to, 30*time.Second); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	if _, err := s.HistoryContext(context.Background(), "bogus", "g", from, to, 0); !errors.Is(err, models.ErrMetricInvalidType) {
+		t.Fatalf("want ErrMetricInvalidType, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBStorage_PruneHistory(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock, WithHistory())
+
+	before := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta(sqlPruneGaugeHistory)).
+		WithArgs(before).WillReturnResult(pgxmock.NewResult("DELETE", 3))
+	mock.ExpectExec(regexp.QuoteMeta(sqlPruneCounterHistory)).
+		WithArgs(before).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	if err := s.PruneHistoryContext(context.Background(), before); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlPruneGaugeHistory)).
+		WithArgs(before).WillReturnError(errors.New("boom"))
+	if err := s.PruneHistoryContext(context.Background(), before); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
@@ -14,194 +18,520 @@ import (
 )
 
 const (
-	sqlUpdateGauges = `INSERT INTO gauges(id, value, updated_at) VALUES ($1,$2,NOW())
+	sqlUpdateGauges = `INSERT INTO gauges(id, value, labels, updated_at) VALUES ($1,$2,$3::jsonb,NOW())
     ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW();`
 
-	sqlUpdateCounters = `INSERT INTO counters(id, value, updated_at) VALUES ($1,$2,NOW())
+	sqlUpdateCounters = `INSERT INTO counters(id, value, labels, updated_at) VALUES ($1,$2,$3::jsonb,NOW())
     ON CONFLICT (id) DO UPDATE SET value = counters.value + EXCLUDED.value, updated_at = NOW();`
 
-	sqlSetGauges = `INSERT INTO gauges(id, value, updated_at) VALUES ($1,$2,NOW())
+	sqlSetGauges = `INSERT INTO gauges(id, value, labels, updated_at) VALUES ($1,$2,$3::jsonb,NOW())
     ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW();`
 
-	sqlSetCounters = `INSERT INTO counters(id, value, updated_at) VALUES ($1,$2,NOW())
+	sqlSetCounters = `INSERT INTO counters(id, value, labels, updated_at) VALUES ($1,$2,$3::jsonb,NOW())
     ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW();`
 
 	sqlUpsertGauges = `
-	INSERT INTO gauges(id, value, updated_at)
-	SELECT u.id, u.value, NOW()
-	FROM UNNEST($1::text[], $2::double precision[]) AS u(id, value)
+	INSERT INTO gauges(id, value, labels, updated_at)
+	SELECT u.id, u.value, u.labels::jsonb, NOW()
+	FROM UNNEST($1::text[], $2::double precision[], $3::text[]) AS u(id, value, labels)
 	ON CONFLICT (id) DO UPDATE
 	SET value = EXCLUDED.value,
     updated_at = NOW();`
 
 	sqlUpsertCounters = `
-	INSERT INTO counters(id, value, updated_at)
-	SELECT u.id, u.value, NOW()
-	FROM UNNEST($1::text[], $2::bigint[]) AS u(id, value)
+	INSERT INTO counters(id, value, labels, updated_at)
+	SELECT u.id, u.value, u.labels::jsonb, NOW()
+	FROM UNNEST($1::text[], $2::bigint[], $3::text[]) AS u(id, value, labels)
 	ON CONFLICT (id) DO UPDATE
 	SET value = counters.value + EXCLUDED.value,
 	updated_at = NOW();`
+
+	sqlGaugeHistory = `SELECT ts, value FROM gauge_samples
+	WHERE id = $1 AND ts >= $2 AND ts <= $3 ORDER BY ts;`
+
+	sqlCounterHistory = `SELECT ts, value FROM counter_samples
+	WHERE id = $1 AND ts >= $2 AND ts <= $3 ORDER BY ts;`
+
+	sqlGaugeHistoryStep = `
+	SELECT DISTINCT ON (bucket) bucket, value FROM (
+		SELECT to_timestamp(floor(extract(epoch FROM ts) / $4::double precision) * $4::double precision) AS bucket, value, ts
+		FROM gauge_samples WHERE id = $1 AND ts >= $2 AND ts <= $3
+	) s
+	ORDER BY bucket, ts DESC;`
+
+	sqlCounterHistoryStep = `
+	SELECT DISTINCT ON (bucket) bucket, value FROM (
+		SELECT to_timestamp(floor(extract(epoch FROM ts) / $4::double precision) * $4::double precision) AS bucket, value, ts
+		FROM counter_samples WHERE id = $1 AND ts >= $2 AND ts <= $3
+	) s
+	ORDER BY bucket, ts DESC;`
+
+	// sqlDeleteMetrics removes gauges, counters and histograms in one statement and counts the removed rows.
+	sqlDeleteMetrics = `
+	WITH g AS (DELETE FROM gauges WHERE id = ANY($1::text[]) RETURNING 1),
+	c AS (DELETE FROM counters WHERE id = ANY($2::text[]) RETURNING 1),
+	h AS (DELETE FROM histograms WHERE id = ANY($3::text[]) RETURNING 1)
+	SELECT (SELECT count(*) FROM g) + (SELECT count(*) FROM c) + (SELECT count(*) FROM h);`
+
+	// sqlExpireMetrics removes the listed gauges, counters and histograms last written before $4 and returns them.
+	sqlExpireMetrics = `
+	WITH g AS (DELETE FROM gauges WHERE id = ANY($1::text[]) AND updated_at < $4 RETURNING id),
+	c AS (DELETE FROM counters WHERE id = ANY($2::text[]) AND updated_at < $4 RETURNING id),
+	h AS (DELETE FROM histograms WHERE id = ANY($3::text[]) AND updated_at < $4 RETURNING id)
+	SELECT 'gauge', id FROM g UNION ALL SELECT 'counter', id FROM c UNION ALL SELECT 'histogram', id FROM h;`
+
+	// sqlQueryFilter selects the series listed by QueryContext: $1 is the key to resume after, $2 the metric names,
+	// $3 the key prefix and $4 the limit. Keys are compared byte-wise to match the other backends.
+	sqlQueryFilter = `
+	WHERE id COLLATE "C" > $1
+	AND ($2::text[] IS NULL OR split_part(id, '{', 1) = ANY($2::text[]))
+	AND left(id, length($3)) = $3
+	ORDER BY id COLLATE "C"
+	LIMIT $4;`
+
+	sqlQueryGauges     = `SELECT id, value FROM gauges` + sqlQueryFilter
+	sqlQueryCounters   = `SELECT id, value FROM counters` + sqlQueryFilter
+	sqlQueryHistograms = `SELECT id, bounds, counts, sum, count FROM histograms` + sqlQueryFilter
+
+	sqlPruneGaugeHistory   = `DELETE FROM gauge_samples WHERE ts < $1;`
+	sqlPruneCounterHistory = `DELETE FROM counter_samples WHERE ts < $1;`
+
+	// sqlMergeHistogram adds bucket counts element-wise; a bounds mismatch leaves the row untouched and returns nothing.
+	sqlMergeHistogram = `INSERT INTO histograms(id, bounds, counts, sum, count, labels, updated_at)
+	VALUES ($1,$2,$3,$4,$5,$6::jsonb,NOW())
+	ON CONFLICT (id) DO UPDATE
+	SET counts = ARRAY(
+		SELECT u.a + u.b FROM UNNEST(histograms.counts, EXCLUDED.counts) WITH ORDINALITY AS u(a, b, i) ORDER BY u.i
+	),
+	sum = histograms.sum + EXCLUDED.sum,
+	count = histograms.count + EXCLUDED.count,
+	updated_at = NOW()
+	WHERE histograms.bounds = EXCLUDED.bounds
+	RETURNING id;`
+
+	sqlSetHistogram = `INSERT INTO histograms(id, bounds, counts, sum, count, labels, updated_at)
+	VALUES ($1,$2,$3,$4,$5,$6::jsonb,NOW())
+	ON CONFLICT (id) DO UPDATE
+	SET bounds = EXCLUDED.bounds, counts = EXCLUDED.counts, sum = EXCLUDED.sum, count = EXCLUDED.count, updated_at = NOW();`
+
+	sqlGetHistogram  = `SELECT bounds, counts, sum, count FROM histograms WHERE id=$1`
+	sqlAllHistograms = `SELECT id, bounds, counts, sum, count FROM histograms`
 )
 
+var (
+	sqlUpdateGaugesHistory   = withSamples(sqlUpdateGauges, "gauge_samples")
+	sqlUpdateCountersHistory = withSamples(sqlUpdateCounters, "counter_samples")
+	sqlUpsertGaugesHistory   = withSamples(sqlUpsertGauges, "gauge_samples")
+	sqlUpsertCountersHistory = withSamples(sqlUpsertCounters, "counter_samples")
+)
+
+// withSamples wraps an upsert statement so that every written row is also appended to the samples table.
+func withSamples(upsert, table string) string {
+	stmt := strings.TrimSuffix(strings.TrimSpace(upsert), ";")
+	return "WITH up AS (" + stmt + "\n    RETURNING id, value)\n" +
+		"INSERT INTO " + table + "(id, value, ts) SELECT id, value, NOW() FROM up;"
+}
+
 // DBStorage persists metrics in PostgreSQL.
+// Rows are keyed by the series key (see models.SeriesKey); labels are also kept in a JSONB column for querying.
 type DBStorage struct {
-	pool db.Pool
+	pool    db.Pool
+	history bool
+}
+
+// DBOption configures optional DBStorage behaviour.
+type DBOption func(*DBStorage)
+
+// WithHistory makes DBStorage append every update to the gauge_samples and counter_samples tables.
+func WithHistory() DBOption {
+	return func(s *DBStorage) { s.history = true }
 }
 
 // NewDBStorage constructs a database-backed MetricStorage implementation.
-func NewDBStorage(p db.Pool) *DBStorage {
-	return &DBStorage{pool: p}
+func NewDBStorage(p db.Pool, opts ...DBOption) *DBStorage {
+	s := &DBStorage{pool: p}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
 }
 
-// UpdateGauge upserts a gauge metric value.
+// UpdateGauge upserts a gauge metric value. Errors are dropped; use UpdateGaugeContext to observe them.
 func (s *DBStorage) UpdateGauge(name string, value float64) {
-	_ = retrier.Do(context.Background(), func() error {
-		_, err := s.pool.Exec(context.Background(), sqlUpdateGauges,
-			name, value,
-		)
-		return err
-	}, isPGConnError, retrier.DefaultDelays)
+	_ = s.UpdateGaugeContext(context.Background(), name, value)
+}
+
+// UpdateGaugeContext upserts a gauge metric value.
+func (s *DBStorage) UpdateGaugeContext(ctx context.Context, name string, value float64) error {
+	query := sqlUpdateGauges
+	if s.history {
+		query = sqlUpdateGaugesHistory
+	}
+	return s.exec(ctx, query, name, value, labelsJSON(name))
 }
 
-// UpdateCounter increments a counter metric in the database.
+// UpdateCounter increments a counter metric in the database. Errors are dropped; use UpdateCounterContext to observe them.
 func (s *DBStorage) UpdateCounter(name string, delta int64) {
-	_ = retrier.Do(context.Background(), func() error {
-		_, err := s.pool.Exec(context.Background(), sqlUpdateCounters,
-			name, delta,
-		)
-		return err
-	}, isPGConnError, retrier.DefaultDelays)
+	_ = s.UpdateCounterContext(context.Background(), name, delta)
+}
+
+// UpdateCounterContext increments a counter metric in the database.
+func (s *DBStorage) UpdateCounterContext(ctx context.Context, name string, delta int64) error {
+	query := sqlUpdateCounters
+	if s.history {
+		query = sqlUpdateCountersHistory
+	}
+	return s.exec(ctx, query, name, delta, labelsJSON(name))
 }
 
 // GetGauge retrieves a gauge value from the database.
 func (s *DBStorage) GetGauge(name string) (float64, error) {
+	return s.GetGaugeContext(context.Background(), name)
+}
+
+// GetGaugeContext retrieves a gauge value from the database.
+func (s *DBStorage) GetGaugeContext(ctx context.Context, name string) (float64, error) {
 	var v float64
-	err := retrier.Do(context.Background(), func() error {
-		return s.pool.QueryRow(context.Background(), `SELECT value FROM gauges WHERE id=$1`, name).Scan(&v)
+	err := retrier.Do(ctx, func() error {
+		return s.pool.QueryRow(ctx, `SELECT value FROM gauges WHERE id=$1`, name).Scan(&v)
 	}, isPGConnError, retrier.DefaultDelays)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return 0, ErrMetricNotFound
 	}
-	return v, err
+	return v, wrapDBError(ctx, err)
 }
 
 // GetCounter retrieves a counter value from the database.
 func (s *DBStorage) GetCounter(name string) (int64, error) {
+	return s.GetCounterContext(context.Background(), name)
+}
+
+// GetCounterContext retrieves a counter value from the database.
+func (s *DBStorage) GetCounterContext(ctx context.Context, name string) (int64, error) {
 	var v int64
-	err := retrier.Do(context.Background(), func() error {
-		return s.pool.QueryRow(context.Background(), `SELECT value FROM counters WHERE id=$1`, name).Scan(&v)
+	err := retrier.Do(ctx, func() error {
+		return s.pool.QueryRow(ctx, `SELECT value FROM counters WHERE id=$1`, name).Scan(&v)
 	}, isPGConnError, retrier.DefaultDelays)
-
 	if errors.Is(err, pgx.ErrNoRows) {
 		return 0, ErrMetricNotFound
 	}
-	return v, err
+	return v, wrapDBError(ctx, err)
 }
 
-// SetGauge overwrites a gauge value in the database.
+// SetGauge overwrites a gauge value in the database. Errors are dropped; use SetGaugeContext to observe them.
 func (s *DBStorage) SetGauge(name string, value float64) {
-	_ = retrier.Do(context.Background(), func() error {
-		_, err := s.pool.Exec(context.Background(), sqlSetGauges,
-			name, value,
-		)
-		return err
-	}, isPGConnError, retrier.DefaultDelays)
+	_ = s.SetGaugeContext(context.Background(), name, value)
 }
 
-// SetCounter overwrites a counter value in the database.
+// SetGaugeContext overwrites a gauge value in the database.
+func (s *DBStorage) SetGaugeContext(ctx context.Context, name string, value float64) error {
+	return s.exec(ctx, sqlSetGauges, name, value, labelsJSON(name))
+}
+
+// SetCounter overwrites a counter value in the database. Errors are dropped; use SetCounterContext to observe them.
 func (s *DBStorage) SetCounter(name string, value int64) {
-	_ = retrier.Do(context.Background(), func() error {
-		_, err := s.pool.Exec(context.Background(), sqlSetCounters,
-			name, value,
-		)
+	_ = s.SetCounterContext(context.Background(), name, value)
+}
+
+// SetCounterContext overwrites a counter value in the database.
+func (s *DBStorage) SetCounterContext(ctx context.Context, name string, value int64) error {
+	return s.exec(ctx, sqlSetCounters, name, value, labelsJSON(name))
+}
+
+// AllGauges returns all gauge metrics stored in the database, or an empty map when the query fails.
+func (s *DBStorage) AllGauges() map[string]float64 {
+	res, _ := s.AllGaugesContext(context.Background())
+	if res == nil {
+		return map[string]float64{}
+	}
+	return res
+}
+
+// AllGaugesContext returns all gauge metrics stored in the database.
+func (s *DBStorage) AllGaugesContext(ctx context.Context) (map[string]float64, error) {
+	return queryAll[float64](ctx, s, `SELECT id, value FROM gauges`)
+}
+
+// AllCounters returns all counter metrics stored in the database, or an empty map when the query fails.
+func (s *DBStorage) AllCounters() map[string]int64 {
+	res, _ := s.AllCountersContext(context.Background())
+	if res == nil {
+		return map[string]int64{}
+	}
+	return res
+}
+
+// AllCountersContext returns all counter metrics stored in the database.
+func (s *DBStorage) AllCountersContext(ctx context.Context) (map[string]int64, error) {
+	return queryAll[int64](ctx, s, `SELECT id, value FROM counters`)
+}
+
+// exec runs a statement with retries on connection errors.
+func (s *DBStorage) exec(ctx context.Context, query string, args ...any) error {
+	err := retrier.Do(ctx, func() error {
+		_, err := s.pool.Exec(ctx, query, args...)
 		return err
 	}, isPGConnError, retrier.DefaultDelays)
+	return wrapDBError(ctx, err)
 }
 
-// AllGauges returns all gauge metrics stored in the database.
-func (s *DBStorage) AllGauges() map[string]float64 {
+// queryAll reads id/value rows into a map. Rows that cannot be scanned are skipped.
+func queryAll[V any](ctx context.Context, s *DBStorage, query string) (map[string]V, error) {
 	var rows pgx.Rows
-	err := retrier.Do(context.Background(), func() error {
+	err := retrier.Do(ctx, func() error {
 		var e error
-		rows, e = s.pool.Query(context.Background(), `SELECT id, value FROM gauges`)
+		rows, e = s.pool.Query(ctx, query)
 		return e
 	}, isPGConnError, retrier.DefaultDelays)
-
 	if err != nil {
-		return map[string]float64{}
+		return nil, wrapDBError(ctx, err)
 	}
 	defer rows.Close()
-	res := make(map[string]float64)
+	res := make(map[string]V)
 	for rows.Next() {
-		var id string
-		var val float64
+		var (
+			id  string
+			val V
+		)
 		if err := rows.Scan(&id, &val); err == nil {
 			res[id] = val
 		}
 	}
-	return res
+	return res, wrapDBError(ctx, rows.Err())
 }
 
-// AllCounters returns all counter metrics stored in the database.
-func (s *DBStorage) AllCounters() map[string]int64 {
+// GaugeUpdateTimesContext returns the last update time of every gauge stored in the database.
+func (s *DBStorage) GaugeUpdateTimesContext(ctx context.Context) (map[string]time.Time, error) {
+	return s.updateTimes(ctx, `SELECT id, updated_at FROM gauges`)
+}
+
+// CounterUpdateTimesContext returns the last update time of every counter stored in the database.
+func (s *DBStorage) CounterUpdateTimesContext(ctx context.Context) (map[string]time.Time, error) {
+	return s.updateTimes(ctx, `SELECT id, updated_at FROM counters`)
+}
+
+// HistogramUpdateTimesContext returns the last update time of every histogram stored in the database.
+func (s *DBStorage) HistogramUpdateTimesContext(ctx context.Context) (map[string]time.Time, error) {
+	return s.updateTimes(ctx, `SELECT id, updated_at FROM histograms`)
+}
+
+func (s *DBStorage) updateTimes(ctx context.Context, query string) (map[string]time.Time, error) {
 	var rows pgx.Rows
-	err := retrier.Do(context.Background(), func() error {
+	err := retrier.Do(ctx, func() error {
 		var e error
-		rows, e = s.pool.Query(context.Background(), `SELECT id, value FROM counters`)
+		rows, e = s.pool.Query(ctx, query)
 		return e
 	}, isPGConnError, retrier.DefaultDelays)
 	if err != nil {
-		return map[string]int64{}
+		return nil, wrapDBError(ctx, err)
 	}
 	defer rows.Close()
-	res := make(map[string]int64)
+	res := make(map[string]time.Time)
 	for rows.Next() {
 		var id string
-		var val int64
-		if err := rows.Scan(&id, &val); err == nil {
-			res[id] = val
+		var ts time.Time
+		if err := rows.Scan(&id, &ts); err != nil {
+			return nil, wrapDBError(ctx, err)
 		}
+		res[id] = ts
 	}
-	return res
+	return res, wrapDBError(ctx, rows.Err())
 }
 
 // UpdateBatch performs a batch upsert of metrics in a single transaction.
-func (s *DBStorage) UpdateBatch(metrics []models.Metrics) (err error) {
+func (s *DBStorage) UpdateBatch(metrics []models.Metrics) error {
+	return s.UpdateBatchContext(context.Background(), metrics)
+}
+
+// UpdateBatchContext performs a batch upsert of metrics in a single transaction.
+func (s *DBStorage) UpdateBatchContext(ctx context.Context, metrics []models.Metrics) (err error) {
 	if len(metrics) == 0 {
 		return nil
 	}
 
 	gm, cm := aggregateMetrics(metrics)
-	if len(gm) == 0 && len(cm) == 0 {
+	hm, err := aggregateHistograms(metrics)
+	if err != nil {
+		return err
+	}
+	if len(gm) == 0 && len(cm) == 0 && len(hm) == 0 {
 		return nil
 	}
 
-	ctx := context.Background()
 	var tx pgx.Tx
 	if err = retrier.Do(ctx, func() error {
 		var e error
 		tx, e = s.pool.Begin(ctx)
 		return e
 	}, isPGConnError, retrier.DefaultDelays); err != nil {
-		return err
+		return wrapDBError(ctx, err)
 	}
 	defer s.commitOrRollback(ctx, tx, &err)
 
+	gaugeQuery, counterQuery := sqlUpsertGauges, sqlUpsertCounters
+	if s.history {
+		gaugeQuery, counterQuery = sqlUpsertGaugesHistory, sqlUpsertCountersHistory
+	}
 	if len(gm) > 0 {
 		ids, vals := mapToSlices(gm)
-		if err = execUpsertGauges(ctx, tx, ids, vals); err != nil {
+		if err = execUpsert(ctx, tx, gaugeQuery, ids, vals); err != nil {
 			return err
 		}
 	}
 	if len(cm) > 0 {
 		ids, vals := mapToSlices(cm)
-		if err = execUpsertCounters(ctx, tx, ids, vals); err != nil {
+		if err = execUpsert(ctx, tx, counterQuery, ids, vals); err != nil {
+			return err
+		}
+	}
+	for name, h := range hm {
+		if err = mergeHistogram(ctx, tx, name, h); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// UpdateHistogram merges the distribution into the stored histogram in a single statement.
+func (s *DBStorage) UpdateHistogram(name string, h models.Histogram) error {
+	return s.UpdateHistogramContext(context.Background(), name, h)
+}
+
+// UpdateHistogramContext merges the distribution into the stored histogram in a single statement.
+func (s *DBStorage) UpdateHistogramContext(ctx context.Context, name string, h models.Histogram) error {
+	return mergeHistogram(ctx, s.pool, name, h)
+}
+
+// GetHistogram retrieves a histogram from the database.
+func (s *DBStorage) GetHistogram(name string) (models.Histogram, error) {
+	return s.GetHistogramContext(context.Background(), name)
+}
+
+// GetHistogramContext retrieves a histogram from the database.
+func (s *DBStorage) GetHistogramContext(ctx context.Context, name string) (models.Histogram, error) {
+	var (
+		h      models.Histogram
+		counts []int64
+		count  int64
+	)
+	err := retrier.Do(ctx, func() error {
+		return s.pool.QueryRow(ctx, sqlGetHistogram, name).Scan(&h.Bounds, &counts, &h.Sum, &count)
+	}, isPGConnError, retrier.DefaultDelays)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Histogram{}, ErrMetricNotFound
+	}
+	if err != nil {
+		return models.Histogram{}, wrapDBError(ctx, err)
+	}
+	h.Counts = fromDBCounts(counts)
+	h.Count = uint64(count)
+	return h, nil
+}
+
+// SetHistogram overwrites a histogram in the database. Errors are dropped; use SetHistogramContext to observe them.
+func (s *DBStorage) SetHistogram(name string, h models.Histogram) {
+	_ = s.SetHistogramContext(context.Background(), name, h)
+}
+
+// SetHistogramContext overwrites a histogram in the database.
+func (s *DBStorage) SetHistogramContext(ctx context.Context, name string, h models.Histogram) error {
+	return s.exec(ctx, sqlSetHistogram, name, h.Bounds, toDBCounts(h.Counts), h.Sum, int64(h.Count), labelsJSON(name))
+}
+
+// AllHistograms returns all histograms stored in the database, or an empty map when the query fails.
+func (s *DBStorage) AllHistograms() map[string]models.Histogram {
+	res, _ := s.AllHistogramsContext(context.Background())
+	if res == nil {
+		return map[string]models.Histogram{}
+	}
+	return res
+}
+
+// AllHistogramsContext returns all histograms stored in the database. Rows that cannot be scanned are skipped.
+func (s *DBStorage) AllHistogramsContext(ctx context.Context) (map[string]models.Histogram, error) {
+	var rows pgx.Rows
+	err := retrier.Do(ctx, func() error {
+		var e error
+		rows, e = s.pool.Query(ctx, sqlAllHistograms)
+		return e
+	}, isPGConnError, retrier.DefaultDelays)
+	if err != nil {
+		return nil, wrapDBError(ctx, err)
+	}
+	defer rows.Close()
+	res := make(map[string]models.Histogram)
+	for rows.Next() {
+		var (
+			id     string
+			h      models.Histogram
+			counts []int64
+			count  int64
+		)
+		if err := rows.Scan(&id, &h.Bounds, &counts, &h.Sum, &count); err == nil {
+			h.Counts = fromDBCounts(counts)
+			h.Count = uint64(count)
+			res[id] = h
+		}
+	}
+	return res, wrapDBError(ctx, rows.Err())
+}
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func mergeHistogram(ctx context.Context, q queryRower, name string, h models.Histogram) error {
+	err := retrier.Do(ctx, func() error {
+		var id string
+		return q.QueryRow(ctx, sqlMergeHistogram,
+			name, h.Bounds, toDBCounts(h.Counts), h.Sum, int64(h.Count), labelsJSON(name),
+		).Scan(&id)
+	}, isPGConnError, retrier.DefaultDelays)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ErrHistogramBucketsMismatch
+	}
+	return wrapDBError(ctx, err)
+}
+
+func toDBCounts(counts []uint64) []int64 {
+	out := make([]int64, len(counts))
+	for i, c := range counts {
+		out[i] = int64(c)
+	}
+	return out
+}
+
+func fromDBCounts(counts []int64) []uint64 {
+	out := make([]uint64, len(counts))
+	for i, c := range counts {
+		out[i] = uint64(c)
+	}
+	return out
+}
+
+// aggregateHistograms merges histograms of the same series within a batch.
+func aggregateHistograms(metrics []models.Metrics) (map[string]models.Histogram, error) {
+	res := make(map[string]models.Histogram)
+	for i := range metrics {
+		m := &metrics[i]
+		if m.MType != models.HistogramType || m.Histogram == nil {
+			continue
+		}
+		key := m.Key()
+		cur, ok := res[key]
+		if !ok {
+			res[key] = m.Histogram.Clone()
+			continue
+		}
+		merged, err := cur.Merge(*m.Histogram)
+		if err != nil {
+			return nil, err
+		}
+		res[key] = merged
+	}
+	return res, nil
+}
+
 func aggregateMetrics(metrics []models.Metrics) (map[string]float64, map[string]int64) {
 	gauges := make(map[string]float64)
 	counters := make(map[string]int64)
@@ -211,35 +541,106 @@ func aggregateMetrics(metrics []models.Metrics) (map[string]float64, map[string]
 		switch m.MType {
 		case models.GaugeType:
 			if m.Value != nil {
-				gauges[m.ID] = *m.Value
+				gauges[m.Key()] = *m.Value
 			}
 		case models.CounterType:
 			if m.Delta != nil {
-				counters[m.ID] += *m.Delta
+				counters[m.Key()] += *m.Delta
 			}
 		}
 	}
 	return gauges, counters
 }
 
-func execUpsertGauges(ctx context.Context, tx pgx.Tx, ids []string, values []float64) error {
+func execUpsert[V any](ctx context.Context, tx pgx.Tx, query string, ids []string, values []V) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	return retrier.Do(ctx, func() error {
-		_, err := tx.Exec(ctx, sqlUpsertGauges, ids, values)
+	labels := make([]string, len(ids))
+	for i, id := range ids {
+		labels[i] = labelsJSON(id)
+	}
+	err := retrier.Do(ctx, func() error {
+		_, err := tx.Exec(ctx, query, ids, values, labels)
 		return err
 	}, isPGConnError, retrier.DefaultDelays)
+	return wrapDBError(ctx, err)
 }
 
-func execUpsertCounters(ctx context.Context, tx pgx.Tx, ids []string, values []int64) error {
-	if len(ids) == 0 {
-		return nil
+// HistoryContext returns samples of the metric recorded between from and to.
+// A positive step groups samples into buckets of that width and keeps the latest sample of each bucket.
+func (s *DBStorage) HistoryContext(ctx context.Context, t models.MetricType, name string, from, to time.Time, step time.Duration) ([]models.Sample, error) {
+	if !s.history {
+		return nil, ErrHistoryDisabled
 	}
-	return retrier.Do(ctx, func() error {
-		_, err := tx.Exec(ctx, sqlUpsertCounters, ids, values)
-		return err
+
+	var query string
+	switch t {
+	case models.GaugeType:
+		query = sqlGaugeHistory
+		if step > 0 {
+			query = sqlGaugeHistoryStep
+		}
+	case models.CounterType:
+		query = sqlCounterHistory
+		if step > 0 {
+			query = sqlCounterHistoryStep
+		}
+	default:
+		return nil, models.ErrMetricInvalidType
+	}
+
+	args := []any{name, from, to}
+	if step > 0 {
+		args = append(args, step.Seconds())
+	}
+
+	var rows pgx.Rows
+	err := retrier.Do(ctx, func() error {
+		var e error
+		rows, e = s.pool.Query(ctx, query, args...)
+		return e
 	}, isPGConnError, retrier.DefaultDelays)
+	if err != nil {
+		return nil, wrapDBError(ctx, err)
+	}
+	defer rows.Close()
+
+	samples := make([]models.Sample, 0)
+	for rows.Next() {
+		var sample models.Sample
+		if t == models.GaugeType {
+			var v float64
+			if err := rows.Scan(&sample.Timestamp, &v); err != nil {
+				return nil, wrapDBError(ctx, err)
+			}
+			sample.Value = &v
+		} else {
+			var d int64
+			if err := rows.Scan(&sample.Timestamp, &d); err != nil {
+				return nil, wrapDBError(ctx, err)
+			}
+			sample.Delta = &d
+		}
+		samples = append(samples, sample)
+	}
+	return samples, wrapDBError(ctx, rows.Err())
+}
+
+// PruneHistoryContext deletes samples recorded before the supplied moment.
+func (s *DBStorage) PruneHistoryContext(ctx context.Context, before time.Time) error {
+	if !s.history {
+		return nil
+	}
+	for _, query := range []string{sqlPruneGaugeHistory, sqlPruneCounterHistory} {
+		if err := retrier.Do(ctx, func() error {
+			_, err := s.pool.Exec(ctx, query, before)
+			return err
+		}, isPGConnError, retrier.DefaultDelays); err != nil {
+			return wrapDBError(ctx, err)
+		}
+	}
+	return nil
 }
 
 func (s *DBStorage) commitOrRollback(ctx context.Context, tx pgx.Tx, errp *error) {
@@ -247,9 +648,9 @@ func (s *DBStorage) commitOrRollback(ctx context.Context, tx pgx.Tx, errp *error
 		_ = tx.Rollback(ctx)
 		return
 	}
-	*errp = retrier.Do(ctx, func() error {
+	*errp = wrapDBError(ctx, retrier.Do(ctx, func() error {
 		return tx.Commit(ctx)
-	}, isPGConnError, retrier.DefaultDelays)
+	}, isPGConnError, retrier.DefaultDelays))
 }
 
 func mapToSlices[V any](m map[string]V) ([]string, []V) {
@@ -262,6 +663,35 @@ func mapToSlices[V any](m map[string]V) ([]string, []V) {
 	return ids, vals
 }
 
+// labelsJSON encodes the labels of a series key as a JSON object for the labels column.
+func labelsJSON(key string) string {
+	_, labels, err := models.ParseSeriesKey(key)
+	if err != nil || len(labels) == 0 {
+		return "{}"
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// wrapDBError classifies a database failure as ErrStorageUnavailable when the database cannot be reached
+// and as ErrStorageFailure otherwise. Failures caused by the caller's context keep the context error.
+func wrapDBError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	var connErr *pgconn.ConnectError
+	if isPGConnError(err) || errors.As(err, &connErr) {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+	return fmt.Errorf("%w: %w", ErrStorageFailure, err)
+}
+
 func isPGConnError(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
@@ -279,4 +709,158 @@ func isPGConnError(err error) bool {
 	return false
 }
 
-var _ MetricStorage = NewDBStorage(nil)
+// DeleteContext removes the listed metrics in a single statement. History samples are kept.
+func (s *DBStorage) DeleteContext(ctx context.Context, metrics []models.Metrics) (int, error) {
+	gauges, counters, histograms := deleteKeys(metrics)
+	if len(gauges) == 0 && len(counters) == 0 && len(histograms) == 0 {
+		return 0, nil
+	}
+	var n int64
+	err := retrier.Do(ctx, func() error {
+		return s.pool.QueryRow(ctx, sqlDeleteMetrics, gauges, counters, histograms).Scan(&n)
+	}, isPGConnError, retrier.DefaultDelays)
+	return int(n), wrapDBError(ctx, err)
+}
+
+// ExpireContext removes the listed metrics whose updated_at is before the cutoff in a single statement.
+func (s *DBStorage) ExpireContext(ctx context.Context, metrics []models.Metrics, before time.Time) ([]models.Metrics, error) {
+	gauges, counters, histograms := deleteKeys(metrics)
+	if len(gauges) == 0 && len(counters) == 0 && len(histograms) == 0 {
+		return nil, nil
+	}
+	var stale []models.Metrics
+	err := retrier.Do(ctx, func() error {
+		stale = stale[:0]
+		rows, err := s.pool.Query(ctx, sqlExpireMetrics, gauges, counters, histograms, before)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var t, id string
+			if err := rows.Scan(&t, &id); err != nil {
+				return err
+			}
+			m := models.Metrics{MType: models.MetricType(t)}
+			m.SetKey(id)
+			stale = append(stale, m)
+		}
+		return rows.Err()
+	}, isPGConnError, retrier.DefaultDelays)
+	if err != nil {
+		return nil, wrapDBError(ctx, err)
+	}
+	return stale, nil
+}
+
+// QueryContext lists the matching metrics with one filtered, ordered and limited statement per metric type.
+// The name pattern is matched in Go, so it behaves as with the other backends; with a pattern the rows
+// are read until the limit is reached instead of being limited by the statement.
+func (s *DBStorage) QueryContext(ctx context.Context, q MetricQuery) ([]models.Metrics, error) {
+	// An empty array would match no name at all; nil disables the filter.
+	names := q.Names
+	if len(names) == 0 {
+		names = nil
+	}
+	var res []models.Metrics
+	for _, t := range models.MetricTypes {
+		if !q.wants(t) {
+			continue
+		}
+		var limit any
+		if q.Limit > 0 {
+			if len(res) >= q.Limit {
+				break
+			}
+			if !q.filtered() {
+				limit = q.Limit - len(res)
+			}
+		}
+
+		var stmt string
+		switch t {
+		case models.GaugeType:
+			stmt = sqlQueryGauges
+		case models.CounterType:
+			stmt = sqlQueryCounters
+		case models.HistogramType:
+			stmt = sqlQueryHistograms
+		default:
+			continue
+		}
+
+		n := len(res)
+		err := retrier.Do(ctx, func() error {
+			res = res[:n]
+			rows, err := s.pool.Query(ctx, stmt, q.after(t), names, q.Prefix, limit)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				m, err := scanQueryRow(rows, t)
+				if err != nil {
+					return err
+				}
+				if !q.filter(m.Key()) {
+					continue
+				}
+				res = append(res, m)
+				if q.Limit > 0 && len(res) >= q.Limit {
+					return nil
+				}
+			}
+			return rows.Err()
+		}, isPGConnError, retrier.DefaultDelays)
+		if err != nil {
+			return nil, wrapDBError(ctx, err)
+		}
+	}
+	return res, nil
+}
+
+// scanQueryRow reads a row returned by one of the sqlQuery statements for metrics of type t.
+func scanQueryRow(rows pgx.Rows, t models.MetricType) (models.Metrics, error) {
+	var (
+		id string
+		m  = models.Metrics{MType: t}
+	)
+	switch t {
+	case models.GaugeType:
+		var v float64
+		if err := rows.Scan(&id, &v); err != nil {
+			return m, err
+		}
+		m.Value = &v
+	case models.CounterType:
+		var v int64
+		if err := rows.Scan(&id, &v); err != nil {
+			return m, err
+		}
+		m.Delta = &v
+	default:
+		var (
+			h      models.Histogram
+			counts []int64
+			count  int64
+		)
+		if err := rows.Scan(&id, &h.Bounds, &counts, &h.Sum, &count); err != nil {
+			return m, err
+		}
+		h.Counts = fromDBCounts(counts)
+		h.Count = uint64(count)
+		m.Histogram = &h
+	}
+	m.SetKey(id)
+	return m, nil
+}
+
+var (
+	_ MetricStorage      = NewDBStorage(nil)
+	_ UpdateTimesStorage = NewDBStorage(nil)
+	_ HistoryStorage     = NewDBStorage(nil)
+	_ HistogramStorage   = NewDBStorage(nil)
+	_ DeleteStorage      = NewDBStorage(nil)
+	_ ExpiringStorage    = NewDBStorage(nil)
+	_ QueryStorage       = NewDBStorage(nil)
+)
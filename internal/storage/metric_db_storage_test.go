@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	pgxmock "github.com/pashagolub/pgxmock/v4"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 )
@@ -21,12 +26,12 @@ func TestUpdateGauge_PositiveAndError_NoPanic(t *testing.T) {
 	s := NewDBStorage(mock)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateGauges)).
-		WithArgs("Temp", 12.34).
+		WithArgs("Temp", 12.34, "{}").
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	s.UpdateGauge("Temp", 12.34)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateGauges)).
-		WithArgs("Temp", 1.0).
+		WithArgs("Temp", 1.0, "{}").
 		WillReturnError(errors.New("boom"))
 	s.UpdateGauge("Temp", 1.0)
 
@@ -45,12 +50,12 @@ func TestUpdateCounter_PositiveAndError_NoPanic(t *testing.T) {
 	s := NewDBStorage(mock)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateCounters)).
-		WithArgs("Poll", int64(5)).
+		WithArgs("Poll", int64(5), "{}").
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	s.UpdateCounter("Poll", 5)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateCounters)).
-		WithArgs("Poll", int64(1)).
+		WithArgs("Poll", int64(1), "{}").
 		WillReturnError(errors.New("fail"))
 	s.UpdateCounter("Poll", 1)
 
@@ -66,12 +71,12 @@ func TestSetGauge_PositiveAndError_NoPanic(t *testing.T) {
 	s := NewDBStorage(mock)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlSetGauges)).
-		WithArgs("G", 1.1).
+		WithArgs("G", 1.1, "{}").
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	s.SetGauge("G", 1.1)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlSetGauges)).
-		WithArgs("G", 2.2).
+		WithArgs("G", 2.2, "{}").
 		WillReturnError(errors.New("fail"))
 	s.SetGauge("G", 2.2)
 
@@ -87,12 +92,12 @@ func TestSetCounter_PositiveAndError_NoPanic(t *testing.T) {
 	s := NewDBStorage(mock)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlSetCounters)).
-		WithArgs("C", int64(7)).
+		WithArgs("C", int64(7), "{}").
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	s.SetCounter("C", 7)
 
 	mock.ExpectExec(regexp.QuoteMeta(sqlSetCounters)).
-		WithArgs("C", int64(8)).
+		WithArgs("C", int64(8), "{}").
 		WillReturnError(errors.New("fail"))
 	s.SetCounter("C", 8)
 
@@ -245,10 +250,10 @@ func TestUpdateBatch_Positive_BothGroups(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpsertGauges)).
-		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
 		WillReturnResult(pgxmock.NewResult("INSERT", 2))
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpsertCounters)).
-		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
 		WillReturnResult(pgxmock.NewResult("INSERT", 2))
 	mock.ExpectCommit()
 
@@ -287,7 +292,7 @@ func TestUpdateBatch_GaugesExecError_Rollback(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpsertGauges)).
-		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
 		WillReturnError(errors.New("upsert gauges fail"))
 	mock.ExpectRollback()
 
@@ -307,7 +312,7 @@ func TestUpdateBatch_CountersExecError_Rollback(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpsertCounters)).
-		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
 		WillReturnError(errors.New("counters fail"))
 	mock.ExpectRollback()
 
@@ -327,12 +332,12 @@ func TestUpdateBatch_CommitError(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectExec(regexp.QuoteMeta(sqlUpsertGauges)).
-		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 	mock.ExpectCommit().WillReturnError(errors.New("commit failed"))
 
 	err := s.UpdateBatch([]models.Metrics{{ID: "g1", MType: models.GaugeType, Value: pFloat64(1)}})
-	if err == nil || err.Error() != "commit failed" {
+	if !errors.Is(err, ErrStorageFailure) || !strings.HasSuffix(err.Error(), "commit failed") {
 		t.Fatalf("want commit failed, got %v", err)
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -381,3 +386,80 @@ func TestMapToSlices(t *testing.T) {
 
 func pInt64(v int64) *int64       { return &v }
 func pFloat64(v float64) *float64 { return &v }
+
+func TestUpdateTimes_PositiveAndError(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, updated_at FROM gauges`)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "updated_at"}).AddRow("g", ts))
+	if got, err := s.GaugeUpdateTimesContext(context.Background()); err != nil || !got["g"].Equal(ts) {
+		t.Fatalf("unexpected gauge times: %v, %v", got, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, updated_at FROM counters`)).
+		WillReturnError(errors.New("boom"))
+	if _, err := s.CounterUpdateTimesContext(context.Background()); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet: %v", err)
+	}
+}
+
+func TestUpdateGauge_WritesLabels(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateGauges)).
+		WithArgs(`CPU{cpu="1",host="a"}`, 2.5, `{"cpu":"1","host":"a"}`).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	s.UpdateGauge(models.SeriesKey("CPU", models.Labels{"host": "a", "cpu": "1"}), 2.5)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet: %v", err)
+	}
+}
+
+func TestDBStorage_ContextMethodsReportErrors(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+
+	mock.ExpectExec(regexp.QuoteMeta(sqlUpdateGauges)).
+		WithArgs("g", 1.5, "{}").
+		WillReturnError(errors.New("disk full"))
+	if err := s.UpdateGaugeContext(context.Background(), "g", 1.5); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, value FROM counters`)).
+		WillReturnError(errors.New("boom"))
+	if _, err := s.AllCountersContext(context.Background()); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.SetCounterContext(ctx, "c", 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+}
+
+func TestWrapDBError(t *testing.T) {
+	ctx := context.Background()
+	if err := wrapDBError(ctx, nil); err != nil {
+		t.Fatalf("nil must stay nil, got %v", err)
+	}
+	conn := &pgconn.PgError{Code: pgerrcode.ConnectionFailure}
+	if err := wrapDBError(ctx, conn); !errors.Is(err, ErrStorageUnavailable) || !errors.Is(err, conn) {
+		t.Fatalf("want ErrStorageUnavailable wrapping the cause, got %v", err)
+	}
+	if err := wrapDBError(ctx, &pgconn.PgError{Code: pgerrcode.UniqueViolation}); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+}
@@ -1,19 +1,22 @@
 package storage
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
 )
 
-// MemStorageT stores metrics of any comparable type in memory with concurrency safety.
-type MemStorageT[T comparable] struct {
+// MemStorageT stores metrics of any type in memory with concurrency safety.
+type MemStorageT[T any] struct {
 	mu   sync.RWMutex
 	data map[string]T
 }
 
 // NewMemStorageT creates a new thread-safe storage for the provided type.
-func NewMemStorageT[T comparable]() *MemStorageT[T] {
+func NewMemStorageT[T any]() *MemStorageT[T] {
 	return &MemStorageT[T]{data: make(map[string]T)}
 }
 
@@ -71,27 +74,151 @@ func (m *NumMemStorage[T]) Add(name string, delta T) {
 	m.data[name] += delta
 }
 
-// MemStorage keeps gauge and counter metrics in memory.
+// MemStorage keeps gauge, counter and histogram metrics in sharded in-memory maps,
+// so concurrent writes to different series do not contend on a single lock.
+// The last write time of every series is tracked for expiry.
+// With a WAL attached every write is logged before it is applied; writes are then serialised
+// so that the log order matches the order in which they were applied.
 type MemStorage struct {
-	gauges   *NumMemStorage[float64]
-	counters *NumMemStorage[int64]
+	gauges     *ShardedNumMemStorage[float64]
+	counters   *ShardedNumMemStorage[int64]
+	histograms *ShardedHistMemStorage
+
+	gaugeTimes     *ShardedMemStorageT[time.Time]
+	counterTimes   *ShardedMemStorageT[time.Time]
+	histogramTimes *ShardedMemStorageT[time.Time]
+
+	// walMu is held shared by writes without a WAL and exclusively by logged writes,
+	// Restore and Checkpoint.
+	walMu sync.RWMutex
+	wal   *WAL
+	// walReplayed reports whether every record of wal is reflected in the stored metrics,
+	// which Checkpoint requires before it drops them.
+	walReplayed bool
 }
 
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		gauges:   NewNumMemStorage[float64](),
-		counters: NewNumMemStorage[int64](),
+		gauges:     NewShardedNumMemStorage[float64](),
+		counters:   NewShardedNumMemStorage[int64](),
+		histograms: NewShardedHistMemStorage(),
+
+		gaugeTimes:     NewShardedMemStorageT[time.Time](),
+		counterTimes:   NewShardedMemStorageT[time.Time](),
+		histogramTimes: NewShardedMemStorageT[time.Time](),
+	}
+}
+
+func (m *MemStorage) putGauge(name string, value float64) {
+	m.gauges.Update(name, value)
+	m.gaugeTimes.Update(name, time.Now())
+}
+
+func (m *MemStorage) addCounter(name string, delta int64) {
+	m.counters.Add(name, delta)
+	m.counterTimes.Update(name, time.Now())
+}
+
+func (m *MemStorage) putCounter(name string, value int64) {
+	m.counters.Update(name, value)
+	m.counterTimes.Update(name, time.Now())
+}
+
+func (m *MemStorage) mergeHistogram(name string, h models.Histogram) error {
+	if err := m.histograms.Merge(name, h); err != nil {
+		return err
+	}
+	m.histogramTimes.Update(name, time.Now())
+	return nil
+}
+
+func (m *MemStorage) putHistogram(name string, h models.Histogram) {
+	m.histograms.Update(name, h.Clone())
+	m.histogramTimes.Update(name, time.Now())
+}
+
+// AttachWAL makes every subsequent write be logged to w before it is applied.
+// Records already in w must be replayed by Restore before Checkpoint may drop them.
+func (m *MemStorage) AttachWAL(w *WAL) {
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	m.wal = w
+	m.walReplayed = w == nil || w.empty()
+}
+
+// logged appends a record to the WAL, if any, and then applies the write.
+// A write whose record cannot be logged is rejected.
+func (m *MemStorage) logged(op walOp, metrics []models.Metrics, apply func() error) error {
+	m.walMu.RLock()
+	if m.wal == nil {
+		defer m.walMu.RUnlock()
+		return apply()
+	}
+	m.walMu.RUnlock()
+
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	return m.logAndApply(op, metrics, apply)
+}
+
+// logAndApply is logged for callers that already hold walMu exclusively.
+func (m *MemStorage) logAndApply(op walOp, metrics []models.Metrics, apply func() error) error {
+	if m.wal == nil {
+		return apply()
+	}
+	if err := m.wal.append(walRecord{Op: op, Metrics: metrics}); err != nil {
+		return fmt.Errorf("%w: %w", ErrStorageFailure, err)
+	}
+	return apply()
+}
+
+// loggedVoid is logged for the MetricStorage methods that cannot return errors:
+// the write is still applied and the failure is reported to the WAL error handler.
+func (m *MemStorage) loggedVoid(op walOp, metric models.Metrics, apply func()) {
+	m.walMu.RLock()
+	if m.wal == nil {
+		defer m.walMu.RUnlock()
+		apply()
+		return
+	}
+	m.walMu.RUnlock()
+
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	if m.wal != nil {
+		if err := m.wal.append(walRecord{Op: op, Metrics: []models.Metrics{metric}}); err != nil {
+			m.wal.onError(err)
+		}
 	}
+	apply()
+}
+
+func gaugeRecord(name string, value float64) models.Metrics {
+	m := models.Metrics{MType: models.GaugeType, Value: &value}
+	m.SetKey(name)
+	return m
+}
+
+func counterRecord(name string, value int64) models.Metrics {
+	m := models.Metrics{MType: models.CounterType, Delta: &value}
+	m.SetKey(name)
+	return m
+}
+
+func histogramRecord(name string, h models.Histogram) models.Metrics {
+	m := models.Metrics{MType: models.HistogramType, Histogram: &h}
+	m.SetKey(name)
+	return m
 }
 
 // UpdateGauge stores the latest gauge value.
 func (m *MemStorage) UpdateGauge(name string, value float64) {
-	m.gauges.Update(name, value)
+	m.loggedVoid(walUpdate, gaugeRecord(name, value), func() { m.putGauge(name, value) })
 }
 
 // UpdateCounter increments the counter by the provided delta.
 func (m *MemStorage) UpdateCounter(name string, delta int64) {
-	m.counters.Add(name, delta)
+	m.loggedVoid(walUpdate, counterRecord(name, delta), func() { m.addCounter(name, delta) })
 }
 
 // GetGauge retrieves a gauge value.
@@ -106,12 +233,12 @@ func (m *MemStorage) GetCounter(name string) (int64, error) {
 
 // SetGauge overwrites a gauge without additional processing.
 func (m *MemStorage) SetGauge(name string, value float64) {
-	m.gauges.Update(name, value)
+	m.loggedVoid(walSet, gaugeRecord(name, value), func() { m.putGauge(name, value) })
 }
 
 // SetCounter overwrites a counter without additional processing.
 func (m *MemStorage) SetCounter(name string, value int64) {
-	m.counters.Update(name, value)
+	m.loggedVoid(walSet, counterRecord(name, value), func() { m.putCounter(name, value) })
 }
 
 // AllGauges returns a snapshot of all gauges.
@@ -124,7 +251,34 @@ func (m *MemStorage) AllCounters() map[string]int64 {
 	return m.counters.Snapshot()
 }
 
+// UpdateHistogram merges the distribution into the stored histogram.
+func (m *MemStorage) UpdateHistogram(name string, h models.Histogram) error {
+	return m.logged(walUpdate, []models.Metrics{histogramRecord(name, h)}, func() error {
+		return m.mergeHistogram(name, h)
+	})
+}
+
+// GetHistogram retrieves a copy of a histogram.
+func (m *MemStorage) GetHistogram(name string) (models.Histogram, error) {
+	h, err := m.histograms.Get(name)
+	if err != nil {
+		return h, err
+	}
+	return h.Clone(), nil
+}
+
+// SetHistogram overwrites a histogram without merging.
+func (m *MemStorage) SetHistogram(name string, h models.Histogram) {
+	m.loggedVoid(walSet, histogramRecord(name, h), func() { m.putHistogram(name, h) })
+}
+
+// AllHistograms returns a snapshot of all histograms.
+func (m *MemStorage) AllHistograms() map[string]models.Histogram {
+	return m.histograms.Snapshot()
+}
+
 // Snapshot returns all metrics as model instances suitable for serialisation.
+// Series keys are split back into metric names and labels.
 func (m *MemStorage) Snapshot() []models.Metrics {
 	gauges := m.gauges.Snapshot()
 	counters := m.counters.Snapshot()
@@ -136,39 +290,106 @@ func (m *MemStorage) Snapshot() []models.Metrics {
 	for name, value := range gauges {
 		gaugeValues = append(gaugeValues, value)
 		v := &gaugeValues[len(gaugeValues)-1]
-		metrics = append(metrics, models.Metrics{
-			ID:    name,
-			MType: models.GaugeType,
-			Value: v,
-		})
+		metric := models.Metrics{MType: models.GaugeType, Value: v}
+		metric.SetKey(name)
+		metrics = append(metrics, metric)
 	}
 	for name, value := range counters {
 		counterValues = append(counterValues, value)
 		v := &counterValues[len(counterValues)-1]
-		metrics = append(metrics, models.Metrics{
-			ID:    name,
-			MType: models.CounterType,
-			Delta: v,
-		})
+		metric := models.Metrics{MType: models.CounterType, Delta: v}
+		metric.SetKey(name)
+		metrics = append(metrics, metric)
+	}
+	for name, value := range m.histograms.Snapshot() {
+		h := value.Clone()
+		metric := models.Metrics{MType: models.HistogramType, Histogram: &h}
+		metric.SetKey(name)
+		metrics = append(metrics, metric)
 	}
 
 	return metrics
 }
 
-// UpdateBatch applies a batch of metric updates in a single pass.
+// UpdateBatch applies a batch of metric updates in a single pass and logs it as one WAL record.
+// A batch with a histogram whose buckets do not match the stored ones is rejected as a whole.
+// Batches with histograms hold walMu exclusively, so that no other write changes the stored buckets
+// between the check and the merge.
 func (m *MemStorage) UpdateBatch(metrics []models.Metrics) error {
+	apply := func() error { return m.applyBatch(metrics) }
+	if !hasHistograms(metrics) {
+		return m.logged(walUpdate, metrics, apply)
+	}
+
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	if err := m.checkHistograms(metrics); err != nil {
+		return err
+	}
+	return m.logAndApply(walUpdate, metrics, apply)
+}
+
+func hasHistograms(metrics []models.Metrics) bool {
+	for i := range metrics {
+		if metrics[i].MType == models.HistogramType && metrics[i].Histogram != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHistograms rejects a batch with a histogram that cannot be merged, before anything is logged or applied,
+// so that a batch is applied entirely or not at all, as in the DBStorage transaction. The caller holds walMu exclusively.
+func (m *MemStorage) checkHistograms(metrics []models.Metrics) error {
+	var merged map[string]models.Histogram
+	for i := range metrics {
+		mt := &metrics[i]
+		if mt.MType != models.HistogramType || mt.Histogram == nil {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string]models.Histogram)
+		}
+		key := mt.Key()
+		cur, ok := merged[key]
+		if !ok {
+			stored, err := m.histograms.Get(key)
+			if err != nil {
+				merged[key] = *mt.Histogram
+				continue
+			}
+			cur = stored
+		}
+		next, err := cur.Merge(*mt.Histogram)
+		if err != nil {
+			return err
+		}
+		merged[key] = next
+	}
+	return nil
+}
+
+func (m *MemStorage) applyBatch(metrics []models.Metrics) error {
 	for i := range metrics {
 		mt := &metrics[i]
 
 		if mt.MType == models.GaugeType {
 			if mt.Value != nil {
-				m.UpdateGauge(mt.ID, *mt.Value)
+				m.putGauge(mt.Key(), *mt.Value)
 			}
 			continue
 		}
 		if mt.MType == models.CounterType {
 			if mt.Delta != nil {
-				m.UpdateCounter(mt.ID, *mt.Delta)
+				m.addCounter(mt.Key(), *mt.Delta)
+			}
+			continue
+		}
+		if mt.MType == models.HistogramType {
+			if mt.Histogram != nil {
+				if err := m.mergeHistogram(mt.Key(), *mt.Histogram); err != nil {
+					return err
+				}
 			}
 			continue
 		}
@@ -176,4 +397,174 @@ func (m *MemStorage) UpdateBatch(metrics []models.Metrics) error {
 	return nil
 }
 
-var _ MetricStorage = NewMemStorage()
+func (m *MemStorage) applySet(metrics []models.Metrics) {
+	for i := range metrics {
+		mt := &metrics[i]
+		switch mt.MType {
+		case models.GaugeType:
+			if mt.Value != nil {
+				m.putGauge(mt.Key(), *mt.Value)
+			}
+		case models.CounterType:
+			if mt.Delta != nil {
+				m.putCounter(mt.Key(), *mt.Delta)
+			}
+		case models.HistogramType:
+			if mt.Histogram != nil {
+				m.putHistogram(mt.Key(), *mt.Histogram)
+			}
+		}
+	}
+}
+
+func (m *MemStorage) applyDelete(metrics []models.Metrics) int {
+	gauges, counters, histograms := deleteKeys(metrics)
+	n := 0
+	for _, k := range gauges {
+		m.gaugeTimes.Delete(k)
+		if m.gauges.Delete(k) {
+			n++
+		}
+	}
+	for _, k := range counters {
+		m.counterTimes.Delete(k)
+		if m.counters.Delete(k) {
+			n++
+		}
+	}
+	for _, k := range histograms {
+		m.histogramTimes.Delete(k)
+		if m.histograms.Delete(k) {
+			n++
+		}
+	}
+	return n
+}
+
+// GaugeUpdateTimes returns the last write time of every gauge.
+func (m *MemStorage) GaugeUpdateTimes() map[string]time.Time {
+	return m.gaugeTimes.Snapshot()
+}
+
+// CounterUpdateTimes returns the last write time of every counter.
+func (m *MemStorage) CounterUpdateTimes() map[string]time.Time {
+	return m.counterTimes.Snapshot()
+}
+
+// HistogramUpdateTimes returns the last write time of every histogram.
+func (m *MemStorage) HistogramUpdateTimes() map[string]time.Time {
+	return m.histogramTimes.Snapshot()
+}
+
+// GaugeUpdateTimesContext is GaugeUpdateTimes that honours the cancellation of ctx.
+func (m *MemStorage) GaugeUpdateTimesContext(ctx context.Context) (map[string]time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GaugeUpdateTimes(), nil
+}
+
+// CounterUpdateTimesContext is CounterUpdateTimes that honours the cancellation of ctx.
+func (m *MemStorage) CounterUpdateTimesContext(ctx context.Context) (map[string]time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.CounterUpdateTimes(), nil
+}
+
+// HistogramUpdateTimesContext is HistogramUpdateTimes that honours the cancellation of ctx.
+func (m *MemStorage) HistogramUpdateTimesContext(ctx context.Context) (map[string]time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.HistogramUpdateTimes(), nil
+}
+
+// ExpireContext removes the listed metrics last written before the cutoff and logs
+// the removal as one WAL record. Writes wait until the expiry completes.
+func (m *MemStorage) ExpireContext(ctx context.Context, metrics []models.Metrics, before time.Time) ([]models.Metrics, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+
+	var stale []models.Metrics
+	for i := range metrics {
+		var times *ShardedMemStorageT[time.Time]
+		switch metrics[i].MType {
+		case models.GaugeType:
+			times = m.gaugeTimes
+		case models.CounterType:
+			times = m.counterTimes
+		case models.HistogramType:
+			times = m.histogramTimes
+		default:
+			continue
+		}
+		if t, err := times.Get(metrics[i].Key()); err == nil && t.Before(before) {
+			stale = append(stale, metrics[i])
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	if m.wal != nil {
+		if err := m.wal.append(walRecord{Op: walDelete, Metrics: stale}); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrStorageFailure, err)
+		}
+	}
+	m.applyDelete(stale)
+	return stale, nil
+}
+
+// Restore overwrites the stored metrics with a snapshot and then replays the attached WAL on top of it.
+// Neither step is logged: the snapshot and the log already hold the data.
+func (m *MemStorage) Restore(snapshot []models.Metrics) error {
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	m.applySet(snapshot)
+	if m.wal == nil {
+		return nil
+	}
+	err := m.wal.replay(func(rec walRecord) error {
+		switch rec.Op {
+		case walSet:
+			m.applySet(rec.Metrics)
+			return nil
+		case walDelete:
+			m.applyDelete(rec.Metrics)
+			return nil
+		}
+		return m.applyBatch(rec.Metrics)
+	})
+	m.walReplayed = err == nil
+	return err
+}
+
+// Checkpoint passes a consistent snapshot to save and compacts the WAL once save succeeds.
+// A WAL with records that were not replayed by Restore is neither saved over nor compacted,
+// so that those records are not lost; ErrWALNotReplayed is returned instead.
+// Writes wait until the checkpoint completes.
+func (m *MemStorage) Checkpoint(save func([]models.Metrics) error) error {
+	m.walMu.Lock()
+	defer m.walMu.Unlock()
+	if m.wal != nil && !m.walReplayed {
+		return ErrWALNotReplayed
+	}
+	if err := save(m.Snapshot()); err != nil {
+		return err
+	}
+	if m.wal == nil {
+		return nil
+	}
+	return m.wal.truncate()
+}
+
+var (
+	_ MetricStorage    = NewMemStorage()
+	_ HistogramStorage = NewMemStorage()
+	_ DeleteStorage    = NewMemStorage()
+	_ ExpiringStorage  = NewMemStorage()
+	_ QueryStorage     = NewMemStorage()
+)
@@ -55,3 +55,44 @@ func BenchmarkMemStorageSnapshot(b *testing.B) {
 		_ = storage.Snapshot()
 	}
 }
+
+// counterAdder is the accumulation API shared by the single-lock and sharded numeric storages.
+type counterAdder interface {
+	Add(name string, delta int64)
+}
+
+func benchmarkParallelAdd(b *testing.B, st counterAdder) {
+	names := append(append([]string(nil), models.GaugeNames...), models.CounterNames...)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			st.Add(names[i%len(names)], 1)
+			i++
+		}
+	})
+}
+
+func BenchmarkNumMemStorageAddParallel(b *testing.B) {
+	benchmarkParallelAdd(b, NewNumMemStorage[int64]())
+}
+
+func BenchmarkShardedNumMemStorageAddParallel(b *testing.B) {
+	benchmarkParallelAdd(b, NewShardedNumMemStorage[int64]())
+}
+
+func BenchmarkMemStorageUpdateBatchParallel(b *testing.B) {
+	storage := NewMemStorage()
+	metrics := buildMetricsSet()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := storage.UpdateBatch(metrics); err != nil {
+				b.Errorf("unexpected error: %v", err)
+				return
+			}
+		}
+	})
+}
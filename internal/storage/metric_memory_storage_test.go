@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"sync"
 	"testing"
 
@@ -278,3 +279,123 @@ func TestMemStorage_UpdateBatch_EmptyInput(t *testing.T) {
 		t.Fatalf("UpdateBatch(empty) want nil, got %v", err)
 	}
 }
+
+func TestMemStorage_UpdateBatch_Labels(t *testing.T) {
+	s := NewMemStorage()
+	v := 1.0
+	_ = s.UpdateBatch([]models.Metrics{
+		{ID: "CPU", MType: models.GaugeType, Value: &v, Labels: models.Labels{"cpu": "2"}},
+	})
+	if got, err := s.GetGauge(`CPU{cpu="2"}`); err != nil || got != 1 {
+		t.Fatalf("labelled gauge: %v %v", got, err)
+	}
+	if _, err := s.GetGauge("CPU"); err != ErrMetricNotFound {
+		t.Fatalf("plain series must be separate, got %v", err)
+	}
+
+	snap := s.Snapshot()
+	if len(snap) != 1 || snap[0].ID != "CPU" || snap[0].Labels["cpu"] != "2" {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestMemStorage_UpdateBatch_HistogramMismatchAppliesNothing(t *testing.T) {
+	s := NewMemStorage()
+	if err := s.UpdateHistogram("lat", *models.NewHistogram([]float64{1})); err != nil {
+		t.Fatal(err)
+	}
+	v := 1.0
+	err := s.UpdateBatch([]models.Metrics{
+		{ID: "g", MType: models.GaugeType, Value: &v},
+		{ID: "lat", MType: models.HistogramType, Histogram: models.NewHistogram([]float64{1})},
+		{ID: "lat", MType: models.HistogramType, Histogram: models.NewHistogram([]float64{2})},
+	})
+	if !errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want ErrHistogramBucketsMismatch, got %v", err)
+	}
+	if _, err := s.GetGauge("g"); err != ErrMetricNotFound {
+		t.Fatalf("gauge of a rejected batch was applied: %v", err)
+	}
+	if h, _ := s.GetHistogram("lat"); h.Count != 0 {
+		t.Fatalf("histogram of a rejected batch was merged: %+v", h)
+	}
+}
+
+func TestMemStorage_UpdateBatch_ConcurrentBucketChangeAppliesAllOrNothing(t *testing.T) {
+	s := NewMemStorage()
+	one, two := []float64{1}, []float64{2}
+	s.SetHistogram("lat", *models.NewHistogram(one))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			bounds := one
+			if i%2 == 1 {
+				bounds = two
+			}
+			s.SetHistogram("lat", *models.NewHistogram(bounds))
+		}
+	}()
+
+	// The counters ahead of the histogram widen the window in which the buckets could change.
+	d := int64(1)
+	batch := make([]models.Metrics, 0, 101)
+	for i := 0; i < 100; i++ {
+		batch = append(batch, models.Metrics{ID: "c", MType: models.CounterType, Delta: &d})
+	}
+	batch = append(batch, models.Metrics{ID: "lat", MType: models.HistogramType, Histogram: models.NewHistogram(one)})
+
+	var applied int64
+	for i := 0; i < 500; i++ {
+		err := s.UpdateBatch(batch)
+		switch {
+		case err == nil:
+			applied += 100
+		case !errors.Is(err, models.ErrHistogramBucketsMismatch):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if got, _ := s.GetCounter("c"); got != applied {
+		t.Fatalf("counter = %d, want %d: a rejected batch was partly applied", got, applied)
+	}
+}
+
+func TestMemStorage_Histograms(t *testing.T) {
+	s := NewMemStorage()
+	a := models.NewHistogram([]float64{1})
+	a.Observe(0.5)
+	b := models.NewHistogram([]float64{1})
+	b.Observe(2)
+
+	if err := s.UpdateHistogram("lat", *a); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateBatch([]models.Metrics{{ID: "lat", MType: models.HistogramType, Histogram: b}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetHistogram("lat")
+	if err != nil || got.Count != 2 || got.Counts[0] != 1 || got.Counts[1] != 1 {
+		t.Fatalf("unexpected merged histogram: %+v %v", got, err)
+	}
+
+	got.Counts[0] = 100
+	if again, _ := s.GetHistogram("lat"); again.Counts[0] != 1 {
+		t.Fatalf("GetHistogram must return a copy")
+	}
+
+	if err := s.UpdateHistogram("lat", *models.NewHistogram([]float64{5})); !errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want ErrHistogramBucketsMismatch, got %v", err)
+	}
+	if _, err := s.GetHistogram("missing"); err != ErrMetricNotFound {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+
+	snap := s.Snapshot()
+	if len(snap) != 1 || snap[0].MType != models.HistogramType || snap[0].Histogram.Count != 2 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// UpdateGaugeContext stores the latest gauge value. It fails only when ctx is done or the WAL cannot be written.
+func (m *MemStorage) UpdateGaugeContext(ctx context.Context, name string, value float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.logged(walUpdate, []models.Metrics{gaugeRecord(name, value)}, func() error {
+		m.putGauge(name, value)
+		return nil
+	})
+}
+
+// UpdateCounterContext increments the counter by the provided delta.
+func (m *MemStorage) UpdateCounterContext(ctx context.Context, name string, delta int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.logged(walUpdate, []models.Metrics{counterRecord(name, delta)}, func() error {
+		m.addCounter(name, delta)
+		return nil
+	})
+}
+
+// GetGaugeContext retrieves a gauge value.
+func (m *MemStorage) GetGaugeContext(ctx context.Context, name string) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return m.GetGauge(name)
+}
+
+// GetCounterContext retrieves a counter value.
+func (m *MemStorage) GetCounterContext(ctx context.Context, name string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return m.GetCounter(name)
+}
+
+// SetGaugeContext overwrites a gauge without additional processing.
+func (m *MemStorage) SetGaugeContext(ctx context.Context, name string, value float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.logged(walSet, []models.Metrics{gaugeRecord(name, value)}, func() error {
+		m.putGauge(name, value)
+		return nil
+	})
+}
+
+// SetCounterContext overwrites a counter without additional processing.
+func (m *MemStorage) SetCounterContext(ctx context.Context, name string, value int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.logged(walSet, []models.Metrics{counterRecord(name, value)}, func() error {
+		m.putCounter(name, value)
+		return nil
+	})
+}
+
+// AllGaugesContext returns a snapshot of all gauges.
+func (m *MemStorage) AllGaugesContext(ctx context.Context) (map[string]float64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.AllGauges(), nil
+}
+
+// AllCountersContext returns a snapshot of all counters.
+func (m *MemStorage) AllCountersContext(ctx context.Context) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.AllCounters(), nil
+}
+
+// UpdateBatchContext applies a batch of metric updates and logs it as one WAL record.
+func (m *MemStorage) UpdateBatchContext(ctx context.Context, metrics []models.Metrics) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.UpdateBatch(metrics)
+}
+
+// DeleteContext removes the listed metrics and logs the removal as one WAL record.
+func (m *MemStorage) DeleteContext(ctx context.Context, metrics []models.Metrics) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	var n int
+	err := m.logged(walDelete, metrics, func() error {
+		n = m.applyDelete(metrics)
+		return nil
+	})
+	return n, err
+}
+
+// QueryContext lists the matching metrics, filtering each shard in place instead of copying the whole storage.
+func (m *MemStorage) QueryContext(ctx context.Context, q MetricQuery) ([]models.Metrics, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var res []models.Metrics
+	if q.wants(models.GaugeType) {
+		m.gauges.Range(func(key string, value float64) {
+			res = q.appendMatch(res, models.GaugeType, key, func(m *models.Metrics) { m.Value = &value })
+		})
+	}
+	if q.wants(models.CounterType) {
+		m.counters.Range(func(key string, value int64) {
+			res = q.appendMatch(res, models.CounterType, key, func(m *models.Metrics) { m.Delta = &value })
+		})
+	}
+	if q.wants(models.HistogramType) {
+		m.histograms.Range(func(key string, value models.Histogram) {
+			res = q.appendMatch(res, models.HistogramType, key, func(m *models.Metrics) { m.Histogram = &value })
+		})
+	}
+	return q.page(res), nil
+}
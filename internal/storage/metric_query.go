@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// MetricQuery selects the metrics returned by a listing. Zero-valued fields do not filter.
+// Names and Pattern apply to the metric name, Prefix to the series key; a series is listed
+// when it passes every filter that is set.
+type MetricQuery struct {
+	Type    models.MetricType
+	Names   []string
+	Prefix  string
+	Pattern *regexp.Regexp
+	// Instance keeps only the series whose instance label equals it.
+	Instance string
+	// After resumes the listing right behind the given series.
+	After QueryCursor
+	// Limit caps the number of returned metrics; zero means no limit.
+	Limit int
+}
+
+// QueryCursor identifies the last series of a listed page.
+type QueryCursor struct {
+	Type models.MetricType
+	Key  string
+}
+
+// QueryStorage is implemented by backends that filter and page metric listings themselves.
+// QueryContext returns the matching metrics ordered by type, as listed in models.MetricTypes,
+// and then byte-wise by series key.
+type QueryStorage interface {
+	QueryContext(ctx context.Context, q MetricQuery) ([]models.Metrics, error)
+}
+
+// Query lists the metrics matching q. Backends that do not implement QueryStorage are listed
+// in full and filtered in memory.
+func Query(ctx context.Context, st MetricStorage, q MetricQuery) ([]models.Metrics, error) {
+	if qs, ok := st.(QueryStorage); ok {
+		return qs.QueryContext(ctx, q)
+	}
+
+	v2 := AsV2(st)
+	var res []models.Metrics
+	if q.wants(models.GaugeType) {
+		gauges, err := v2.AllGaugesContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range gauges {
+			res = q.appendMatch(res, models.GaugeType, key, func(m *models.Metrics) { v := value; m.Value = &v })
+		}
+	}
+	if q.wants(models.CounterType) {
+		counters, err := v2.AllCountersContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range counters {
+			res = q.appendMatch(res, models.CounterType, key, func(m *models.Metrics) { v := value; m.Delta = &v })
+		}
+	}
+	if hs, ok := st.(HistogramStorage); ok && q.wants(models.HistogramType) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for key, value := range hs.AllHistograms() {
+			res = q.appendMatch(res, models.HistogramType, key, func(m *models.Metrics) { h := value; m.Histogram = &h })
+		}
+	}
+	return q.page(res), nil
+}
+
+// seriesName returns the metric name of a series key.
+func seriesName(key string) string {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// wants reports whether series of type t may be listed: the type passes the filter
+// and is not before the cursor.
+func (q MetricQuery) wants(t models.MetricType) bool {
+	if q.Type != "" && q.Type != t {
+		return false
+	}
+	return q.After.Type == "" || t.Rank() >= q.After.Type.Rank()
+}
+
+// after returns the key the series of type t must sort behind, or "" when every series qualifies.
+func (q MetricQuery) after(t models.MetricType) string {
+	if q.After.Type == t {
+		return q.After.Key
+	}
+	return ""
+}
+
+// match reports whether the series of type t stored under key passes the query.
+func (q MetricQuery) match(t models.MetricType, key string) bool {
+	if after := q.after(t); after != "" && key <= after {
+		return false
+	}
+	if !strings.HasPrefix(key, q.Prefix) {
+		return false
+	}
+	name := seriesName(key)
+	if len(q.Names) > 0 {
+		found := false
+		for _, n := range q.Names {
+			if n == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return q.filter(key)
+}
+
+// filter reports whether the series stored under key passes the name pattern and the instance,
+// which backends cannot check in their own query language and apply to the series they read.
+func (q MetricQuery) filter(key string) bool {
+	if q.Pattern != nil && !q.Pattern.MatchString(seriesName(key)) {
+		return false
+	}
+	if q.Instance == "" {
+		return true
+	}
+	_, labels, err := models.ParseSeriesKey(key)
+	return err == nil && labels[models.InstanceLabel] == q.Instance
+}
+
+// filtered reports whether filter may drop series, so reads cannot stop at the limit.
+func (q MetricQuery) filtered() bool {
+	return q.Pattern != nil || q.Instance != ""
+}
+
+// appendMatch appends the series to res when it passes the query; set fills in its value.
+func (q MetricQuery) appendMatch(res []models.Metrics, t models.MetricType, key string, set func(*models.Metrics)) []models.Metrics {
+	if !q.match(t, key) {
+		return res
+	}
+	m := models.Metrics{MType: t}
+	m.SetKey(key)
+	set(&m)
+	return append(res, m)
+}
+
+// page sorts the matching metrics into listing order and cuts them to the limit.
+func (q MetricQuery) page(res []models.Metrics) []models.Metrics {
+	keys := make([]string, len(res))
+	for i := range res {
+		keys[i] = res[i].Key()
+	}
+	sort.Sort(byTypeAndKey{metrics: res, keys: keys})
+	if q.Limit > 0 && len(res) > q.Limit {
+		res = res[:q.Limit]
+	}
+	return res
+}
+
+type byTypeAndKey struct {
+	metrics []models.Metrics
+	keys    []string
+}
+
+func (s byTypeAndKey) Len() int { return len(s.metrics) }
+
+func (s byTypeAndKey) Less(i, j int) bool {
+	if s.metrics[i].MType != s.metrics[j].MType {
+		return s.metrics[i].MType.Rank() < s.metrics[j].MType.Rank()
+	}
+	return s.keys[i] < s.keys[j]
+}
+
+func (s byTypeAndKey) Swap(i, j int) {
+	s.metrics[i], s.metrics[j] = s.metrics[j], s.metrics[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func queryKeys(metrics []models.Metrics) []string {
+	keys := make([]string, len(metrics))
+	for i := range metrics {
+		keys[i] = string(metrics[i].MType) + ":" + metrics[i].Key()
+	}
+	return keys
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQuery_Backends(t *testing.T) {
+	bs, bdb := openTestBolt(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer bdb.Close()
+	rs, _ := newTestRedisStorage(t)
+
+	for name, st := range map[string]MetricStorage{"memory": NewMemStorage(), "bolt": bs, "redis": rs} {
+		t.Run(name, func(t *testing.T) {
+			st.UpdateGauge("Alloc", 1)
+			st.UpdateGauge(`Alloc{instance="a"}`, 2)
+			st.UpdateGauge("HeapAlloc", 3)
+			st.UpdateCounter("PollCount", 4)
+			ctx := context.Background()
+
+			all, err := Query(ctx, st, MetricQuery{})
+			want := []string{"gauge:Alloc", `gauge:Alloc{instance="a"}`, "gauge:HeapAlloc", "counter:PollCount"}
+			if err != nil || !equalKeys(queryKeys(all), want) {
+				t.Fatalf("got %v %v, want %v", queryKeys(all), err, want)
+			}
+			if v := all[1].Value; v == nil || *v != 2 || all[1].Labels["instance"] != "a" {
+				t.Fatalf("labelled gauge must carry its value and labels, got %+v", all[1])
+			}
+			if d := all[3].Delta; d == nil || *d != 4 {
+				t.Fatalf("counter must carry its value, got %+v", all[3])
+			}
+
+			page, _ := Query(ctx, st, MetricQuery{Limit: 2, After: QueryCursor{Type: models.GaugeType, Key: "Alloc"}})
+			if !equalKeys(queryKeys(page), []string{`gauge:Alloc{instance="a"}`, "gauge:HeapAlloc"}) {
+				t.Fatalf("page after cursor: %v", queryKeys(page))
+			}
+			page, _ = Query(ctx, st, MetricQuery{After: QueryCursor{Type: models.CounterType, Key: "PollCount"}})
+			if len(page) != 0 {
+				t.Fatalf("nothing follows the last series, got %v", queryKeys(page))
+			}
+
+			filtered, _ := Query(ctx, st, MetricQuery{Type: models.GaugeType, Names: []string{"Alloc", "PollCount"}})
+			if !equalKeys(queryKeys(filtered), []string{"gauge:Alloc", `gauge:Alloc{instance="a"}`}) {
+				t.Fatalf("names filter must match every series of the name: %v", queryKeys(filtered))
+			}
+			filtered, _ = Query(ctx, st, MetricQuery{Prefix: "Heap"})
+			if !equalKeys(queryKeys(filtered), []string{"gauge:HeapAlloc"}) {
+				t.Fatalf("prefix filter: %v", queryKeys(filtered))
+			}
+			filtered, _ = Query(ctx, st, MetricQuery{Pattern: regexp.MustCompile(`^[A-Z][a-z]+$`)})
+			if !equalKeys(queryKeys(filtered), []string{"gauge:Alloc", `gauge:Alloc{instance="a"}`}) {
+				t.Fatalf("pattern filter must match the name: %v", queryKeys(filtered))
+			}
+			filtered, _ = Query(ctx, st, MetricQuery{Instance: "a"})
+			if !equalKeys(queryKeys(filtered), []string{`gauge:Alloc{instance="a"}`}) {
+				t.Fatalf("instance filter: %v", queryKeys(filtered))
+			}
+		})
+	}
+}
+
+func TestQuery_CanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Query(ctx, NewMemStorage(), MetricQuery{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+}
+
+func TestDBStorage_QueryContext_PatternMatchedInGo(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+	// \z is RE2 syntax that PostgreSQL does not share.
+	q := MetricQuery{Type: models.GaugeType, Pattern: regexp.MustCompile(`^Heap\w+\z`), Limit: 2}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlQueryGauges)).
+		WithArgs("", []string(nil), "", nil).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).
+			AddRow("Alloc", 1.0).
+			AddRow(`HeapAlloc{instance="a"}`, 2.0).
+			AddRow("HeapIdle", 3.0).
+			AddRow("HeapSys", 4.0))
+	metrics, err := s.QueryContext(context.Background(), q)
+	if err != nil || !equalKeys(queryKeys(metrics), []string{`gauge:HeapAlloc{instance="a"}`, "gauge:HeapIdle"}) {
+		t.Fatalf("got %v %v", queryKeys(metrics), err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBStorage_QueryContext_InstanceAndEmptyNames(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+	q := MetricQuery{Type: models.GaugeType, Names: []string{}, Instance: "a", Limit: 1}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlQueryGauges)).
+		WithArgs("", []string(nil), "", nil).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).
+			AddRow("Alloc", 1.0).
+			AddRow(`Alloc{instance="b"}`, 2.0).
+			AddRow(`HeapAlloc{instance="a"}`, 3.0))
+	metrics, err := s.QueryContext(context.Background(), q)
+	if err != nil || !equalKeys(queryKeys(metrics), []string{`gauge:HeapAlloc{instance="a"}`}) {
+		t.Fatalf("got %v %v", queryKeys(metrics), err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBStorage_QueryContext(t *testing.T) {
+	mock, _ := pgxmock.NewPool()
+	defer mock.Close()
+	s := NewDBStorage(mock)
+	q := MetricQuery{
+		Names:   []string{"Alloc"},
+		Prefix:  "A",
+		Pattern: regexp.MustCompile("^A"),
+		After:   QueryCursor{Type: models.GaugeType, Key: "Alloc"},
+		Limit:   2,
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlQueryGauges)).
+		WithArgs("Alloc", []string{"Alloc"}, "A", nil).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).AddRow(`Alloc{instance="a"}`, 2.5))
+	mock.ExpectQuery(regexp.QuoteMeta(sqlQueryCounters)).
+		WithArgs("", []string{"Alloc"}, "A", nil).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).AddRow("Alloc", int64(7)))
+	metrics, err := s.QueryContext(context.Background(), q)
+	if err != nil || !equalKeys(queryKeys(metrics), []string{`gauge:Alloc{instance="a"}`, "counter:Alloc"}) {
+		t.Fatalf("got %v %v", queryKeys(metrics), err)
+	}
+	if *metrics[0].Value != 2.5 || *metrics[1].Delta != 7 {
+		t.Fatalf("values must be scanned, got %+v", metrics)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlQueryCounters)).
+		WithArgs("", []string(nil), "", 1).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "value"}).AddRow("Alloc", int64(7)))
+	if metrics, err = s.QueryContext(context.Background(), MetricQuery{Type: models.CounterType, Limit: 1}); err != nil || len(metrics) != 1 {
+		t.Fatalf("got %v %v", queryKeys(metrics), err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(sqlQueryCounters)).
+		WithArgs("", []string(nil), "", nil).
+		WillReturnError(errors.New("boom"))
+	if _, err := s.QueryContext(context.Background(), MetricQuery{Type: models.CounterType}); !errors.Is(err, ErrStorageFailure) {
+		t.Fatalf("want ErrStorageFailure, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,463 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+const (
+	// redisGaugesKey is the hash of gauge values keyed by series key.
+	redisGaugesKey = "metrics:gauges"
+	// redisCountersKey is the set of counter series keys, used to list counters without scanning the keyspace.
+	redisCountersKey = "metrics:counters"
+	// redisCounterPrefix prefixes the string key holding each counter value.
+	redisCounterPrefix = "metrics:counter:"
+	// redisHistogramsKey is the set of histogram series keys.
+	redisHistogramsKey = "metrics:histograms"
+	// redisHistogramPrefix prefixes the hash holding each histogram: its bounds as JSON, sum, count,
+	// and the count of bucket i in field c<i>.
+	redisHistogramPrefix = "metrics:histogram:"
+	// redisTxAttempts bounds how often a batch is retried when a watched histogram changes under it.
+	redisTxAttempts = 3
+)
+
+// RedisStorage keeps metrics in Redis so that several server replicas can share them.
+// Gauges live in a single hash; every counter is a separate integer key incremented with INCRBY;
+// every histogram is a hash whose buckets, sum and count are incremented with HINCRBY and HINCRBYFLOAT.
+type RedisStorage struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStorage constructs a Redis-backed MetricStorage implementation.
+func NewRedisStorage(c redis.UniversalClient) *RedisStorage {
+	return &RedisStorage{client: c}
+}
+
+func counterKey(name string) string {
+	return redisCounterPrefix + name
+}
+
+func histogramKey(name string) string {
+	return redisHistogramPrefix + name
+}
+
+func bucketField(i int) string {
+	return "c" + strconv.Itoa(i)
+}
+
+// encodeBounds gives equal bounds the same encoding, so that stored bounds are compared as strings.
+func encodeBounds(bounds []float64) string {
+	b, _ := json.Marshal(bounds)
+	return string(b)
+}
+
+// UpdateGauge stores the latest gauge value. Errors are dropped; use UpdateGaugeContext to observe them.
+func (s *RedisStorage) UpdateGauge(name string, value float64) {
+	_ = s.UpdateGaugeContext(context.Background(), name, value)
+}
+
+// UpdateGaugeContext stores the latest gauge value.
+func (s *RedisStorage) UpdateGaugeContext(ctx context.Context, name string, value float64) error {
+	return s.SetGaugeContext(ctx, name, value)
+}
+
+// UpdateCounter increments the counter. Errors are dropped; use UpdateCounterContext to observe them.
+func (s *RedisStorage) UpdateCounter(name string, delta int64) {
+	_ = s.UpdateCounterContext(context.Background(), name, delta)
+}
+
+// UpdateCounterContext atomically increments the counter by delta.
+func (s *RedisStorage) UpdateCounterContext(ctx context.Context, name string, delta int64) error {
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.IncrBy(ctx, counterKey(name), delta)
+		p.SAdd(ctx, redisCountersKey, name)
+		return nil
+	})
+	return wrapRedisError(ctx, err)
+}
+
+// GetGauge retrieves a gauge value.
+func (s *RedisStorage) GetGauge(name string) (float64, error) {
+	return s.GetGaugeContext(context.Background(), name)
+}
+
+// GetGaugeContext retrieves a gauge value.
+func (s *RedisStorage) GetGaugeContext(ctx context.Context, name string) (float64, error) {
+	v, err := s.client.HGet(ctx, redisGaugesKey, name).Float64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrMetricNotFound
+	}
+	return v, wrapRedisError(ctx, err)
+}
+
+// GetCounter retrieves a counter value.
+func (s *RedisStorage) GetCounter(name string) (int64, error) {
+	return s.GetCounterContext(context.Background(), name)
+}
+
+// GetCounterContext retrieves a counter value.
+func (s *RedisStorage) GetCounterContext(ctx context.Context, name string) (int64, error) {
+	v, err := s.client.Get(ctx, counterKey(name)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrMetricNotFound
+	}
+	return v, wrapRedisError(ctx, err)
+}
+
+// SetGauge overwrites a gauge. Errors are dropped; use SetGaugeContext to observe them.
+func (s *RedisStorage) SetGauge(name string, value float64) {
+	_ = s.SetGaugeContext(context.Background(), name, value)
+}
+
+// SetGaugeContext overwrites a gauge.
+func (s *RedisStorage) SetGaugeContext(ctx context.Context, name string, value float64) error {
+	return wrapRedisError(ctx, s.client.HSet(ctx, redisGaugesKey, name, value).Err())
+}
+
+// SetCounter overwrites a counter. Errors are dropped; use SetCounterContext to observe them.
+func (s *RedisStorage) SetCounter(name string, value int64) {
+	_ = s.SetCounterContext(context.Background(), name, value)
+}
+
+// SetCounterContext overwrites a counter.
+func (s *RedisStorage) SetCounterContext(ctx context.Context, name string, value int64) error {
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, counterKey(name), value, 0)
+		p.SAdd(ctx, redisCountersKey, name)
+		return nil
+	})
+	return wrapRedisError(ctx, err)
+}
+
+// AllGauges returns all gauges, or an empty map when Redis cannot be queried.
+func (s *RedisStorage) AllGauges() map[string]float64 {
+	res, err := s.AllGaugesContext(context.Background())
+	if err != nil {
+		return map[string]float64{}
+	}
+	return res
+}
+
+// AllGaugesContext returns all gauges. Values that cannot be parsed are skipped.
+func (s *RedisStorage) AllGaugesContext(ctx context.Context) (map[string]float64, error) {
+	raw, err := s.client.HGetAll(ctx, redisGaugesKey).Result()
+	if err != nil {
+		return nil, wrapRedisError(ctx, err)
+	}
+	res := make(map[string]float64, len(raw))
+	for name, v := range raw {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			res[name] = f
+		}
+	}
+	return res, nil
+}
+
+// AllCounters returns all counters, or an empty map when Redis cannot be queried.
+func (s *RedisStorage) AllCounters() map[string]int64 {
+	res, err := s.AllCountersContext(context.Background())
+	if err != nil {
+		return map[string]int64{}
+	}
+	return res
+}
+
+// AllCountersContext returns all counters. Values that cannot be parsed are skipped.
+func (s *RedisStorage) AllCountersContext(ctx context.Context) (map[string]int64, error) {
+	names, err := s.client.SMembers(ctx, redisCountersKey).Result()
+	if err != nil {
+		return nil, wrapRedisError(ctx, err)
+	}
+	res := make(map[string]int64, len(names))
+	if len(names) == 0 {
+		return res, nil
+	}
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = counterKey(name)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, wrapRedisError(ctx, err)
+	}
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+			res[names[i]] = n
+		}
+	}
+	return res, nil
+}
+
+// UpdateBatch applies a batch of gauge and counter updates in a single pipelined transaction.
+func (s *RedisStorage) UpdateBatch(metrics []models.Metrics) error {
+	return s.UpdateBatchContext(context.Background(), metrics)
+}
+
+// UpdateBatchContext applies a batch of updates in a single transaction. The stored histograms of the batch
+// are watched while their bounds are checked, so a histogram whose buckets do not match the stored one
+// rejects the whole batch before anything is written.
+func (s *RedisStorage) UpdateBatchContext(ctx context.Context, metrics []models.Metrics) error {
+	gauges, counters := aggregateMetrics(metrics)
+	histograms, err := aggregateHistograms(metrics)
+	if err != nil {
+		return err
+	}
+	if len(gauges) == 0 && len(counters) == 0 && len(histograms) == 0 {
+		return nil
+	}
+	queue := func(p redis.Pipeliner) error {
+		if len(gauges) > 0 {
+			fields := make([]any, 0, 2*len(gauges))
+			for name, v := range gauges {
+				fields = append(fields, name, v)
+			}
+			p.HSet(ctx, redisGaugesKey, fields...)
+		}
+		for name, delta := range counters {
+			p.IncrBy(ctx, counterKey(name), delta)
+			p.SAdd(ctx, redisCountersKey, name)
+		}
+		for name, h := range histograms {
+			queueHistogramMerge(ctx, p, name, h)
+		}
+		return nil
+	}
+	if len(histograms) == 0 {
+		_, err := s.client.TxPipelined(ctx, queue)
+		return wrapRedisError(ctx, err)
+	}
+
+	keys := make([]string, 0, len(histograms))
+	for name := range histograms {
+		keys = append(keys, histogramKey(name))
+	}
+	for attempt := 0; ; attempt++ {
+		err = s.client.Watch(ctx, func(tx *redis.Tx) error {
+			for name, h := range histograms {
+				if err := checkHistogramBounds(ctx, tx, name, h); err != nil {
+					return err
+				}
+			}
+			_, err := tx.TxPipelined(ctx, queue)
+			return err
+		}, keys...)
+		if !errors.Is(err, redis.TxFailedErr) || attempt+1 == redisTxAttempts {
+			break
+		}
+	}
+	return wrapRedisError(ctx, err)
+}
+
+// UpdateHistogram merges the distribution into the stored histogram.
+func (s *RedisStorage) UpdateHistogram(name string, h models.Histogram) error {
+	return s.UpdateHistogramContext(context.Background(), name, h)
+}
+
+// UpdateHistogramContext merges the distribution into the stored histogram and fails when bucket bounds differ.
+func (s *RedisStorage) UpdateHistogramContext(ctx context.Context, name string, h models.Histogram) error {
+	return s.UpdateBatchContext(ctx, []models.Metrics{{ID: name, MType: models.HistogramType, Histogram: &h}})
+}
+
+// GetHistogram retrieves a histogram.
+func (s *RedisStorage) GetHistogram(name string) (models.Histogram, error) {
+	return s.GetHistogramContext(context.Background(), name)
+}
+
+// GetHistogramContext retrieves a histogram.
+func (s *RedisStorage) GetHistogramContext(ctx context.Context, name string) (models.Histogram, error) {
+	raw, err := s.client.HGetAll(ctx, histogramKey(name)).Result()
+	if err != nil {
+		return models.Histogram{}, wrapRedisError(ctx, err)
+	}
+	if len(raw) == 0 {
+		return models.Histogram{}, ErrMetricNotFound
+	}
+	h, err := parseRedisHistogram(raw)
+	if err != nil {
+		return models.Histogram{}, fmt.Errorf("%w: histogram %q: %w", ErrStorageFailure, name, err)
+	}
+	return h, nil
+}
+
+// SetHistogram overwrites a histogram. Errors are dropped; use SetHistogramContext to observe them.
+func (s *RedisStorage) SetHistogram(name string, h models.Histogram) {
+	_ = s.SetHistogramContext(context.Background(), name, h)
+}
+
+// SetHistogramContext overwrites a histogram without merging.
+func (s *RedisStorage) SetHistogramContext(ctx context.Context, name string, h models.Histogram) error {
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		fields := []any{"bounds", encodeBounds(h.Bounds), "sum", h.Sum, "count", h.Count}
+		for i, c := range h.Counts {
+			fields = append(fields, bucketField(i), c)
+		}
+		p.Del(ctx, histogramKey(name))
+		p.HSet(ctx, histogramKey(name), fields...)
+		p.SAdd(ctx, redisHistogramsKey, name)
+		return nil
+	})
+	return wrapRedisError(ctx, err)
+}
+
+// AllHistograms returns all histograms, or an empty map when Redis cannot be queried.
+func (s *RedisStorage) AllHistograms() map[string]models.Histogram {
+	res, err := s.AllHistogramsContext(context.Background())
+	if err != nil {
+		return map[string]models.Histogram{}
+	}
+	return res
+}
+
+// AllHistogramsContext returns all histograms. Histograms that cannot be parsed are skipped.
+func (s *RedisStorage) AllHistogramsContext(ctx context.Context) (map[string]models.Histogram, error) {
+	names, err := s.client.SMembers(ctx, redisHistogramsKey).Result()
+	if err != nil {
+		return nil, wrapRedisError(ctx, err)
+	}
+	res := make(map[string]models.Histogram, len(names))
+	if len(names) == 0 {
+		return res, nil
+	}
+	cmds := make([]*redis.MapStringStringCmd, len(names))
+	_, err = s.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, name := range names {
+			cmds[i] = p.HGetAll(ctx, histogramKey(name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapRedisError(ctx, err)
+	}
+	for i, cmd := range cmds {
+		if h, err := parseRedisHistogram(cmd.Val()); err == nil {
+			res[names[i]] = h
+		}
+	}
+	return res, nil
+}
+
+// checkHistogramBounds fails with models.ErrHistogramBucketsMismatch when the stored histogram has other bounds.
+func checkHistogramBounds(ctx context.Context, tx *redis.Tx, name string, h models.Histogram) error {
+	bounds, err := tx.HGet(ctx, histogramKey(name), "bounds").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bounds != encodeBounds(h.Bounds) {
+		return fmt.Errorf("%w: %q", models.ErrHistogramBucketsMismatch, name)
+	}
+	return nil
+}
+
+// queueHistogramMerge adds the distribution to the stored histogram, creating it when missing.
+func queueHistogramMerge(ctx context.Context, p redis.Pipeliner, name string, h models.Histogram) {
+	key := histogramKey(name)
+	p.HSet(ctx, key, "bounds", encodeBounds(h.Bounds))
+	for i, c := range h.Counts {
+		p.HIncrBy(ctx, key, bucketField(i), int64(c))
+	}
+	p.HIncrByFloat(ctx, key, "sum", h.Sum)
+	p.HIncrBy(ctx, key, "count", int64(h.Count))
+	p.SAdd(ctx, redisHistogramsKey, name)
+}
+
+func parseRedisHistogram(raw map[string]string) (models.Histogram, error) {
+	var h models.Histogram
+	if err := json.Unmarshal([]byte(raw["bounds"]), &h.Bounds); err != nil {
+		return models.Histogram{}, fmt.Errorf("parse bounds: %w", err)
+	}
+	var err error
+	if h.Sum, err = strconv.ParseFloat(raw["sum"], 64); err != nil {
+		return models.Histogram{}, fmt.Errorf("parse sum: %w", err)
+	}
+	if h.Count, err = strconv.ParseUint(raw["count"], 10, 64); err != nil {
+		return models.Histogram{}, fmt.Errorf("parse count: %w", err)
+	}
+	h.Counts = make([]uint64, len(h.Bounds)+1)
+	for i := range h.Counts {
+		if h.Counts[i], err = strconv.ParseUint(raw[bucketField(i)], 10, 64); err != nil {
+			return models.Histogram{}, fmt.Errorf("parse bucket %d: %w", i, err)
+		}
+	}
+	return h, nil
+}
+
+// DeleteContext removes the listed metrics in a single transaction.
+func (s *RedisStorage) DeleteContext(ctx context.Context, metrics []models.Metrics) (int, error) {
+	gauges, counters, histograms := deleteKeys(metrics)
+	if len(gauges) == 0 && len(counters) == 0 && len(histograms) == 0 {
+		return 0, nil
+	}
+	var (
+		hdel *redis.IntCmd
+		dels []*redis.IntCmd
+	)
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if len(gauges) > 0 {
+			hdel = p.HDel(ctx, redisGaugesKey, gauges...)
+		}
+		for _, name := range counters {
+			dels = append(dels, p.Del(ctx, counterKey(name)))
+			p.SRem(ctx, redisCountersKey, name)
+		}
+		for _, name := range histograms {
+			dels = append(dels, p.Del(ctx, histogramKey(name)))
+			p.SRem(ctx, redisHistogramsKey, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, wrapRedisError(ctx, err)
+	}
+	n := 0
+	if hdel != nil {
+		n += int(hdel.Val())
+	}
+	for _, d := range dels {
+		n += int(d.Val())
+	}
+	return n, nil
+}
+
+// wrapRedisError classifies a Redis failure as ErrStorageUnavailable when the server cannot be reached
+// and as ErrStorageFailure otherwise. Failures caused by the caller's context keep the context error;
+// rejected histogram merges are returned unchanged.
+func wrapRedisError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	if errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, redis.ErrClosed) {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+	return fmt.Errorf("%w: %w", ErrStorageFailure, err)
+}
+
+var (
+	_ MetricStorage      = NewRedisStorage(nil)
+	_ MetricStorageV2    = NewRedisStorage(nil)
+	_ BatchStorageV2     = NewRedisStorage(nil)
+	_ HistogramStorage   = NewRedisStorage(nil)
+	_ HistogramStorageV2 = NewRedisStorage(nil)
+	_ DeleteStorage      = NewRedisStorage(nil)
+)
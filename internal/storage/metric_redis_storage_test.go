@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = c.Close() })
+	return NewRedisStorage(c), mr
+}
+
+func TestRedisStorage_GaugesAndCounters(t *testing.T) {
+	s, mr := newTestRedisStorage(t)
+
+	s.UpdateGauge(`g{host="a"}`, 1.5)
+	s.UpdateGauge(`g{host="a"}`, 2.5)
+	s.UpdateCounter("c", 2)
+	s.UpdateCounter("c", 3)
+
+	if v, err := s.GetGauge(`g{host="a"}`); err != nil || v != 2.5 {
+		t.Fatalf("gauge: %v %v", v, err)
+	}
+	if v, err := s.GetCounter("c"); err != nil || v != 5 {
+		t.Fatalf("counter: %v %v", v, err)
+	}
+	if got := mr.HGet(redisGaugesKey, `g{host="a"}`); got != "2.5" {
+		t.Fatalf("gauge must be a hash field, got %q", got)
+	}
+	if got, _ := mr.Get(counterKey("c")); got != "5" {
+		t.Fatalf("counter must be an integer key, got %q", got)
+	}
+
+	s.SetCounter("c", 1)
+	if v, _ := s.GetCounter("c"); v != 1 {
+		t.Fatalf("set counter: got %d", v)
+	}
+	if _, err := s.GetGauge("missing"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+	if _, err := s.GetCounter("missing"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+
+	if g := s.AllGauges(); len(g) != 1 || g[`g{host="a"}`] != 2.5 {
+		t.Fatalf("all gauges: %v", g)
+	}
+	if c := s.AllCounters(); len(c) != 1 || c["c"] != 1 {
+		t.Fatalf("all counters: %v", c)
+	}
+}
+
+func TestRedisStorage_UpdateBatch(t *testing.T) {
+	s, _ := newTestRedisStorage(t)
+	s.UpdateCounter("c", 10)
+
+	err := s.UpdateBatch([]models.Metrics{
+		{ID: "g", MType: models.GaugeType, Value: pFloat64(1)},
+		{ID: "g", MType: models.GaugeType, Value: pFloat64(2)},
+		{ID: "c", MType: models.CounterType, Delta: pInt64(1)},
+		{ID: "c", MType: models.CounterType, Delta: pInt64(2)},
+	})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if v, _ := s.GetGauge("g"); v != 2 {
+		t.Fatalf("last gauge in batch must win, got %v", v)
+	}
+	if v, _ := s.GetCounter("c"); v != 13 {
+		t.Fatalf("counter deltas must add up, got %d", v)
+	}
+
+	if err := s.UpdateHistogram("h", *models.NewHistogram([]float64{1, 2})); err != nil {
+		t.Fatal(err)
+	}
+	err = s.UpdateBatch([]models.Metrics{
+		{ID: "c", MType: models.CounterType, Delta: pInt64(1)},
+		{ID: "h", MType: models.HistogramType, Histogram: models.NewHistogram([]float64{1})},
+	})
+	if !errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want ErrHistogramBucketsMismatch, got %v", err)
+	}
+	if v, _ := s.GetCounter("c"); v != 13 {
+		t.Fatalf("rejected batch must not be applied, got %d", v)
+	}
+}
+
+func TestRedisStorage_Histograms(t *testing.T) {
+	s, mr := newTestRedisStorage(t)
+
+	h1 := models.NewHistogram([]float64{1, 10})
+	h1.Observe(0.5)
+	h1.Observe(5)
+	h2 := models.NewHistogram([]float64{1, 10})
+	h2.Observe(20)
+	err := s.UpdateBatch([]models.Metrics{
+		{ID: "GCPauseNs", MType: models.HistogramType, Histogram: h1},
+		{ID: "PollCount", MType: models.CounterType, Delta: pInt64(1)},
+		{ID: "GCPauseNs", MType: models.HistogramType, Histogram: h2},
+	})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if err := s.UpdateHistogramContext(context.Background(), "GCPauseNs", *h2); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetHistogram("GCPauseNs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Histogram{Bounds: []float64{1, 10}, Counts: []uint64{1, 1, 2}, Sum: 45.5, Count: 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged histogram = %+v, want %+v", got, want)
+	}
+	if got := mr.HGet(histogramKey("GCPauseNs"), "c2"); got != "2" {
+		t.Fatalf("buckets must be hash fields, got %q", got)
+	}
+	if _, err := s.GetHistogram("missing"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+
+	s.SetHistogram(`h{host="a"}`, *h1)
+	all := s.AllHistograms()
+	if len(all) != 2 || all[`h{host="a"}`].Count != 2 {
+		t.Fatalf("all histograms = %+v", all)
+	}
+
+	n, err := s.DeleteContext(context.Background(), []models.Metrics{{ID: "GCPauseNs", MType: models.HistogramType}})
+	if err != nil || n != 1 {
+		t.Fatalf("delete: %d %v", n, err)
+	}
+	if _, err := s.GetHistogram("GCPauseNs"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("deleted histogram still stored: %v", err)
+	}
+}
+
+func TestRedisStorage_ErrorsAreClassified(t *testing.T) {
+	s, mr := newTestRedisStorage(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.UpdateCounterContext(ctx, "c", 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+
+	mr.Close()
+	if err := s.SetGaugeContext(context.Background(), "g", 1); !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("want ErrStorageUnavailable, got %v", err)
+	}
+	if _, err := s.AllCountersContext(context.Background()); !errors.Is(err, ErrStorageUnavailable) {
+		t.Fatalf("want ErrStorageUnavailable, got %v", err)
+	}
+}
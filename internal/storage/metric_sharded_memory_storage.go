@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"hash/maphash"
+	"sync"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// memShardCount is the number of independently locked shards of a ShardedMemStorageT. A power of two.
+const memShardCount = 64
+
+type memShard[T any] struct {
+	mu   sync.RWMutex
+	data map[string]T
+	// pad keeps neighbouring shard locks on separate cache lines.
+	_ [32]byte
+}
+
+// ShardedMemStorageT stores metrics of any type in memory, spreading series over independently
+// locked shards so that writers of different series rarely contend.
+type ShardedMemStorageT[T any] struct {
+	seed   maphash.Seed
+	shards [memShardCount]memShard[T]
+}
+
+// NewShardedMemStorageT creates a new sharded storage for the provided type.
+func NewShardedMemStorageT[T any]() *ShardedMemStorageT[T] {
+	m := &ShardedMemStorageT[T]{seed: maphash.MakeSeed()}
+	for i := range m.shards {
+		m.shards[i].data = make(map[string]T)
+	}
+	return m
+}
+
+func (m *ShardedMemStorageT[T]) shard(name string) *memShard[T] {
+	return &m.shards[maphash.String(m.seed, name)&(memShardCount-1)]
+}
+
+// Update sets the value of the metric with the given name.
+func (m *ShardedMemStorageT[T]) Update(name string, value T) {
+	s := m.shard(name)
+	s.mu.Lock()
+	s.data[name] = value
+	s.mu.Unlock()
+}
+
+// Get retrieves the value for the metric with the given name.
+func (m *ShardedMemStorageT[T]) Get(name string) (T, error) {
+	s := m.shard(name)
+	s.mu.RLock()
+	v, ok := s.data[name]
+	s.mu.RUnlock()
+	if !ok {
+		var zero T
+		return zero, ErrMetricNotFound
+	}
+	return v, nil
+}
+
+// Delete removes the metric with the given name and reports whether it existed.
+func (m *ShardedMemStorageT[T]) Delete(name string) bool {
+	s := m.shard(name)
+	s.mu.Lock()
+	_, ok := s.data[name]
+	delete(s.data, name)
+	s.mu.Unlock()
+	return ok
+}
+
+// Snapshot returns a copy of the storage contents. Shards are copied one at a time,
+// so writes racing with the call may or may not be included.
+func (m *ShardedMemStorageT[T]) Snapshot() map[string]T {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += len(s.data)
+		s.mu.RUnlock()
+	}
+
+	res := make(map[string]T, n)
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for k, v := range s.data {
+			res[k] = v
+		}
+		s.mu.RUnlock()
+	}
+	return res
+}
+
+// Range calls fn for every stored metric, holding the lock of one shard at a time.
+// fn must not write to the storage.
+func (m *ShardedMemStorageT[T]) Range(fn func(name string, value T)) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for k, v := range s.data {
+			fn(k, v)
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// ShardedNumMemStorage wraps ShardedMemStorageT for numeric types and adds atomic addition.
+type ShardedNumMemStorage[T Number] struct {
+	*ShardedMemStorageT[T]
+}
+
+// NewShardedNumMemStorage constructs sharded numeric storage capable of accumulation operations.
+func NewShardedNumMemStorage[T Number]() *ShardedNumMemStorage[T] {
+	return &ShardedNumMemStorage[T]{NewShardedMemStorageT[T]()}
+}
+
+// Add increments the existing value of a metric by delta.
+func (m *ShardedNumMemStorage[T]) Add(name string, delta T) {
+	s := m.shard(name)
+	s.mu.Lock()
+	s.data[name] += delta
+	s.mu.Unlock()
+}
+
+// ShardedHistMemStorage wraps ShardedMemStorageT for histograms and merges updates bucket-wise.
+// Stored histograms are never mutated in place, so snapshots may share their slices.
+type ShardedHistMemStorage struct {
+	*ShardedMemStorageT[models.Histogram]
+}
+
+// NewShardedHistMemStorage constructs sharded histogram storage capable of merge operations.
+func NewShardedHistMemStorage() *ShardedHistMemStorage {
+	return &ShardedHistMemStorage{NewShardedMemStorageT[models.Histogram]()}
+}
+
+// Merge adds h to the stored histogram, creating it when missing.
+func (m *ShardedHistMemStorage) Merge(name string, h models.Histogram) error {
+	s := m.shard(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.data[name]
+	if !ok {
+		s.data[name] = h.Clone()
+		return nil
+	}
+	merged, err := cur.Merge(h)
+	if err != nil {
+		return err
+	}
+	s.data[name] = merged
+	return nil
+}
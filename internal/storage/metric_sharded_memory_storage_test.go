@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func TestShardedNumMemStorage_ConcurrentAddAndSnapshot(t *testing.T) {
+	const series, workers = 200, 8
+	m := NewShardedNumMemStorage[int64]()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < series; i++ {
+				m.Add("c"+strconv.Itoa(i), 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := m.Snapshot()
+	if len(snap) != series {
+		t.Fatalf("snapshot must hold every series, got %d", len(snap))
+	}
+	for name, v := range snap {
+		if v != workers {
+			t.Fatalf("%s: got %d, want %d", name, v, workers)
+		}
+	}
+	if _, err := m.Get("missing"); !errors.Is(err, ErrMetricNotFound) {
+		t.Fatalf("want ErrMetricNotFound, got %v", err)
+	}
+}
+
+func TestShardedHistMemStorage_Merge(t *testing.T) {
+	m := NewShardedHistMemStorage()
+	h := models.NewHistogram([]float64{1})
+	h.Observe(0.5)
+	if err := m.Merge("h", *h); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Merge("h", *h); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Get("h"); got.Count != 2 {
+		t.Fatalf("want merged count 2, got %d", got.Count)
+	}
+	if err := m.Merge("h", *models.NewHistogram([]float64{2})); !errors.Is(err, models.ErrHistogramBucketsMismatch) {
+		t.Fatalf("want bucket mismatch, got %v", err)
+	}
+}
@@ -1,10 +1,22 @@
 package storage
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
 
 var (
 	// ErrMetricNotFound indicates that a metric is missing from storage.
 	ErrMetricNotFound = fmt.Errorf("metric not found")
+	// ErrHistoryDisabled indicates that the backend was not configured to record metric history.
+	ErrHistoryDisabled = fmt.Errorf("metric history is disabled")
+	// ErrStorageUnavailable indicates that the backend cannot be reached, e.g. the database is down.
+	ErrStorageUnavailable = fmt.Errorf("storage unavailable")
+	// ErrStorageFailure indicates that the backend failed to carry out an otherwise valid operation.
+	ErrStorageFailure = fmt.Errorf("storage failure")
 )
 
 // MetricStorage defines the operations required from metric persistence backends.
@@ -18,3 +30,60 @@ type MetricStorage interface {
 	AllGauges() map[string]float64
 	AllCounters() map[string]int64
 }
+
+// UpdateTimesStorage is implemented by backends that track when each metric was last written.
+type UpdateTimesStorage interface {
+	GaugeUpdateTimesContext(ctx context.Context) (map[string]time.Time, error)
+	CounterUpdateTimesContext(ctx context.Context) (map[string]time.Time, error)
+}
+
+// HistogramUpdateTimesStorage is implemented by backends that track when each histogram was last written.
+type HistogramUpdateTimesStorage interface {
+	HistogramUpdateTimesContext(ctx context.Context) (map[string]time.Time, error)
+}
+
+// HistoryStorage is implemented by backends that keep an append-only log of metric samples.
+type HistoryStorage interface {
+	HistoryContext(ctx context.Context, t models.MetricType, name string, from, to time.Time, step time.Duration) ([]models.Sample, error)
+	PruneHistoryContext(ctx context.Context, before time.Time) error
+}
+
+// DeleteStorage is implemented by backends that can remove metrics.
+// DeleteContext removes the series identified by the type and key of each metric in one operation
+// and returns how many of them existed. Recorded history samples are kept.
+type DeleteStorage interface {
+	DeleteContext(ctx context.Context, metrics []models.Metrics) (int, error)
+}
+
+// ExpiringStorage is implemented by backends that track update times and can evict stale series.
+// ExpireContext removes those of the listed metrics that were last written before the cutoff,
+// atomically with respect to concurrent writes, and returns the removed ones.
+type ExpiringStorage interface {
+	UpdateTimesStorage
+	HistogramUpdateTimesStorage
+	ExpireContext(ctx context.Context, metrics []models.Metrics, before time.Time) ([]models.Metrics, error)
+}
+
+// deleteKeys splits the series keys to delete by metric type. Unknown types are ignored.
+func deleteKeys(metrics []models.Metrics) (gauges, counters, histograms []string) {
+	for i := range metrics {
+		switch metrics[i].MType {
+		case models.GaugeType:
+			gauges = append(gauges, metrics[i].Key())
+		case models.CounterType:
+			counters = append(counters, metrics[i].Key())
+		case models.HistogramType:
+			histograms = append(histograms, metrics[i].Key())
+		}
+	}
+	return gauges, counters, histograms
+}
+
+// HistogramStorage is implemented by backends that keep histogram metrics.
+// UpdateHistogram merges the supplied distribution into the stored one and fails when bucket bounds differ.
+type HistogramStorage interface {
+	UpdateHistogram(name string, h models.Histogram) error
+	GetHistogram(name string) (models.Histogram, error)
+	SetHistogram(name string, h models.Histogram)
+	AllHistograms() map[string]models.Histogram
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// MetricStorageV2 is the context-aware counterpart of MetricStorage.
+// Every method honours cancellation of ctx and reports backend failures, wrapped in
+// ErrStorageUnavailable or ErrStorageFailure, instead of dropping them.
+type MetricStorageV2 interface {
+	UpdateGaugeContext(ctx context.Context, name string, value float64) error
+	UpdateCounterContext(ctx context.Context, name string, delta int64) error
+	GetGaugeContext(ctx context.Context, name string) (float64, error)
+	GetCounterContext(ctx context.Context, name string) (int64, error)
+	SetGaugeContext(ctx context.Context, name string, value float64) error
+	SetCounterContext(ctx context.Context, name string, value int64) error
+	AllGaugesContext(ctx context.Context) (map[string]float64, error)
+	AllCountersContext(ctx context.Context) (map[string]int64, error)
+}
+
+// BatchStorageV2 is implemented by backends that apply a batch of updates in one operation.
+type BatchStorageV2 interface {
+	UpdateBatchContext(ctx context.Context, metrics []models.Metrics) error
+}
+
+// HistogramStorageV2 is the context-aware counterpart of HistogramStorage.
+type HistogramStorageV2 interface {
+	UpdateHistogramContext(ctx context.Context, name string, h models.Histogram) error
+	GetHistogramContext(ctx context.Context, name string) (models.Histogram, error)
+	SetHistogramContext(ctx context.Context, name string, h models.Histogram) error
+	AllHistogramsContext(ctx context.Context) (map[string]models.Histogram, error)
+}
+
+// AsV2 returns st itself when it implements MetricStorageV2 and otherwise wraps it.
+// The wrapper only checks ctx before delegating and never reports backend failures,
+// as MetricStorage gives it no way to observe them.
+func AsV2(st MetricStorage) MetricStorageV2 {
+	if v2, ok := st.(MetricStorageV2); ok {
+		return v2
+	}
+	return legacyStorage{st: st}
+}
+
+// AsHistogramV2 returns st itself when it implements HistogramStorageV2, wraps it when it only implements
+// HistogramStorage, and reports false when st keeps no histograms.
+func AsHistogramV2(st MetricStorage) (HistogramStorageV2, bool) {
+	if v2, ok := st.(HistogramStorageV2); ok {
+		return v2, true
+	}
+	if hs, ok := st.(HistogramStorage); ok {
+		return legacyHistograms{hs: hs}, true
+	}
+	return nil, false
+}
+
+type legacyStorage struct {
+	st MetricStorage
+}
+
+func (l legacyStorage) UpdateGaugeContext(ctx context.Context, name string, value float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.st.UpdateGauge(name, value)
+	return nil
+}
+
+func (l legacyStorage) UpdateCounterContext(ctx context.Context, name string, delta int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.st.UpdateCounter(name, delta)
+	return nil
+}
+
+func (l legacyStorage) GetGaugeContext(ctx context.Context, name string) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return l.st.GetGauge(name)
+}
+
+func (l legacyStorage) GetCounterContext(ctx context.Context, name string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return l.st.GetCounter(name)
+}
+
+func (l legacyStorage) SetGaugeContext(ctx context.Context, name string, value float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.st.SetGauge(name, value)
+	return nil
+}
+
+func (l legacyStorage) SetCounterContext(ctx context.Context, name string, value int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.st.SetCounter(name, value)
+	return nil
+}
+
+func (l legacyStorage) AllGaugesContext(ctx context.Context) (map[string]float64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.st.AllGauges(), nil
+}
+
+func (l legacyStorage) AllCountersContext(ctx context.Context) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.st.AllCounters(), nil
+}
+
+type legacyHistograms struct {
+	hs HistogramStorage
+}
+
+func (l legacyHistograms) UpdateHistogramContext(ctx context.Context, name string, h models.Histogram) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.hs.UpdateHistogram(name, h)
+}
+
+func (l legacyHistograms) GetHistogramContext(ctx context.Context, name string) (models.Histogram, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Histogram{}, err
+	}
+	return l.hs.GetHistogram(name)
+}
+
+func (l legacyHistograms) SetHistogramContext(ctx context.Context, name string, h models.Histogram) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.hs.SetHistogram(name, h)
+	return nil
+}
+
+func (l legacyHistograms) AllHistogramsContext(ctx context.Context) (map[string]models.Histogram, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.hs.AllHistograms(), nil
+}
+
+var (
+	_ MetricStorageV2    = NewDBStorage(nil)
+	_ HistogramStorageV2 = NewDBStorage(nil)
+	_ BatchStorageV2     = NewDBStorage(nil)
+	_ MetricStorageV2    = NewMemStorage()
+	_ BatchStorageV2     = NewMemStorage()
+)
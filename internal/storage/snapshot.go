@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// ErrHistogramsUnsupported indicates an import of histograms into a backend that cannot keep them.
+var ErrHistogramsUnsupported = fmt.Errorf("backend does not support histogram metrics")
+
+// Export returns every metric kept by the backend, histograms included when it keeps them.
+// Gauges and counters are set from their current values, so the result can be fed to Import on any backend.
+// A backend failure is returned instead of a partial listing.
+func Export(ctx context.Context, st MetricStorage) ([]models.Metrics, error) {
+	if ms, ok := st.(*MemStorage); ok {
+		return ms.Snapshot(), nil
+	}
+
+	v2 := AsV2(st)
+	gauges, err := v2.AllGaugesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := v2.AllCountersContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]models.Metrics, 0, len(gauges)+len(counters))
+	for key, value := range gauges {
+		v := value
+		m := models.Metrics{MType: models.GaugeType, Value: &v}
+		m.SetKey(key)
+		metrics = append(metrics, m)
+	}
+	for key, value := range counters {
+		v := value
+		m := models.Metrics{MType: models.CounterType, Delta: &v}
+		m.SetKey(key)
+		metrics = append(metrics, m)
+	}
+	if hs, ok := AsHistogramV2(st); ok {
+		histograms, err := hs.AllHistogramsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range histograms {
+			h := value
+			m := models.Metrics{MType: models.HistogramType, Histogram: &h}
+			m.SetKey(key)
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, nil
+}
+
+// Import overwrites the backend metrics with the supplied ones, as written by Export.
+// Metrics the backend cannot keep are skipped and reported in the returned error; the rest are still imported.
+// The first backend failure stops the import.
+func Import(ctx context.Context, st MetricStorage, metrics []models.Metrics) error {
+	v2 := AsV2(st)
+	hs, hasHistograms := AsHistogramV2(st)
+	var skipped int
+	for i := range metrics {
+		m := &metrics[i]
+		var err error
+		switch m.MType {
+		case models.GaugeType:
+			if m.Value != nil {
+				err = v2.SetGaugeContext(ctx, m.Key(), *m.Value)
+			}
+		case models.CounterType:
+			if m.Delta != nil {
+				err = v2.SetCounterContext(ctx, m.Key(), *m.Delta)
+			}
+		case models.HistogramType:
+			if m.Histogram == nil {
+				continue
+			}
+			if !hasHistograms {
+				skipped++
+				continue
+			}
+			err = hs.SetHistogramContext(ctx, m.Key(), *m.Histogram)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%w: %d histograms skipped", ErrHistogramsUnsupported, skipped)
+	}
+	return nil
+}
+
+// IsEmpty reports whether the backend keeps no metrics at all. A backend that cannot be read
+// is reported through the error rather than as empty.
+func IsEmpty(ctx context.Context, st MetricStorage) (bool, error) {
+	v2 := AsV2(st)
+	gauges, err := v2.AllGaugesContext(ctx)
+	if err != nil || len(gauges) > 0 {
+		return false, err
+	}
+	counters, err := v2.AllCountersContext(ctx)
+	if err != nil || len(counters) > 0 {
+		return false, err
+	}
+	if hs, ok := AsHistogramV2(st); ok {
+		histograms, err := hs.AllHistogramsContext(ctx)
+		if err != nil {
+			return false, err
+		}
+		return len(histograms) == 0, nil
+	}
+	return true, nil
+}
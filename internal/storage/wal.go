@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// ErrWALCorrupted indicates a complete WAL record that cannot be decoded.
+var ErrWALCorrupted = errors.New("wal record corrupted")
+
+// ErrWALNotReplayed indicates a checkpoint of a storage whose WAL holds records that were never replayed into it.
+var ErrWALNotReplayed = errors.New("wal holds records that were not replayed")
+
+// WALConfig describes the write-ahead log of MemStorage. An empty Path disables the log. The log is
+// compacted only by snapshots, so the server refuses a WAL without a snapshot file.
+// SyncInterval selects the fsync policy: 0 syncs after every record, a positive value syncs
+// at most that often and a negative value leaves flushing to the operating system.
+type WALConfig struct {
+	Path         string
+	SyncInterval time.Duration
+}
+
+// ParseWALSync parses a fsync policy: "always", "none" or a duration such as "1s".
+func ParseWALSync(raw string) (time.Duration, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "always":
+		return 0, nil
+	case "none":
+		return -1, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid wal sync policy %q: want always, none or a positive duration", raw)
+	}
+	return d, nil
+}
+
+type walOp string
+
+const (
+	// walUpdate records gauge overwrites, counter increments and histogram merges.
+	walUpdate walOp = "update"
+	// walSet records plain overwrites of any metric type.
+	walSet walOp = "set"
+	// walDelete records removals; only the type and key of each metric are used.
+	walDelete walOp = "delete"
+)
+
+type walRecord struct {
+	Op      walOp            `json:"op"`
+	Metrics []models.Metrics `json:"metrics"`
+}
+
+// WAL is an append-only log of storage writes, one JSON record per line.
+type WAL struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	sync    time.Duration
+	dirty   bool
+	onError func(error)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenWAL opens or creates the log file. onError receives failures of background syncs
+// and of writes that cannot report errors to their caller; it may be nil.
+func OpenWAL(cfg WALConfig, onError func(error)) (*WAL, error) {
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o666)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	if onError == nil {
+		onError = func(error) {}
+	}
+	w := &WAL{path: cfg.Path, f: f, sync: cfg.SyncInterval, onError: onError}
+	if w.sync > 0 {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.syncLoop()
+	}
+	return w, nil
+}
+
+func (w *WAL) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.sync)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Sync(); err != nil {
+				w.onError(err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// append writes a record and, with the "always" policy, syncs it before returning.
+func (w *WAL) append(rec walRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal wal record: %w", err)
+	}
+	b = append(b, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.f.Write(b); err != nil {
+		return fmt.Errorf("write wal: %w", err)
+	}
+	if w.sync == 0 {
+		if err := w.f.Sync(); err != nil {
+			return fmt.Errorf("sync wal: %w", err)
+		}
+		return nil
+	}
+	w.dirty = true
+	return nil
+}
+
+// Sync flushes records written since the last sync.
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.dirty {
+		return nil
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+// replay feeds every record to apply in order. A trailing partial record left by a crash
+// in the middle of a write is cut off so that new records start on a clean line.
+func (w *WAL) replay(apply func(walRecord) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	r, err := os.Open(w.path)
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+	defer r.Close()
+
+	var (
+		br     = bufio.NewReader(r)
+		offset int64
+		errs   []error
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				if err := w.f.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate torn wal record: %w", err)
+				}
+			}
+			return errors.Join(errs...)
+		}
+		if err != nil {
+			return fmt.Errorf("read wal: %w", err)
+		}
+		offset += int64(len(line))
+
+		var rec walRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("%w at offset %d: %v", ErrWALCorrupted, offset-int64(len(line)), err)
+		}
+		if err := apply(rec); err != nil {
+			errs = append(errs, err)
+		}
+	}
+}
+
+// empty reports whether the log holds no records.
+func (w *WAL) empty() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fi, err := w.f.Stat()
+	return err == nil && fi.Size() == 0
+}
+
+// truncate drops every record, typically once they are covered by a snapshot.
+func (w *WAL) truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.f.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+// Close stops background syncing, flushes pending records and closes the file.
+func (w *WAL) Close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	if w.sync >= 0 {
+		errs = append(errs, w.f.Sync())
+	}
+	errs = append(errs, w.f.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func openTestWAL(t *testing.T, path string) *WAL {
+	t.Helper()
+	w, err := OpenWAL(WALConfig{Path: path}, nil)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	return w
+}
+
+func TestParseWALSync(t *testing.T) {
+	cases := map[string]time.Duration{"": 0, "always": 0, "NONE": -1, "250ms": 250 * time.Millisecond}
+	for raw, want := range cases {
+		got, err := ParseWALSync(raw)
+		if err != nil || got != want {
+			t.Fatalf("ParseWALSync(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"sometimes", "0s", "-1s"} {
+		if _, err := ParseWALSync(raw); err == nil {
+			t.Fatalf("ParseWALSync(%q) must fail", raw)
+		}
+	}
+}
+
+func TestMemStorage_WALReplayAfterRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.wal")
+
+	ms := NewMemStorage()
+	ms.AttachWAL(openTestWAL(t, path))
+	ms.UpdateCounter("c", 2)
+	ms.UpdateGauge("g", 1.5)
+	if err := ms.UpdateBatch([]models.Metrics{
+		{ID: "c", MType: models.CounterType, Delta: pInt64(3)},
+		{ID: "h", MType: models.HistogramType, Histogram: &models.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}},
+	}); err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	ms.SetCounter("reset", 7)
+
+	restored := NewMemStorage()
+	restored.AttachWAL(openTestWAL(t, path))
+	snapshot := []models.Metrics{{ID: "c", MType: models.CounterType, Delta: pInt64(10)}}
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	if v, _ := restored.GetCounter("c"); v != 15 {
+		t.Fatalf("counter must be snapshot plus logged deltas, got %d", v)
+	}
+	if v, _ := restored.GetGauge("g"); v != 1.5 {
+		t.Fatalf("gauge: got %v", v)
+	}
+	if v, _ := restored.GetCounter("reset"); v != 7 {
+		t.Fatalf("set counter: got %d", v)
+	}
+	if h, err := restored.GetHistogram("h"); err != nil || h.Count != 1 {
+		t.Fatalf("histogram: %+v %v", h, err)
+	}
+}
+
+func TestMemStorage_CheckpointCompactsWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.wal")
+	ms := NewMemStorage()
+	ms.AttachWAL(openTestWAL(t, path))
+	ms.UpdateCounter("c", 1)
+
+	var saved []models.Metrics
+	if err := ms.Checkpoint(func(m []models.Metrics) error { saved = m; return nil }); err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+	if len(saved) != 1 {
+		t.Fatalf("snapshot must be passed to save, got %+v", saved)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != 0 {
+		t.Fatalf("wal must be empty after checkpoint, size %d", fi.Size())
+	}
+
+	ms.UpdateCounter("c", 1)
+	if err := ms.Checkpoint(func([]models.Metrics) error { return errors.New("disk full") }); err == nil {
+		t.Fatalf("want save error")
+	}
+	if fi, _ := os.Stat(path); fi.Size() == 0 {
+		t.Fatalf("wal must be kept when the snapshot was not saved")
+	}
+}
+
+func TestWAL_ReplayTornAndCorruptedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.wal")
+	good := `{"op":"update","metrics":[{"id":"c","type":"counter","delta":1}]}` + "\n"
+
+	if err := os.WriteFile(path, []byte(good+`{"op":"upd`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	ms := NewMemStorage()
+	ms.AttachWAL(openTestWAL(t, path))
+	if err := ms.Restore(nil); err != nil {
+		t.Fatalf("torn tail must be dropped, got %v", err)
+	}
+	if v, _ := ms.GetCounter("c"); v != 1 {
+		t.Fatalf("complete record must be replayed, got %d", v)
+	}
+	if b, _ := os.ReadFile(path); string(b) != good {
+		t.Fatalf("torn tail must be truncated, got %q", b)
+	}
+
+	if err := os.WriteFile(path, []byte("garbage\n"+good), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	ms = NewMemStorage()
+	ms.AttachWAL(openTestWAL(t, path))
+	if err := ms.Restore(nil); !errors.Is(err, ErrWALCorrupted) {
+		t.Fatalf("want ErrWALCorrupted, got %v", err)
+	}
+}
+
+func TestMemStorage_CheckpointKeepsUnreplayedWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.wal")
+	good := `{"op":"update","metrics":[{"id":"c","type":"counter","delta":1}]}` + "\n"
+	saveCalled := func(called *bool) func([]models.Metrics) error {
+		return func([]models.Metrics) error { *called = true; return nil }
+	}
+
+	for name, content := range map[string]string{"not restored": good, "replay failed": "garbage\n" + good} {
+		if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		ms := NewMemStorage()
+		ms.AttachWAL(openTestWAL(t, path))
+		if name == "replay failed" {
+			if err := ms.Restore(nil); !errors.Is(err, ErrWALCorrupted) {
+				t.Fatalf("%s: want ErrWALCorrupted, got %v", name, err)
+			}
+		}
+		ms.UpdateCounter("c", 1)
+
+		var saved bool
+		if err := ms.Checkpoint(saveCalled(&saved)); !errors.Is(err, ErrWALNotReplayed) {
+			t.Fatalf("%s: want ErrWALNotReplayed, got %v", name, err)
+		}
+		if saved {
+			t.Fatalf("%s: snapshot must not be saved", name)
+		}
+		if b, _ := os.ReadFile(path); len(b) <= len(content) {
+			t.Fatalf("%s: wal must keep its records, got %q", name, b)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(good), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	ms := NewMemStorage()
+	ms.AttachWAL(openTestWAL(t, path))
+	if err := ms.Restore(nil); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	var saved bool
+	if err := ms.Checkpoint(saveCalled(&saved)); err != nil || !saved {
+		t.Fatalf("replayed wal must be checkpointed: saved %v, err %v", saved, err)
+	}
+}
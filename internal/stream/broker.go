@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+// DefaultSubscriberBuffer is the number of updates a subscriber may lag behind before it is dropped.
+const DefaultSubscriberBuffer = 256
+
+var (
+	// ErrSlowSubscriber indicates a subscription dropped because its buffer filled up.
+	ErrSlowSubscriber = fmt.Errorf("subscriber is too slow")
+	// ErrClosed indicates a subscription ended by the shutdown of the broker.
+	ErrClosed = fmt.Errorf("update stream closed")
+)
+
+// Filter selects the updates delivered to a subscription. Zero-valued fields do not filter.
+type Filter struct {
+	Type    models.MetricType
+	Pattern *regexp.Regexp
+}
+
+func (f Filter) match(m *models.Metrics) bool {
+	if f.Type != "" && f.Type != m.MType {
+		return false
+	}
+	return f.Pattern == nil || f.Pattern.MatchString(m.ID)
+}
+
+// Subscription receives the accepted updates that pass its filter.
+type Subscription struct {
+	b      *Broker
+	filter Filter
+	ch     chan models.Metrics
+	err    error
+}
+
+// C returns the channel of updates. It is closed when the subscription ends.
+func (s *Subscription) C() <-chan models.Metrics {
+	return s.ch
+}
+
+// Err reports why the subscription ended once C is closed: ErrSlowSubscriber, ErrClosed,
+// or nil when the subscriber closed it.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// offer queues the matching updates without blocking and reports whether they all fit.
+func (s *Subscription) offer(metrics []models.Metrics) bool {
+	for i := range metrics {
+		if !s.filter.match(&metrics[i]) {
+			continue
+		}
+		select {
+		case s.ch <- metrics[i]:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.b.drop(s, nil)
+}
+
+// Broker fans accepted metric updates out to live subscribers.
+// Publishing never blocks: a subscriber whose buffer is full is dropped with ErrSlowSubscriber,
+// so a stalled client cannot slow down updates or silently miss counter deltas.
+type Broker struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	buffer int
+	closed bool
+}
+
+// NewBroker constructs a Broker whose subscribers buffer DefaultSubscriberBuffer updates.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{}), buffer: DefaultSubscriberBuffer}
+}
+
+// Subscribe registers a subscriber for updates passing f. After Close the returned
+// subscription is already ended with ErrClosed.
+func (b *Broker) Subscribe(f Filter) *Subscription {
+	s := &Subscription{b: b, filter: f, ch: make(chan models.Metrics, b.buffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		s.err = ErrClosed
+		close(s.ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Publish delivers copies of the updates to every matching subscriber.
+func (b *Broker) Publish(metrics []models.Metrics) {
+	if b == nil || len(metrics) == 0 {
+		return
+	}
+	var (
+		copies []models.Metrics
+		slow   []*Subscription
+	)
+	b.mu.RLock()
+	if len(b.subs) > 0 {
+		copies = make([]models.Metrics, len(metrics))
+		for i := range metrics {
+			copies[i] = clone(&metrics[i])
+		}
+	}
+	for s := range b.subs {
+		if !s.offer(copies) {
+			slow = append(slow, s)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, s := range slow {
+		b.drop(s, ErrSlowSubscriber)
+	}
+}
+
+// Close ends every subscription with ErrClosed and rejects new ones.
+func (b *Broker) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		s.err = ErrClosed
+		close(s.ch)
+		delete(b.subs, s)
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+func (b *Broker) drop(s *Subscription, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.err = err
+	close(s.ch)
+}
+
+// clone copies the update so that subscribers do not share memory with the request that carried it.
+func clone(m *models.Metrics) models.Metrics {
+	c := models.Metrics{ID: m.ID, MType: m.MType, Labels: m.Labels.Clone()}
+	if m.Value != nil {
+		v := *m.Value
+		c.Value = &v
+	}
+	if m.Delta != nil {
+		d := *m.Delta
+		c.Delta = &d
+	}
+	if m.Histogram != nil {
+		h := m.Histogram.Clone()
+		c.Histogram = &h
+	}
+	return c
+}
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
+)
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.GaugeType, Value: &v}
+}
+
+func TestBroker_DeliversMatchingCopies(t *testing.T) {
+	b := NewBroker()
+	all := b.Subscribe(Filter{})
+	cpu := b.Subscribe(Filter{Type: models.GaugeType, Pattern: regexp.MustCompile("^CPU")})
+
+	d := int64(1)
+	updates := []models.Metrics{gauge("CPUutilization1", 5), {ID: "CPUcount", MType: models.CounterType, Delta: &d}, gauge("Alloc", 1)}
+	b.Publish(updates)
+	*updates[0].Value = 100
+
+	if got := len(all.C()); got != 3 {
+		t.Fatalf("unfiltered subscriber must get every update, got %d", got)
+	}
+	if got := len(cpu.C()); got != 1 {
+		t.Fatalf("filtered subscriber must get one update, got %d", got)
+	}
+	if m := <-cpu.C(); m.ID != "CPUutilization1" || *m.Value != 5 {
+		t.Fatalf("subscriber must get a copy of the update, got %+v", m)
+	}
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	b.buffer = 1
+	slow := b.Subscribe(Filter{})
+	fast := b.Subscribe(Filter{})
+
+	b.Publish([]models.Metrics{gauge("a", 1)})
+	<-fast.C()
+	b.Publish([]models.Metrics{gauge("b", 2)})
+
+	if _, ok := <-slow.C(); !ok {
+		t.Fatalf("buffered update must still be delivered")
+	}
+	if _, ok := <-slow.C(); ok {
+		t.Fatalf("slow subscriber must be closed")
+	}
+	if !errors.Is(slow.Err(), ErrSlowSubscriber) {
+		t.Fatalf("want ErrSlowSubscriber, got %v", slow.Err())
+	}
+	if m := <-fast.C(); m.ID != "b" {
+		t.Fatalf("fast subscriber must keep receiving, got %+v", m)
+	}
+	if n := b.Subscribers(); n != 1 {
+		t.Fatalf("want 1 subscriber left, got %d", n)
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(Filter{})
+	left := b.Subscribe(Filter{})
+	left.Close()
+	left.Close()
+	if left.Err() != nil {
+		t.Fatalf("closing a subscription is not an error, got %v", left.Err())
+	}
+
+	b.Close()
+	if _, ok := <-s.C(); ok || !errors.Is(s.Err(), ErrClosed) {
+		t.Fatalf("subscription must end with ErrClosed, got %v", s.Err())
+	}
+	s.Close()
+	late := b.Subscribe(Filter{})
+	if _, ok := <-late.C(); ok || !errors.Is(late.Err(), ErrClosed) {
+		t.Fatalf("subscribing after Close must fail, got %v", late.Err())
+	}
+	b.Publish([]models.Metrics{gauge("a", 1)})
+
+	var nilBroker *Broker
+	nilBroker.Publish([]models.Metrics{gauge("a", 1)})
+	nilBroker.Close()
+}
+
+func TestBroker_ConcurrentPublishAndClose(t *testing.T) {
+	b := NewBroker()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		s := b.Subscribe(Filter{})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range s.C() {
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.Publish([]models.Metrics{gauge("a", float64(j))})
+			}
+		}()
+	}
+	b.Close()
+	wg.Wait()
+}
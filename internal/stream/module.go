@@ -0,0 +1,9 @@
+package stream
+
+import "go.uber.org/fx"
+
+// Module provides the broker of live metric updates; the server closes it on shutdown.
+var Module = fx.Module(
+	"stream",
+	fx.Provide(NewBroker),
+)
@@ -0,0 +1,49 @@
+package subnet
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrUntrusted is passed to AbortFunc for a client outside the trusted subnet.
+var ErrUntrusted = errors.New("client is outside the trusted subnet")
+
+// AbortFunc ends a request that Middleware rejects with status because of err.
+type AbortFunc func(c *gin.Context, status int, err error)
+
+// Middleware rejects requests that modify metrics — /update*, /reset* and every DELETE — from clients
+// outside the trusted subnet with 403.
+// The client address is taken from the X-Real-IP header, falling back to the connection peer address.
+// Rejected requests are ended by abort with ErrUntrusted; a nil abort replies with an empty body.
+func Middleware(t Trusted, abort AbortFunc) gin.HandlerFunc {
+	if !t.Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+	if abort == nil {
+		abort = func(c *gin.Context, status int, _ error) { c.AbortWithStatus(status) }
+	}
+	return func(c *gin.Context) {
+		if !modifies(c.Request) {
+			c.Next()
+			return
+		}
+		ip := c.GetHeader(RealIPHeader)
+		if ip == "" {
+			ip = c.RemoteIP()
+		}
+		if !t.Allows(ip) {
+			abort(c, http.StatusForbidden, ErrUntrusted)
+			return
+		}
+		c.Next()
+	}
+}
+
+func modifies(r *http.Request) bool {
+	return r.Method == http.MethodDelete ||
+		strings.HasPrefix(r.URL.Path, "/update") ||
+		strings.HasPrefix(r.URL.Path, "/reset")
+}
@@ -0,0 +1,47 @@
+package subnet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tr, _ := ParseTrusted("10.0.0.0/8")
+	r := gin.New()
+	r.Use(Middleware(tr, nil))
+	r.POST("/update/:type/:name/:value", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/updates", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/value", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.DELETE("/value/:type/:name", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/reset/counter/:name", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := []struct {
+		method, path, realIP, remote string
+		want                         int
+	}{
+		{http.MethodPost, "/update/gauge/a/1", "10.1.2.3", "192.0.2.1:1000", http.StatusOK},
+		{http.MethodPost, "/updates", "192.0.2.1", "10.0.0.1:1000", http.StatusForbidden},
+		{http.MethodPost, "/updates", "", "10.0.0.1:1000", http.StatusOK},
+		{http.MethodPost, "/updates", "", "192.0.2.1:1000", http.StatusForbidden},
+		{http.MethodPost, "/value", "192.0.2.1", "192.0.2.1:1000", http.StatusOK},
+		{http.MethodDelete, "/value/gauge/a", "192.0.2.1", "192.0.2.1:1000", http.StatusForbidden},
+		{http.MethodDelete, "/value/gauge/a", "10.1.2.3", "192.0.2.1:1000", http.StatusOK},
+		{http.MethodPost, "/reset/counter/c", "", "192.0.2.1:1000", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.RemoteAddr = tc.remote
+		if tc.realIP != "" {
+			req.Header.Set(RealIPHeader, tc.realIP)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s %s real=%q remote=%s: status %d, want %d", tc.method, tc.path, tc.realIP, tc.remote, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package subnet restricts metric updates to clients from a trusted network.
+package subnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RealIPHeader carries the agent's own address so the check works behind proxies.
+const RealIPHeader = "X-Real-IP"
+
+// ErrInvalidSubnet indicates that the trusted subnet is not a valid CIDR.
+var ErrInvalidSubnet = errors.New("invalid trusted subnet")
+
+// Trusted is the allow-list of update clients. The zero value trusts everyone.
+type Trusted struct {
+	Net *net.IPNet
+}
+
+// ParseTrusted parses a CIDR such as "192.168.1.0/24". An empty string disables the check.
+func ParseTrusted(cidr string) (Trusted, error) {
+	cidr = strings.TrimSpace(cidr)
+	if cidr == "" {
+		return Trusted{}, nil
+	}
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return Trusted{}, fmt.Errorf("%w: %v", ErrInvalidSubnet, err)
+	}
+	return Trusted{Net: n}, nil
+}
+
+// Enabled reports whether a subnet is configured.
+func (t Trusted) Enabled() bool { return t.Net != nil }
+
+// Allows reports whether the textual IP belongs to the trusted subnet.
+// Without a configured subnet every client is allowed; an unparsable IP never is.
+func (t Trusted) Allows(ip string) bool {
+	if t.Net == nil {
+		return true
+	}
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	return parsed != nil && t.Net.Contains(parsed)
+}
+
+// LocalIP returns the local address the host uses to reach addr (host:port).
+// No packets are sent: dialing UDP only selects the route.
+func LocalIP(addr string) (net.IP, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	udp, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("unexpected local address %v", conn.LocalAddr())
+	}
+	return udp.IP, nil
+}
@@ -0,0 +1,39 @@
+package subnet
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParseTrusted(t *testing.T) {
+	tr, err := ParseTrusted("")
+	if err != nil || tr.Enabled() || !tr.Allows("8.8.8.8") {
+		t.Fatalf("empty subnet must allow everyone: %+v %v", tr, err)
+	}
+
+	if _, err := ParseTrusted("10.0.0.0/33"); !errors.Is(err, ErrInvalidSubnet) {
+		t.Fatalf("want ErrInvalidSubnet, got %v", err)
+	}
+
+	tr, err = ParseTrusted(" 192.168.1.0/24 ")
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	cases := map[string]bool{"192.168.1.17": true, "192.168.2.1": false, "": false, "garbage": false}
+	for ip, want := range cases {
+		if got := tr.Allows(ip); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestLocalIP_Loopback(t *testing.T) {
+	ip, err := LocalIP("127.0.0.1:8080")
+	if err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("want loopback, got %v", ip)
+	}
+}
@@ -1,6 +1,8 @@
 package test
 
 import (
+	"context"
+	"sync"
 	"sync/atomic"
 
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
@@ -33,3 +35,15 @@ func (m *FakeAgentSenderWithChan) SendBatch(metrics []*models.Metrics) {
 	default:
 	}
 }
+
+type FakeStreamSender struct {
+	FakeAgentSender
+	mu      sync.Mutex
+	Streams [][]*models.Metrics
+}
+
+func (m *FakeStreamSender) SendStream(_ context.Context, metrics []*models.Metrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Streams = append(m.Streams, metrics)
+}
@@ -2,9 +2,12 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/polkiloo/go-musthave-metrics-tppl/internal/models"
@@ -13,11 +16,17 @@ import (
 type FakeMetricService struct {
 	Err       error
 	Metric    models.Metrics
+	All       []models.Metrics
+	Times     map[models.MetricType]map[string]time.Time
+	History   []models.Sample
+	Deleted   []models.Metrics
+	Listed    models.ListOptions
+	Next      string
 	SaveCalls int
 	LoadCalls int
 }
 
-func (f *FakeMetricService) ProcessUpdate(m *models.Metrics) error {
+func (f *FakeMetricService) ProcessUpdate(_ context.Context, m *models.Metrics) error {
 	f.Metric.MType = m.MType
 	f.Metric.ID = m.ID
 
@@ -32,7 +41,7 @@ func (f *FakeMetricService) ProcessUpdate(m *models.Metrics) error {
 	return f.Err
 }
 
-func (f *FakeMetricService) ProcessGetValue(metricName string, metricType models.MetricType) (*models.Metrics, error) {
+func (f *FakeMetricService) ProcessGetValue(_ context.Context, metricName string, metricType models.MetricType) (*models.Metrics, error) {
 	var m *models.Metrics
 
 	switch {
@@ -46,6 +55,39 @@ func (f *FakeMetricService) ProcessGetValue(metricName string, metricType models
 	return m, f.Err
 }
 
+func (f *FakeMetricService) ProcessGetAll(context.Context) ([]models.Metrics, error) {
+	return f.All, f.Err
+}
+
+func (f *FakeMetricService) ProcessList(_ context.Context, opts models.ListOptions) ([]models.Metrics, string, error) {
+	f.Listed = opts
+	return f.All, f.Next, f.Err
+}
+
+func (f *FakeMetricService) ProcessGetUpdateTimes(context.Context) (map[models.MetricType]map[string]time.Time, error) {
+	return f.Times, f.Err
+}
+
+func (f *FakeMetricService) ProcessGetHistory(_ context.Context, name string, metricType models.MetricType, from, to time.Time, step time.Duration) ([]models.Sample, error) {
+	f.Metric.ID = name
+	f.Metric.MType = metricType
+	return f.History, f.Err
+}
+
+func (f *FakeMetricService) ProcessDelete(_ context.Context, metrics []models.Metrics) (int, error) {
+	f.Deleted = append(f.Deleted, metrics...)
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return len(metrics), nil
+}
+
+func (f *FakeMetricService) ProcessResetCounter(_ context.Context, name string) error {
+	f.Metric.ID = name
+	f.Metric.MType = models.CounterType
+	return f.Err
+}
+
 func (f *FakeMetricService) SaveFile(path string) error {
 	f.SaveCalls++
 	return nil
@@ -80,11 +122,26 @@ func DoGET(r *gin.Engine, url, accept string) *httptest.ResponseRecorder {
 	return w
 }
 
-func (f *FakeMetricService) ProcessUpdates(metrics []models.Metrics) error {
+func (f *FakeMetricService) ProcessUpdates(ctx context.Context, metrics []models.Metrics) error {
 	for i := range metrics {
-		if err := f.ProcessUpdate(&metrics[i]); err != nil {
+		if err := f.ProcessUpdate(ctx, &metrics[i]); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func (f *FakeMetricService) ProcessUpdatesPartial(ctx context.Context, metrics []models.Metrics) ([]error, error) {
+	rejected := make([]error, len(metrics))
+	for i := range metrics {
+		err := f.ProcessUpdate(ctx, &metrics[i])
+		if errors.Is(err, models.ErrMetricInvalidType) {
+			rejected[i] = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rejected, nil
+}
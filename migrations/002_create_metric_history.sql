@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS gauge_samples (
+    id TEXT NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    ts TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS gauge_samples_id_ts_idx ON gauge_samples (id, ts);
+
+CREATE TABLE IF NOT EXISTS counter_samples (
+    id TEXT NOT NULL,
+    value BIGINT NOT NULL,
+    ts TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS counter_samples_id_ts_idx ON counter_samples (id, ts);
+
+-- +goose Down
+DROP TABLE IF EXISTS counter_samples;
+DROP TABLE IF EXISTS gauge_samples;
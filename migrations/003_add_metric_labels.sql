@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE gauges ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE counters ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS gauges_labels_idx ON gauges USING GIN (labels);
+CREATE INDEX IF NOT EXISTS counters_labels_idx ON counters USING GIN (labels);
+
+-- +goose Down
+DROP INDEX IF EXISTS counters_labels_idx;
+DROP INDEX IF EXISTS gauges_labels_idx;
+ALTER TABLE counters DROP COLUMN IF EXISTS labels;
+ALTER TABLE gauges DROP COLUMN IF EXISTS labels;